@@ -0,0 +1,96 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"sync"
+	"time"
+)
+
+// maxCacheEntries bounds the memory used by a PasswordCache.
+const maxCacheEntries = 10000
+
+// PasswordCache remembers successful password verifications for a while, so that clients re-sending the same
+// credentials, e.g. on every SSE reconnect, do not pay the cost of the KDF each time.
+// Only a keyed digest of the credentials is kept in memory, and an entry no longer matches once the stored hash changes.
+// It is safe for concurrent use.
+type PasswordCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	key     []byte
+	entries map[uint64]cacheEntry
+}
+
+type cacheEntry struct {
+	digest  []byte
+	expires time.Time
+}
+
+// NewPasswordCache returns a cache keeping verifications for ttl. Verifications are not cached if ttl is zero.
+func NewPasswordCache(ttl time.Duration) (*PasswordCache, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return &PasswordCache{ttl: ttl, key: key, entries: make(map[uint64]cacheEntry)}, nil
+}
+
+// Verify reports whether password matches the stored password of the user with the given ID, see VerifyPassword.
+func (c *PasswordCache) Verify(id uint64, password, stored string) (bool, error) {
+	if c.ttl <= 0 {
+		return VerifyPassword(password, stored)
+	}
+
+	digest := c.digest(password, stored)
+	now := time.Now()
+
+	c.mu.Lock()
+	entry, ok := c.entries[id]
+	c.mu.Unlock()
+	if ok && now.Before(entry.expires) && hmac.Equal(entry.digest, digest) {
+		return true, nil
+	}
+
+	match, err := VerifyPassword(password, stored)
+	if err != nil || !match {
+		return match, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.entries) >= maxCacheEntries {
+		c.prune(now)
+	}
+	c.entries[id] = cacheEntry{digest: digest, expires: now.Add(c.ttl)}
+
+	return true, nil
+}
+
+// Forget removes the cached verification of a user, e.g. when it is deleted.
+func (c *PasswordCache) Forget(id uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, id)
+}
+
+// digest returns a keyed digest of the credentials, bound to the stored password.
+func (c *PasswordCache) digest(password, stored string) []byte {
+	mac := hmac.New(sha256.New, c.key)
+	mac.Write([]byte(stored))
+	mac.Write([]byte{0})
+	mac.Write([]byte(password))
+	return mac.Sum(nil)
+}
+
+// prune removes expired entries, or all of them if none expired. The caller must hold the lock.
+func (c *PasswordCache) prune(now time.Time) {
+	for id, entry := range c.entries {
+		if !now.Before(entry.expires) {
+			delete(c.entries, id)
+		}
+	}
+	if len(c.entries) >= maxCacheEntries {
+		c.entries = make(map[uint64]cacheEntry)
+	}
+}
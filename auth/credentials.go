@@ -0,0 +1,18 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// passwordBytes is the number of random bytes of a generated password.
+const passwordBytes = 32
+
+// GeneratePassword returns a password made of 32 bytes from a cryptographically secure source, hex encoded.
+func GeneratePassword() (string, error) {
+	password := make([]byte, passwordBytes)
+	if _, err := rand.Read(password); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(password), nil
+}
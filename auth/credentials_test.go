@@ -0,0 +1,49 @@
+package auth
+
+import (
+	"encoding/hex"
+	"math"
+	"regexp"
+	"testing"
+
+	"github.com/go-playground/assert/v2"
+)
+
+func TestGeneratePasswordFormat(t *testing.T) {
+	password, err := GeneratePassword()
+	assert.Equal(t, err, nil)
+	assert.MatchRegex(t, password, regexp.MustCompile(`^[0-9a-f]{64}$`))
+}
+
+// TestGeneratePasswordEntropy asserts generated passwords are unique and their bytes evenly distributed.
+func TestGeneratePasswordEntropy(t *testing.T) {
+	const count = 2000
+	seen := make(map[string]bool, count)
+	var frequencies [256]int
+
+	for i := 0; i < count; i++ {
+		password, err := GeneratePassword()
+		assert.Equal(t, err, nil)
+		assert.Equal(t, seen[password], false)
+		seen[password] = true
+
+		raw, err := hex.DecodeString(password)
+		assert.Equal(t, err, nil)
+		for _, b := range raw {
+			frequencies[b]++
+		}
+	}
+
+	// The Shannon entropy of uniformly random bytes is 8 bits, the sample size leaves a small margin.
+	total := float64(count * passwordBytes)
+	entropy := 0.0
+	for _, frequency := range frequencies {
+		if frequency > 0 {
+			p := float64(frequency) / total
+			entropy -= p * math.Log2(p)
+		}
+	}
+	if entropy < 7.99 {
+		t.Errorf("entropy of generated passwords is too low: %f bits per byte", entropy)
+	}
+}
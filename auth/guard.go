@@ -0,0 +1,176 @@
+package auth
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// maxGuardEntries bounds the memory used by each throttle of a Guard.
+const maxGuardEntries = 100000
+
+// Guard slows down brute-force attacks on passwords by locking out the accounts, and the clients, failing to
+// authenticate too many times in a row. Each new lockout lasts twice as long as the previous one, up to a maximum.
+// Failures and lockouts are forgotten once an account or a client has neither failed nor been locked out
+// for the maximum lockout duration.
+// Lockouts are kept in memory, so they apply per server instance. It is safe for concurrent use.
+type Guard struct {
+	accounts *throttle
+	clients  *throttle
+}
+
+// NewGuard returns a Guard locking out accounts after accountFailures failed authentications,
+// and clients after clientFailures, for lockout at first and up to maxLockout.
+func NewGuard(accountFailures, clientFailures int, lockout, maxLockout time.Duration) *Guard {
+	return &Guard{
+		accounts: newThrottle(accountFailures, lockout, maxLockout),
+		clients:  newThrottle(clientFailures, lockout, maxLockout),
+	}
+}
+
+// Check returns how long authentication is locked out for an account or a client, or 0 if it is not.
+// Accounts are any identifier a client authenticates with, whether it exists or not.
+func (g *Guard) Check(account, client string) time.Duration {
+	accountLockout := g.accounts.check(account)
+	if clientLockout := g.clients.check(client); clientLockout > accountLockout {
+		return clientLockout
+	}
+	return accountLockout
+}
+
+// Fail records a failed authentication of a client on an account.
+// It returns the durations of the lockouts this failure started, 0 if it did not start any.
+func (g *Guard) Fail(account, client string) (accountLockout, clientLockout time.Duration) {
+	return g.accounts.fail(account), g.clients.fail(client)
+}
+
+// Succeed records a successful authentication on an account, resetting its failures.
+// The failures of the client are kept, not to let clients with a valid account try their luck on other ones.
+func (g *Guard) Succeed(account string) {
+	g.accounts.succeed(account)
+}
+
+// throttle tracks the consecutive failures of keys and locks them out.
+type throttle struct {
+	mu         sync.Mutex
+	failures   int
+	lockout    time.Duration
+	maxLockout time.Duration
+	entries    map[string]*throttleEntry
+	maxEntries int
+	now        func() time.Time
+}
+
+type throttleEntry struct {
+	failures    int
+	lockouts    int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+func newThrottle(failures int, lockout, maxLockout time.Duration) *throttle {
+	return &throttle{
+		failures:   failures,
+		lockout:    lockout,
+		maxLockout: maxLockout,
+		entries:    make(map[string]*throttleEntry),
+		maxEntries: maxGuardEntries,
+		now:        time.Now,
+	}
+}
+
+// check returns how long key is locked out for.
+func (t *throttle) check(key string) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	entry, ok := t.entries[key]
+	if !ok {
+		return 0
+	}
+	if lockout := entry.lockedUntil.Sub(t.now()); lockout > 0 {
+		return lockout
+	}
+	return 0
+}
+
+// fail records a failure of key and returns the duration it is locked out for if this failure locked it out.
+func (t *throttle) fail(key string) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	entry, ok := t.entries[key]
+	if !ok || t.expired(entry, now) {
+		if !ok && len(t.entries) >= t.maxEntries {
+			t.prune(now)
+			// Every entry is locked out: the failure is not recorded rather than lifting a lockout.
+			if len(t.entries) >= t.maxEntries {
+				return 0
+			}
+		}
+		entry = &throttleEntry{}
+		t.entries[key] = entry
+	}
+	entry.failures++
+	entry.lastFailure = now
+
+	if entry.failures < t.failures {
+		return 0
+	}
+	lockout := t.lockout
+	for i := 0; i < entry.lockouts && lockout < t.maxLockout; i++ {
+		lockout *= 2
+	}
+	if lockout > t.maxLockout {
+		lockout = t.maxLockout
+	}
+	entry.failures = 0
+	entry.lockouts++
+	entry.lockedUntil = now.Add(lockout)
+	return lockout
+}
+
+// succeed forgets the failures of key.
+func (t *throttle) succeed(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if entry, ok := t.entries[key]; ok && !t.now().Before(entry.lockedUntil) {
+		delete(t.entries, key)
+	}
+}
+
+// expired reports whether an entry has neither failed nor been locked out for long enough to be forgotten.
+func (t *throttle) expired(entry *throttleEntry, now time.Time) bool {
+	return now.Sub(entry.lastFailure) >= t.maxLockout && now.Sub(entry.lockedUntil) >= t.maxLockout
+}
+
+// prune removes the expired entries and, if that is not enough, the entries not locked out that failed least recently,
+// making room for a tenth of the maximum number of entries not to prune on every failure.
+// Entries locked out are never removed, so that failing on many keys cannot lift the lockout of another one.
+// The caller must hold the lock.
+func (t *throttle) prune(now time.Time) {
+	var unlocked []string
+	for key, entry := range t.entries {
+		if t.expired(entry, now) {
+			delete(t.entries, key)
+		} else if !now.Before(entry.lockedUntil) {
+			unlocked = append(unlocked, key)
+		}
+	}
+
+	excess := len(t.entries) - t.maxEntries + t.maxEntries/10 + 1
+	if excess <= 0 {
+		return
+	}
+	if excess > len(unlocked) {
+		excess = len(unlocked)
+	}
+	sort.Slice(unlocked, func(i, j int) bool {
+		return t.entries[unlocked[i]].lastFailure.Before(t.entries[unlocked[j]].lastFailure)
+	})
+	for _, key := range unlocked[:excess] {
+		delete(t.entries, key)
+	}
+}
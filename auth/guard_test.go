@@ -0,0 +1,105 @@
+package auth
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+)
+
+func TestGuard(t *testing.T) {
+	now := time.Now()
+	guard := NewGuard(3, 5, time.Minute, 4*time.Minute)
+	guard.accounts.now = func() time.Time { return now }
+	guard.clients.now = func() time.Time { return now }
+
+	failN := func(n int, account, client string) (accountLockout, clientLockout time.Duration) {
+		for i := 0; i < n; i++ {
+			accountLockout, clientLockout = guard.Fail(account, client)
+		}
+		return accountLockout, clientLockout
+	}
+
+	t.Run("Locked out after too many failures", func(t *testing.T) {
+		accountLockout, _ := failN(2, "user:1", "a")
+		assert.Equal(t, accountLockout, time.Duration(0))
+		assert.Equal(t, guard.Check("user:1", "b"), time.Duration(0))
+
+		accountLockout, _ = guard.Fail("user:1", "b")
+		assert.Equal(t, accountLockout, time.Minute)
+		assert.Equal(t, guard.Check("user:1", "c"), time.Minute)
+		assert.Equal(t, guard.Check("user:2", "c"), time.Duration(0))
+	})
+	t.Run("Success does not lift lockout", func(t *testing.T) {
+		guard.Succeed("user:1")
+		assert.Equal(t, guard.Check("user:1", "c"), time.Minute)
+	})
+	t.Run("Lockouts double up to the maximum", func(t *testing.T) {
+		for _, expected := range []time.Duration{2 * time.Minute, 4 * time.Minute, 4 * time.Minute} {
+			now = now.Add(guard.Check("user:1", "x"))
+			assert.Equal(t, guard.Check("user:1", "x"), time.Duration(0))
+			accountLockout, _ := failN(3, "user:1", "c")
+			assert.Equal(t, accountLockout, expected)
+		}
+	})
+	t.Run("Failures expire", func(t *testing.T) {
+		now = now.Add(guard.Check("user:1", "x") + 4*time.Minute)
+		accountLockout, _ := failN(3, "user:1", "d")
+		assert.Equal(t, accountLockout, time.Minute)
+	})
+	t.Run("Success resets failures", func(t *testing.T) {
+		failN(2, "user:3", "e")
+		guard.Succeed("user:3")
+		accountLockout, _ := failN(2, "user:3", "e")
+		assert.Equal(t, accountLockout, time.Duration(0))
+	})
+	t.Run("Client locked out across accounts", func(t *testing.T) {
+		for _, account := range []string{"user:4", "user:5", "user:6", "user:7"} {
+			_, clientLockout := guard.Fail(account, "f")
+			assert.Equal(t, clientLockout, time.Duration(0))
+			assert.Equal(t, guard.Check("user:8", "f"), time.Duration(0))
+		}
+		guard.Succeed("user:4")
+		_, clientLockout := guard.Fail("user:8", "f")
+		assert.Equal(t, clientLockout, time.Minute)
+		assert.Equal(t, guard.Check("user:9", "f"), time.Minute)
+		assert.Equal(t, guard.Check("user:9", "g"), time.Duration(0))
+	})
+}
+
+// TestGuardPrune tests that the entries of a full throttle are removed without lifting any lockout.
+func TestGuardPrune(t *testing.T) {
+	now := time.Now()
+	throttle := newThrottle(2, time.Minute, 4*time.Minute)
+	throttle.maxEntries = 10
+	throttle.now = func() time.Time { return now }
+
+	throttle.fail("victim")
+	assert.Equal(t, throttle.fail("victim"), time.Minute)
+
+	// Failing on many keys removes the ones that failed least recently, but not the locked out one.
+	for i := 0; i < 50; i++ {
+		now = now.Add(time.Millisecond)
+		throttle.fail(fmt.Sprint("spray:", i))
+		assert.Equal(t, len(throttle.entries) <= throttle.maxEntries, true)
+	}
+	assert.NotEqual(t, throttle.check("victim"), time.Duration(0))
+	_, ok := throttle.entries["spray:49"]
+	assert.Equal(t, ok, true)
+	_, ok = throttle.entries["spray:0"]
+	assert.Equal(t, ok, false)
+
+	// Once every entry is locked out, failures on new keys are not recorded.
+	locked := newThrottle(1, time.Minute, 4*time.Minute)
+	locked.maxEntries = 3
+	locked.now = func() time.Time { return now }
+	for _, key := range []string{"a", "b", "c"} {
+		assert.Equal(t, locked.fail(key), time.Minute)
+	}
+	assert.Equal(t, locked.fail("d"), time.Duration(0))
+	assert.Equal(t, locked.check("d"), time.Duration(0))
+	for _, key := range []string{"a", "b", "c"} {
+		assert.Equal(t, locked.check(key), time.Minute)
+	}
+}
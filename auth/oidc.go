@@ -0,0 +1,105 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// ErrInvalidIdentity is returned when the identity provider does not vouch for a user, e.g. the code or the ID token is invalid.
+var ErrInvalidIdentity = errors.New("invalid identity")
+
+// Identity is a user as known by an identity provider.
+type Identity struct {
+	// Issuer identifies the identity provider.
+	Issuer string
+	// Subject identifies the user within the identity provider. It never changes, unlike its name or email.
+	Subject string
+	// Name is the name the user goes by, if the identity provider gave one.
+	Name string
+}
+
+// IdentityProvider authenticates users with the authorization code flow, redirecting them to an external provider.
+type IdentityProvider interface {
+	// AuthCodeURL returns the URL to redirect users to so that they log in with the provider.
+	// state, nonce and verifier must be random and kept by the client to be given back to Exchange.
+	AuthCodeURL(state, nonce, verifier string) string
+	// Exchange trades the code the provider gave back for the identity of the user.
+	Exchange(ctx context.Context, code, nonce, verifier string) (*Identity, error)
+}
+
+// OIDC is an IdentityProvider using OpenID Connect.
+type OIDC struct {
+	config   oauth2.Config
+	verifier *oidc.IDTokenVerifier
+	issuer   string
+}
+
+// NewOIDC discovers the configuration of the OpenID Connect provider at issuer, to log in users through it
+// as the given client. The provider redirects users to redirectURL once they logged in.
+// ctx is used to fetch the keys of the provider for as long as it is used, so it should not be cancelled.
+func NewOIDC(ctx context.Context, issuer, clientID, clientSecret, redirectURL string, scopes []string) (*OIDC, error) {
+	provider, err := oidc.NewProvider(ctx, issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	return &OIDC{
+		config: oauth2.Config{
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			Endpoint:     provider.Endpoint(),
+			RedirectURL:  redirectURL,
+			Scopes:       append([]string{oidc.ScopeOpenID}, scopes...),
+		},
+		verifier: provider.Verifier(&oidc.Config{ClientID: clientID}),
+		issuer:   issuer,
+	}, nil
+}
+
+// AuthCodeURL returns the URL to redirect users to so that they log in with the provider.
+// The verifier is only sent hashed, as a PKCE challenge.
+func (o *OIDC) AuthCodeURL(state, nonce, verifier string) string {
+	challenge := sha256.Sum256([]byte(verifier))
+	return o.config.AuthCodeURL(state, oidc.Nonce(nonce),
+		oauth2.SetAuthURLParam("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:])),
+		oauth2.SetAuthURLParam("code_challenge_method", "S256"))
+}
+
+// Exchange trades the code the provider gave back for the identity of the user, verifying the ID token it comes with.
+func (o *OIDC) Exchange(ctx context.Context, code, nonce, verifier string) (*Identity, error) {
+	token, err := o.config.Exchange(ctx, code, oauth2.SetAuthURLParam("code_verifier", verifier))
+	if err != nil {
+		return nil, err
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, ErrInvalidIdentity
+	}
+	idToken, err := o.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, err
+	}
+	if idToken.Nonce != nonce {
+		return nil, ErrInvalidIdentity
+	}
+
+	var claims struct {
+		Name              string `json:"name"`
+		PreferredUsername string `json:"preferred_username"`
+	}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, err
+	}
+	name := claims.PreferredUsername
+	if name == "" {
+		name = claims.Name
+	}
+
+	return &Identity{Issuer: o.issuer, Subject: idToken.Subject, Name: name}, nil
+}
@@ -0,0 +1,109 @@
+// Package auth gathers the primitives used to authenticate users.
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// Argon2id parameters used to hash new passwords, following the OWASP recommendations.
+const (
+	argon2Time    = 2
+	argon2Memory  = 19 * 1024
+	argon2Threads = 1
+	argon2KeyLen  = 32
+	saltLen       = 16
+)
+
+const argon2Prefix = "$argon2id$"
+
+// ErrInvalidHash is returned when a stored password hash cannot be parsed.
+var ErrInvalidHash = errors.New("invalid password hash")
+
+// dummyHash is a hash verified against when a user is not found, see VerifyUnknownUser.
+var (
+	dummyHash     string
+	dummyHashOnce sync.Once
+)
+
+// HashPassword hashes a password with argon2id and a random salt.
+// The returned string encodes the parameters, the salt and the hash in the PHC format
+// so that they can be changed without breaking existing hashes.
+func HashPassword(password string) (string, error) {
+	salt := make([]byte, saltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	hash := argon2.IDKey([]byte(password), salt, argon2Time, argon2Memory, argon2Threads, argon2KeyLen)
+
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s", argon2Prefix, argon2.Version, argon2Memory, argon2Time, argon2Threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(hash)), nil
+}
+
+// VerifyPassword reports whether password matches stored, which is either a hash produced by HashPassword or,
+// for users created before passwords were hashed, the plaintext password itself.
+func VerifyPassword(password, stored string) (bool, error) {
+	if !IsHashed(stored) {
+		// Compare hashes of equal length to avoid leaking the length of the password.
+		passwordHash := sha256.Sum256([]byte(password))
+		storedHash := sha256.Sum256([]byte(stored))
+		return subtle.ConstantTimeCompare(passwordHash[:], storedHash[:]) == 1, nil
+	}
+
+	var version int
+	var memory, time uint32
+	var threads uint8
+	parts := strings.Split(stored, "$")
+	if len(parts) != 6 {
+		return false, ErrInvalidHash
+	}
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false, ErrInvalidHash
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &time, &threads); err != nil || time < 1 || threads < 1 {
+		return false, ErrInvalidHash
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, ErrInvalidHash
+	}
+	expectedHash, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(expectedHash) == 0 {
+		return false, ErrInvalidHash
+	}
+
+	hash := argon2.IDKey([]byte(password), salt, time, memory, threads, uint32(len(expectedHash)))
+
+	return subtle.ConstantTimeCompare(hash, expectedHash) == 1, nil
+}
+
+// IsHashed reports whether stored is a password hash produced by HashPassword, rather than a plaintext password.
+func IsHashed(stored string) bool {
+	return strings.HasPrefix(stored, argon2Prefix)
+}
+
+// NeedsRehash reports whether stored should be replaced by a new hash of the password,
+// i.e. it is a plaintext password or was hashed with outdated parameters.
+func NeedsRehash(stored string) bool {
+	current := fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$", argon2Prefix, argon2.Version, argon2Memory, argon2Time, argon2Threads)
+	return !strings.HasPrefix(stored, current)
+}
+
+// VerifyUnknownUser takes as long as verifying a password against a hash produced by HashPassword, so that
+// the response time does not reveal whether a user exists when it is not found.
+func VerifyUnknownUser(password string) {
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = HashPassword("")
+	})
+	//nolint:errcheck
+	VerifyPassword(password, dummyHash)
+}
@@ -0,0 +1,95 @@
+package auth
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+)
+
+func TestHashPassword(t *testing.T) {
+	hash, err := HashPassword("password")
+	assert.Equal(t, err, nil)
+	assert.MatchRegex(t, hash, regexp.MustCompile(`^\$argon2id\$v=19\$m=19456,t=2,p=1\$[A-Za-z0-9+/]{22}\$[A-Za-z0-9+/]{43}$`))
+	assert.Equal(t, IsHashed(hash), true)
+	assert.Equal(t, NeedsRehash(hash), false)
+
+	other, err := HashPassword("password")
+	assert.Equal(t, err, nil)
+	assert.NotEqual(t, hash, other)
+}
+
+func TestVerifyPassword(t *testing.T) {
+	hash, err := HashPassword("password")
+	assert.Equal(t, err, nil)
+
+	tests := []struct {
+		name     string
+		password string
+		stored   string
+		match    bool
+		err      error
+	}{
+		{"Hashed, right password", "password", hash, true, nil},
+		{"Hashed, wrong password", "wrong", hash, false, nil},
+		{"Plaintext, right password", "password", "password", true, nil},
+		{"Plaintext, wrong password", "wrong", "password", false, nil},
+		{"Malformed hash", "password", "$argon2id$v=19$m=19456,t=2,p=1$salt", false, ErrInvalidHash},
+		{"Empty hash", "password", "$argon2id$v=19$m=19456,t=2,p=1$c2FsdHNhbHRzYWx0c2FsdA$", false, ErrInvalidHash},
+		{"Unknown version", "password", "$argon2id$v=16$m=19456,t=2,p=1$c2FsdHNhbHRzYWx0c2FsdA$aGFzaA", false, ErrInvalidHash},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			match, err := VerifyPassword(test.password, test.stored)
+			assert.Equal(t, match, test.match)
+			assert.Equal(t, err, test.err)
+		})
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	assert.Equal(t, NeedsRehash("plaintext"), true)
+	assert.Equal(t, NeedsRehash("$argon2id$v=19$m=65536,t=1,p=4$c2FsdA$aGFzaA"), true)
+}
+
+func TestPasswordCache(t *testing.T) {
+	hash, err := HashPassword("password")
+	assert.Equal(t, err, nil)
+	newHash, err := HashPassword("new password")
+	assert.Equal(t, err, nil)
+
+	cache, err := NewPasswordCache(time.Minute)
+	assert.Equal(t, err, nil)
+
+	match, err := cache.Verify(1, "wrong", hash)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, match, false)
+	assert.Equal(t, len(cache.entries), 0)
+
+	match, err = cache.Verify(1, "password", hash)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, match, true)
+	assert.Equal(t, len(cache.entries), 1)
+
+	// Cached verifications must neither match another password nor survive a change of the stored password.
+	match, _ = cache.Verify(1, "wrong", hash)
+	assert.Equal(t, match, false)
+	match, _ = cache.Verify(1, "password", newHash)
+	assert.Equal(t, match, false)
+	match, _ = cache.Verify(2, "password", newHash)
+	assert.Equal(t, match, false)
+
+	cache.Forget(1)
+	assert.Equal(t, len(cache.entries), 0)
+
+	// Entries expire after the TTL.
+	cache, err = NewPasswordCache(time.Nanosecond)
+	assert.Equal(t, err, nil)
+	_, _ = cache.Verify(1, "password", hash)
+	time.Sleep(time.Millisecond)
+	cache.mu.Lock()
+	cache.prune(time.Now())
+	cache.mu.Unlock()
+	assert.Equal(t, len(cache.entries), 0)
+}
@@ -0,0 +1,166 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	tokenIssuer    = "dionysos"
+	accessAudience = "access"
+	// minKeyLen is the minimum length of a signing key, matching the output size of HS256.
+	minKeyLen = 32
+)
+
+// ErrInvalidToken is returned when a token is malformed, expired or not signed by a known key.
+var ErrInvalidToken = errors.New("invalid token")
+
+// claims are the claims of access tokens and stream tickets. The generation is the token generation of the user
+// when the token was issued: tokens of an older generation are rejected once the user is looked up.
+type claims struct {
+	jwt.RegisteredClaims
+	Generation uint64 `json:"gen,omitempty"`
+}
+
+// Tokens issues and verifies signed access tokens and stream tickets.
+// Several keys can be active at once to rotate them: tokens are signed with the first one
+// and verified with any of them, so a new key can be prepended before the previous one is removed.
+// It is safe for concurrent use.
+type Tokens struct {
+	keys         map[string][]byte
+	signingKeyID string
+	ttl          time.Duration
+}
+
+// NewTokens returns a Tokens using the given comma-separated list of signing keys, written as kid:secret.
+// If keys is empty, a random key is generated, so that tokens are not valid anymore once the server restarts.
+// Access tokens are valid for ttl.
+func NewTokens(keys string, ttl time.Duration) (*Tokens, error) {
+	t := &Tokens{keys: make(map[string][]byte), ttl: ttl}
+
+	if keys == "" {
+		secret := make([]byte, minKeyLen)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+		t.signingKeyID = "random"
+		t.keys[t.signingKeyID] = secret
+		return t, nil
+	}
+
+	for _, key := range strings.Split(keys, ",") {
+		id, secret, found := strings.Cut(strings.TrimSpace(key), ":")
+		if !found || id == "" {
+			return nil, fmt.Errorf("signing key must be written as kid:secret")
+		}
+		if len(secret) < minKeyLen {
+			return nil, fmt.Errorf("signing key %s must be at least %d bytes long", id, minKeyLen)
+		}
+		if _, ok := t.keys[id]; ok {
+			return nil, fmt.Errorf("signing key %s is defined twice", id)
+		}
+		if t.signingKeyID == "" {
+			t.signingKeyID = id
+		}
+		t.keys[id] = []byte(secret)
+	}
+	return t, nil
+}
+
+// TTL returns the duration access tokens are valid for.
+func (t *Tokens) TTL() time.Duration {
+	return t.ttl
+}
+
+// Issue returns an access token for the user with the given ID and token generation, along with its expiration time.
+func (t *Tokens) Issue(userID, generation uint64) (string, time.Time, error) {
+	return t.issue(userID, generation, accessAudience, t.ttl)
+}
+
+// Verify checks an access token and returns the ID and token generation of the user it has been issued for.
+func (t *Tokens) Verify(token string) (uint64, uint64, error) {
+	return t.verify(token, accessAudience)
+}
+
+// IssueStreamTicket returns a ticket valid for ttl, authenticating the user with the given ID and token generation
+// on the stream of the room with the given ID only.
+func (t *Tokens) IssueStreamTicket(userID, generation, roomID uint64, ttl time.Duration) (string, time.Time, error) {
+	return t.issue(userID, generation, streamAudience(roomID), ttl)
+}
+
+// VerifyStreamTicket checks a stream ticket for the room with the given ID
+// and returns the ID and token generation of the user it has been issued for.
+func (t *Tokens) VerifyStreamTicket(ticket string, roomID uint64) (uint64, uint64, error) {
+	return t.verify(ticket, streamAudience(roomID))
+}
+
+// issue returns a token for the given user, token generation and audience, valid for ttl.
+func (t *Tokens) issue(userID, generation uint64, audience string, ttl time.Duration) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(ttl)
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    tokenIssuer,
+			Subject:   strconv.FormatUint(userID, 10),
+			Audience:  jwt.ClaimStrings{audience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+		Generation: generation,
+	})
+	token.Header["kid"] = t.signingKeyID
+
+	signed, err := token.SignedString(t.keys[t.signingKeyID])
+	return signed, expiresAt, err
+}
+
+// verify checks a token issued for the given audience and returns the ID and token generation of the user it has been issued for.
+func (t *Tokens) verify(token string, audience string) (uint64, uint64, error) {
+	var claims claims
+	_, err := jwt.ParseWithClaims(token, &claims, func(token *jwt.Token) (interface{}, error) {
+		id, _ := token.Header["kid"].(string)
+		key, ok := t.keys[id]
+		if !ok {
+			return nil, ErrInvalidToken
+		}
+		return key, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil || !claims.VerifyIssuer(tokenIssuer, true) || !claims.VerifyAudience(audience, true) || claims.ExpiresAt == nil {
+		return 0, 0, ErrInvalidToken
+	}
+
+	userID, err := strconv.ParseUint(claims.Subject, 10, 64)
+	if err != nil {
+		return 0, 0, ErrInvalidToken
+	}
+	return userID, claims.Generation, nil
+}
+
+// streamAudience returns the audience of the stream tickets of a room.
+func streamAudience(roomID uint64) string {
+	return "stream:" + strconv.FormatUint(roomID, 10)
+}
+
+// GenerateRefreshToken returns a new opaque refresh token and the hash to store to find it back.
+func GenerateRefreshToken() (string, string, error) {
+	token, err := GeneratePassword()
+	if err != nil {
+		return "", "", err
+	}
+	return token, HashRefreshToken(token), nil
+}
+
+// HashRefreshToken hashes a refresh token. Refresh tokens are random enough not to need a slow KDF.
+func HashRefreshToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,136 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-playground/assert/v2"
+)
+
+const (
+	oldKey = "old:0123456789abcdef0123456789abcdef"
+	newKey = "new:fedcba9876543210fedcba9876543210"
+)
+
+func TestNewTokens(t *testing.T) {
+	tests := []struct {
+		name  string
+		keys  string
+		valid bool
+	}{
+		{"Random key", "", true},
+		{"Single key", oldKey, true},
+		{"Several keys", newKey + "," + oldKey, true},
+		{"Missing kid", "0123456789abcdef0123456789abcdef", false},
+		{"Empty kid", ":0123456789abcdef0123456789abcdef", false},
+		{"Short secret", "kid:secret", false},
+		{"Duplicated kid", oldKey + "," + oldKey, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := NewTokens(test.keys, time.Minute)
+			assert.Equal(t, err == nil, test.valid)
+		})
+	}
+}
+
+func TestTokensVerify(t *testing.T) {
+	tokens, err := NewTokens(oldKey, time.Minute)
+	assert.Equal(t, err, nil)
+
+	token, expiresAt, err := tokens.Issue(42, 3)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, expiresAt.After(time.Now()), true)
+
+	userID, generation, err := tokens.Verify(token)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, userID, uint64(42))
+	assert.Equal(t, generation, uint64(3))
+
+	// A tampered token is rejected.
+	parts := strings.Split(token, ".")
+	_, _, err = tokens.Verify(parts[0] + "." + parts[1] + "." + strings.Repeat("A", len(parts[2])))
+	assert.Equal(t, err, ErrInvalidToken)
+
+	// A token signed with a random key is rejected.
+	other, err := NewTokens("", time.Minute)
+	assert.Equal(t, err, nil)
+	otherToken, _, err := other.Issue(42, 0)
+	assert.Equal(t, err, nil)
+	_, _, err = tokens.Verify(otherToken)
+	assert.Equal(t, err, ErrInvalidToken)
+
+	// An expired token is rejected.
+	expired, err := NewTokens(oldKey, -time.Minute)
+	assert.Equal(t, err, nil)
+	expiredToken, _, err := expired.Issue(42, 0)
+	assert.Equal(t, err, nil)
+	_, _, err = tokens.Verify(expiredToken)
+	assert.Equal(t, err, ErrInvalidToken)
+}
+
+// TestTokensKeyRotation tests that tokens signed with a previous key stay valid while the key is kept.
+func TestTokensKeyRotation(t *testing.T) {
+	before, err := NewTokens(oldKey, time.Minute)
+	assert.Equal(t, err, nil)
+	during, err := NewTokens(newKey+","+oldKey, time.Minute)
+	assert.Equal(t, err, nil)
+	after, err := NewTokens(newKey, time.Minute)
+	assert.Equal(t, err, nil)
+
+	oldToken, _, err := before.Issue(1, 0)
+	assert.Equal(t, err, nil)
+	newToken, _, err := during.Issue(2, 0)
+	assert.Equal(t, err, nil)
+
+	userID, _, err := during.Verify(oldToken)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, userID, uint64(1))
+	userID, _, err = after.Verify(newToken)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, userID, uint64(2))
+
+	_, _, err = after.Verify(oldToken)
+	assert.Equal(t, err, ErrInvalidToken)
+	_, _, err = before.Verify(newToken)
+	assert.Equal(t, err, ErrInvalidToken)
+}
+
+func TestStreamTicket(t *testing.T) {
+	tokens, err := NewTokens(oldKey, time.Minute)
+	assert.Equal(t, err, nil)
+
+	ticket, _, err := tokens.IssueStreamTicket(42, 3, 7, time.Minute)
+	assert.Equal(t, err, nil)
+
+	userID, generation, err := tokens.VerifyStreamTicket(ticket, 7)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, userID, uint64(42))
+	assert.Equal(t, generation, uint64(3))
+
+	// A ticket is valid on the stream of its room only, and cannot be used as an access token.
+	_, _, err = tokens.VerifyStreamTicket(ticket, 8)
+	assert.Equal(t, err, ErrInvalidToken)
+	_, _, err = tokens.Verify(ticket)
+	assert.Equal(t, err, ErrInvalidToken)
+
+	// An access token cannot be used as a ticket.
+	token, _, err := tokens.Issue(42, 0)
+	assert.Equal(t, err, nil)
+	_, _, err = tokens.VerifyStreamTicket(token, 7)
+	assert.Equal(t, err, ErrInvalidToken)
+
+	// An expired ticket is rejected.
+	expired, _, err := tokens.IssueStreamTicket(42, 0, 7, -time.Minute)
+	assert.Equal(t, err, nil)
+	_, _, err = tokens.VerifyStreamTicket(expired, 7)
+	assert.Equal(t, err, ErrInvalidToken)
+}
+
+func TestRefreshToken(t *testing.T) {
+	token, hash, err := GenerateRefreshToken()
+	assert.Equal(t, err, nil)
+	assert.Equal(t, HashRefreshToken(token), hash)
+	assert.NotEqual(t, token, hash)
+}
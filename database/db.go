@@ -1,9 +1,11 @@
 package database
 
 import (
-	"github.com/Brawdunoir/dionysos-server/models"
+	"github.com/Brawdunoir/dionysos-server/metrics"
+	"github.com/Brawdunoir/dionysos-server/tracing"
 	l "github.com/Brawdunoir/dionysos-server/utils/logger"
 	c "github.com/Brawdunoir/dionysos-server/variables"
+	"github.com/glebarez/sqlite"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
@@ -11,20 +13,47 @@ import (
 
 var database *gorm.DB
 
-// Init initializes the database connection and migrate models within the database.
-// It also resets the database in case of testing or development environment.
+// Init initializes the database connection and applies the pending migrations.
 func Init() {
-	resetDB := c.Environment == c.ENVIRONMENT_DEVELOPMENT || c.Environment == c.ENVIRONMENT_TESTING
+	Connect()
 
-	db, err := gorm.Open(postgres.Open(createDSN()), createConfig())
+	err := MigrateDB(database, false)
+	if err != nil {
+		l.Logger.Fatal("Failed to migrate database: ", err)
+	}
+
+	err = hashPlaintextPasswords(database)
+	if err != nil {
+		l.Logger.Fatal("Failed to hash plaintext passwords: ", err)
+	}
+}
+
+// Connect initializes the database connection, without migrating the database.
+func Connect() {
+	db, err := gorm.Open(createDialector(), createConfig())
 	if err != nil {
 		l.Logger.Fatal("Failed to connect to the database: ", err)
 	}
 
-	err = MigrateDB(db, resetDB)
+	if c.DatabaseDriver == c.DATABASE_DRIVER_SQLITE {
+		// SQLite has a single writer, and transactions upgrading from reading to writing fail instead of waiting
+		// if another connection writes meanwhile. Queue all queries on a single connection instead.
+		sqlDB, err := db.DB()
+		if err != nil {
+			l.Logger.Fatal("Failed to connect to the database: ", err)
+		}
+		sqlDB.SetMaxOpenConns(1)
+	}
+
+	err = db.Use(metrics.GormPlugin{})
 	if err != nil {
-		l.Logger.Fatal("Failed to migrate database: ", err)
+		l.Logger.Fatal("Failed to register database metrics: ", err)
+	}
+	err = db.Use(tracing.GormPlugin{})
+	if err != nil {
+		l.Logger.Fatal("Failed to register database tracing: ", err)
 	}
+
 	database = db
 }
 
@@ -33,7 +62,24 @@ func GetDB() *gorm.DB {
 	return database
 }
 
-// createDSN creates a DSN string from the environment variables to connect to the database.
+// createDialector creates the gorm dialector of the database driver, from the environment variables.
+func createDialector() gorm.Dialector {
+	switch c.DatabaseDriver {
+	case c.DATABASE_DRIVER_POSTGRES:
+		if c.PostgresHost == "" || c.PostgresPort == "" || c.PostgresUser == "" || c.PostgresDB == "" {
+			l.Logger.Fatal("POSTGRES_HOST, POSTGRES_PORT, POSTGRES_USER and POSTGRES_DB must be set to connect to the database")
+		}
+		return postgres.Open(createDSN())
+	case c.DATABASE_DRIVER_SQLITE:
+		// Foreign keys are not enforced by default, and concurrent processes, e.g. migrate, wait for each other.
+		return sqlite.Open("file:" + c.SQLitePath + "?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	default:
+		l.Logger.Fatal("Unknown database driver: " + c.DatabaseDriver)
+		return nil
+	}
+}
+
+// createDSN creates a DSN string from the environment variables to connect to the Postgres database.
 func createDSN() string {
 	return "host=" + c.PostgresHost + " port=" + c.PostgresPort + " user=" + c.PostgresUser + " password=" + c.PostgresPassword + " dbname=" + c.PostgresDB
 }
@@ -53,17 +99,23 @@ func createConfig() *gorm.Config {
 	}
 }
 
-// MigrateDB migrate a table in the database and resets all tables if needed.
+// MigrateDB applies the pending migrations. If reset is true, all the migrations are reverted first,
+// which deletes all data. It is meant for tests.
 func MigrateDB(db *gorm.DB, reset bool) error {
 	if reset {
-		err := db.Migrator().DropTable(&models.User{}, &models.Room{}, "room_users")
+		err := MigrateDown(db, -1)
 		if err != nil {
 			return err
 		}
 	}
-	err := db.AutoMigrate(&models.Room{}, &models.User{})
+	return MigrateUp(db)
+}
+
+// Close closes the database connection.
+func Close() error {
+	sqlDB, err := database.DB()
 	if err != nil {
 		return err
 	}
-	return nil
+	return sqlDB.Close()
 }
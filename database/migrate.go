@@ -0,0 +1,257 @@
+package database
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	l "github.com/Brawdunoir/dionysos-server/utils/logger"
+	c "github.com/Brawdunoir/dionysos-server/variables"
+	"gorm.io/gorm"
+)
+
+//go:embed migrations/*/*.sql
+var migrationsFS embed.FS
+
+// dialect gathers the statements of migrate that differ between databases.
+type dialect struct {
+	// prepare takes the lock held until the end of the transaction, so that only one instance migrates at a time,
+	// and creates the table recording the applied migrations if it does not exist.
+	prepare []string
+}
+
+// dialects maps the names of the gorm dialectors to their dialect.
+var dialects = map[string]dialect{
+	c.DATABASE_DRIVER_POSTGRES: {prepare: []string{
+		"SELECT pg_advisory_xact_lock(7346298105)",
+		`CREATE TABLE IF NOT EXISTS schema_migrations (
+			version bigint PRIMARY KEY,
+			name text NOT NULL,
+			applied_at timestamptz NOT NULL
+		)`,
+	}},
+	// SQLite has a single writer: the first write of a transaction waits for the other writers to complete.
+	c.DATABASE_DRIVER_SQLITE: {prepare: []string{
+		`CREATE TABLE IF NOT EXISTS schema_migrations (
+			version integer PRIMARY KEY,
+			name text NOT NULL,
+			applied_at datetime NOT NULL
+		)`,
+		"DELETE FROM schema_migrations WHERE version < 0",
+	}},
+}
+
+// Migration is a versioned change of the schema of the database, along with the change reverting it.
+// Migrations are stored as SQL files in the migrations/<driver> directory, named <version>_<name>.up.sql and
+// <version>_<name>.down.sql, and are applied in the order of their versions.
+type Migration struct {
+	Version uint64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus tells whether a migration has been applied to the database.
+type MigrationStatus struct {
+	Version uint64
+	Name    string
+	// AppliedAt is the time the migration was applied at, nil if it is pending.
+	AppliedAt *time.Time
+	// Unknown reports whether the migration has been applied but is not known, e.g. by an older version of the API.
+	Unknown bool
+}
+
+// schemaMigration is a row of the table recording the migrations applied to the database.
+type schemaMigration struct {
+	Version   uint64 `gorm:"primaryKey;autoIncrement:false"`
+	Name      string `gorm:"not null"`
+	AppliedAt time.Time
+}
+
+func (schemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// loadMigrations reads the migrations from fsys, sorted by version.
+func loadMigrations(fsys fs.FS) ([]Migration, error) {
+	files, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := make(map[uint64]*Migration)
+	for _, file := range files {
+		base, direction := strings.TrimSuffix(file, ".sql"), ""
+		switch {
+		case strings.HasSuffix(base, ".up"):
+			base, direction = strings.TrimSuffix(base, ".up"), "up"
+		case strings.HasSuffix(base, ".down"):
+			base, direction = strings.TrimSuffix(base, ".down"), "down"
+		default:
+			return nil, fmt.Errorf("migration is neither up nor down: %s", file)
+		}
+		version, name, found := strings.Cut(base, "_")
+		if !found || name == "" {
+			return nil, fmt.Errorf("migration must be named <version>_<name>: %s", file)
+		}
+		v, err := strconv.ParseUint(version, 10, 64)
+		if err != nil || v == 0 {
+			return nil, fmt.Errorf("invalid migration version: %s", file)
+		}
+
+		content, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := migrations[v]
+		if !ok {
+			m = &Migration{Version: v, Name: name}
+			migrations[v] = m
+		}
+		if m.Name != name {
+			return nil, fmt.Errorf("duplicated migration version: %s", file)
+		}
+		if direction == "up" {
+			m.Up = string(content)
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	sorted := make([]Migration, 0, len(migrations))
+	for _, m := range migrations {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s must have both an up and a down file", m.Version, m.Name)
+		}
+		sorted = append(sorted, *m)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Version < sorted[j].Version })
+	return sorted, nil
+}
+
+// Migrations returns the migrations shipped with the API for the given database driver, sorted by version.
+// Each driver has its own SQL files, but they all share the same versions and names.
+func Migrations(driver string) ([]Migration, error) {
+	if _, ok := dialects[driver]; !ok {
+		return nil, fmt.Errorf("unknown database driver: %s", driver)
+	}
+	fsys, err := fs.Sub(migrationsFS, path.Join("migrations", driver))
+	if err != nil {
+		return nil, err
+	}
+	return loadMigrations(fsys)
+}
+
+// migrate runs fn in a transaction holding the migrations lock, with the applied migrations sorted by version.
+// Other instances wait for the lock to be released before migrating, and then see the migrations applied meanwhile.
+func migrate(db *gorm.DB, fn func(tx *gorm.DB, migrations []Migration, applied []schemaMigration) error) error {
+	driver := db.Dialector.Name()
+	migrations, err := Migrations(driver)
+	if err != nil {
+		return err
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, statement := range dialects[driver].prepare {
+			err := tx.Exec(statement).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		var applied []schemaMigration
+		err = tx.Order("version").Find(&applied).Error
+		if err != nil {
+			return err
+		}
+		return fn(tx, migrations, applied)
+	})
+}
+
+// MigrateUp applies the pending migrations.
+func MigrateUp(db *gorm.DB) error {
+	return migrate(db, func(tx *gorm.DB, migrations []Migration, applied []schemaMigration) error {
+		done := make(map[uint64]bool, len(applied))
+		for _, a := range applied {
+			done[a.Version] = true
+		}
+
+		for _, m := range migrations {
+			if done[m.Version] {
+				continue
+			}
+			err := tx.Exec(m.Up).Error
+			if err != nil {
+				return fmt.Errorf("migration %d_%s: %w", m.Version, m.Name, err)
+			}
+			err = tx.Create(&schemaMigration{Version: m.Version, Name: m.Name, AppliedAt: time.Now()}).Error
+			if err != nil {
+				return err
+			}
+			l.Logger.Infof("Applied migration %d_%s", m.Version, m.Name)
+		}
+		return nil
+	})
+}
+
+// MigrateDown reverts the last steps applied migrations, or all of them if steps is negative.
+// It fails without reverting anything if one of them is not known.
+func MigrateDown(db *gorm.DB, steps int) error {
+	return migrate(db, func(tx *gorm.DB, migrations []Migration, applied []schemaMigration) error {
+		known := make(map[uint64]Migration, len(migrations))
+		for _, m := range migrations {
+			known[m.Version] = m
+		}
+
+		for i := len(applied) - 1; i >= 0 && steps != 0; i, steps = i-1, steps-1 {
+			m, ok := known[applied[i].Version]
+			if !ok {
+				return fmt.Errorf("migration %d_%s is not known and cannot be reverted", applied[i].Version, applied[i].Name)
+			}
+			err := tx.Exec(m.Down).Error
+			if err != nil {
+				return fmt.Errorf("migration %d_%s: %w", m.Version, m.Name, err)
+			}
+			err = tx.Delete(&applied[i]).Error
+			if err != nil {
+				return err
+			}
+			l.Logger.Infof("Reverted migration %d_%s", m.Version, m.Name)
+		}
+		return nil
+	})
+}
+
+// GetMigrationStatus returns the status of the migrations known or applied, sorted by version.
+func GetMigrationStatus(db *gorm.DB) ([]MigrationStatus, error) {
+	var status []MigrationStatus
+
+	err := migrate(db, func(tx *gorm.DB, migrations []Migration, applied []schemaMigration) error {
+		byVersion := make(map[uint64]*MigrationStatus)
+		for _, m := range migrations {
+			byVersion[m.Version] = &MigrationStatus{Version: m.Version, Name: m.Name}
+		}
+		for _, a := range applied {
+			a := a
+			s, ok := byVersion[a.Version]
+			if !ok {
+				s = &MigrationStatus{Version: a.Version, Name: a.Name, Unknown: true}
+				byVersion[a.Version] = s
+			}
+			s.AppliedAt = &a.AppliedAt
+		}
+
+		for _, s := range byVersion {
+			status = append(status, *s)
+		}
+		sort.Slice(status, func(i, j int) bool { return status[i].Version < status[j].Version })
+		return nil
+	})
+	return status, err
+}
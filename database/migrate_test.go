@@ -0,0 +1,139 @@
+package database
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	l "github.com/Brawdunoir/dionysos-server/utils/logger"
+	c "github.com/Brawdunoir/dionysos-server/variables"
+	"github.com/glebarez/sqlite"
+	"github.com/go-playground/assert/v2"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestMigrations(t *testing.T) {
+	postgres, err := Migrations(c.DATABASE_DRIVER_POSTGRES)
+	assert.Equal(t, err, nil)
+	assert.NotEqual(t, len(postgres), 0)
+	for i, m := range postgres {
+		assert.Equal(t, m.Version, uint64(i+1))
+	}
+
+	// All drivers must have the same migrations.
+	sqlite, err := Migrations(c.DATABASE_DRIVER_SQLITE)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(sqlite), len(postgres))
+	for i, m := range sqlite {
+		assert.Equal(t, m.Version, postgres[i].Version)
+		assert.Equal(t, m.Name, postgres[i].Name)
+	}
+
+	_, err = Migrations("unknown")
+	assert.NotEqual(t, err, nil)
+}
+
+func TestLoadMigrations(t *testing.T) {
+	file := &fstest.MapFile{Data: []byte("SELECT 1;")}
+	tests := []struct {
+		name     string
+		files    []string
+		versions []uint64
+		valid    bool
+	}{
+		{"Empty", nil, []uint64{}, true},
+		{"Sorted by version", []string{"0010_b.up.sql", "0010_b.down.sql", "0002_a.up.sql", "0002_a.down.sql"}, []uint64{2, 10}, true},
+		{"Missing down", []string{"0001_a.up.sql"}, nil, false},
+		{"Missing up", []string{"0001_a.down.sql"}, nil, false},
+		{"Duplicated version", []string{"0001_a.up.sql", "0001_a.down.sql", "0001_b.up.sql", "0001_b.down.sql"}, nil, false},
+		{"Missing name", []string{"0001.up.sql", "0001.down.sql"}, nil, false},
+		{"Invalid version", []string{"first_a.up.sql", "first_a.down.sql"}, nil, false},
+		{"Version 0", []string{"0000_a.up.sql", "0000_a.down.sql"}, nil, false},
+		{"Missing direction", []string{"0001_a.sql"}, nil, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fsys := fstest.MapFS{}
+			for _, name := range test.files {
+				fsys[name] = file
+			}
+
+			migrations, err := loadMigrations(fsys)
+			assert.Equal(t, err == nil, test.valid)
+			if test.valid {
+				versions := []uint64{}
+				for _, m := range migrations {
+					versions = append(versions, m.Version)
+				}
+				assert.Equal(t, versions, test.versions)
+			}
+		})
+	}
+}
+
+// TestMigrateBaseline tests the migrations upgrade a database created by AutoMigrate before they were versioned.
+func TestMigrateBaseline(t *testing.T) {
+	l.Logger = zap.NewNop().Sugar()
+	db, err := gorm.Open(sqlite.Open("file:"+filepath.Join(t.TempDir(), "dionysos.db")+"?_pragma=foreign_keys(1)"),
+		&gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	assert.Equal(t, err, nil)
+
+	// The models as they were when the schema was created by AutoMigrate.
+	type User struct {
+		ID        uint64 `gorm:"primarykey"`
+		CreatedAt time.Time
+		UpdatedAt time.Time
+		DeletedAt sql.NullTime `gorm:"index"`
+		Name      string
+		Password  string
+	}
+	type Room struct {
+		ID        uint64 `gorm:"primaryKey;autoincrement:false"`
+		CreatedAt time.Time
+		UpdatedAt time.Time
+		DeletedAt sql.NullTime `gorm:"index"`
+		Name      string
+		OwnerID   uint64
+		Users     []User `gorm:"many2many:room_users"`
+	}
+	err = db.AutoMigrate(&Room{}, &User{})
+	assert.Equal(t, err, nil)
+	user := User{Name: "user", Password: "password"}
+	err = db.Create(&user).Error
+	assert.Equal(t, err, nil)
+	err = db.Create(&Room{ID: 1, Name: "room", OwnerID: user.ID, Users: []User{user}}).Error
+	assert.Equal(t, err, nil)
+
+	err = MigrateDB(db, false)
+	assert.Equal(t, err, nil)
+
+	status, err := GetMigrationStatus(db)
+	assert.Equal(t, err, nil)
+	for _, s := range status {
+		assert.NotEqual(t, s.AppliedAt, nil)
+	}
+
+	// Existing data is kept, and later columns and tables are usable.
+	var name string
+	err = db.Raw("SELECT name FROM users WHERE id = ?", user.ID).Scan(&name).Error
+	assert.Equal(t, err, nil)
+	assert.Equal(t, name, "user")
+	var members int64
+	err = db.Table("room_users").Where("room_id = ? AND user_id = ?", 1, user.ID).Count(&members).Error
+	assert.Equal(t, err, nil)
+	assert.Equal(t, members, int64(1))
+	err = db.Exec("UPDATE users SET handle = ? WHERE id = ?", "handle", user.ID).Error
+	assert.Equal(t, err, nil)
+	err = db.Exec("INSERT INTO refresh_tokens (user_id, hash) VALUES (?, ?)", user.ID, "hash").Error
+	assert.Equal(t, err, nil)
+	err = db.Exec("INSERT INTO identities (user_id, issuer, subject) VALUES (?, ?, ?)", user.ID, "issuer", "subject").Error
+	assert.Equal(t, err, nil)
+
+	// Every migration can be reverted and applied again.
+	err = MigrateDB(db, true)
+	assert.Equal(t, err, nil)
+}
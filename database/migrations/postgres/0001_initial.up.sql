@@ -0,0 +1,29 @@
+-- Schema created by gorm AutoMigrate before migrations were versioned.
+-- Tables and indexes are only created if missing, so that existing databases are adopted as they are.
+CREATE TABLE IF NOT EXISTS rooms (
+	id bigint PRIMARY KEY,
+	created_at timestamptz,
+	updated_at timestamptz,
+	deleted_at timestamptz,
+	name text,
+	owner_id bigint
+);
+CREATE INDEX IF NOT EXISTS idx_rooms_deleted_at ON rooms (deleted_at);
+
+CREATE TABLE IF NOT EXISTS users (
+	id bigserial PRIMARY KEY,
+	created_at timestamptz,
+	updated_at timestamptz,
+	deleted_at timestamptz,
+	name text,
+	password text
+);
+CREATE INDEX IF NOT EXISTS idx_users_deleted_at ON users (deleted_at);
+
+CREATE TABLE IF NOT EXISTS room_users (
+	room_id bigint,
+	user_id bigint,
+	PRIMARY KEY (room_id, user_id),
+	CONSTRAINT fk_room_users_room FOREIGN KEY (room_id) REFERENCES rooms (id),
+	CONSTRAINT fk_room_users_user FOREIGN KEY (user_id) REFERENCES users (id)
+);
@@ -0,0 +1,10 @@
+-- Refresh tokens of users, stored by hash to exchange them for new access tokens.
+CREATE TABLE refresh_tokens (
+	id bigserial PRIMARY KEY,
+	created_at timestamptz,
+	expires_at timestamptz,
+	user_id bigint NOT NULL,
+	hash text NOT NULL
+);
+CREATE INDEX idx_refresh_tokens_user_id ON refresh_tokens (user_id);
+CREATE UNIQUE INDEX idx_refresh_tokens_hash ON refresh_tokens (hash);
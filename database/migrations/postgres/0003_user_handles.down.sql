@@ -0,0 +1,2 @@
+DROP INDEX idx_users_handle;
+ALTER TABLE users DROP COLUMN handle;
@@ -0,0 +1,10 @@
+-- Identities of users at OpenID Connect providers.
+CREATE TABLE identities (
+	id bigserial PRIMARY KEY,
+	created_at timestamptz,
+	user_id bigint NOT NULL,
+	issuer text NOT NULL,
+	subject text NOT NULL
+);
+CREATE INDEX idx_identities_user_id ON identities (user_id);
+CREATE UNIQUE INDEX idx_identities_subject ON identities (issuer, subject);
@@ -0,0 +1,3 @@
+-- Versions of rooms and users, for optimistic concurrency with ETag and If-Match headers.
+ALTER TABLE rooms ADD COLUMN version bigint NOT NULL DEFAULT 1;
+ALTER TABLE users ADD COLUMN version bigint NOT NULL DEFAULT 1;
@@ -0,0 +1,3 @@
+-- Time users joined rooms, for the ownership of a room to go to the member who joined it first.
+-- Existing memberships are given the same time, falling back to the order of user IDs.
+ALTER TABLE room_users ADD COLUMN joined_at timestamptz NOT NULL DEFAULT now();
@@ -0,0 +1,28 @@
+-- Same schema as on Postgres. Users IDs are never reused, as with Postgres sequences.
+CREATE TABLE IF NOT EXISTS rooms (
+	id integer PRIMARY KEY,
+	created_at datetime,
+	updated_at datetime,
+	deleted_at datetime,
+	name text,
+	owner_id integer
+);
+CREATE INDEX IF NOT EXISTS idx_rooms_deleted_at ON rooms (deleted_at);
+
+CREATE TABLE IF NOT EXISTS users (
+	id integer PRIMARY KEY AUTOINCREMENT,
+	created_at datetime,
+	updated_at datetime,
+	deleted_at datetime,
+	name text,
+	password text
+);
+CREATE INDEX IF NOT EXISTS idx_users_deleted_at ON users (deleted_at);
+
+CREATE TABLE IF NOT EXISTS room_users (
+	room_id integer,
+	user_id integer,
+	PRIMARY KEY (room_id, user_id),
+	CONSTRAINT fk_room_users_room FOREIGN KEY (room_id) REFERENCES rooms (id),
+	CONSTRAINT fk_room_users_user FOREIGN KEY (user_id) REFERENCES users (id)
+);
@@ -0,0 +1,10 @@
+-- Refresh tokens of users, stored by hash to exchange them for new access tokens.
+CREATE TABLE refresh_tokens (
+	id integer PRIMARY KEY AUTOINCREMENT,
+	created_at datetime,
+	expires_at datetime,
+	user_id integer NOT NULL,
+	hash text NOT NULL
+);
+CREATE INDEX idx_refresh_tokens_user_id ON refresh_tokens (user_id);
+CREATE UNIQUE INDEX idx_refresh_tokens_hash ON refresh_tokens (hash);
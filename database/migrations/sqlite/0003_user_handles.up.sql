@@ -0,0 +1,3 @@
+-- Handles of registered users, to log in with a password. Anonymous users have none.
+ALTER TABLE users ADD COLUMN handle text;
+CREATE UNIQUE INDEX idx_users_handle ON users (handle);
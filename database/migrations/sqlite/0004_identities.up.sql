@@ -0,0 +1,10 @@
+-- Identities of users at OpenID Connect providers.
+CREATE TABLE identities (
+	id integer PRIMARY KEY AUTOINCREMENT,
+	created_at datetime,
+	user_id integer NOT NULL,
+	issuer text NOT NULL,
+	subject text NOT NULL
+);
+CREATE INDEX idx_identities_user_id ON identities (user_id);
+CREATE UNIQUE INDEX idx_identities_subject ON identities (issuer, subject);
@@ -0,0 +1,2 @@
+-- Generations of the access tokens and stream tickets of users, incremented to reject the ones issued before.
+ALTER TABLE users ADD COLUMN token_generation integer NOT NULL DEFAULT 0;
@@ -0,0 +1 @@
+ALTER TABLE room_users DROP COLUMN joined_at;
@@ -0,0 +1,4 @@
+-- Time users joined rooms, for the ownership of a room to go to the member who joined it first.
+-- Existing memberships are given the same time, falling back to the order of user IDs.
+-- SQLite cannot add a column defaulting to the current time, nor compares times other than as text, hence UTC.
+ALTER TABLE room_users ADD COLUMN joined_at datetime NOT NULL DEFAULT '1970-01-01 00:00:00+00:00';
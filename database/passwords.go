@@ -0,0 +1,41 @@
+package database
+
+import (
+	"github.com/Brawdunoir/dionysos-server/auth"
+	"github.com/Brawdunoir/dionysos-server/models"
+	l "github.com/Brawdunoir/dionysos-server/utils/logger"
+	"gorm.io/gorm"
+)
+
+// hashPlaintextPasswords replaces the plaintext passwords of users created before passwords were hashed.
+// Users are still able to authenticate with the same password afterwards.
+func hashPlaintextPasswords(db *gorm.DB) error {
+	var users []models.User
+	count := 0
+
+	err := db.Unscoped().Where("password NOT LIKE ?", "$argon2id$%").FindInBatches(&users, 100, func(tx *gorm.DB, batch int) error {
+		for _, user := range users {
+			if auth.IsHashed(user.Password) {
+				continue
+			}
+			hash, err := auth.HashPassword(user.Password)
+			if err != nil {
+				return err
+			}
+			err = db.Unscoped().Model(&user).UpdateColumn("password", hash).Error
+			if err != nil {
+				return err
+			}
+			count++
+		}
+		return nil
+	}).Error
+	if err != nil {
+		return err
+	}
+
+	if count > 0 {
+		l.Logger.Infof("Hashed the plaintext password of %d users", count)
+	}
+	return nil
+}
@@ -23,13 +23,51 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
-        "/rooms": {
+        "/admin/export": {
+            "get": {
+                "security": [
+                    {
+                        "AdminToken": []
+                    }
+                ],
+                "description": "Returns a versioned archive of the users and rooms which are not deleted, along with their memberships,\nto back them up or import them into another instance. It holds the password hashes of the users.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Admin"
+                ],
+                "summary": "Exports the users, rooms and memberships.",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.Archive"
+                        }
+                    },
+                    "401": {
+                        "description": "Invalid admin token",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/import": {
             "post": {
                 "security": [
                     {
-                        "BasicAuth": []
+                        "AdminToken": []
                     }
                 ],
+                "description": "Imports an archive from the export endpoint, of this instance or of another one, next to the existing users and rooms.\nUsers and rooms are given new IDs, returned by archive ID. Either everything is imported or nothing is.",
                 "consumes": [
                     "application/json"
                 ],
@@ -37,25 +75,25 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "Rooms"
+                    "Admin"
                 ],
-                "summary": "Creates a room.",
+                "summary": "Imports users, rooms and memberships.",
                 "parameters": [
                     {
-                        "description": "Room object",
-                        "name": "room",
+                        "description": "Archive",
+                        "name": "archive",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/models.RoomUpdate"
+                            "$ref": "#/definitions/models.Archive"
                         }
                     }
                 ],
                 "responses": {
                     "201": {
-                        "description": "Room created",
+                        "description": "Created",
                         "schema": {
-                            "$ref": "#/definitions/utils.CreateResponse"
+                            "$ref": "#/definitions/models.ArchiveMapping"
                         }
                     },
                     "400": {
@@ -65,13 +103,13 @@ const docTemplate = `{
                         }
                     },
                     "401": {
-                        "description": "User not authorized",
+                        "description": "Invalid admin token",
                         "schema": {
                             "$ref": "#/definitions/utils.ErrorResponse"
                         }
                     },
-                    "404": {
-                        "description": "Invalid user in auth method",
+                    "409": {
+                        "description": "Handle already taken or identity already linked",
                         "schema": {
                             "$ref": "#/definitions/utils.ErrorResponse"
                         }
@@ -85,34 +123,68 @@ const docTemplate = `{
                 }
             }
         },
-        "/rooms/{id}": {
+        "/admin/log-level": {
             "get": {
                 "security": [
                     {
-                        "BasicAuth": []
+                        "AdminToken": []
                     }
                 ],
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Rooms"
+                    "Admin"
                 ],
-                "summary": "Gets a room.",
+                "summary": "Gets the current log level.",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/utils.LogLevel"
+                        }
+                    },
+                    "401": {
+                        "description": "Invalid admin token",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "security": [
+                    {
+                        "AdminToken": []
+                    }
+                ],
+                "description": "Changes the log level until the server restarts, without affecting access logs. Possible levels are debug, info, warn, error, dpanic, panic and fatal.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Admin"
+                ],
+                "summary": "Changes the log level at runtime.",
                 "parameters": [
                     {
-                        "type": "integer",
-                        "description": "Room ID",
-                        "name": "id",
-                        "in": "path",
-                        "required": true
+                        "description": "New log level",
+                        "name": "level",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/utils.LogLevel"
+                        }
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/models.Room"
+                            "$ref": "#/definitions/utils.LogLevel"
                         }
                     },
                     "400": {
@@ -122,57 +194,36 @@ const docTemplate = `{
                         }
                     },
                     "401": {
-                        "description": "User not authorized",
-                        "schema": {
-                            "$ref": "#/definitions/utils.ErrorResponse"
-                        }
-                    },
-                    "404": {
-                        "description": "Room not found or invalid user in auth method",
-                        "schema": {
-                            "$ref": "#/definitions/utils.ErrorResponse"
-                        }
-                    },
-                    "500": {
-                        "description": "Internal server error",
+                        "description": "Invalid admin token",
                         "schema": {
                             "$ref": "#/definitions/utils.ErrorResponse"
                         }
                     }
                 }
-            },
-            "patch": {
+            }
+        },
+        "/admin/users/{id}/restore": {
+            "post": {
                 "security": [
                     {
-                        "BasicAuth": []
+                        "AdminToken": []
                     }
                 ],
-                "consumes": [
-                    "application/json"
-                ],
+                "description": "Restores a user deleted during the restore period, 24 hours by default. The user does not get its rooms back.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Rooms"
+                    "Admin"
                 ],
-                "summary": "Updates a room.",
+                "summary": "Restores a deleted user.",
                 "parameters": [
                     {
                         "type": "integer",
-                        "description": "Room ID",
+                        "description": "User ID",
                         "name": "id",
                         "in": "path",
                         "required": true
-                    },
-                    {
-                        "description": "Room object",
-                        "name": "room",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/models.RoomUpdate"
-                        }
                     }
                 ],
                 "responses": {
@@ -186,13 +237,13 @@ const docTemplate = `{
                         }
                     },
                     "401": {
-                        "description": "User not authorized",
+                        "description": "Invalid admin token",
                         "schema": {
                             "$ref": "#/definitions/utils.ErrorResponse"
                         }
                     },
                     "404": {
-                        "description": "Room not found or invalid user in auth method",
+                        "description": "User not found",
                         "schema": {
                             "$ref": "#/definitions/utils.ErrorResponse"
                         }
@@ -206,56 +257,90 @@ const docTemplate = `{
                 }
             }
         },
-        "/rooms/{id}/connect": {
-            "patch": {
-                "security": [
-                    {
-                        "BasicAuth": []
-                    }
+        "/livez": {
+            "get": {
+                "description": "Reports the process as alive. It does not check any dependency and keeps on succeeding while the server shuts down.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Misc"
                 ],
+                "summary": "Liveness probe.",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/utils.HealthResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/oidc/callback": {
+            "get": {
+                "description": "Called by the OpenID Connect provider once the user logged in. Returns the URI of the user,\nalong with an access token and a refresh token as /token does. A user is created the first time it logs in.\nOnly available if an OpenID Connect provider is configured.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Rooms"
+                    "OIDC"
                 ],
-                "summary": "Connects a user to a room.",
+                "summary": "Ends logging in with the OpenID Connect provider.",
                 "parameters": [
                     {
-                        "type": "integer",
-                        "description": "Room ID",
-                        "name": "id",
-                        "in": "path",
+                        "type": "string",
+                        "description": "Authorization code",
+                        "name": "code",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "State",
+                        "name": "state",
+                        "in": "query",
                         "required": true
                     }
                 ],
                 "responses": {
-                    "204": {
-                        "description": "No Content"
-                    },
-                    "400": {
-                        "description": "Invalid request",
+                    "200": {
+                        "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/utils.ErrorResponse"
+                            "$ref": "#/definitions/utils.TokenResponse"
                         }
                     },
                     "401": {
-                        "description": "User not authorized",
+                        "description": "Identity not verified",
                         "schema": {
                             "$ref": "#/definitions/utils.ErrorResponse"
                         }
                     },
-                    "404": {
-                        "description": "Room not found or invalid user in auth method",
+                    "429": {
+                        "description": "Too many requests",
                         "schema": {
                             "$ref": "#/definitions/utils.ErrorResponse"
                         }
                     },
-                    "409": {
-                        "description": "User already in room",
+                    "500": {
+                        "description": "Internal server error",
                         "schema": {
                             "$ref": "#/definitions/utils.ErrorResponse"
                         }
+                    }
+                }
+            }
+        },
+        "/oidc/login": {
+            "get": {
+                "description": "Redirects to the OpenID Connect provider, which redirects back to /oidc/callback once the user logged in.\nOnly available if an OpenID Connect provider is configured.",
+                "tags": [
+                    "OIDC"
+                ],
+                "summary": "Starts logging in with the OpenID Connect provider.",
+                "responses": {
+                    "302": {
+                        "description": "Found"
                     },
                     "500": {
                         "description": "Internal server error",
@@ -266,32 +351,77 @@ const docTemplate = `{
                 }
             }
         },
-        "/rooms/{id}/disconnect": {
-            "patch": {
+        "/readyz": {
+            "get": {
+                "description": "Checks every dependency of the API (database, cache, event broadcaster) and reports their status along with the check latency.\nThe server is reported as not ready as soon as it starts shutting down.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Misc"
+                ],
+                "summary": "Readiness probe.",
+                "parameters": [
+                    {
+                        "type": "boolean",
+                        "description": "Include the error of failed checks",
+                        "name": "verbose",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/utils.HealthResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "At least one dependency is unavailable or the server is shutting down",
+                        "schema": {
+                            "$ref": "#/definitions/utils.HealthResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/rooms": {
+            "post": {
                 "security": [
                     {
                         "BasicAuth": []
+                    },
+                    {
+                        "BearerAuth": []
                     }
                 ],
+                "consumes": [
+                    "application/json"
+                ],
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
                     "Rooms"
                 ],
-                "summary": "Disconnects a user from a room.",
+                "summary": "Creates a room.",
                 "parameters": [
                     {
-                        "type": "integer",
-                        "description": "Room ID",
-                        "name": "id",
-                        "in": "path",
-                        "required": true
+                        "description": "Room object",
+                        "name": "room",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.RoomUpdate"
+                        }
                     }
                 ],
                 "responses": {
-                    "204": {
-                        "description": "No Content"
+                    "201": {
+                        "description": "Room created",
+                        "schema": {
+                            "$ref": "#/definitions/utils.CreateResponse"
+                        }
                     },
                     "400": {
                         "description": "Invalid request",
@@ -306,7 +436,7 @@ const docTemplate = `{
                         }
                     },
                     "404": {
-                        "description": "Room not found or invalid user in auth method",
+                        "description": "Invalid user in auth method",
                         "schema": {
                             "$ref": "#/definitions/utils.ErrorResponse"
                         }
@@ -320,11 +450,14 @@ const docTemplate = `{
                 }
             }
         },
-        "/rooms/{id}/kick/{userid}": {
-            "patch": {
+        "/rooms/{id}": {
+            "get": {
                 "security": [
                     {
                         "BasicAuth": []
+                    },
+                    {
+                        "BearerAuth": []
                     }
                 ],
                 "produces": [
@@ -333,7 +466,7 @@ const docTemplate = `{
                 "tags": [
                     "Rooms"
                 ],
-                "summary": "Kicks a user from a room.",
+                "summary": "Gets a room.",
                 "parameters": [
                     {
                         "type": "integer",
@@ -343,16 +476,27 @@ const docTemplate = `{
                         "required": true
                     },
                     {
-                        "type": "integer",
-                        "description": "User ID",
-                        "name": "userid",
-                        "in": "path",
-                        "required": true
+                        "type": "string",
+                        "description": "ETag of a previously fetched version",
+                        "name": "If-None-Match",
+                        "in": "header"
                     }
                 ],
                 "responses": {
-                    "204": {
-                        "description": "No Content"
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.Room"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "Version of the room"
+                            }
+                        }
+                    },
+                    "304": {
+                        "description": "Room not modified since the given version"
                     },
                     "400": {
                         "description": "Invalid request",
@@ -367,7 +511,7 @@ const docTemplate = `{
                         }
                     },
                     "404": {
-                        "description": "Room not found or invalid user in auth method",
+                        "description": "Room not found",
                         "schema": {
                             "$ref": "#/definitions/utils.ErrorResponse"
                         }
@@ -379,24 +523,24 @@ const docTemplate = `{
                         }
                     }
                 }
-            }
-        },
-        "/rooms/{id}/stream": {
-            "get": {
+            },
+            "delete": {
                 "security": [
                     {
                         "BasicAuth": []
+                    },
+                    {
+                        "BearerAuth": []
                     }
                 ],
-                "description": "This endpoint is used to subscribe to a SSE stream for a given room.\nThe stream will send an event when a room is updated.\nA room is updated when a user connects or disconnects from it, or when we have a owner change, and so on.",
+                "description": "Deletes the room on behalf of its owner, disconnecting all of its users.\nA \"roomClosed\" event is sent to the subscribers of its stream, which is then closed.\nThe owner can restore it during the restore period, 24 hours by default.",
                 "produces": [
-                    "text/event-stream"
+                    "application/json"
                 ],
                 "tags": [
-                    "Rooms",
-                    "SSE"
+                    "Rooms"
                 ],
-                "summary": "SSE stream of a room for any updates.",
+                "summary": "Closes a room.",
                 "parameters": [
                     {
                         "type": "integer",
@@ -407,8 +551,14 @@ const docTemplate = `{
                     }
                 ],
                 "responses": {
-                    "200": {
-                        "description": "Send \\\"RoomUpdate\\\" event each time room is updated. Send 200 when stream is closed"
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "400": {
+                        "description": "Invalid request",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
                     },
                     "401": {
                         "description": "User not authorized",
@@ -417,7 +567,7 @@ const docTemplate = `{
                         }
                     },
                     "404": {
-                        "description": "Room not found or invalid user in auth method",
+                        "description": "Room not found",
                         "schema": {
                             "$ref": "#/definitions/utils.ErrorResponse"
                         }
@@ -429,11 +579,16 @@ const docTemplate = `{
                         }
                     }
                 }
-            }
-        },
-        "/users": {
-            "post": {
-                "description": "Creates a user. You will need to use BasicAuth to authenticate with the created user, using its ID and password produced by this endpoint.",
+            },
+            "patch": {
+                "security": [
+                    {
+                        "BasicAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
                 "consumes": [
                     "application/json"
                 ],
@@ -441,26 +596,36 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "Users"
+                    "Rooms"
                 ],
-                "summary": "Creates a user. Needed for further request during authentication.",
+                "summary": "Updates a room.",
                 "parameters": [
                     {
-                        "description": "User object",
-                        "name": "user",
+                        "type": "integer",
+                        "description": "Room ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag the room must still have to be updated",
+                        "name": "If-Match",
+                        "in": "header"
+                    },
+                    {
+                        "description": "Room object",
+                        "name": "room",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/models.UserUpdate"
+                            "$ref": "#/definitions/models.RoomUpdate"
                         }
                     }
                 ],
                 "responses": {
-                    "201": {
-                        "description": "User created",
-                        "schema": {
-                            "$ref": "#/definitions/utils.CreateResponse"
-                        }
+                    "204": {
+                        "description": "No Content"
                     },
                     "400": {
                         "description": "Invalid request",
@@ -468,6 +633,24 @@ const docTemplate = `{
                             "$ref": "#/definitions/utils.ErrorResponse"
                         }
                     },
+                    "401": {
+                        "description": "User not authorized",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Room not found",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "412": {
+                        "description": "Room modified since the given version",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
                     "500": {
                         "description": "Internal server error",
                         "schema": {
@@ -477,35 +660,35 @@ const docTemplate = `{
                 }
             }
         },
-        "/users/{id}": {
-            "get": {
+        "/rooms/{id}/connect": {
+            "patch": {
                 "security": [
                     {
                         "BasicAuth": []
+                    },
+                    {
+                        "BearerAuth": []
                     }
                 ],
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Users"
+                    "Rooms"
                 ],
-                "summary": "Gets a user.",
+                "summary": "Connects a user to a room.",
                 "parameters": [
                     {
                         "type": "integer",
-                        "description": "User ID",
+                        "description": "Room ID",
                         "name": "id",
                         "in": "path",
                         "required": true
                     }
                 ],
                 "responses": {
-                    "200": {
-                        "description": "OK",
-                        "schema": {
-                            "$ref": "#/definitions/models.User"
-                        }
+                    "204": {
+                        "description": "No Content"
                     },
                     "400": {
                         "description": "Invalid request",
@@ -520,27 +703,53 @@ const docTemplate = `{
                         }
                     },
                     "404": {
-                        "description": "User not found",
+                        "description": "Room not found",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "User already in room",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Too many requests",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
                         "schema": {
                             "$ref": "#/definitions/utils.ErrorResponse"
                         }
                     }
                 }
-            },
-            "delete": {
+            }
+        },
+        "/rooms/{id}/disconnect": {
+            "patch": {
                 "security": [
                     {
                         "BasicAuth": []
+                    },
+                    {
+                        "BearerAuth": []
                     }
                 ],
+                "produces": [
+                    "application/json"
+                ],
                 "tags": [
-                    "Users"
+                    "Rooms"
                 ],
-                "summary": "Deletes a user. Should be used when disconnecting a user.",
+                "summary": "Disconnects a user from a room.",
                 "parameters": [
                     {
                         "type": "integer",
-                        "description": "User ID",
+                        "description": "Room ID",
                         "name": "id",
                         "in": "path",
                         "required": true
@@ -563,7 +772,13 @@ const docTemplate = `{
                         }
                     },
                     "404": {
-                        "description": "User not found",
+                        "description": "Room not found",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Too many requests",
                         "schema": {
                             "$ref": "#/definitions/utils.ErrorResponse"
                         }
@@ -575,39 +790,103 @@ const docTemplate = `{
                         }
                     }
                 }
-            },
+            }
+        },
+        "/rooms/{id}/kick/{userid}": {
             "patch": {
                 "security": [
                     {
                         "BasicAuth": []
+                    },
+                    {
+                        "BearerAuth": []
                     }
                 ],
-                "consumes": [
-                    "application/json"
-                ],
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "Users"
+                    "Rooms"
                 ],
-                "summary": "Updates a user.",
+                "summary": "Kicks a user from a room.",
                 "parameters": [
                     {
                         "type": "integer",
-                        "description": "User ID",
+                        "description": "Room ID",
                         "name": "id",
                         "in": "path",
                         "required": true
                     },
                     {
-                        "description": "User object",
-                        "name": "user",
-                        "in": "body",
-                        "required": true,
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "userid",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "400": {
+                        "description": "Invalid request",
                         "schema": {
-                            "$ref": "#/definitions/models.UserUpdate"
+                            "$ref": "#/definitions/utils.ErrorResponse"
                         }
+                    },
+                    "401": {
+                        "description": "User not authorized",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Room not found",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Too many requests",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/rooms/{id}/restore": {
+            "post": {
+                "security": [
+                    {
+                        "BasicAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Restores a room deleted during the restore period, 24 hours by default, on behalf of its owner.\nThe owner is connected to the room again, the other users have to reconnect.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Rooms"
+                ],
+                "summary": "Restores a room.",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Room ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
                     }
                 ],
                 "responses": {
@@ -627,7 +906,7 @@ const docTemplate = `{
                         }
                     },
                     "404": {
-                        "description": "User not found",
+                        "description": "Room not found",
                         "schema": {
                             "$ref": "#/definitions/utils.ErrorResponse"
                         }
@@ -641,34 +920,1027 @@ const docTemplate = `{
                 }
             }
         },
-        "/version": {
+        "/rooms/{id}/stream": {
             "get": {
+                "security": [
+                    {
+                        "BasicAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "This endpoint is used to subscribe to a SSE stream for a given room.\nThe stream will send an event when a room is updated.\nA room is updated when a user connects or disconnects from it, or when we have a owner change, and so on.\nWhen the server shuts down, a \"serverShuttingDown\" event is sent with a retry hint before the stream is closed.\nWhen the room is closed or its last user leaves, a \"roomClosed\" event is sent before the stream is closed.\nClients unable to set the Authorization header can authenticate with a ticket from the stream ticket endpoint instead.",
                 "produces": [
-                    "text/plain"
+                    "text/event-stream"
                 ],
                 "tags": [
-                    "Misc"
+                    "Rooms",
+                    "SSE"
+                ],
+                "summary": "SSE stream of a room for any updates.",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Room ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Stream ticket",
+                        "name": "ticket",
+                        "in": "query"
+                    }
                 ],
-                "summary": "Get the api version.",
                 "responses": {
                     "200": {
-                        "description": "Version as x.x.x",
+                        "description": "Send \\\"RoomUpdate\\\" event each time room is updated. Send 200 when stream is closed"
+                    },
+                    "401": {
+                        "description": "User not authorized",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Room not found",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
                         }
                     },
                     "500": {
-                        "description": "Version has not been set correctly on the server side",
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Server shutting down",
                         "schema": {
                             "$ref": "#/definitions/utils.ErrorResponse"
                         }
                     }
                 }
             }
-        }
-    },
-    "definitions": {
-        "models.Room": {
+        },
+        "/rooms/{id}/stream/ticket": {
+            "post": {
+                "security": [
+                    {
+                        "BasicAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Returns a short-lived ticket, valid on the stream of this room only, to be given in the ticket query parameter\nof the stream endpoint by clients unable to set the Authorization header, such as browsers' EventSource.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Rooms",
+                    "SSE"
+                ],
+                "summary": "Creates a ticket to authenticate on the stream of a room.",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Room ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/utils.StreamTicketResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "User not authorized",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Room not found",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/token": {
+            "post": {
+                "security": [
+                    {
+                        "BasicAuth": []
+                    }
+                ],
+                "description": "Returns a short-lived access token, to be sent in the Authorization header with the Bearer scheme instead of the user credentials,\nand a refresh token to get a new access token once it expires.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Tokens"
+                ],
+                "summary": "Exchanges credentials for tokens.",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/utils.TokenResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "User not authorized",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Too many requests",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/token/login": {
+            "post": {
+                "description": "Returns the URI of the user, holding its ID to authenticate with BasicAuth,\nalong with an access token and a refresh token as /token does. Handles are case-insensitive.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Tokens"
+                ],
+                "summary": "Logs a registered user in with its handle and password.",
+                "parameters": [
+                    {
+                        "description": "Account",
+                        "name": "account",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.UserAccount"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/utils.TokenResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Invalid handle or password",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Too many requests",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/token/refresh": {
+            "post": {
+                "description": "Returns a new access token and a new refresh token. The given refresh token cannot be used anymore.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Tokens"
+                ],
+                "summary": "Exchanges a refresh token for new tokens.",
+                "parameters": [
+                    {
+                        "description": "Refresh token",
+                        "name": "token",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/utils.RefreshRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/utils.TokenResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Invalid refresh token",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Too many requests",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/users": {
+            "post": {
+                "description": "Creates a user. You will need to use BasicAuth to authenticate with the created user, using its ID and password produced by this endpoint.\nDisabled if the server only accepts users logging in with OIDC.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Users"
+                ],
+                "summary": "Creates a user. Needed for further request during authentication.",
+                "parameters": [
+                    {
+                        "description": "User object",
+                        "name": "user",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.UserUpdate"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "User created",
+                        "schema": {
+                            "$ref": "#/definitions/utils.CreateResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "403": {
+                        "description": "Anonymous users disabled",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Too many requests",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/users/{id}": {
+            "get": {
+                "security": [
+                    {
+                        "BasicAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Users"
+                ],
+                "summary": "Gets a user.",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag of a previously fetched version",
+                        "name": "If-None-Match",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.User"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "Version of the user"
+                            }
+                        }
+                    },
+                    "304": {
+                        "description": "User not modified since the given version"
+                    },
+                    "400": {
+                        "description": "Invalid request",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "User not authorized",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "User not found",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "BasicAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "The user leaves all of its rooms first. It can be restored by an administrator during the restore period, 24 hours by default.",
+                "tags": [
+                    "Users"
+                ],
+                "summary": "Deletes a user. Should be used when disconnecting a user.",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "400": {
+                        "description": "Invalid request",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "User not authorized",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "User not found",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "patch": {
+                "security": [
+                    {
+                        "BasicAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Users"
+                ],
+                "summary": "Updates a user.",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag the user must still have to be updated",
+                        "name": "If-Match",
+                        "in": "header"
+                    },
+                    {
+                        "description": "User object",
+                        "name": "user",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.UserUpdate"
+                        }
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "400": {
+                        "description": "Invalid request",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "User not authorized",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "User not found",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "412": {
+                        "description": "User modified since the given version",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/users/{id}/account": {
+            "put": {
+                "security": [
+                    {
+                        "BasicAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Turns an anonymous user into a registered one, or changes the handle and password of a registered user.\nThe user can then log in from any device with its handle and password to get its ID back, see /token/login.\nHandles are case-insensitive. The previous password stops working immediately and refresh tokens are revoked.",
+                "consumes": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Users"
+                ],
+                "summary": "Registers a user with a handle and a password.",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Account",
+                        "name": "account",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.UserAccount"
+                        }
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "400": {
+                        "description": "Invalid request",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "User not authorized",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Handle already taken",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/users/{id}/credentials": {
+            "post": {
+                "security": [
+                    {
+                        "BasicAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Generates a new password for the user. The previous password stops working immediately,\nand the access tokens, stream tickets and refresh tokens issued before are revoked.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Users"
+                ],
+                "summary": "Rotates the password of a user.",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "New password",
+                        "schema": {
+                            "$ref": "#/definitions/utils.CreateResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "User not authorized",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/users/{id}/erase": {
+            "post": {
+                "security": [
+                    {
+                        "BasicAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "The user leaves all of its rooms, whose names are anonymised if it owns them, then the user, its identities,\nits refresh tokens and its deleted rooms are deleted for good. Unlike a deleted user, an erased user cannot be restored.",
+                "tags": [
+                    "Users"
+                ],
+                "summary": "Erases a user and its personal data.",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "400": {
+                        "description": "Invalid request",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "User not authorized",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "User not found",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/users/{id}/export": {
+            "get": {
+                "security": [
+                    {
+                        "BasicAuth": []
+                    },
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Returns everything stored about the user: its profile, identities, memberships, owned rooms, deleted ones included,\nand refresh tokens, along with their timestamps. Credentials are left out.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Users"
+                ],
+                "summary": "Exports the personal data of a user.",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.PersonalData"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "User not authorized",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "User not found",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/version": {
+            "get": {
+                "produces": [
+                    "text/plain"
+                ],
+                "tags": [
+                    "Misc"
+                ],
+                "summary": "Get the api version.",
+                "responses": {
+                    "200": {
+                        "description": "Version as x.x.x",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Version has not been set correctly on the server side",
+                        "schema": {
+                            "$ref": "#/definitions/utils.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "models.Archive": {
+            "type": "object",
+            "properties": {
+                "exportedAt": {
+                    "type": "string"
+                },
+                "rooms": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.ArchiveRoom"
+                    }
+                },
+                "users": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.ArchiveUser"
+                    }
+                },
+                "version": {
+                    "type": "integer"
+                }
+            }
+        },
+        "models.ArchiveIdentity": {
+            "type": "object",
+            "properties": {
+                "issuer": {
+                    "type": "string"
+                },
+                "subject": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.ArchiveMapping": {
+            "type": "object",
+            "properties": {
+                "rooms": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "integer"
+                    }
+                },
+                "users": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "integer"
+                    }
+                }
+            }
+        },
+        "models.ArchiveRoom": {
+            "type": "object",
+            "properties": {
+                "createdAt": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "members": {
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    }
+                },
+                "name": {
+                    "type": "string"
+                },
+                "ownerID": {
+                    "type": "integer"
+                }
+            }
+        },
+        "models.ArchiveUser": {
+            "type": "object",
+            "properties": {
+                "createdAt": {
+                    "type": "string"
+                },
+                "handle": {
+                    "description": "Only set for registered users, always lowercase.",
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "identities": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.ArchiveIdentity"
+                    }
+                },
+                "name": {
+                    "type": "string"
+                },
+                "password": {
+                    "description": "argon2id hash of the password, see the auth package.",
+                    "type": "string"
+                }
+            }
+        },
+        "models.PersonalData": {
+            "type": "object",
+            "properties": {
+                "exportedAt": {
+                    "type": "string"
+                },
+                "identities": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.PersonalIdentity"
+                    }
+                },
+                "memberships": {
+                    "description": "Rooms the user is in.",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.PersonalRoom"
+                    }
+                },
+                "refreshTokens": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.PersonalRefreshToken"
+                    }
+                },
+                "roomsOwned": {
+                    "description": "Rooms the user owns, deleted ones included until they are purged.",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.PersonalRoom"
+                    }
+                },
+                "user": {
+                    "$ref": "#/definitions/models.PersonalUser"
+                }
+            }
+        },
+        "models.PersonalIdentity": {
+            "type": "object",
+            "properties": {
+                "createdAt": {
+                    "type": "string"
+                },
+                "issuer": {
+                    "type": "string"
+                },
+                "subject": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.PersonalRefreshToken": {
+            "type": "object",
+            "properties": {
+                "createdAt": {
+                    "type": "string"
+                },
+                "expiresAt": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.PersonalRoom": {
+            "type": "object",
+            "properties": {
+                "createdAt": {
+                    "type": "string"
+                },
+                "deletedAt": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "ownerID": {
+                    "type": "integer"
+                },
+                "updatedAt": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.PersonalUser": {
+            "type": "object",
+            "properties": {
+                "createdAt": {
+                    "type": "string"
+                },
+                "handle": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "registered": {
+                    "type": "boolean"
+                },
+                "updatedAt": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.Room": {
             "type": "object",
             "required": [
                 "name"
@@ -719,6 +1991,27 @@ const docTemplate = `{
                 }
             }
         },
+        "models.UserAccount": {
+            "type": "object",
+            "required": [
+                "handle",
+                "password"
+            ],
+            "properties": {
+                "handle": {
+                    "type": "string",
+                    "maxLength": 32,
+                    "minLength": 3,
+                    "example": "diablox9"
+                },
+                "password": {
+                    "type": "string",
+                    "maxLength": 128,
+                    "minLength": 8,
+                    "example": "correct horse battery staple"
+                }
+            }
+        },
         "models.UserUpdate": {
             "type": "object",
             "properties": {
@@ -730,6 +2023,23 @@ const docTemplate = `{
                 }
             }
         },
+        "utils.CheckResult": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "description": "Only set in verbose mode when the check failed.",
+                    "type": "string"
+                },
+                "latency": {
+                    "type": "string",
+                    "example": "1.234ms"
+                },
+                "status": {
+                    "type": "string",
+                    "example": "ok"
+                }
+            }
+        },
         "utils.CreateResponse": {
             "type": "object",
             "properties": {
@@ -747,13 +2057,110 @@ const docTemplate = `{
             "properties": {
                 "error": {
                     "type": "string"
+                },
+                "requestID": {
+                    "description": "RequestID is the ID of the request, to be given when reporting the error.",
+                    "type": "string"
+                }
+            }
+        },
+        "utils.HealthResponse": {
+            "type": "object",
+            "properties": {
+                "checks": {
+                    "description": "Only set for readiness, the result of each dependency check indexed by dependency name.",
+                    "type": "object",
+                    "additionalProperties": {
+                        "$ref": "#/definitions/utils.CheckResult"
+                    }
+                },
+                "status": {
+                    "type": "string",
+                    "example": "ok"
+                }
+            }
+        },
+        "utils.LogLevel": {
+            "type": "object",
+            "required": [
+                "level"
+            ],
+            "properties": {
+                "level": {
+                    "type": "string",
+                    "example": "debug"
+                }
+            }
+        },
+        "utils.RefreshRequest": {
+            "type": "object",
+            "required": [
+                "refreshToken"
+            ],
+            "properties": {
+                "refreshToken": {
+                    "type": "string"
+                }
+            }
+        },
+        "utils.StreamTicketResponse": {
+            "type": "object",
+            "properties": {
+                "expiresIn": {
+                    "description": "ExpiresIn is the number of seconds the ticket is valid for.",
+                    "type": "integer",
+                    "example": 60
+                },
+                "ticket": {
+                    "type": "string"
+                },
+                "uri": {
+                    "description": "URI is the URI of the stream including the ticket.",
+                    "type": "string",
+                    "example": "/rooms/1/stream?ticket=xxx"
+                }
+            }
+        },
+        "utils.TokenResponse": {
+            "type": "object",
+            "properties": {
+                "accessToken": {
+                    "type": "string"
+                },
+                "expiresIn": {
+                    "description": "ExpiresIn is the number of seconds the access token is valid for.",
+                    "type": "integer",
+                    "example": 900
+                },
+                "refreshToken": {
+                    "type": "string"
+                },
+                "tokenType": {
+                    "type": "string",
+                    "example": "Bearer"
+                },
+                "uri": {
+                    "description": "Only set when logging in with a handle, the URI of the user.",
+                    "type": "string",
+                    "example": "/users/1"
                 }
             }
         }
     },
     "securityDefinitions": {
+        "AdminToken": {
+            "type": "apiKey",
+            "name": "X-Admin-Token",
+            "in": "header"
+        },
         "BasicAuth": {
             "type": "basic"
+        },
+        "BearerAuth": {
+            "description": "Access token obtained from /token, sent as \"Bearer \u003ctoken\u003e\".",
+            "type": "apiKey",
+            "name": "Authorization",
+            "in": "header"
         }
     }
 }`
@@ -1,10 +1,21 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"github.com/Brawdunoir/dionysos-server/database"
 	"github.com/Brawdunoir/dionysos-server/docs"
+	"github.com/Brawdunoir/dionysos-server/metrics"
+	"github.com/Brawdunoir/dionysos-server/repositories"
 	"github.com/Brawdunoir/dionysos-server/routes"
+	"github.com/Brawdunoir/dionysos-server/tracing"
 	"github.com/Brawdunoir/dionysos-server/utils"
 	l "github.com/Brawdunoir/dionysos-server/utils/logger"
 	"github.com/Brawdunoir/dionysos-server/variables"
@@ -17,6 +28,13 @@ const VERSION = "0.4.0"
 // @title           Dionysos
 // @description     API instance for the Dionysos client application.
 // @securityDefinitions.basic BasicAuth
+// @securityDefinitions.apikey BearerAuth
+// @in header
+// @name Authorization
+// @description Access token obtained from /token, sent as "Bearer <token>".
+// @securityDefinitions.apikey AdminToken
+// @in header
+// @name X-Admin-Token
 
 // @contact.name   API Support
 // @contact.url    https://github.com/Brawdunoir/dionysos-server/issues
@@ -24,10 +42,45 @@ const VERSION = "0.4.0"
 // @license.name  GNU General Public License v3.0
 // @license.url   https://www.gnu.org/licenses/gpl-3.0.html
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		err := runMigrate(os.Args[2:], os.Stdout)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	utils.InitAPI()
 
+	shutdownTimeout, err := time.ParseDuration(variables.ShutdownTimeout)
+	if err != nil {
+		l.Logger.Fatal("Invalid shutdown timeout: ", err)
+	}
+	shutdownDelay, err := time.ParseDuration(variables.ShutdownDelay)
+	if err != nil {
+		l.Logger.Fatal("Invalid shutdown delay: ", err)
+	}
+	reconnectDelay, err := time.ParseDuration(variables.ReconnectDelay)
+	if err != nil {
+		l.Logger.Fatal("Invalid reconnect delay: ", err)
+	}
+	deletedRetention, err := time.ParseDuration(variables.DeletedRetention)
+	if err != nil {
+		l.Logger.Fatal("Invalid deleted retention: ", err)
+	}
+	purgeInterval, err := time.ParseDuration(variables.PurgeInterval)
+	if err != nil || purgeInterval <= 0 {
+		l.Logger.Fatal("Invalid purge interval: ", variables.PurgeInterval)
+	}
+	// Deleted rooms and users must not be purged while they can still be restored.
+	restorePeriod, err := time.ParseDuration(variables.RestorePeriod)
+	if err == nil && deletedRetention < restorePeriod {
+		l.Logger.Fatalf("Deleted retention %s is shorter than restore period %s", deletedRetention, restorePeriod)
+	}
+
 	// Gin initialization.
-	router := routes.SetupRouter(gin.New())
+	repos := repositories.NewGorm(database.GetDB())
+	router := routes.SetupRouter(gin.New(), repos)
 
 	// Set VERSION in environment.
 	os.Setenv("VERSION", VERSION)
@@ -35,10 +88,72 @@ func main() {
 	docs.SwaggerInfo.Version = VERSION
 	docs.SwaggerInfo.BasePath = variables.BasePath
 
-	// Start the server.
-	l.Logger.Infof("Starting server on port %s", variables.Port)
-	err := router.Run(":" + variables.Port)
+	servers := []*http.Server{{
+		Addr:              variables.Host + ":" + variables.Port,
+		Handler:           router,
+		ReadHeaderTimeout: 10 * time.Second,
+	}}
+	if variables.MetricsPort != "" {
+		servers = append(servers, &http.Server{
+			Addr:              variables.Host + ":" + variables.MetricsPort,
+			Handler:           metrics.Handler(),
+			ReadHeaderTimeout: 10 * time.Second,
+		})
+	}
+
+	// Start the servers.
+	for _, server := range servers {
+		go serve(server)
+	}
+
+	// Wait for an interrupt or termination signal. A second signal kills the server right away.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go purge(ctx, repos, deletedRetention, purgeInterval)
+	<-ctx.Done()
+	stop()
+
+	shutdown(servers, shutdownDelay, shutdownTimeout, reconnectDelay)
+}
+
+// serve starts listening with the given server until it is shut down.
+func serve(server *http.Server) {
+	l.Logger.Infof("Starting server on %s", server.Addr)
+	err := server.ListenAndServe()
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		l.Logger.Fatal("Failed to start server: ", err)
+	}
+}
+
+// shutdown gracefully stops the servers.
+// SSE streams are closed first since they would otherwise keep their connection busy until the timeout,
+// and the servers keep on serving requests during delay while reporting themselves as not ready.
+// In-flight requests are then given up to timeout to complete before the database connection is closed.
+func shutdown(servers []*http.Server, delay, timeout, reconnectDelay time.Duration) {
+	l.Logger.Infof("Shutting down server in %s, draining connections for up to %s", delay, timeout)
+	routes.Drain(reconnectDelay)
+	time.Sleep(delay)
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	for _, server := range servers {
+		err := server.Shutdown(ctx)
+		if err != nil {
+			l.Logger.Errorf("Failed to drain all connections of server on %s: %v", server.Addr, err)
+		}
+	}
+
+	err := database.Close()
 	if err != nil {
-		panic(err)
+		l.Logger.Errorf("Failed to close database connection: %v", err)
 	}
+
+	err = tracing.Shutdown(ctx)
+	if err != nil {
+		l.Logger.Errorf("Failed to flush traces: %v", err)
+	}
+
+	l.Logger.Info("Server stopped")
+	//nolint:errcheck
+	l.Logger.Sync()
 }
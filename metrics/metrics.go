@@ -0,0 +1,115 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "dionysos"
+
+// registry holds all the collectors exposed by Handler.
+var registry = prometheus.NewRegistry()
+
+var factory = promauto.With(registry)
+
+// HTTPRequestDuration observes the duration of HTTP requests by method, gin route template and status code.
+var HTTPRequestDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: namespace,
+	Name:      "http_request_duration_seconds",
+	Help:      "Duration of HTTP requests by method, route and status code.",
+	Buckets:   prometheus.DefBuckets,
+}, []string{"method", "route", "status"})
+
+// SSESubscribers counts the clients currently subscribed to the stream of a room.
+var SSESubscribers = factory.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: namespace,
+	Name:      "sse_subscribers",
+	Help:      "Number of clients currently subscribed to the stream of a room.",
+}, []string{"room"})
+
+// EventsDistributed counts the SSE events sent to clients, by event type.
+var EventsDistributed = factory.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "events_distributed_total",
+	Help:      "Number of SSE events sent to clients, by event type.",
+}, []string{"event"})
+
+// EventsDropped counts the SSE events that could not be sent to a client lagging behind, by event type.
+var EventsDropped = factory.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "events_dropped_total",
+	Help:      "Number of SSE events dropped for clients lagging behind, by event type.",
+}, []string{"event"})
+
+// RoomsCreated counts the rooms created.
+var RoomsCreated = factory.NewCounter(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "rooms_created_total",
+	Help:      "Number of rooms created.",
+})
+
+// RoomsDeleted counts the rooms deleted.
+var RoomsDeleted = factory.NewCounter(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "rooms_deleted_total",
+	Help:      "Number of rooms deleted.",
+})
+
+// UsersCreated counts the users created.
+var UsersCreated = factory.NewCounter(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "users_created_total",
+	Help:      "Number of users created.",
+})
+
+// UsersDeleted counts the users deleted.
+var UsersDeleted = factory.NewCounter(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "users_deleted_total",
+	Help:      "Number of users deleted.",
+})
+
+// CacheHits counts the requests served from the response cache.
+var CacheHits = factory.NewCounter(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "cache_hits_total",
+	Help:      "Number of requests served from the response cache.",
+})
+
+// CacheMisses counts the cacheable requests that were not found in the response cache.
+var CacheMisses = factory.NewCounter(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "cache_misses_total",
+	Help:      "Number of cacheable requests not found in the response cache.",
+})
+
+// RateLimited counts the requests rejected for exceeding a rate limit, by policy.
+var RateLimited = factory.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "rate_limited_total",
+	Help:      "Number of requests rejected for exceeding a rate limit, by policy.",
+}, []string{"policy"})
+
+// DBQueryDuration observes the duration of database queries by operation and table.
+var DBQueryDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: namespace,
+	Name:      "db_query_duration_seconds",
+	Help:      "Duration of database queries by operation and table.",
+	Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+}, []string{"operation", "table"})
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// Handler returns the HTTP handler exposing the metrics in the Prometheus format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
@@ -0,0 +1,29 @@
+package middlewares
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"net/http"
+
+	e "github.com/Brawdunoir/dionysos-server/utils/errors"
+	"github.com/gin-gonic/gin"
+)
+
+// AdminTokenHeader is the header carrying the admin token.
+const AdminTokenHeader = "X-Admin-Token"
+
+// AdminAuthentication only lets through requests carrying the given admin token in the X-Admin-Token header.
+func AdminAuthentication(token string) gin.HandlerFunc {
+	expectedTokenHash := sha256.Sum256([]byte(token))
+
+	return func(c *gin.Context) {
+		tokenHash := sha256.Sum256([]byte(c.GetHeader(AdminTokenHeader)))
+
+		// Use the subtle.ConstantTimeCompare() function to avoid leaking information.
+		if token == "" || subtle.ConstantTimeCompare(tokenHash[:], expectedTokenHash[:]) != 1 {
+			c.AbortWithError(http.StatusUnauthorized, e.UserNotAuthorized{}).SetMeta("AdminAuthentication")
+			return
+		}
+		c.Next()
+	}
+}
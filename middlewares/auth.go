@@ -2,55 +2,192 @@ package middlewares
 
 import (
 	"context"
-	"crypto/sha256"
-	"crypto/subtle"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/Brawdunoir/dionysos-server/auth"
 	"github.com/Brawdunoir/dionysos-server/models"
+	"github.com/Brawdunoir/dionysos-server/repositories"
+	"github.com/Brawdunoir/dionysos-server/tracing"
 	e "github.com/Brawdunoir/dionysos-server/utils/errors"
+	l "github.com/Brawdunoir/dionysos-server/utils/logger"
+	routes "github.com/Brawdunoir/dionysos-server/utils/routes"
 	"github.com/Brawdunoir/dionysos-server/variables"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
-	"gorm.io/gorm"
 )
 
-// Middleware to authenticate users.
+// Middleware to authenticate users, either with their ID and password or with an access token.
 // It also places the user in the context for later use.
-func Authentication(db *gorm.DB, logger *zap.SugaredLogger) gin.HandlerFunc {
+// Successful password verifications are remembered by passwords to spare the KDF on subsequent requests.
+// Users and clients failing to give the right password too many times are locked out by guard.
+// Users authenticated by access token are looked up as well, so that the tokens of deleted users, and the ones
+// issued before their password was rotated, are rejected by every instance, even one that has restarted since.
+func Authentication(users repositories.UserRepository, passwords *auth.PasswordCache, guard *auth.Guard, tokens *auth.Tokens, logger *zap.SugaredLogger) gin.HandlerFunc {
+	return authentication(users, passwords, guard, tokens)
+}
+
+// BasicAuthentication is the same as Authentication but only accepts users' ID and password.
+func BasicAuthentication(users repositories.UserRepository, passwords *auth.PasswordCache, guard *auth.Guard, logger *zap.SugaredLogger) gin.HandlerFunc {
+	return authentication(users, passwords, guard, nil)
+}
+
+// StreamAuthentication authenticates users on the stream of a room with a ticket given in the ticket query parameter,
+// for clients such as browsers' EventSource that cannot set the Authorization header. The ticket must have been issued
+// for the room in the path. Requests without ticket are handed to authenticate.
+func StreamAuthentication(users repositories.UserRepository, tokens *auth.Tokens, authenticate gin.HandlerFunc) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		ctx, cancelCtx := context.WithTimeout(c, 1000*time.Millisecond)
+		ticket, ok := c.GetQuery("ticket")
+		if !ok {
+			authenticate(c)
+			return
+		}
+
+		ctx, span := tracing.Start(c, "StreamAuthentication")
+		defer span.End()
+		ctx, cancelCtx := context.WithTimeout(ctx, 1000*time.Millisecond)
 		defer cancelCtx()
-		// Extract the id and password from the request Authorization header.
-		id, password, ok := c.Request.BasicAuth()
-		if ok {
-			// Get user from database.
-			var user models.User
-			err := db.WithContext(ctx).First(&user, id).Error
 
+		roomID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			c.Error(err).SetMeta("StreamAuthentication.ParseUint")
+			c.AbortWithError(http.StatusBadRequest, e.InvalidID{}).SetMeta("StreamAuthentication.ParseUint")
+			return
+		}
+
+		userID, generation, err := tokens.VerifyStreamTicket(ticket, roomID)
+		if err != nil {
+			c.Error(err).SetMeta("StreamAuthentication.VerifyStreamTicket")
+			c.AbortWithError(http.StatusUnauthorized, e.UserNotAuthorized{}).SetMeta("StreamAuthentication.VerifyStreamTicket")
+			return
+		}
+
+		user, err := tokenUser(ctx, users, userID, generation)
+		if err != nil {
+			c.Error(err).SetMeta("StreamAuthentication.tokenUser")
+			c.AbortWithError(http.StatusUnauthorized, e.UserNotAuthorized{}).SetMeta("StreamAuthentication.tokenUser")
+			return
+		}
+		c.Set(variables.USER_CONTEXT_KEY, user)
+		l.AddFields(c, "userID", user.ID)
+		span.End()
+		c.Next()
+	}
+}
+
+// authentication authenticates users with their ID and password, or with an access token if tokens is not nil.
+func authentication(users repositories.UserRepository, passwords *auth.PasswordCache, guard *auth.Guard, tokens *auth.Tokens) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, span := tracing.Start(c, "Authentication")
+		defer span.End()
+		ctx, cancelCtx := context.WithTimeout(ctx, 1000*time.Millisecond)
+		defer cancelCtx()
+
+		// Verify the access token of the Authorization header, if any.
+		if token, ok := bearerToken(c); ok && tokens != nil {
+			userID, generation, err := tokens.Verify(token)
+			var user models.User
+			if err == nil {
+				user, err = tokenUser(ctx, users, userID, generation)
+			}
 			if err != nil {
-				c.Error(err).SetMeta("Authentication.First")
-				c.AbortWithError(http.StatusNotFound, e.UserNotFound{}).SetMeta("Authentication.First")
+				c.Error(err).SetMeta("Authentication.Verify")
+				c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+				c.AbortWithError(http.StatusUnauthorized, e.UserNotAuthorized{}).SetMeta("Authentication.Verify")
 				return
 			}
-			// Calculate SHA-256 hashes for the provided and expected passwords.
-			passwordHash := sha256.Sum256([]byte(password))
-			expectedPasswordHash := sha256.Sum256([]byte(user.Password))
+			c.Set(variables.USER_CONTEXT_KEY, user)
+			l.AddFields(c, "userID", user.ID)
+			span.End()
+			c.Next()
+			return
+		}
 
-			// Use the subtle.ConstantTimeCompare() function to avoid leaking information.
-			passwordMatch := (subtle.ConstantTimeCompare(passwordHash[:], expectedPasswordHash[:]) == 1)
+		// Extract the id and password from the request Authorization header.
+		id, password, ok := c.Request.BasicAuth()
+		if ok {
+			account := "user:" + id
+			if err := routes.AssertNotLockedOut(c, guard, account); err != nil {
+				return
+			}
 
-			if passwordMatch || variables.Environment == variables.ENVIRONMENT_DEVELOPMENT {
+			user, passwordMatch := verifyCredentials(ctx, c, users, passwords, id, password)
+			if passwordMatch {
+				guard.Succeed(account)
 				c.Set(variables.USER_CONTEXT_KEY, user)
+				l.AddFields(c, "userID", user.ID)
+				span.End()
 				c.Next()
 				return
 			}
+			routes.RecordAuthenticationFailure(c, guard, account)
 		}
 
-		// If the Authentication header is not present, is invalid, or thepassword is wrong, then
+		// If the Authentication header is not present, is invalid, or the password is wrong, then
 		// set a WWW-Authenticate header to inform the client that we expect them
 		// to use basic authentication and send a 401 Unauthorized response.
 		c.Header("WWW-Authenticate", `Basic id:password charset="UTF-8"`)
+		if tokens != nil {
+			c.Writer.Header().Add("WWW-Authenticate", "Bearer")
+		}
 		c.AbortWithError(http.StatusUnauthorized, e.UserNotAuthorized{}).SetMeta("Authentication")
 	}
 }
+
+// tokenUser returns the user a token has been issued for, provided it has not been deleted
+// nor has its token generation been incremented since, e.g. by rotating its password.
+func tokenUser(ctx context.Context, users repositories.UserRepository, userID, generation uint64) (models.User, error) {
+	user, err := users.Get(ctx, userID)
+	if err == nil && user.TokenGeneration != generation {
+		err = auth.ErrInvalidToken
+	}
+	return user, err
+}
+
+// verifyCredentials returns the user with the given ID and whether the password matches.
+// Unknown users take as long to verify as existing ones, so that clients cannot tell them apart.
+func verifyCredentials(ctx context.Context, c *gin.Context, users repositories.UserRepository, passwords *auth.PasswordCache, id, password string) (models.User, bool) {
+	var user models.User
+
+	userID, err := strconv.ParseUint(id, 10, 64)
+	if err == nil {
+		user, err = users.Get(ctx, userID)
+	}
+	if err != nil {
+		c.Error(err).SetMeta("Authentication.Get")
+		auth.VerifyUnknownUser(password)
+		return user, false
+	}
+
+	passwordMatch, err := passwords.Verify(user.ID, password, user.Password)
+	if err != nil {
+		c.Error(err).SetMeta("Authentication.Verify")
+	}
+	if passwordMatch && auth.NeedsRehash(user.Password) {
+		rehashPassword(ctx, users, &user, password)
+	}
+	return user, passwordMatch
+}
+
+// bearerToken extracts the token from an Authorization header using the Bearer scheme.
+func bearerToken(c *gin.Context) (string, bool) {
+	scheme, token, found := strings.Cut(c.GetHeader("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	return token, true
+}
+
+// rehashPassword replaces the stored password of a user, either plaintext or hashed with outdated parameters,
+// by a fresh hash. Failing to do so does not prevent the user from authenticating.
+func rehashPassword(ctx context.Context, users repositories.UserRepository, user *models.User, password string) {
+	hash, err := auth.HashPassword(password)
+	if err == nil {
+		err = users.SetPassword(ctx, user.ID, hash)
+	}
+	if err != nil {
+		l.FromContext(ctx).Warnf("Failed to rehash password of user %v: %v", user.ID, err)
+	}
+}
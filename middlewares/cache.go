@@ -1,25 +1,147 @@
 package middlewares
 
 import (
+	"errors"
+	"time"
+
+	"github.com/Brawdunoir/dionysos-server/metrics"
+	"github.com/Brawdunoir/dionysos-server/tracing"
+	l "github.com/Brawdunoir/dionysos-server/utils/logger"
+	"github.com/Brawdunoir/dionysos-server/variables"
+	cache "github.com/chenyahui/gin-cache"
 	"github.com/chenyahui/gin-cache/persist"
 	"github.com/gin-gonic/gin"
-	"go.uber.org/zap"
+	"go.opentelemetry.io/otel/attribute"
 )
 
-// Invalidate cache for a given URI.
-func InvalidateCacheURI(cacheStore persist.CacheStore, logger *zap.SugaredLogger) gin.HandlerFunc {
+const cacheHitContextKey = "cacheHit"
+
+// CacheByRequestURI caches successful responses by request URI for the given duration.
+// Responses are tagged by the handler with the entities they contain, see utils.TagCache,
+// and are dropped as soon as one of these tags is invalidated by InvalidateCacheTags.
+// Cache hits and misses are counted in metrics and traced, the span including the handler on a miss.
+// Conditional requests bypass the cache.
+func CacheByRequestURI(cacheStore persist.CacheStore, expire time.Duration) gin.HandlerFunc {
+	handler := cache.Cache(cacheStore, expire,
+		cache.WithCacheStrategyByRequest(func(c *gin.Context) (bool, cache.Strategy) {
+			return true, cache.Strategy{
+				CacheKey:   c.Request.RequestURI,
+				CacheStore: &taggedCacheStore{store: cacheStore, c: c, start: time.Now().UnixNano()},
+			}
+		}),
+		cache.WithOnHitCache(func(c *gin.Context) {
+			c.Set(cacheHitContextKey, true)
+		}))
+
 	return func(c *gin.Context) {
-		key := c.Request.RequestURI
+		// Conditional requests revalidate against the stored resource, as a cached response may be stale.
+		if c.GetHeader("If-None-Match") != "" {
+			c.Next()
+			return
+		}
+
+		_, span := tracing.Start(c, "Cache")
+		defer span.End()
+
+		handler(c)
+
+		span.SetAttributes(attribute.Bool("cache.hit", c.GetBool(cacheHitContextKey)))
+		if c.GetBool(cacheHitContextKey) {
+			metrics.CacheHits.Inc()
+		} else {
+			metrics.CacheMisses.Inc()
+		}
+	}
+}
+
+// InvalidateCacheTags invalidates the cache tags of successful requests, dropping every cached response tagged with one of them.
+// The expire duration must be at least the one of the cached responses.
+func InvalidateCacheTags(cacheStore persist.CacheStore, expire time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
 
-		// Get the response code.
 		code := c.Writer.Status()
-		if code >= 200 && code < 300 && cacheStore != nil {
-			err := cacheStore.Delete(key)
-			if err != nil {
-				logger.Errorf("Failed to invalidate cache with key '%s': %v", key, err)
+		if code < 200 || code >= 300 || cacheStore == nil {
+			return
+		}
+
+		now := time.Now().UnixNano()
+		for _, tag := range c.GetStringSlice(variables.CACHE_TAGS_CONTEXT_KEY) {
+			if err := cacheStore.Set(tagKey(tag), now, expire); err != nil {
+				l.FromContext(c).Errorf("Failed to invalidate cache tag '%s': %v", tag, err)
 			} else {
-				logger.Debugln("Cache deleted for key", key)
+				l.FromContext(c).Debugln("Cache invalidated for tag", tag)
 			}
 		}
 	}
 }
+
+// taggedResponse is a cached response along with its tags.
+type taggedResponse struct {
+	Response *cache.ResponseCache
+	Tags     []string
+
+	// Start is the time the handler started at, in nanoseconds.
+	// The response is stale if one of its tags was invalidated since.
+	Start int64
+}
+
+// taggedCacheStore stores the responses of a request along with the cache tags set by its handler.
+// A tag is invalidated by storing the time of the invalidation, which works with any store without
+// read-modify-write cycles, at the cost of trusting the clocks of the instances sharing the store.
+type taggedCacheStore struct {
+	store persist.CacheStore
+	c     *gin.Context
+	start int64
+}
+
+// Get retrieves a response, returning persist.ErrCacheMiss if one of its tags was invalidated after it was generated.
+func (s *taggedCacheStore) Get(key string, value interface{}) error {
+	response, ok := value.(**cache.ResponseCache)
+	if !ok {
+		return errors.New("tagged cache store only holds responses")
+	}
+
+	var entry *taggedResponse
+	if err := s.store.Get(key, &entry); err != nil {
+		return err
+	}
+
+	for _, tag := range entry.Tags {
+		var invalidatedAt int64
+		err := s.store.Get(tagKey(tag), &invalidatedAt)
+		if err == nil && invalidatedAt >= entry.Start {
+			return persist.ErrCacheMiss
+		}
+		if err != nil && !errors.Is(err, persist.ErrCacheMiss) {
+			return err
+		}
+	}
+
+	*response = entry.Response
+	return nil
+}
+
+// Set stores a response along with the cache tags of the request.
+func (s *taggedCacheStore) Set(key string, value interface{}, expire time.Duration) error {
+	response, ok := value.(*cache.ResponseCache)
+	if !ok {
+		return errors.New("tagged cache store only holds responses")
+	}
+
+	return s.store.Set(key, &taggedResponse{
+		Response: response,
+		Tags:     s.c.GetStringSlice(variables.CACHE_TAGS_CONTEXT_KEY),
+		Start:    s.start,
+	}, expire)
+}
+
+// Delete removes a response.
+func (s *taggedCacheStore) Delete(key string) error {
+	return s.store.Delete(key)
+}
+
+// tagKey returns the key storing the time a cache tag was last invalidated at.
+func tagKey(tag string) string {
+	return "tag:" + tag
+}
@@ -0,0 +1,67 @@
+package middlewares
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/Brawdunoir/dionysos-server/repositories"
+	"github.com/Brawdunoir/dionysos-server/tracing"
+	e "github.com/Brawdunoir/dionysos-server/utils/errors"
+	l "github.com/Brawdunoir/dionysos-server/utils/logger"
+	"github.com/Brawdunoir/dionysos-server/variables"
+	"github.com/gin-gonic/gin"
+)
+
+// DebugUserHeader is the header carrying the ID of the user to authenticate as when the debug identity is enabled.
+const DebugUserHeader = "X-Debug-User"
+
+// DebugIdentityAllowed returns an error if the debug identity cannot be enabled in the given environment
+// with the server listening on host: it is never allowed in production nor on a host other than a loopback address.
+func DebugIdentityAllowed(environment, host string) error {
+	if environment == variables.ENVIRONMENT_PRODUCTION {
+		return errors.New("debug identity is not allowed in production")
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return errors.New("debug identity is only allowed when the server listens on a loopback address, set HOST to 127.0.0.1 or localhost")
+	}
+	return nil
+}
+
+// DebugAuthentication authenticates requests carrying the X-Debug-User header as the user with the given ID,
+// without checking any credentials, to ease local development and manual testing.
+// Requests without this header are handed to authenticate.
+// It must only be used once DebugIdentityAllowed agreed, and still ignores the header in production.
+func DebugAuthentication(users repositories.UserRepository, authenticate gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(DebugUserHeader)
+		if id == "" || variables.Environment == variables.ENVIRONMENT_PRODUCTION {
+			authenticate(c)
+			return
+		}
+
+		ctx, span := tracing.Start(c, "DebugAuthentication")
+		defer span.End()
+
+		userID, err := strconv.ParseUint(id, 10, 64)
+		if err != nil {
+			c.Error(err).SetMeta("DebugAuthentication.ParseUint")
+			c.AbortWithError(http.StatusUnauthorized, e.UserNotAuthorized{}).SetMeta("DebugAuthentication.ParseUint")
+			return
+		}
+
+		user, err := users.Get(ctx, userID)
+		if err != nil {
+			c.Error(err).SetMeta("DebugAuthentication.Get")
+			c.AbortWithError(http.StatusUnauthorized, e.UserNotAuthorized{}).SetMeta("DebugAuthentication.Get")
+			return
+		}
+
+		l.FromContext(c).Warnf("Request authenticated as user %v with the %s header", user.ID, DebugUserHeader)
+		c.Set(variables.USER_CONTEXT_KEY, user)
+		l.AddFields(c, "userID", user.ID, "debugIdentity", true)
+		span.End()
+		c.Next()
+	}
+}
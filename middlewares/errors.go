@@ -4,22 +4,29 @@ import (
 	"strings"
 
 	utils "github.com/Brawdunoir/dionysos-server/utils/routes"
+	"github.com/Brawdunoir/dionysos-server/variables"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 )
 
+// ErrorHandler logs the errors of a request with the request-scoped logger, falling back to the given one,
+// and responds with the last error and the request ID.
 func ErrorHandler(logger *zap.SugaredLogger) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Next()
 		if len(c.Errors) > 0 {
+			requestLogger, ok := c.Value(variables.LOGGER_CONTEXT_KEY).(*zap.SugaredLogger)
+			if !ok {
+				requestLogger = logger
+			}
 
 			for _, ginErr := range c.Errors {
-				logger.With("Context", ginErr.Meta).Error(ginErr.Error())
+				requestLogger.With("Context", ginErr.Meta).Error(ginErr.Error())
 			}
 
 			// status -1 doesn't overwrite existing status code
 			lastErr := c.Errors[len(c.Errors)-1].Error()
-			c.JSON(-1, utils.CreateErrorResponse(strings.ToUpper(lastErr[0:1])+lastErr[1:]))
+			c.JSON(-1, utils.CreateErrorResponse(c, strings.ToUpper(lastErr[0:1])+lastErr[1:]))
 		}
 	}
 }
@@ -0,0 +1,23 @@
+package middlewares
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/Brawdunoir/dionysos-server/metrics"
+	"github.com/gin-gonic/gin"
+)
+
+// Metrics observes the duration of every request, labelled by method, gin route template and status code.
+func Metrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		metrics.HTTPRequestDuration.WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).Observe(time.Since(start).Seconds())
+	}
+}
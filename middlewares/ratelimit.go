@@ -0,0 +1,272 @@
+package middlewares
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Brawdunoir/dionysos-server/metrics"
+	e "github.com/Brawdunoir/dionysos-server/utils/errors"
+	l "github.com/Brawdunoir/dionysos-server/utils/logger"
+	routes "github.com/Brawdunoir/dionysos-server/utils/routes"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+)
+
+// maxRateLimitBuckets bounds the memory used by a MemoryRateLimitStore: beyond it, the least recently used buckets are dropped.
+const maxRateLimitBuckets = 100000
+
+// RateLimitPolicy is a token bucket holding up to Limit requests, refilled at the rate of Limit requests per Period.
+// Clients can then send Limit requests at once, and Limit requests per Period on average.
+type RateLimitPolicy struct {
+	// Name distinguishes the buckets of different policies for the same client.
+	Name   string
+	Limit  int
+	Period time.Duration
+}
+
+// ParseRateLimitPolicy parses a policy written as limit/period, e.g. 60/1m for 60 requests per minute.
+// It returns nil if value is empty, meaning requests are not limited.
+func ParseRateLimitPolicy(name, value string) (*RateLimitPolicy, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	limit, period, found := strings.Cut(value, "/")
+	if !found {
+		return nil, fmt.Errorf("rate limit must be written as limit/period: %s", value)
+	}
+	p := RateLimitPolicy{Name: name}
+	var err error
+	if p.Limit, err = strconv.Atoi(limit); err != nil || p.Limit < 1 {
+		return nil, fmt.Errorf("invalid rate limit: %s", value)
+	}
+	if p.Period, err = time.ParseDuration(period); err != nil || p.Period <= 0 {
+		return nil, fmt.Errorf("invalid rate limit period: %s", value)
+	}
+	return &p, nil
+}
+
+// rate returns the number of tokens added to the bucket per second.
+func (p *RateLimitPolicy) rate() float64 {
+	return float64(p.Limit) / p.Period.Seconds()
+}
+
+// refill returns the tokens in a bucket holding tokens after elapsed.
+func (p *RateLimitPolicy) refill(tokens float64, elapsed time.Duration) float64 {
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	return math.Min(float64(p.Limit), tokens+elapsed.Seconds()*p.rate())
+}
+
+// result returns the outcome of taking a token from a bucket holding tokens once refilled.
+func (p *RateLimitPolicy) result(tokens float64) RateLimitResult {
+	r := RateLimitResult{Allowed: tokens >= 1}
+	if r.Allowed {
+		tokens--
+	} else {
+		r.RetryAfter = time.Duration((1 - tokens) / p.rate() * float64(time.Second))
+	}
+	r.Remaining = int(tokens)
+	r.Reset = time.Duration((float64(p.Limit) - tokens) / p.rate() * float64(time.Second))
+	return r
+}
+
+// RateLimitResult is the outcome of a request against a RateLimitPolicy.
+type RateLimitResult struct {
+	Allowed bool
+	// Remaining is the number of requests that can still be sent right away.
+	Remaining int
+	// RetryAfter is the time to wait before the next request is allowed, if it is not.
+	RetryAfter time.Duration
+	// Reset is the time after which the bucket is full again.
+	Reset time.Duration
+}
+
+// RateLimitStore keeps the token buckets of the clients.
+type RateLimitStore interface {
+	// Take takes a token from the bucket of a client, following the given policy.
+	Take(ctx context.Context, key string, policy *RateLimitPolicy) (RateLimitResult, error)
+}
+
+// RateLimitKey identifies the client a request comes from.
+type RateLimitKey func(c *gin.Context) string
+
+// ByIP identifies clients by their IP address. It is meant for public routes.
+func ByIP(c *gin.Context) string {
+	return "ip:" + c.ClientIP()
+}
+
+// ByUser identifies clients by the ID of the authenticated user, or by their IP address if they are not authenticated.
+// It is meant for routes requiring authentication.
+func ByUser(c *gin.Context) string {
+	user, err := routes.ExtractUserFromContext(c)
+	if err != nil {
+		return ByIP(c)
+	}
+	return "user:" + strconv.FormatUint(user.ID, 10)
+}
+
+// RateLimit limits the requests of each client, identified by key, following the given policy.
+// Requests over the limit are answered with 429 Too Many Requests and a Retry-After header.
+// RateLimit headers tell clients where they stand. Requests are not limited if policy is nil,
+// nor if the store fails, to keep the API available.
+func RateLimit(store RateLimitStore, policy *RateLimitPolicy, key RateLimitKey) gin.HandlerFunc {
+	if policy == nil {
+		return func(c *gin.Context) {
+			c.Next()
+		}
+	}
+
+	return func(c *gin.Context) {
+		res, err := store.Take(c, "ratelimit:"+policy.Name+":"+key(c), policy)
+		if err != nil {
+			l.FromContext(c).Errorf("Failed to apply rate limit %s: %v", policy.Name, err)
+			c.Next()
+			return
+		}
+
+		c.Header("RateLimit-Limit", strconv.Itoa(policy.Limit))
+		c.Header("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		c.Header("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.Reset)))
+		c.Header("RateLimit-Policy", fmt.Sprintf("%d;w=%d", policy.Limit, ceilSeconds(policy.Period)))
+
+		if !res.Allowed {
+			metrics.RateLimited.WithLabelValues(policy.Name).Inc()
+			c.Header("Retry-After", strconv.Itoa(ceilSeconds(res.RetryAfter)))
+			c.AbortWithError(http.StatusTooManyRequests, e.TooManyRequests{}).SetMeta("RateLimit." + policy.Name)
+			return
+		}
+		c.Next()
+	}
+}
+
+// ceilSeconds returns d in seconds, rounded up.
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// MemoryRateLimitStore keeps token buckets in memory, so that limits apply per server instance.
+// It is safe for concurrent use.
+type MemoryRateLimitStore struct {
+	mu         sync.Mutex
+	buckets    map[string]*list.Element
+	recent     *list.List // Buckets from the most to the least recently used.
+	maxBuckets int
+	now        func() time.Time
+}
+
+type rateLimitBucket struct {
+	key     string
+	tokens  float64
+	updated time.Time
+	full    time.Time
+}
+
+// NewMemoryRateLimitStore returns an empty MemoryRateLimitStore.
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{
+		buckets:    make(map[string]*list.Element),
+		recent:     list.New(),
+		maxBuckets: maxRateLimitBuckets,
+		now:        time.Now,
+	}
+}
+
+// Take takes a token from the bucket of a client, following the given policy.
+func (s *MemoryRateLimitStore) Take(ctx context.Context, key string, policy *RateLimitPolicy) (RateLimitResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	element, ok := s.buckets[key]
+	tokens := float64(policy.Limit)
+	if ok {
+		bucket := element.Value.(*rateLimitBucket)
+		tokens = policy.refill(bucket.tokens, now.Sub(bucket.updated))
+		s.recent.MoveToFront(element)
+	} else {
+		if len(s.buckets) >= s.maxBuckets {
+			s.prune(now)
+		}
+		element = s.recent.PushFront(&rateLimitBucket{key: key})
+		s.buckets[key] = element
+	}
+
+	res := policy.result(tokens)
+	if res.Allowed {
+		tokens--
+	}
+
+	bucket := element.Value.(*rateLimitBucket)
+	bucket.tokens, bucket.updated, bucket.full = tokens, now, now.Add(res.Reset)
+	return res, nil
+}
+
+// prune makes room for a new bucket. It removes the least recently used buckets that are full again, since they are
+// the same as no bucket, then the least recently used one if there is still no room, its client starting over with
+// a full bucket. The caller must hold the lock.
+func (s *MemoryRateLimitStore) prune(now time.Time) {
+	for element := s.recent.Back(); element != nil && !now.Before(element.Value.(*rateLimitBucket).full); element = s.recent.Back() {
+		s.remove(element)
+	}
+	if element := s.recent.Back(); element != nil && len(s.buckets) >= s.maxBuckets {
+		s.remove(element)
+	}
+}
+
+// remove removes a bucket. The caller must hold the lock.
+func (s *MemoryRateLimitStore) remove(element *list.Element) {
+	s.recent.Remove(element)
+	delete(s.buckets, element.Value.(*rateLimitBucket).key)
+}
+
+// takeScript atomically refills the bucket in KEYS[1] and takes a token from it if possible.
+// ARGV holds the limit, the rate in tokens per second and the current time in milliseconds.
+// It returns the tokens in the bucket once refilled, before any token is taken, as a string to keep decimals.
+var takeScript = redis.NewScript(`
+local limit = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local bucket = redis.call("HMGET", KEYS[1], "tokens", "updated")
+local tokens = tonumber(bucket[1]) or limit
+local updated = tonumber(bucket[2]) or now
+tokens = math.min(limit, tokens + math.max(0, now - updated) * rate / 1000)
+local left = tokens
+if left >= 1 then
+	left = left - 1
+end
+redis.call("HSET", KEYS[1], "tokens", tostring(left), "updated", now)
+redis.call("PEXPIRE", KEYS[1], math.ceil((limit - left) * 1000 / rate) + 1000)
+return tostring(tokens)
+`)
+
+// RedisRateLimitStore keeps token buckets in Redis, so that limits apply across server instances.
+type RedisRateLimitStore struct {
+	client *redis.Client
+}
+
+// NewRedisRateLimitStore returns a RedisRateLimitStore using the given client.
+func NewRedisRateLimitStore(client *redis.Client) *RedisRateLimitStore {
+	return &RedisRateLimitStore{client: client}
+}
+
+// Take takes a token from the bucket of a client, following the given policy.
+func (s *RedisRateLimitStore) Take(ctx context.Context, key string, policy *RateLimitPolicy) (RateLimitResult, error) {
+	value, err := takeScript.Run(ctx, s.client, []string{key}, policy.Limit, policy.rate(), time.Now().UnixMilli()).Text()
+	if err != nil {
+		return RateLimitResult{}, err
+	}
+	tokens, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return RateLimitResult{}, err
+	}
+	return policy.result(tokens), nil
+}
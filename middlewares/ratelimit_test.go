@@ -0,0 +1,129 @@
+package middlewares
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/assert/v2"
+)
+
+func TestParseRateLimitPolicy(t *testing.T) {
+	tests := []struct {
+		name   string
+		value  string
+		policy *RateLimitPolicy
+		valid  bool
+	}{
+		{"Disabled", "", nil, true},
+		{"Per minute", "60/1m", &RateLimitPolicy{Name: "test", Limit: 60, Period: time.Minute}, true},
+		{"Per hour", "20/1h", &RateLimitPolicy{Name: "test", Limit: 20, Period: time.Hour}, true},
+		{"Missing period", "60", nil, false},
+		{"Invalid limit", "a/1m", nil, false},
+		{"Zero limit", "0/1m", nil, false},
+		{"Invalid period", "60/minute", nil, false},
+		{"Zero period", "60/0s", nil, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			policy, err := ParseRateLimitPolicy("test", test.value)
+			assert.Equal(t, err == nil, test.valid)
+			assert.Equal(t, policy, test.policy)
+		})
+	}
+}
+
+func TestMemoryRateLimitStore(t *testing.T) {
+	now := time.Now()
+	store := NewMemoryRateLimitStore()
+	store.now = func() time.Time { return now }
+	policy := &RateLimitPolicy{Name: "test", Limit: 2, Period: time.Second}
+	ctx := context.Background()
+
+	res, err := store.Take(ctx, "client", policy)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, res, RateLimitResult{Allowed: true, Remaining: 1, Reset: 500 * time.Millisecond})
+
+	res, _ = store.Take(ctx, "client", policy)
+	assert.Equal(t, res, RateLimitResult{Allowed: true, Remaining: 0, Reset: time.Second})
+
+	// The bucket is empty.
+	res, _ = store.Take(ctx, "client", policy)
+	assert.Equal(t, res, RateLimitResult{Allowed: false, Remaining: 0, RetryAfter: 500 * time.Millisecond, Reset: time.Second})
+
+	// Other clients have their own bucket.
+	res, _ = store.Take(ctx, "other", policy)
+	assert.Equal(t, res.Allowed, true)
+
+	// A token is added every 500ms.
+	now = now.Add(500 * time.Millisecond)
+	res, _ = store.Take(ctx, "client", policy)
+	assert.Equal(t, res, RateLimitResult{Allowed: true, Remaining: 0, Reset: time.Second})
+
+	// The bucket never holds more than the limit.
+	now = now.Add(time.Hour)
+	res, _ = store.Take(ctx, "client", policy)
+	assert.Equal(t, res, RateLimitResult{Allowed: true, Remaining: 1, Reset: 500 * time.Millisecond})
+
+	// Full buckets are pruned.
+	store.prune(now.Add(time.Second))
+	assert.Equal(t, len(store.buckets), 0)
+}
+
+// TestMemoryRateLimitStoreBound tests that the least recently used buckets are dropped once the store is full.
+func TestMemoryRateLimitStoreBound(t *testing.T) {
+	now := time.Now()
+	store := NewMemoryRateLimitStore()
+	store.maxBuckets = 3
+	store.now = func() time.Time { return now }
+	policy := &RateLimitPolicy{Name: "test", Limit: 1, Period: time.Hour}
+	ctx := context.Background()
+
+	for _, key := range []string{"limited", "a", "b", "limited"} {
+		store.Take(ctx, key, policy)
+	}
+
+	// Many clients do not lift the limit of a client using its bucket, nor grow the store past its bound.
+	for i := 0; i < 10; i++ {
+		store.Take(ctx, fmt.Sprint("spray:", i), policy)
+		res, _ := store.Take(ctx, "limited", policy)
+		assert.Equal(t, res.Allowed, false)
+		assert.Equal(t, len(store.buckets), store.maxBuckets)
+		assert.Equal(t, store.recent.Len(), store.maxBuckets)
+	}
+	_, ok := store.buckets["a"]
+	assert.Equal(t, ok, false)
+}
+
+func TestRateLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/", RateLimit(NewMemoryRateLimitStore(), &RateLimitPolicy{Name: "test", Limit: 1, Period: time.Minute}, ByIP), func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+	request := func(ip string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = ip + ":1234"
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := request("192.0.2.1")
+	assert.Equal(t, w.Code, http.StatusNoContent)
+	assert.Equal(t, w.Header().Get("RateLimit-Limit"), "1")
+	assert.Equal(t, w.Header().Get("RateLimit-Remaining"), "0")
+	assert.Equal(t, w.Header().Get("RateLimit-Reset"), "60")
+	assert.Equal(t, w.Header().Get("RateLimit-Policy"), "1;w=60")
+
+	w = request("192.0.2.1")
+	assert.Equal(t, w.Code, http.StatusTooManyRequests)
+	assert.Equal(t, w.Header().Get("Retry-After"), "60")
+
+	w = request("192.0.2.2")
+	assert.Equal(t, w.Code, http.StatusNoContent)
+}
@@ -0,0 +1,95 @@
+package middlewares
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/Brawdunoir/dionysos-server/models"
+	"github.com/Brawdunoir/dionysos-server/variables"
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// RequestIDHeader is the header carrying the ID of a request, both in the request and in the response.
+const RequestIDHeader = "X-Request-ID"
+
+// requestIDPattern restricts the request IDs accepted from clients so that they can safely be logged and echoed.
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// RequestID identifies every request, reusing the ID sent by the client in the X-Request-ID header if valid.
+// The ID is returned in the X-Request-ID response header and placed in the context along with a request-scoped logger
+// carrying the request ID, the route and the trace ID.
+func RequestID(logger *zap.SugaredLogger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if !requestIDPattern.MatchString(id) {
+			id = newRequestID()
+		}
+		c.Set(variables.REQUEST_ID_CONTEXT_KEY, id)
+		c.Header(RequestIDHeader, id)
+
+		fields := []interface{}{"requestID", id, "route", c.FullPath()}
+		span := trace.SpanFromContext(c.Request.Context())
+		if span.SpanContext().HasTraceID() {
+			fields = append(fields, "traceID", span.SpanContext().TraceID().String())
+		}
+		span.SetAttributes(attribute.String("http.request_id", id))
+		c.Set(variables.LOGGER_CONTEXT_KEY, logger.With(fields...))
+
+		c.Next()
+	}
+}
+
+// AccessLog writes a structured entry for every request once handled, except for the given paths.
+func AccessLog(logger *zap.Logger, skipPaths ...string) gin.HandlerFunc {
+	skip := make(map[string]bool, len(skipPaths))
+	for _, path := range skipPaths {
+		skip[path] = true
+	}
+
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		if skip[c.Request.URL.Path] {
+			return
+		}
+
+		fields := []zap.Field{
+			zap.String("requestID", c.GetString(variables.REQUEST_ID_CONTEXT_KEY)),
+			zap.String("method", c.Request.Method),
+			zap.String("path", c.Request.URL.Path),
+			zap.String("route", c.FullPath()),
+			zap.Int("status", c.Writer.Status()),
+			zap.Duration("latency", time.Since(start)),
+			zap.String("clientIP", c.ClientIP()),
+			zap.String("userAgent", c.Request.UserAgent()),
+			zap.Int("size", c.Writer.Size()),
+		}
+		if user, ok := c.Value(variables.USER_CONTEXT_KEY).(models.User); ok {
+			fields = append(fields, zap.Uint64("userID", user.ID))
+		}
+		if room, ok := c.Value(variables.ROOM_CONTEXT_KEY).(models.Room); ok {
+			fields = append(fields, zap.Uint64("roomID", room.ID))
+		}
+		if len(c.Errors) > 0 {
+			fields = append(fields, zap.Strings("errors", c.Errors.Errors()))
+		}
+
+		logger.Info("request", fields...)
+	}
+}
+
+// newRequestID generates a random request ID.
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(b)
+}
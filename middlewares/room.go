@@ -4,18 +4,20 @@ import (
 	"net/http"
 	"strconv"
 
-	"github.com/Brawdunoir/dionysos-server/models"
+	"github.com/Brawdunoir/dionysos-server/repositories"
+	"github.com/Brawdunoir/dionysos-server/tracing"
 	e "github.com/Brawdunoir/dionysos-server/utils/errors"
+	l "github.com/Brawdunoir/dionysos-server/utils/logger"
 	"github.com/Brawdunoir/dionysos-server/variables"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
-	"gorm.io/gorm"
 )
 
-// RetrieveRoom retrieves the room from the database and adds it to the context.
-func RetrieveRoom(logger *zap.SugaredLogger, db *gorm.DB) gin.HandlerFunc {
+// RetrieveRoom retrieves the room from the repository and adds it to the context.
+func RetrieveRoom(logger *zap.SugaredLogger, rooms repositories.RoomRepository) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var room models.Room
+		ctx, span := tracing.Start(c, "RetrieveRoom")
+		defer span.End()
 
 		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
 		if err != nil {
@@ -24,13 +26,15 @@ func RetrieveRoom(logger *zap.SugaredLogger, db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		err = room.GetRoom(c, db, id)
+		room, err := rooms.Get(ctx, id)
 		if err != nil {
-			c.Error(err).SetMeta("RetrieveRoom.GetRoom")
-			c.AbortWithError(http.StatusNotFound, e.RoomNotFound{}).SetMeta("RetrieveRoom.GetRoom")
+			c.Error(err).SetMeta("RetrieveRoom.Get")
+			c.AbortWithError(http.StatusNotFound, e.RoomNotFound{}).SetMeta("RetrieveRoom.Get")
 			return
 		}
 		c.Set(variables.ROOM_CONTEXT_KEY, room)
+		l.AddFields(c, "roomID", room.ID)
+		span.End()
 		c.Next()
 	}
 }
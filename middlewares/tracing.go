@@ -0,0 +1,46 @@
+package middlewares
+
+import (
+	"github.com/Brawdunoir/dionysos-server/tracing"
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tracing starts a server span for every request, continuing the trace propagated by the client if any.
+// The span is placed in the request context so that any later span is a child of it.
+func Tracing() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := otel.GetTextMapPropagator().Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		ctx, span := tracing.Start(ctx, c.Request.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(semconv.HTTPServerAttributesFromHTTPRequest("", route, c.Request)...),
+		)
+		defer span.End()
+
+		// Stream tickets are credentials, keep them out of traces.
+		if query := c.Request.URL.Query(); query.Has("ticket") {
+			query.Set("ticket", "REDACTED")
+			target := *c.Request.URL
+			target.RawQuery = query.Encode()
+			span.SetAttributes(semconv.HTTPTargetKey.String(target.RequestURI()))
+		}
+
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttributes(semconv.HTTPAttributesFromHTTPStatusCode(status)...)
+		span.SetStatus(semconv.SpanStatusFromHTTPStatusCodeAndSpanKind(status, trace.SpanKindServer))
+		for _, ginErr := range c.Errors {
+			span.RecordError(ginErr.Err)
+		}
+	}
+}
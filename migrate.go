@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Brawdunoir/dionysos-server/database"
+	l "github.com/Brawdunoir/dionysos-server/utils/logger"
+	"github.com/Brawdunoir/dionysos-server/variables"
+)
+
+// migrateUsage describes the migrate subcommand.
+const migrateUsage = `usage: dionysos-server migrate <command>
+
+Commands:
+  up            apply all the pending migrations
+  down [n|all]  revert the last n applied migrations, 1 by default
+  status        list the migrations and whether they are applied`
+
+// runMigrate runs the migrate subcommand with the given arguments, writing its output to w.
+func runMigrate(args []string, w io.Writer) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	steps := 1
+	switch args[0] {
+	case "up", "status":
+		if len(args) > 1 {
+			return errors.New(migrateUsage)
+		}
+	case "down":
+		if len(args) > 2 {
+			return errors.New(migrateUsage)
+		}
+		if len(args) == 2 {
+			if args[1] == "all" {
+				steps = -1
+			} else if n, err := strconv.Atoi(args[1]); err == nil && n > 0 {
+				steps = n
+			} else {
+				return fmt.Errorf("invalid number of migrations to revert: %s", args[1])
+			}
+		}
+	default:
+		return errors.New(migrateUsage)
+	}
+
+	variables.LoadVariables()
+	err := l.InitLogger()
+	if err != nil {
+		log.Fatal(err)
+	}
+	//nolint:errcheck
+	defer l.Logger.Sync()
+	database.Connect()
+	//nolint:errcheck
+	defer database.Close()
+
+	switch args[0] {
+	case "up":
+		return database.MigrateUp(database.GetDB())
+	case "down":
+		return database.MigrateDown(database.GetDB(), steps)
+	default:
+		status, err := database.GetMigrationStatus(database.GetDB())
+		if err != nil {
+			return err
+		}
+		return printMigrationStatus(w, status)
+	}
+}
+
+// printMigrationStatus writes the status of the migrations as a table.
+func printMigrationStatus(w io.Writer, status []database.MigrationStatus) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "VERSION\tNAME\tAPPLIED AT")
+	for _, s := range status {
+		appliedAt := "pending"
+		if s.AppliedAt != nil {
+			appliedAt = s.AppliedAt.Format(time.RFC3339)
+		}
+		if s.Unknown {
+			appliedAt += " (unknown to this version)"
+		}
+		fmt.Fprintf(tw, "%04d\t%s\t%s\n", s.Version, s.Name, appliedAt)
+	}
+	return tw.Flush()
+}
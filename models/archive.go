@@ -0,0 +1,113 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ArchiveVersion is the version of the archives written by exports. It is incremented whenever their format changes,
+// e.g. to hold more room-related data, archives of a newer version being refused by imports.
+const ArchiveVersion = 1
+
+// ErrInvalidArchive is wrapped by the errors of Archive.Validate.
+var ErrInvalidArchive = errors.New("invalid archive")
+
+// Archive is a portable copy of the users, rooms and memberships of an instance, to back them up or move them
+// to another instance. IDs only identify users and rooms within the archive: they are remapped once imported.
+// Deleted users and rooms, refresh tokens and versions are not archived.
+type Archive struct {
+	Version    uint          `json:"version"`
+	ExportedAt time.Time     `json:"exportedAt"`
+	Users      []ArchiveUser `json:"users"`
+	Rooms      []ArchiveRoom `json:"rooms"`
+}
+
+// ArchiveUser is a user of an archive, along with its credentials and external identities.
+type ArchiveUser struct {
+	ID         uint64            `json:"id"`
+	CreatedAt  time.Time         `json:"createdAt"`
+	Name       string            `json:"name"`
+	Password   string            `json:"password"`         // argon2id hash of the password, see the auth package.
+	Handle     *string           `json:"handle,omitempty"` // Only set for registered users, always lowercase.
+	Identities []ArchiveIdentity `json:"identities,omitempty"`
+}
+
+// ArchiveIdentity is an external identity of a user of an archive.
+type ArchiveIdentity struct {
+	Issuer  string `json:"issuer"`
+	Subject string `json:"subject"`
+}
+
+// ArchiveRoom is a room of an archive. Its members are the IDs of its users in the order they joined.
+type ArchiveRoom struct {
+	ID        uint64    `json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	Name      string    `json:"name"`
+	OwnerID   uint64    `json:"ownerID"`
+	Members   []uint64  `json:"members"`
+}
+
+// ArchiveMapping maps the IDs of the users and rooms of an archive to the IDs they were imported with.
+type ArchiveMapping struct {
+	Users map[uint64]uint64 `json:"users"`
+	Rooms map[uint64]uint64 `json:"rooms"`
+}
+
+// Validate checks an archive can be imported: its version is supported, its users and rooms are unique,
+// and every room has members, owned by one of them, among the users of the archive.
+// Conflicts with the stored users, such as a taken handle, are only found by the import.
+func (a *Archive) Validate() error {
+	if a.Version < 1 || a.Version > ArchiveVersion {
+		return fmt.Errorf("%w: unsupported version %d", ErrInvalidArchive, a.Version)
+	}
+
+	users := make(map[uint64]bool, len(a.Users))
+	handles := make(map[string]bool)
+	identities := make(map[ArchiveIdentity]bool)
+	for _, user := range a.Users {
+		if users[user.ID] {
+			return fmt.Errorf("%w: user %d is defined twice", ErrInvalidArchive, user.ID)
+		}
+		users[user.ID] = true
+		if user.Name == "" {
+			return fmt.Errorf("%w: user %d has no name", ErrInvalidArchive, user.ID)
+		}
+		if user.Handle != nil {
+			if *user.Handle == "" || *user.Handle != strings.ToLower(*user.Handle) || handles[*user.Handle] {
+				return fmt.Errorf("%w: user %d has an invalid or duplicate handle", ErrInvalidArchive, user.ID)
+			}
+			handles[*user.Handle] = true
+		}
+		for _, identity := range user.Identities {
+			if identity.Issuer == "" || identity.Subject == "" || identities[identity] {
+				return fmt.Errorf("%w: user %d has an invalid or duplicate identity", ErrInvalidArchive, user.ID)
+			}
+			identities[identity] = true
+		}
+	}
+
+	rooms := make(map[uint64]bool, len(a.Rooms))
+	for _, room := range a.Rooms {
+		if rooms[room.ID] {
+			return fmt.Errorf("%w: room %d is defined twice", ErrInvalidArchive, room.ID)
+		}
+		rooms[room.ID] = true
+		if room.Name == "" {
+			return fmt.Errorf("%w: room %d has no name", ErrInvalidArchive, room.ID)
+		}
+
+		members := make(map[uint64]bool, len(room.Members))
+		for _, member := range room.Members {
+			if !users[member] || members[member] {
+				return fmt.Errorf("%w: room %d has an unknown or duplicate member %d", ErrInvalidArchive, room.ID, member)
+			}
+			members[member] = true
+		}
+		if !members[room.OwnerID] {
+			return fmt.Errorf("%w: room %d is not owned by one of its members", ErrInvalidArchive, room.ID)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// Identity links a user to its account at an external identity provider, see the auth package.
+// A user logging in through the provider again is given back the same user.
+type Identity struct {
+	ID        uint64 `gorm:"primarykey"`
+	CreatedAt time.Time
+	UserID    uint64 `gorm:"index;not null"`
+	Issuer    string `gorm:"uniqueIndex:idx_identities_subject;not null"`
+	Subject   string `gorm:"uniqueIndex:idx_identities_subject;not null"`
+}
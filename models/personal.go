@@ -0,0 +1,56 @@
+package models
+
+import "time"
+
+// PersonalData is everything stored about a user, as exported to the user itself.
+// Credentials are left out: the password hash and the hashes of the refresh tokens.
+type PersonalData struct {
+	ExportedAt    time.Time              `json:"exportedAt"`
+	User          PersonalUser           `json:"user"`
+	Identities    []PersonalIdentity     `json:"identities"`
+	Memberships   []PersonalRoom         `json:"memberships"` // Rooms the user is in.
+	RoomsOwned    []PersonalRoom         `json:"roomsOwned"`  // Rooms the user owns, deleted ones included until they are purged.
+	RefreshTokens []PersonalRefreshToken `json:"refreshTokens"`
+}
+
+// PersonalUser is the profile of a user in its personal data.
+type PersonalUser struct {
+	ID         uint64    `json:"id"`
+	Name       string    `json:"name"`
+	Handle     *string   `json:"handle,omitempty"`
+	Registered bool      `json:"registered"`
+	CreatedAt  time.Time `json:"createdAt"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+}
+
+// PersonalIdentity is an external identity of a user in its personal data.
+type PersonalIdentity struct {
+	Issuer    string    `json:"issuer"`
+	Subject   string    `json:"subject"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// PersonalRoom is a room in the personal data of a user.
+type PersonalRoom struct {
+	ID        uint64     `json:"id"`
+	Name      string     `json:"name"`
+	OwnerID   uint64     `json:"ownerID"`
+	CreatedAt time.Time  `json:"createdAt"`
+	UpdatedAt time.Time  `json:"updatedAt"`
+	DeletedAt *time.Time `json:"deletedAt,omitempty"`
+}
+
+// PersonalRefreshToken is a refresh token in the personal data of a user.
+type PersonalRefreshToken struct {
+	CreatedAt time.Time `json:"createdAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// NewPersonalRoom returns a room as found in the personal data of a user.
+func NewPersonalRoom(room Room) PersonalRoom {
+	personal := PersonalRoom{ID: room.ID, Name: room.Name, OwnerID: room.OwnerID, CreatedAt: room.CreatedAt, UpdatedAt: room.UpdatedAt}
+	if room.DeletedAt.Valid {
+		personal.DeletedAt = &room.DeletedAt.Time
+	}
+	return personal
+}
@@ -1,9 +1,6 @@
 package models
 
 import (
-	"context"
-	"database/sql"
-	"errors"
 	"time"
 
 	"golang.org/x/exp/slices"
@@ -11,13 +8,14 @@ import (
 )
 
 type Room struct {
-	ID        uint64       `gorm:"primaryKey;autoincrement:false" json:"-"`
-	CreatedAt time.Time    `json:"-"`
-	UpdatedAt time.Time    `json:"-"`
-	DeletedAt sql.NullTime `gorm:"index" json:"-"`
-	Name      string       `json:"name" binding:"required,gte=2,lte=20" example:"BirthdayParty"`
-	OwnerID   uint64       `json:"ownerID"`
-	Users     []User       `json:"users" gorm:"many2many:room_users"`
+	ID        uint64         `gorm:"primaryKey;autoincrement:false" json:"-"`
+	CreatedAt time.Time      `json:"-"`
+	UpdatedAt time.Time      `json:"-"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+	Name      string         `json:"name" binding:"required,gte=2,lte=20" example:"BirthdayParty"`
+	OwnerID   uint64         `json:"ownerID"`
+	Users     []User         `json:"users" gorm:"many2many:room_users"`
+	Version   uint64         `gorm:"not null" json:"-"` // Incremented whenever the room as returned by the API changes, users included.
 }
 
 type RoomUpdate struct {
@@ -31,25 +29,7 @@ func (ru *RoomUpdate) ToRoom() *Room {
 	}
 }
 
-// GetRoom gets a room by its ID and sets its Users field before returning it.
-func (r *Room) GetRoom(ctx context.Context, db *gorm.DB, id uint64) error {
-	err := db.WithContext(ctx).First(&r, id).Error
-	if err != nil {
-		return err
-	}
-	err = db.WithContext(ctx).Model(&r).Association("Users").Find(&r.Users)
-	if err != nil {
-		return err
-	}
-
-	return err
-}
-
-// RemoveUser removes a user from a room.
-func (r *Room) RemoveUser(ctx context.Context, db *gorm.DB, user *User) error {
-	if !slices.Contains(r.Users, *user) {
-		return errors.New("User not connected to room")
-	}
-
-	return db.WithContext(ctx).Model(&r).Association("Users").Delete(user)
+// HasUser reports whether the user with the given ID is connected to the room.
+func (r *Room) HasUser(id uint64) bool {
+	return slices.IndexFunc(r.Users, func(user User) bool { return user.ID == id }) != -1
 }
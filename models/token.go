@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// RefreshToken allows a user to get new access tokens without sending its password again.
+// Only the hash of the token is stored. A refresh token can be used only once.
+type RefreshToken struct {
+	ID        uint64 `gorm:"primarykey"`
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UserID    uint64 `gorm:"index;not null"`
+	Hash      string `gorm:"uniqueIndex;not null"`
+}
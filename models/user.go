@@ -1,20 +1,28 @@
 package models
 
 import (
-	"context"
-	"database/sql"
 	"time"
 
 	"gorm.io/gorm"
 )
 
 type User struct {
-	ID        uint64       `gorm:"primarykey"`
-	CreatedAt time.Time    `json:"-"`
-	UpdatedAt time.Time    `json:"-"`
-	DeletedAt sql.NullTime `gorm:"index" json:"-"`
-	Name      string       `json:"name" binding:"required,gte=2,lte=20" example:"Diablox9"`
-	Password  string       `json:"-"`
+	ID        uint64         `gorm:"primarykey"`
+	CreatedAt time.Time      `json:"-"`
+	UpdatedAt time.Time      `json:"-"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+	Name      string         `json:"name" binding:"required,gte=2,lte=20" example:"Diablox9"`
+	Password  string         `json:"-"`                    // argon2id hash of the password, see the auth package.
+	Handle    *string        `gorm:"uniqueIndex" json:"-"` // Only set for registered users, always lowercase.
+	Version   uint64         `gorm:"not null" json:"-"`    // Incremented whenever the user as returned by the API changes.
+	// Embedded in the access tokens and stream tickets of the user, and incremented to reject the ones issued before.
+	TokenGeneration uint64 `gorm:"not null" json:"-"`
+}
+
+// UserAccount holds the handle and password a user registers with, and then logs in with from any device.
+type UserAccount struct {
+	Handle   string `json:"handle" binding:"required,gte=3,lte=32,alphanum" example:"diablox9"`
+	Password string `json:"password" binding:"required,gte=8,lte=128" example:"correct horse battery staple"`
 }
 
 type UserUpdate struct {
@@ -27,12 +35,3 @@ func (u *UserUpdate) ToUser() *User {
 		Name: u.Name,
 	}
 }
-
-func (u *User) GetRoomID(ctx context.Context, db *gorm.DB) (uint64, error) {
-	var roomID uint64
-	err := db.WithContext(ctx).Select("room_id").Table("room_users").Where("user_id = ?", u.ID).Row().Scan(&roomID)
-	if err != nil {
-		return 0, err
-	}
-	return roomID, nil
-}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/Brawdunoir/dionysos-server/repositories"
+	l "github.com/Brawdunoir/dionysos-server/utils/logger"
+)
+
+// purge removes for good the rooms and users deleted for longer than retention, every interval until ctx is done.
+// Instances sharing the database purge concurrently, which is harmless.
+func purge(ctx context.Context, repos repositories.Repositories, retention, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		purgeDeleted(ctx, repos, time.Now().Add(-retention))
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// purgeDeleted removes for good the rooms and users deleted before the given time.
+// Failing to do so is only logged, the next purge trying again.
+func purgeDeleted(ctx context.Context, repos repositories.Repositories, before time.Time) {
+	rooms, err := repos.Rooms.Purge(ctx, before)
+	if err != nil {
+		l.Logger.Errorf("Failed to purge deleted rooms: %v", err)
+	}
+	users, err := repos.Users.Purge(ctx, before)
+	if err != nil {
+		l.Logger.Errorf("Failed to purge deleted users: %v", err)
+	}
+	if rooms > 0 || users > 0 {
+		l.Logger.Infof("Purged %d rooms and %d users deleted before %s", rooms, users, before.Format(time.RFC3339))
+	}
+}
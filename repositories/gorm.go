@@ -0,0 +1,662 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/Brawdunoir/dionysos-server/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// NewGorm returns the repositories storing rooms and users in the given database.
+func NewGorm(db *gorm.DB) Repositories {
+	return Repositories{
+		Rooms:    &GormRoomRepository{db: db},
+		Users:    &GormUserRepository{db: db},
+		Archives: &GormArchiveRepository{db: db},
+	}
+}
+
+// notFound translates the errors of gorm telling a record does not exist to ErrNotFound.
+func notFound(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) || errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// affected returns ErrNotFound if a statement did not affect any row.
+func affected(result *gorm.DB) error {
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected < 1 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// increment is the change incrementing the version of a room or a user.
+var increment = gorm.Expr("version + 1")
+
+// updateVersioned applies changes to the room or user with the given ID, model being its type, incrementing its version.
+// If versions is not nil, the changes are only applied if its version is one of them.
+func updateVersioned(tx *gorm.DB, model interface{}, id uint64, changes map[string]interface{}, versions []uint64) error {
+	changes["version"] = increment
+	query := tx.Model(model).Where("id = ?", id)
+	if versions != nil {
+		query = query.Where("version IN ?", versions)
+	}
+	err := affected(query.Updates(changes))
+	if !errors.Is(err, ErrNotFound) || versions == nil {
+		return err
+	}
+
+	// Tell a missing record from a record at another version.
+	var count int64
+	err = tx.Model(model).Where("id = ?", id).Count(&count).Error
+	if err != nil {
+		return err
+	} else if count > 0 {
+		return ErrVersionMismatch
+	}
+	return ErrNotFound
+}
+
+// memberOrder orders the members of rooms by the time they joined, then by ID for the memberships predating join times.
+const memberOrder = "room_users.joined_at, room_users.user_id"
+
+// addMembers adds users to the members of a room, in the given order. Their join times are a microsecond apart,
+// the precision of PostgreSQL, and in UTC for SQLite to order them as text.
+func addMembers(tx *gorm.DB, roomID uint64, userIDs ...uint64) error {
+	joinedAt := time.Now().UTC()
+	for i, userID := range userIDs {
+		err := tx.Exec("INSERT INTO room_users (room_id, user_id, joined_at) VALUES (?, ?, ?)",
+			roomID, userID, joinedAt.Add(time.Duration(i)*time.Microsecond)).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// assertUnused returns ErrInUse if the memberships matching the given condition exist.
+func assertUnused(tx *gorm.DB, query string, id uint64) error {
+	var count int64
+	err := tx.Table("room_users").Where(query, id).Count(&count).Error
+	if err != nil {
+		return err
+	} else if count > 0 {
+		return ErrInUse
+	}
+	return nil
+}
+
+// GormRoomRepository is a RoomRepository storing rooms in a database with gorm.
+type GormRoomRepository struct {
+	db *gorm.DB
+}
+
+// Get returns the room with the given ID along with its users, in the order they joined.
+func (r *GormRoomRepository) Get(ctx context.Context, id uint64) (models.Room, error) {
+	var room models.Room
+
+	err := r.db.WithContext(ctx).First(&room, id).Error
+	if err != nil {
+		return room, notFound(err)
+	}
+	err = r.db.WithContext(ctx).Model(&room).Order(memberOrder).Association("Users").Find(&room.Users)
+	return room, err
+}
+
+// Create stores a new room with its users as members, in the order they are given.
+func (r *GormRoomRepository) Create(ctx context.Context, room *models.Room) error {
+	room.Version = 1
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Omit("Users").Create(room).Error
+		if err != nil {
+			return err
+		}
+		userIDs := make([]uint64, 0, len(room.Users))
+		for _, user := range room.Users {
+			userIDs = append(userIDs, user.ID)
+		}
+		return addMembers(tx, room.ID, userIDs...)
+	})
+}
+
+// Update changes the name of a room.
+func (r *GormRoomRepository) Update(ctx context.Context, id uint64, update *models.RoomUpdate, versions []uint64) error {
+	changes := make(map[string]interface{})
+	if update.Name != "" {
+		changes["name"] = update.Name
+	}
+	return updateVersioned(r.db.WithContext(ctx), &models.Room{}, id, changes, versions)
+}
+
+// SetOwner changes the owner of a room.
+func (r *GormRoomRepository) SetOwner(ctx context.Context, id, ownerID uint64) error {
+	return updateVersioned(r.db.WithContext(ctx), &models.Room{}, id, map[string]interface{}{"owner_id": ownerID}, nil)
+}
+
+// Close deletes a room on behalf of its owner, removing all of its members.
+func (r *GormRoomRepository) Close(ctx context.Context, id, ownerID uint64) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		room, err := lockRoom(tx, id)
+		if err != nil {
+			return err
+		}
+		if room.OwnerID != ownerID {
+			return ErrNotOwner
+		}
+		err = tx.Exec("DELETE FROM room_users WHERE room_id = ?", id).Error
+		if err != nil {
+			return err
+		}
+		return affected(tx.Delete(&models.Room{}, id))
+	})
+}
+
+// Restore restores a room deleted since the given time on behalf of its owner, who becomes its only member.
+func (r *GormRoomRepository) Restore(ctx context.Context, id, ownerID uint64, since time.Time) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var room models.Room
+		err := tx.Unscoped().Clauses(clause.Locking{Strength: "UPDATE"}).Where("deleted_at >= ?", since).First(&room, id).Error
+		if err != nil {
+			return notFound(err)
+		}
+		if room.OwnerID != ownerID {
+			return ErrNotOwner
+		}
+		err = tx.Unscoped().Model(&room).Updates(map[string]interface{}{"deleted_at": nil, "version": increment}).Error
+		if err != nil {
+			return err
+		}
+		return addMembers(tx, id, ownerID)
+	})
+}
+
+// Purge removes for good the rooms deleted before the given time.
+func (r *GormRoomRepository) Purge(ctx context.Context, before time.Time) (int64, error) {
+	var purged int64
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Deleted rooms have no members left, but their memberships would prevent them from being removed otherwise.
+		ids := tx.Unscoped().Model(&models.Room{}).Select("id").Where("deleted_at < ?", before)
+		err := tx.Exec("DELETE FROM room_users WHERE room_id IN (?)", ids).Error
+		if err != nil {
+			return err
+		}
+		result := tx.Unscoped().Where("deleted_at < ?", before).Delete(&models.Room{})
+		purged = result.RowsAffected
+		return result.Error
+	})
+	return purged, err
+}
+
+// lockRoom returns a room, locking it until the end of the transaction so that its members are changed one at a time.
+// SQLite does not lock rows, but its transactions are serialized by the single connection to the database.
+func lockRoom(tx *gorm.DB, id uint64) (models.Room, error) {
+	var room models.Room
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&room, id).Error
+	return room, notFound(err)
+}
+
+// AddUser makes a user a member of a room.
+func (r *GormRoomRepository) AddUser(ctx context.Context, id, userID uint64) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		_, err := lockRoom(tx, id)
+		if err != nil {
+			return err
+		}
+
+		var count int64
+		err = tx.Table("room_users").Where("room_id = ? AND user_id = ?", id, userID).Count(&count).Error
+		if err != nil {
+			return err
+		} else if count > 0 {
+			return ErrAlreadyMember
+		}
+		err = tx.Model(&models.User{}).Where("id = ?", userID).Count(&count).Error
+		if err != nil {
+			return err
+		} else if count == 0 {
+			return ErrNotFound
+		}
+		err = addMembers(tx, id, userID)
+		if err != nil {
+			return err
+		}
+		return updateVersioned(tx, &models.Room{}, id, map[string]interface{}{}, nil)
+	})
+}
+
+// RemoveUser removes a user from the members of a room, handing the ownership over or deleting the room if needed.
+func (r *GormRoomRepository) RemoveUser(ctx context.Context, id, userID uint64) (bool, error) {
+	var deleted bool
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		room, err := lockRoom(tx, id)
+		if err != nil {
+			return err
+		}
+		deleted, err = removeUser(tx, room, userID)
+		return err
+	})
+	return deleted, err
+}
+
+// KickUser removes a user other than the owner from the members of a room on behalf of its owner.
+func (r *GormRoomRepository) KickUser(ctx context.Context, id, ownerID, userID uint64) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		room, err := lockRoom(tx, id)
+		if err != nil {
+			return err
+		}
+		if room.OwnerID != ownerID || userID == ownerID {
+			return ErrNotOwner
+		}
+		_, err = removeUser(tx, room, userID)
+		return err
+	})
+}
+
+// removeUser removes a user from the members of a locked room, handing the ownership over to another member
+// or deleting the room if needed, and reports whether the room was deleted.
+func removeUser(tx *gorm.DB, room models.Room, userID uint64) (bool, error) {
+	err := affected(tx.Exec("DELETE FROM room_users WHERE room_id = ? AND user_id = ?", room.ID, userID))
+	if err != nil {
+		return false, err
+	}
+
+	var members []uint64
+	err = tx.Table("room_users").Where("room_id = ?", room.ID).Order(memberOrder).Limit(1).Pluck("user_id", &members).Error
+	if err != nil {
+		return false, err
+	}
+	if len(members) == 0 {
+		return true, affected(tx.Delete(&models.Room{}, room.ID))
+	}
+	changes := make(map[string]interface{})
+	if room.OwnerID == userID {
+		changes["owner_id"] = members[0]
+	}
+	return false, updateVersioned(tx, &models.Room{}, room.ID, changes, nil)
+}
+
+// GormUserRepository is a UserRepository storing users in a database with gorm.
+type GormUserRepository struct {
+	db *gorm.DB
+}
+
+// Get returns the user with the given ID.
+func (r *GormUserRepository) Get(ctx context.Context, id uint64) (models.User, error) {
+	var user models.User
+	err := r.db.WithContext(ctx).First(&user, id).Error
+	return user, notFound(err)
+}
+
+// GetByHandle returns the registered user with the given handle.
+func (r *GormUserRepository) GetByHandle(ctx context.Context, handle string) (models.User, error) {
+	var user models.User
+	err := r.db.WithContext(ctx).Where("handle = ?", handle).First(&user).Error
+	return user, notFound(err)
+}
+
+// GetByIdentity returns the user linked to the given identity.
+func (r *GormUserRepository) GetByIdentity(ctx context.Context, issuer, subject string) (models.User, error) {
+	var user models.User
+	err := r.db.WithContext(ctx).Joins("JOIN identities ON identities.user_id = users.id").
+		Where("identities.issuer = ? AND identities.subject = ?", issuer, subject).First(&user).Error
+	return user, notFound(err)
+}
+
+// Create stores a new user and sets its ID.
+func (r *GormUserRepository) Create(ctx context.Context, user *models.User) error {
+	user.Version = 1
+	return r.db.WithContext(ctx).Create(user).Error
+}
+
+// CreateWithIdentity stores a new user linked to the given identity, replacing any previous link of the identity.
+func (r *GormUserRepository) CreateWithIdentity(ctx context.Context, user *models.User, issuer, subject string) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("issuer = ? AND subject = ?", issuer, subject).Delete(&models.Identity{}).Error
+		if err != nil {
+			return err
+		}
+		user.Version = 1
+		err = tx.Create(user).Error
+		if err != nil {
+			return err
+		}
+		return tx.Create(&models.Identity{UserID: user.ID, Issuer: issuer, Subject: subject}).Error
+	})
+}
+
+// Update changes the name of a user, incrementing its version along with the versions of its rooms.
+func (r *GormUserRepository) Update(ctx context.Context, id uint64, update *models.UserUpdate, versions []uint64) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		changes := make(map[string]interface{})
+		if update.Name != "" {
+			changes["name"] = update.Name
+		}
+		err := updateVersioned(tx, &models.User{}, id, changes, versions)
+		if err != nil {
+			return err
+		}
+		return tx.Model(&models.Room{}).Where("id IN (?)", tx.Table("room_users").Select("room_id").Where("user_id = ?", id)).
+			Update("version", increment).Error
+	})
+}
+
+// SetPassword replaces the password hash of a user.
+func (r *GormUserRepository) SetPassword(ctx context.Context, id uint64, hash string) error {
+	return affected(r.db.WithContext(ctx).Model(&models.User{ID: id}).UpdateColumn("password", hash))
+}
+
+// RotatePassword replaces the password hash of a user and increments its token generation.
+func (r *GormUserRepository) RotatePassword(ctx context.Context, id uint64, hash string) error {
+	return affected(r.db.WithContext(ctx).Model(&models.User{ID: id}).
+		UpdateColumns(map[string]interface{}{"password": hash, "token_generation": gorm.Expr("token_generation + 1")}))
+}
+
+// Register sets the handle and password hash of a user.
+func (r *GormUserRepository) Register(ctx context.Context, id uint64, handle, hash string) error {
+	var count int64
+
+	// The unique index on handles still prevents two users from registering the same handle concurrently.
+	// Deleted users keep their handle until they are purged, so that they can be restored.
+	err := r.db.WithContext(ctx).Unscoped().Model(&models.User{}).Where("handle = ? AND id <> ?", handle, id).Count(&count).Error
+	if err != nil {
+		return err
+	} else if count > 0 {
+		return ErrHandleTaken
+	}
+	return affected(r.db.WithContext(ctx).Model(&models.User{ID: id}).Updates(models.User{Handle: &handle, Password: hash}))
+}
+
+// Delete deletes a user along with its refresh tokens, its identities being kept until it is purged.
+func (r *GormUserRepository) Delete(ctx context.Context, id uint64) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := assertUnused(tx, "user_id = ?", id)
+		if err != nil {
+			return err
+		}
+		err = tx.Where("user_id = ?", id).Delete(&models.RefreshToken{}).Error
+		if err != nil {
+			return err
+		}
+		return affected(tx.Delete(&models.User{}, id))
+	})
+}
+
+// Restore restores a user deleted since the given time.
+func (r *GormUserRepository) Restore(ctx context.Context, id uint64, since time.Time) error {
+	return affected(r.db.WithContext(ctx).Unscoped().Model(&models.User{}).Where("id = ? AND deleted_at >= ?", id, since).
+		Updates(map[string]interface{}{"deleted_at": nil, "version": increment}))
+}
+
+// Purge removes for good the users deleted before the given time along with their identities.
+func (r *GormUserRepository) Purge(ctx context.Context, before time.Time) (int64, error) {
+	var purged int64
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		ids := tx.Unscoped().Model(&models.User{}).Select("id").Where("deleted_at < ?", before)
+		for _, table := range []string{"identities", "refresh_tokens", "room_users"} {
+			err := tx.Exec("DELETE FROM "+table+" WHERE user_id IN (?)", ids).Error
+			if err != nil {
+				return err
+			}
+		}
+		result := tx.Unscoped().Where("deleted_at < ?", before).Delete(&models.User{})
+		purged = result.RowsAffected
+		return result.Error
+	})
+	return purged, err
+}
+
+// GetRoomIDs returns the IDs of the rooms a user is in.
+func (r *GormUserRepository) GetRoomIDs(ctx context.Context, id uint64) ([]uint64, error) {
+	var roomIDs []uint64
+	err := r.db.WithContext(ctx).Table("room_users").Where("user_id = ?", id).Order("room_id").Pluck("room_id", &roomIDs).Error
+	return roomIDs, err
+}
+
+// Export returns the personal data of a user.
+func (r *GormUserRepository) Export(ctx context.Context, id uint64) (models.PersonalData, error) {
+	data := models.PersonalData{ExportedAt: time.Now()}
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		err := tx.First(&user, id).Error
+		if err != nil {
+			return notFound(err)
+		}
+		data.User = models.PersonalUser{
+			ID: user.ID, Name: user.Name, Handle: user.Handle, Registered: user.Handle != nil,
+			CreatedAt: user.CreatedAt, UpdatedAt: user.UpdatedAt,
+		}
+
+		var identities []models.Identity
+		err = tx.Where("user_id = ?", id).Order("id").Find(&identities).Error
+		if err != nil {
+			return err
+		}
+		data.Identities = make([]models.PersonalIdentity, 0, len(identities))
+		for _, identity := range identities {
+			data.Identities = append(data.Identities, models.PersonalIdentity{Issuer: identity.Issuer, Subject: identity.Subject, CreatedAt: identity.CreatedAt})
+		}
+
+		var memberships, owned []models.Room
+		err = tx.Where("id IN (?)", tx.Table("room_users").Select("room_id").Where("user_id = ?", id)).Order("id").Find(&memberships).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Unscoped().Where("owner_id = ?", id).Order("id").Find(&owned).Error
+		if err != nil {
+			return err
+		}
+		data.Memberships = make([]models.PersonalRoom, 0, len(memberships))
+		for _, room := range memberships {
+			data.Memberships = append(data.Memberships, models.NewPersonalRoom(room))
+		}
+		data.RoomsOwned = make([]models.PersonalRoom, 0, len(owned))
+		for _, room := range owned {
+			data.RoomsOwned = append(data.RoomsOwned, models.NewPersonalRoom(room))
+		}
+
+		var tokens []models.RefreshToken
+		err = tx.Where("user_id = ?", id).Order("id").Find(&tokens).Error
+		if err != nil {
+			return err
+		}
+		data.RefreshTokens = make([]models.PersonalRefreshToken, 0, len(tokens))
+		for _, token := range tokens {
+			data.RefreshTokens = append(data.RefreshTokens, models.PersonalRefreshToken{CreatedAt: token.CreatedAt, ExpiresAt: token.ExpiresAt})
+		}
+		return nil
+	})
+	return data, err
+}
+
+// Erase deletes a user for good along with its identities, its refresh tokens and the deleted rooms it owns.
+func (r *GormUserRepository) Erase(ctx context.Context, id uint64) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := assertUnused(tx, "user_id = ?", id)
+		if err != nil {
+			return err
+		}
+		rooms := tx.Unscoped().Model(&models.Room{}).Select("id").Where("owner_id = ? AND deleted_at IS NOT NULL", id)
+		err = tx.Exec("DELETE FROM room_users WHERE room_id IN (?)", rooms).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Unscoped().Where("owner_id = ? AND deleted_at IS NOT NULL", id).Delete(&models.Room{}).Error
+		if err != nil {
+			return err
+		}
+		for _, table := range []string{"identities", "refresh_tokens"} {
+			err = tx.Exec("DELETE FROM "+table+" WHERE user_id = ?", id).Error
+			if err != nil {
+				return err
+			}
+		}
+		return affected(tx.Unscoped().Delete(&models.User{}, id))
+	})
+}
+
+// CreateRefreshToken stores a refresh token, removing the expired ones of its user at the same time.
+func (r *GormUserRepository) CreateRefreshToken(ctx context.Context, token *models.RefreshToken) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("user_id = ? AND expires_at <= ?", token.UserID, time.Now()).Delete(&models.RefreshToken{}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Create(token).Error
+	})
+}
+
+// ConsumeRefreshToken deletes the unexpired refresh token with the given hash and returns it.
+func (r *GormUserRepository) ConsumeRefreshToken(ctx context.Context, hash string) (models.RefreshToken, error) {
+	var token models.RefreshToken
+
+	err := r.db.WithContext(ctx).Where("hash = ? AND expires_at > ?", hash, time.Now()).First(&token).Error
+	if err != nil {
+		return token, notFound(err)
+	}
+	// The first concurrent request to delete the token wins.
+	return token, affected(r.db.WithContext(ctx).Delete(&token))
+}
+
+// DeleteRefreshTokens deletes the refresh tokens of a user.
+func (r *GormUserRepository) DeleteRefreshTokens(ctx context.Context, userID uint64) error {
+	return r.db.WithContext(ctx).Where("user_id = ?", userID).Delete(&models.RefreshToken{}).Error
+}
+
+// GormArchiveRepository is an ArchiveRepository exporting and importing users and rooms stored in a database with gorm.
+type GormArchiveRepository struct {
+	db *gorm.DB
+}
+
+// Export returns an archive of the users and rooms which are not deleted, along with their memberships.
+func (r *GormArchiveRepository) Export(ctx context.Context) (models.Archive, error) {
+	archive := models.Archive{Version: models.ArchiveVersion, ExportedAt: time.Now()}
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var users []models.User
+		err := tx.Order("id").Find(&users).Error
+		if err != nil {
+			return err
+		}
+		var identities []models.Identity
+		err = tx.Where("user_id IN (?)", tx.Model(&models.User{}).Select("id")).Order("id").Find(&identities).Error
+		if err != nil {
+			return err
+		}
+		identitiesOf := make(map[uint64][]models.ArchiveIdentity)
+		for _, identity := range identities {
+			identitiesOf[identity.UserID] = append(identitiesOf[identity.UserID], models.ArchiveIdentity{Issuer: identity.Issuer, Subject: identity.Subject})
+		}
+		archive.Users = make([]models.ArchiveUser, 0, len(users))
+		for _, user := range users {
+			archive.Users = append(archive.Users, models.ArchiveUser{
+				ID: user.ID, CreatedAt: user.CreatedAt, Name: user.Name, Password: user.Password, Handle: user.Handle,
+				Identities: identitiesOf[user.ID],
+			})
+		}
+
+		var memberships []struct{ RoomID, UserID uint64 }
+		err = tx.Table("room_users").Order("room_id, " + memberOrder).Find(&memberships).Error
+		if err != nil {
+			return err
+		}
+		membersOf := make(map[uint64][]uint64)
+		for _, membership := range memberships {
+			membersOf[membership.RoomID] = append(membersOf[membership.RoomID], membership.UserID)
+		}
+
+		var rooms []models.Room
+		err = tx.Order("id").Find(&rooms).Error
+		if err != nil {
+			return err
+		}
+		archive.Rooms = make([]models.ArchiveRoom, 0, len(rooms))
+		for _, room := range rooms {
+			archive.Rooms = append(archive.Rooms, models.ArchiveRoom{
+				ID: room.ID, CreatedAt: room.CreatedAt, Name: room.Name, OwnerID: room.OwnerID, Members: membersOf[room.ID],
+			})
+		}
+		return nil
+	})
+	return archive, err
+}
+
+// Import stores the users and rooms of a valid archive under new IDs and returns the IDs they were given.
+func (r *GormArchiveRepository) Import(ctx context.Context, archive *models.Archive, newRoomID func() (uint64, error)) (models.ArchiveMapping, error) {
+	mapping := models.ArchiveMapping{
+		Users: make(map[uint64]uint64, len(archive.Users)),
+		Rooms: make(map[uint64]uint64, len(archive.Rooms)),
+	}
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, archived := range archive.Users {
+			var count int64
+			if archived.Handle != nil {
+				// Deleted users keep their handle until they are purged, so that they can be restored.
+				err := tx.Unscoped().Model(&models.User{}).Where("handle = ?", *archived.Handle).Count(&count).Error
+				if err != nil {
+					return err
+				} else if count > 0 {
+					return ErrHandleTaken
+				}
+			}
+			for _, identity := range archived.Identities {
+				err := tx.Model(&models.Identity{}).Where("issuer = ? AND subject = ?", identity.Issuer, identity.Subject).Count(&count).Error
+				if err != nil {
+					return err
+				} else if count > 0 {
+					return ErrIdentityTaken
+				}
+			}
+
+			user := models.User{CreatedAt: archived.CreatedAt, Name: archived.Name, Password: archived.Password, Handle: archived.Handle, Version: 1}
+			err := tx.Create(&user).Error
+			if err != nil {
+				return err
+			}
+			mapping.Users[archived.ID] = user.ID
+			for _, identity := range archived.Identities {
+				err = tx.Create(&models.Identity{UserID: user.ID, Issuer: identity.Issuer, Subject: identity.Subject}).Error
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		for _, archived := range archive.Rooms {
+			id, err := newRoomID()
+			if err != nil {
+				return err
+			}
+			room := models.Room{ID: id, CreatedAt: archived.CreatedAt, Name: archived.Name, OwnerID: mapping.Users[archived.OwnerID], Version: 1}
+			err = tx.Create(&room).Error
+			if err != nil {
+				return err
+			}
+			mapping.Rooms[archived.ID] = id
+			members := make([]uint64, 0, len(archived.Members))
+			for _, member := range archived.Members {
+				members = append(members, mapping.Users[member])
+			}
+			err = addMembers(tx, id, members...)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return mapping, err
+}
@@ -0,0 +1,748 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/Brawdunoir/dionysos-server/models"
+	"golang.org/x/exp/slices"
+	"gorm.io/gorm"
+)
+
+// MemoryStore keeps rooms and users in memory, enforcing the same constraints as the database schema.
+// Everything is lost when the server stops, so it is meant for tests. It is safe for concurrent use.
+type MemoryStore struct {
+	mu           sync.Mutex
+	rooms        map[uint64]models.Room
+	deletedRooms map[uint64]models.Room
+	members      map[uint64][]uint64
+	users        map[uint64]models.User
+	deletedUsers map[uint64]models.User
+	lastUserID   uint64
+	identities   map[memoryIdentity]uint64
+	tokens       map[string]models.RefreshToken
+}
+
+// memoryIdentity identifies an identity within a MemoryStore.
+type memoryIdentity struct {
+	issuer  string
+	subject string
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	s := &MemoryStore{}
+	s.Reset()
+	return s
+}
+
+// Reset deletes everything from the store, as a fresh database would be.
+func (s *MemoryStore) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.rooms = make(map[uint64]models.Room)
+	s.deletedRooms = make(map[uint64]models.Room)
+	s.members = make(map[uint64][]uint64)
+	s.users = make(map[uint64]models.User)
+	s.deletedUsers = make(map[uint64]models.User)
+	s.lastUserID = 0
+	s.identities = make(map[memoryIdentity]uint64)
+	s.tokens = make(map[string]models.RefreshToken)
+}
+
+// Repositories returns the repositories reading from and writing to the store.
+func (s *MemoryStore) Repositories() Repositories {
+	return Repositories{
+		Rooms:    &MemoryRoomRepository{s},
+		Users:    &MemoryUserRepository{s},
+		Archives: &MemoryArchiveRepository{s},
+	}
+}
+
+// roomsOf returns the IDs of the rooms a user is in, in ascending order. The caller must hold the lock.
+func (s *MemoryStore) roomsOf(userID uint64) []uint64 {
+	var roomIDs []uint64
+	for roomID, members := range s.members {
+		if slices.Contains(members, userID) {
+			roomIDs = append(roomIDs, roomID)
+		}
+	}
+	slices.Sort(roomIDs)
+	return roomIDs
+}
+
+// deleteRoom soft-deletes a room along with its memberships. The caller must hold the lock.
+func (s *MemoryStore) deleteRoom(id uint64) {
+	room := s.rooms[id]
+	room.DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+	s.deletedRooms[id] = room
+	delete(s.rooms, id)
+	delete(s.members, id)
+}
+
+// touchRoom stores a changed room, incrementing its version. The caller must hold the lock.
+func (s *MemoryStore) touchRoom(room *models.Room) {
+	room.UpdatedAt = time.Now()
+	room.Version++
+	s.rooms[room.ID] = *room
+}
+
+// MemoryRoomRepository is a RoomRepository backed by a MemoryStore.
+type MemoryRoomRepository struct {
+	s *MemoryStore
+}
+
+// Get returns the room with the given ID along with its users, in the order they joined.
+func (r *MemoryRoomRepository) Get(ctx context.Context, id uint64) (models.Room, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	room, ok := r.s.rooms[id]
+	if !ok {
+		return models.Room{}, ErrNotFound
+	}
+	room.Users = make([]models.User, 0, len(r.s.members[id]))
+	for _, userID := range r.s.members[id] {
+		room.Users = append(room.Users, r.s.users[userID])
+	}
+	return room, nil
+}
+
+// Create stores a new room with its users as members.
+func (r *MemoryRoomRepository) Create(ctx context.Context, room *models.Room) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.rooms[room.ID]; ok {
+		return errors.New("room already exists")
+	}
+	if _, ok := r.s.deletedRooms[room.ID]; ok {
+		return errors.New("room already exists")
+	}
+	members := make([]uint64, 0, len(room.Users))
+	for _, user := range room.Users {
+		if _, ok := r.s.users[user.ID]; !ok {
+			return ErrNotFound
+		}
+		members = append(members, user.ID)
+	}
+
+	room.CreatedAt = time.Now()
+	room.UpdatedAt = room.CreatedAt
+	room.Version = 1
+	stored := *room
+	stored.Users = nil
+	r.s.rooms[room.ID] = stored
+	r.s.members[room.ID] = members
+	return nil
+}
+
+// Update changes the name of a room.
+func (r *MemoryRoomRepository) Update(ctx context.Context, id uint64, update *models.RoomUpdate, versions []uint64) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	room, ok := r.s.rooms[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if versions != nil && !slices.Contains(versions, room.Version) {
+		return ErrVersionMismatch
+	}
+	if update.Name != "" {
+		room.Name = update.Name
+	}
+	r.s.touchRoom(&room)
+	return nil
+}
+
+// SetOwner changes the owner of a room.
+func (r *MemoryRoomRepository) SetOwner(ctx context.Context, id, ownerID uint64) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	room, ok := r.s.rooms[id]
+	if !ok {
+		return ErrNotFound
+	}
+	room.OwnerID = ownerID
+	r.s.touchRoom(&room)
+	return nil
+}
+
+// Close deletes a room on behalf of its owner, removing all of its members.
+func (r *MemoryRoomRepository) Close(ctx context.Context, id, ownerID uint64) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	room, ok := r.s.rooms[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if room.OwnerID != ownerID {
+		return ErrNotOwner
+	}
+	r.s.deleteRoom(id)
+	return nil
+}
+
+// Restore restores a room deleted since the given time on behalf of its owner, who becomes its only member.
+func (r *MemoryRoomRepository) Restore(ctx context.Context, id, ownerID uint64, since time.Time) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	room, ok := r.s.deletedRooms[id]
+	if !ok || room.DeletedAt.Time.Before(since) {
+		return ErrNotFound
+	}
+	if room.OwnerID != ownerID {
+		return ErrNotOwner
+	}
+	if _, ok := r.s.users[ownerID]; !ok {
+		return ErrNotFound
+	}
+	delete(r.s.deletedRooms, id)
+	room.DeletedAt = gorm.DeletedAt{}
+	r.s.members[id] = []uint64{ownerID}
+	r.s.touchRoom(&room)
+	return nil
+}
+
+// Purge removes for good the rooms deleted before the given time.
+func (r *MemoryRoomRepository) Purge(ctx context.Context, before time.Time) (int64, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var purged int64
+	for id, room := range r.s.deletedRooms {
+		if room.DeletedAt.Time.Before(before) {
+			delete(r.s.deletedRooms, id)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+// AddUser makes a user a member of a room.
+func (r *MemoryRoomRepository) AddUser(ctx context.Context, id, userID uint64) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.rooms[id]; !ok {
+		return ErrNotFound
+	}
+	if _, ok := r.s.users[userID]; !ok {
+		return ErrNotFound
+	}
+	if slices.Contains(r.s.members[id], userID) {
+		return ErrAlreadyMember
+	}
+	r.s.members[id] = append(r.s.members[id], userID)
+	room := r.s.rooms[id]
+	r.s.touchRoom(&room)
+	return nil
+}
+
+// RemoveUser removes a user from the members of a room, handing the ownership over or deleting the room if needed.
+func (r *MemoryRoomRepository) RemoveUser(ctx context.Context, id, userID uint64) (bool, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	return r.removeUser(id, userID)
+}
+
+// KickUser removes a user other than the owner from the members of a room on behalf of its owner.
+func (r *MemoryRoomRepository) KickUser(ctx context.Context, id, ownerID, userID uint64) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	room, ok := r.s.rooms[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if room.OwnerID != ownerID || userID == ownerID {
+		return ErrNotOwner
+	}
+	_, err := r.removeUser(id, userID)
+	return err
+}
+
+// removeUser removes a user from the members of a room, handing the ownership over to the member who joined first
+// or deleting the room if needed. The caller must hold the lock.
+func (r *MemoryRoomRepository) removeUser(id, userID uint64) (bool, error) {
+	i := slices.Index(r.s.members[id], userID)
+	if i == -1 {
+		return false, ErrNotFound
+	}
+	r.s.members[id] = slices.Delete(r.s.members[id], i, i+1)
+
+	if len(r.s.members[id]) == 0 {
+		r.s.deleteRoom(id)
+		return true, nil
+	}
+	room := r.s.rooms[id]
+	if room.OwnerID == userID {
+		room.OwnerID = r.s.members[id][0]
+	}
+	r.s.touchRoom(&room)
+	return false, nil
+}
+
+// MemoryUserRepository is a UserRepository backed by a MemoryStore.
+type MemoryUserRepository struct {
+	s *MemoryStore
+}
+
+// Get returns the user with the given ID.
+func (r *MemoryUserRepository) Get(ctx context.Context, id uint64) (models.User, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	user, ok := r.s.users[id]
+	if !ok {
+		return models.User{}, ErrNotFound
+	}
+	return user, nil
+}
+
+// GetByHandle returns the registered user with the given handle.
+func (r *MemoryUserRepository) GetByHandle(ctx context.Context, handle string) (models.User, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, user := range r.s.users {
+		if user.Handle != nil && *user.Handle == handle {
+			return user, nil
+		}
+	}
+	return models.User{}, ErrNotFound
+}
+
+// GetByIdentity returns the user linked to the given identity.
+func (r *MemoryUserRepository) GetByIdentity(ctx context.Context, issuer, subject string) (models.User, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	user, ok := r.s.users[r.s.identities[memoryIdentity{issuer, subject}]]
+	if !ok {
+		return models.User{}, ErrNotFound
+	}
+	return user, nil
+}
+
+// Create stores a new user and sets its ID.
+func (r *MemoryUserRepository) Create(ctx context.Context, user *models.User) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	r.create(user)
+	return nil
+}
+
+// create stores a new user and sets its ID. The caller must hold the lock.
+func (r *MemoryUserRepository) create(user *models.User) {
+	r.s.lastUserID++
+	user.ID = r.s.lastUserID
+	user.CreatedAt = time.Now()
+	user.UpdatedAt = user.CreatedAt
+	user.Version = 1
+	r.s.users[user.ID] = *user
+}
+
+// CreateWithIdentity stores a new user linked to the given identity, replacing any previous link of the identity.
+func (r *MemoryUserRepository) CreateWithIdentity(ctx context.Context, user *models.User, issuer, subject string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	r.create(user)
+	r.s.identities[memoryIdentity{issuer, subject}] = user.ID
+	return nil
+}
+
+// Update changes the name of a user, incrementing its version along with the versions of its rooms.
+func (r *MemoryUserRepository) Update(ctx context.Context, id uint64, update *models.UserUpdate, versions []uint64) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	user, ok := r.s.users[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if versions != nil && !slices.Contains(versions, user.Version) {
+		return ErrVersionMismatch
+	}
+	if update.Name != "" {
+		user.Name = update.Name
+	}
+	user.UpdatedAt = time.Now()
+	user.Version++
+	r.s.users[id] = user
+
+	for roomID, members := range r.s.members {
+		if slices.Contains(members, id) {
+			room := r.s.rooms[roomID]
+			r.s.touchRoom(&room)
+		}
+	}
+	return nil
+}
+
+// SetPassword replaces the password hash of a user.
+func (r *MemoryUserRepository) SetPassword(ctx context.Context, id uint64, hash string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	user, ok := r.s.users[id]
+	if !ok {
+		return ErrNotFound
+	}
+	user.Password = hash
+	r.s.users[id] = user
+	return nil
+}
+
+// RotatePassword replaces the password hash of a user and increments its token generation.
+func (r *MemoryUserRepository) RotatePassword(ctx context.Context, id uint64, hash string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	user, ok := r.s.users[id]
+	if !ok {
+		return ErrNotFound
+	}
+	user.Password = hash
+	user.TokenGeneration++
+	r.s.users[id] = user
+	return nil
+}
+
+// Register sets the handle and password hash of a user.
+func (r *MemoryUserRepository) Register(ctx context.Context, id uint64, handle, hash string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	// Deleted users keep their handle until they are purged, so that they can be restored.
+	for _, users := range []map[uint64]models.User{r.s.users, r.s.deletedUsers} {
+		for _, other := range users {
+			if other.ID != id && other.Handle != nil && *other.Handle == handle {
+				return ErrHandleTaken
+			}
+		}
+	}
+	user, ok := r.s.users[id]
+	if !ok {
+		return ErrNotFound
+	}
+	user.Handle = &handle
+	user.Password = hash
+	user.UpdatedAt = time.Now()
+	r.s.users[id] = user
+	return nil
+}
+
+// Delete deletes a user along with its refresh tokens, its identities being kept until it is purged.
+func (r *MemoryUserRepository) Delete(ctx context.Context, id uint64) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	user, ok := r.s.users[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if len(r.s.roomsOf(id)) > 0 {
+		return ErrInUse
+	}
+	r.deleteRefreshTokens(id)
+	user.DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+	r.s.deletedUsers[id] = user
+	delete(r.s.users, id)
+	return nil
+}
+
+// Restore restores a user deleted since the given time.
+func (r *MemoryUserRepository) Restore(ctx context.Context, id uint64, since time.Time) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	user, ok := r.s.deletedUsers[id]
+	if !ok || user.DeletedAt.Time.Before(since) {
+		return ErrNotFound
+	}
+	delete(r.s.deletedUsers, id)
+	user.DeletedAt = gorm.DeletedAt{}
+	user.UpdatedAt = time.Now()
+	user.Version++
+	r.s.users[id] = user
+	return nil
+}
+
+// Purge removes for good the users deleted before the given time along with their identities.
+func (r *MemoryUserRepository) Purge(ctx context.Context, before time.Time) (int64, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var purged int64
+	for id, user := range r.s.deletedUsers {
+		if !user.DeletedAt.Time.Before(before) {
+			continue
+		}
+		for identity, userID := range r.s.identities {
+			if userID == id {
+				delete(r.s.identities, identity)
+			}
+		}
+		delete(r.s.deletedUsers, id)
+		purged++
+	}
+	return purged, nil
+}
+
+// GetRoomIDs returns the IDs of the rooms a user is in.
+func (r *MemoryUserRepository) GetRoomIDs(ctx context.Context, id uint64) ([]uint64, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	return r.s.roomsOf(id), nil
+}
+
+// Export returns the personal data of a user.
+func (r *MemoryUserRepository) Export(ctx context.Context, id uint64) (models.PersonalData, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	user, ok := r.s.users[id]
+	if !ok {
+		return models.PersonalData{}, ErrNotFound
+	}
+	data := models.PersonalData{
+		ExportedAt: time.Now(),
+		User: models.PersonalUser{
+			ID: user.ID, Name: user.Name, Handle: user.Handle, Registered: user.Handle != nil,
+			CreatedAt: user.CreatedAt, UpdatedAt: user.UpdatedAt,
+		},
+		Identities:    []models.PersonalIdentity{},
+		Memberships:   []models.PersonalRoom{},
+		RoomsOwned:    []models.PersonalRoom{},
+		RefreshTokens: []models.PersonalRefreshToken{},
+	}
+
+	for identity, userID := range r.s.identities {
+		if userID == id {
+			data.Identities = append(data.Identities, models.PersonalIdentity{Issuer: identity.issuer, Subject: identity.subject})
+		}
+	}
+	slices.SortFunc(data.Identities, func(a, b models.PersonalIdentity) bool {
+		return a.Issuer < b.Issuer || a.Issuer == b.Issuer && a.Subject < b.Subject
+	})
+
+	for _, roomID := range r.s.roomsOf(id) {
+		data.Memberships = append(data.Memberships, models.NewPersonalRoom(r.s.rooms[roomID]))
+	}
+	for _, rooms := range []map[uint64]models.Room{r.s.rooms, r.s.deletedRooms} {
+		for _, room := range rooms {
+			if room.OwnerID == id {
+				data.RoomsOwned = append(data.RoomsOwned, models.NewPersonalRoom(room))
+			}
+		}
+	}
+	slices.SortFunc(data.RoomsOwned, func(a, b models.PersonalRoom) bool { return a.ID < b.ID })
+
+	for _, token := range r.s.tokens {
+		if token.UserID == id {
+			data.RefreshTokens = append(data.RefreshTokens, models.PersonalRefreshToken{CreatedAt: token.CreatedAt, ExpiresAt: token.ExpiresAt})
+		}
+	}
+	slices.SortFunc(data.RefreshTokens, func(a, b models.PersonalRefreshToken) bool { return a.CreatedAt.Before(b.CreatedAt) })
+	return data, nil
+}
+
+// Erase deletes a user for good along with its identities, its refresh tokens and the deleted rooms it owns.
+func (r *MemoryUserRepository) Erase(ctx context.Context, id uint64) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	_, live := r.s.users[id]
+	_, deleted := r.s.deletedUsers[id]
+	if !live && !deleted {
+		return ErrNotFound
+	}
+	if len(r.s.roomsOf(id)) > 0 {
+		return ErrInUse
+	}
+
+	for roomID, room := range r.s.deletedRooms {
+		if room.OwnerID == id {
+			delete(r.s.deletedRooms, roomID)
+		}
+	}
+	for identity, userID := range r.s.identities {
+		if userID == id {
+			delete(r.s.identities, identity)
+		}
+	}
+	r.deleteRefreshTokens(id)
+	delete(r.s.users, id)
+	delete(r.s.deletedUsers, id)
+	return nil
+}
+
+// CreateRefreshToken stores a refresh token, removing the expired ones of its user at the same time.
+func (r *MemoryUserRepository) CreateRefreshToken(ctx context.Context, token *models.RefreshToken) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	now := time.Now()
+	for hash, t := range r.s.tokens {
+		if t.UserID == token.UserID && !t.ExpiresAt.After(now) {
+			delete(r.s.tokens, hash)
+		}
+	}
+	if _, ok := r.s.tokens[token.Hash]; ok {
+		return errors.New("refresh token already exists")
+	}
+	token.CreatedAt = now
+	r.s.tokens[token.Hash] = *token
+	return nil
+}
+
+// ConsumeRefreshToken deletes the unexpired refresh token with the given hash and returns it.
+func (r *MemoryUserRepository) ConsumeRefreshToken(ctx context.Context, hash string) (models.RefreshToken, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	token, ok := r.s.tokens[hash]
+	if !ok || !token.ExpiresAt.After(time.Now()) {
+		return models.RefreshToken{}, ErrNotFound
+	}
+	delete(r.s.tokens, hash)
+	return token, nil
+}
+
+// DeleteRefreshTokens deletes the refresh tokens of a user.
+func (r *MemoryUserRepository) DeleteRefreshTokens(ctx context.Context, userID uint64) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	r.deleteRefreshTokens(userID)
+	return nil
+}
+
+// deleteRefreshTokens deletes the refresh tokens of a user. The caller must hold the lock.
+func (r *MemoryUserRepository) deleteRefreshTokens(userID uint64) {
+	for hash, token := range r.s.tokens {
+		if token.UserID == userID {
+			delete(r.s.tokens, hash)
+		}
+	}
+}
+
+// MemoryArchiveRepository is an ArchiveRepository backed by a MemoryStore.
+type MemoryArchiveRepository struct {
+	s *MemoryStore
+}
+
+// Export returns an archive of the users and rooms which are not deleted, along with their memberships.
+func (r *MemoryArchiveRepository) Export(ctx context.Context) (models.Archive, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	archive := models.Archive{Version: models.ArchiveVersion, ExportedAt: time.Now()}
+
+	identitiesOf := make(map[uint64][]models.ArchiveIdentity)
+	for identity, userID := range r.s.identities {
+		identitiesOf[userID] = append(identitiesOf[userID], models.ArchiveIdentity{Issuer: identity.issuer, Subject: identity.subject})
+	}
+	archive.Users = make([]models.ArchiveUser, 0, len(r.s.users))
+	for _, user := range r.s.users {
+		identities := identitiesOf[user.ID]
+		slices.SortFunc(identities, func(a, b models.ArchiveIdentity) bool {
+			return a.Issuer < b.Issuer || a.Issuer == b.Issuer && a.Subject < b.Subject
+		})
+		archive.Users = append(archive.Users, models.ArchiveUser{
+			ID: user.ID, CreatedAt: user.CreatedAt, Name: user.Name, Password: user.Password, Handle: user.Handle,
+			Identities: identities,
+		})
+	}
+	slices.SortFunc(archive.Users, func(a, b models.ArchiveUser) bool { return a.ID < b.ID })
+
+	archive.Rooms = make([]models.ArchiveRoom, 0, len(r.s.rooms))
+	for _, room := range r.s.rooms {
+		archive.Rooms = append(archive.Rooms, models.ArchiveRoom{
+			ID: room.ID, CreatedAt: room.CreatedAt, Name: room.Name, OwnerID: room.OwnerID, Members: slices.Clone(r.s.members[room.ID]),
+		})
+	}
+	slices.SortFunc(archive.Rooms, func(a, b models.ArchiveRoom) bool { return a.ID < b.ID })
+	return archive, nil
+}
+
+// Import stores the users and rooms of a valid archive under new IDs and returns the IDs they were given.
+func (r *MemoryArchiveRepository) Import(ctx context.Context, archive *models.Archive, newRoomID func() (uint64, error)) (models.ArchiveMapping, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	mapping := models.ArchiveMapping{
+		Users: make(map[uint64]uint64, len(archive.Users)),
+		Rooms: make(map[uint64]uint64, len(archive.Rooms)),
+	}
+
+	// Check everything can be imported before storing anything.
+	for _, archived := range archive.Users {
+		if archived.Handle != nil {
+			// Deleted users keep their handle until they are purged, so that they can be restored.
+			for _, users := range []map[uint64]models.User{r.s.users, r.s.deletedUsers} {
+				for _, other := range users {
+					if other.Handle != nil && *other.Handle == *archived.Handle {
+						return mapping, ErrHandleTaken
+					}
+				}
+			}
+		}
+		for _, identity := range archived.Identities {
+			if _, ok := r.s.identities[memoryIdentity{identity.Issuer, identity.Subject}]; ok {
+				return mapping, ErrIdentityTaken
+			}
+		}
+	}
+	for _, archived := range archive.Rooms {
+		id, err := newRoomID()
+		if err != nil {
+			return mapping, err
+		}
+		if _, ok := r.s.rooms[id]; ok {
+			return mapping, errors.New("room already exists")
+		}
+		if _, ok := r.s.deletedRooms[id]; ok {
+			return mapping, errors.New("room already exists")
+		}
+		mapping.Rooms[archived.ID] = id
+	}
+
+	now := time.Now()
+	for _, archived := range archive.Users {
+		r.s.lastUserID++
+		r.s.users[r.s.lastUserID] = models.User{
+			ID: r.s.lastUserID, CreatedAt: archived.CreatedAt, UpdatedAt: now,
+			Name: archived.Name, Password: archived.Password, Handle: archived.Handle, Version: 1,
+		}
+		mapping.Users[archived.ID] = r.s.lastUserID
+		for _, identity := range archived.Identities {
+			r.s.identities[memoryIdentity{identity.Issuer, identity.Subject}] = r.s.lastUserID
+		}
+	}
+	for _, archived := range archive.Rooms {
+		id := mapping.Rooms[archived.ID]
+		r.s.rooms[id] = models.Room{
+			ID: id, CreatedAt: archived.CreatedAt, UpdatedAt: now,
+			Name: archived.Name, OwnerID: mapping.Users[archived.OwnerID], Version: 1,
+		}
+		members := make([]uint64, 0, len(archived.Members))
+		for _, member := range archived.Members {
+			members = append(members, mapping.Users[member])
+		}
+		r.s.members[id] = members
+	}
+	return mapping, nil
+}
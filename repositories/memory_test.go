@@ -0,0 +1,269 @@
+package repositories
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Brawdunoir/dionysos-server/models"
+	"github.com/go-playground/assert/v2"
+)
+
+func TestMemoryMembership(t *testing.T) {
+	ctx := context.Background()
+	repos := NewMemoryStore().Repositories()
+
+	owner := models.User{Name: "owner"}
+	other := models.User{Name: "other"}
+	assert.Equal(t, repos.Users.Create(ctx, &owner), nil)
+	assert.Equal(t, repos.Users.Create(ctx, &other), nil)
+	assert.NotEqual(t, owner.ID, other.ID)
+
+	room := models.Room{ID: 1, Name: "room", OwnerID: owner.ID, Users: []models.User{owner}}
+	assert.Equal(t, repos.Rooms.Create(ctx, &room), nil)
+	assert.Equal(t, repos.Rooms.AddUser(ctx, room.ID, other.ID), nil)
+	assert.Equal(t, repos.Rooms.AddUser(ctx, room.ID, 42), ErrNotFound)
+	assert.Equal(t, repos.Rooms.AddUser(ctx, room.ID, other.ID), ErrAlreadyMember)
+
+	stored, err := repos.Rooms.Get(ctx, room.ID)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(stored.Users), 2)
+	assert.Equal(t, stored.Users[1].ID, other.ID)
+
+	roomIDs, err := repos.Users.GetRoomIDs(ctx, other.ID)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, roomIDs, []uint64{room.ID})
+
+	assert.Equal(t, repos.Users.Delete(ctx, other.ID), ErrInUse)
+
+	err = repos.Rooms.KickUser(ctx, room.ID, other.ID, owner.ID)
+	assert.Equal(t, err, ErrNotOwner)
+
+	// The owner leaves, handing the room over.
+	deleted, err := repos.Rooms.RemoveUser(ctx, room.ID, owner.ID)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, deleted, false)
+	stored, err = repos.Rooms.Get(ctx, room.ID)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, stored.OwnerID, other.ID)
+	_, err = repos.Rooms.RemoveUser(ctx, room.ID, owner.ID)
+	assert.Equal(t, err, ErrNotFound)
+	assert.Equal(t, repos.Users.Delete(ctx, owner.ID), nil)
+
+	// The last member leaves, deleting the room.
+	deleted, err = repos.Rooms.RemoveUser(ctx, room.ID, other.ID)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, deleted, true)
+	_, err = repos.Rooms.Get(ctx, room.ID)
+	assert.Equal(t, err, ErrNotFound)
+}
+
+func TestMemoryRegister(t *testing.T) {
+	ctx := context.Background()
+	repos := NewMemoryStore().Repositories()
+
+	a := models.User{Name: "a"}
+	b := models.User{Name: "b"}
+	assert.Equal(t, repos.Users.Create(ctx, &a), nil)
+	assert.Equal(t, repos.Users.Create(ctx, &b), nil)
+
+	assert.Equal(t, repos.Users.Register(ctx, a.ID, "handle", "hash"), nil)
+	assert.Equal(t, repos.Users.Register(ctx, b.ID, "handle", "hash"), ErrHandleTaken)
+	assert.Equal(t, repos.Users.Register(ctx, a.ID, "handle", "other"), nil)
+
+	user, err := repos.Users.GetByHandle(ctx, "handle")
+	assert.Equal(t, err, nil)
+	assert.Equal(t, user.ID, a.ID)
+	assert.Equal(t, user.Password, "other")
+}
+
+func TestMemoryRefreshTokens(t *testing.T) {
+	ctx := context.Background()
+	repos := NewMemoryStore().Repositories()
+
+	valid := models.RefreshToken{Hash: "valid", UserID: 1, ExpiresAt: time.Now().Add(time.Hour)}
+	expired := models.RefreshToken{Hash: "expired", UserID: 1, ExpiresAt: time.Now().Add(-time.Hour)}
+	assert.Equal(t, repos.Users.CreateRefreshToken(ctx, &expired), nil)
+	assert.Equal(t, repos.Users.CreateRefreshToken(ctx, &valid), nil)
+
+	_, err := repos.Users.ConsumeRefreshToken(ctx, "expired")
+	assert.Equal(t, err, ErrNotFound)
+
+	token, err := repos.Users.ConsumeRefreshToken(ctx, "valid")
+	assert.Equal(t, err, nil)
+	assert.Equal(t, token.UserID, uint64(1))
+
+	_, err = repos.Users.ConsumeRefreshToken(ctx, "valid")
+	assert.Equal(t, err, ErrNotFound)
+}
+
+func TestMemoryVersions(t *testing.T) {
+	ctx := context.Background()
+	repos := NewMemoryStore().Repositories()
+
+	owner := models.User{Name: "owner"}
+	assert.Equal(t, repos.Users.Create(ctx, &owner), nil)
+	assert.Equal(t, owner.Version, uint64(1))
+
+	room := models.Room{ID: 1, Name: "room", OwnerID: owner.ID, Users: []models.User{owner}}
+	assert.Equal(t, repos.Rooms.Create(ctx, &room), nil)
+	assert.Equal(t, room.Version, uint64(1))
+
+	update := models.RoomUpdate{Name: "renamed"}
+	assert.Equal(t, repos.Rooms.Update(ctx, room.ID, &update, []uint64{2}), ErrVersionMismatch)
+	assert.Equal(t, repos.Rooms.Update(ctx, room.ID, &update, []uint64{1}), nil)
+	assert.Equal(t, repos.Rooms.Update(ctx, room.ID, &update, nil), nil)
+	assert.Equal(t, repos.Rooms.Update(ctx, 42, &update, nil), ErrNotFound)
+
+	// Renaming a member changes the room as returned by the API.
+	assert.Equal(t, repos.Users.Update(ctx, owner.ID, &models.UserUpdate{Name: "renamed"}, []uint64{1}), nil)
+	user, err := repos.Users.Get(ctx, owner.ID)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, user.Version, uint64(2))
+	stored, err := repos.Rooms.Get(ctx, room.ID)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, stored.Version, uint64(4))
+}
+
+func TestMemorySoftDelete(t *testing.T) {
+	ctx := context.Background()
+	repos := NewMemoryStore().Repositories()
+
+	owner := models.User{Name: "owner"}
+	other := models.User{Name: "other"}
+	assert.Equal(t, repos.Users.Create(ctx, &owner), nil)
+	assert.Equal(t, repos.Users.Create(ctx, &other), nil)
+	assert.Equal(t, repos.Users.Register(ctx, other.ID, "other", "hash"), nil)
+
+	room := models.Room{ID: 1, Name: "room", OwnerID: owner.ID, Users: []models.User{owner}}
+	assert.Equal(t, repos.Rooms.Create(ctx, &room), nil)
+	assert.Equal(t, repos.Rooms.AddUser(ctx, room.ID, other.ID), nil)
+
+	// Only the owner closes the room, removing its members.
+	assert.Equal(t, repos.Rooms.Close(ctx, room.ID, other.ID), ErrNotOwner)
+	assert.Equal(t, repos.Rooms.Close(ctx, room.ID, owner.ID), nil)
+	_, err := repos.Rooms.Get(ctx, room.ID)
+	assert.Equal(t, err, ErrNotFound)
+	roomIDs, err := repos.Users.GetRoomIDs(ctx, other.ID)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(roomIDs), 0)
+
+	// Only the owner restores the room, within the grace period.
+	assert.Equal(t, repos.Rooms.Restore(ctx, room.ID, owner.ID, time.Now()), ErrNotFound)
+	assert.Equal(t, repos.Rooms.Restore(ctx, room.ID, other.ID, time.Now().Add(-time.Hour)), ErrNotOwner)
+	assert.Equal(t, repos.Rooms.Restore(ctx, room.ID, owner.ID, time.Now().Add(-time.Hour)), nil)
+	stored, err := repos.Rooms.Get(ctx, room.ID)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(stored.Users), 1)
+	assert.Equal(t, stored.Users[0].ID, owner.ID)
+
+	// Deleted users keep their handle until purged.
+	assert.Equal(t, repos.Users.Delete(ctx, other.ID), nil)
+	_, err = repos.Users.Get(ctx, other.ID)
+	assert.Equal(t, err, ErrNotFound)
+	assert.Equal(t, repos.Rooms.AddUser(ctx, room.ID, other.ID), ErrNotFound)
+	assert.Equal(t, repos.Users.Register(ctx, owner.ID, "other", "hash"), ErrHandleTaken)
+	assert.Equal(t, repos.Users.Restore(ctx, other.ID, time.Now().Add(-time.Hour)), nil)
+	assert.Equal(t, repos.Users.Delete(ctx, other.ID), nil)
+
+	purged, err := repos.Users.Purge(ctx, time.Now().Add(-time.Hour))
+	assert.Equal(t, err, nil)
+	assert.Equal(t, purged, int64(0))
+	purged, err = repos.Users.Purge(ctx, time.Now().Add(time.Hour))
+	assert.Equal(t, err, nil)
+	assert.Equal(t, purged, int64(1))
+	assert.Equal(t, repos.Users.Restore(ctx, other.ID, time.Time{}), ErrNotFound)
+	assert.Equal(t, repos.Users.Register(ctx, owner.ID, "other", "hash"), nil)
+
+	// The room is deleted along with its last member, and then purged.
+	deleted, err := repos.Rooms.RemoveUser(ctx, room.ID, owner.ID)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, deleted, true)
+	purged, err = repos.Rooms.Purge(ctx, time.Now().Add(time.Hour))
+	assert.Equal(t, err, nil)
+	assert.Equal(t, purged, int64(1))
+	assert.Equal(t, repos.Rooms.Restore(ctx, room.ID, owner.ID, time.Time{}), ErrNotFound)
+}
+
+func TestMemoryArchive(t *testing.T) {
+	ctx := context.Background()
+	source := NewMemoryStore().Repositories()
+
+	user := models.User{Name: "user"}
+	assert.Equal(t, source.Users.CreateWithIdentity(ctx, &user, "issuer", "subject"), nil)
+	room := models.Room{ID: 1, Name: "room", OwnerID: user.ID, Users: []models.User{user}}
+	assert.Equal(t, source.Rooms.Create(ctx, &room), nil)
+
+	archive, err := source.Archives.Export(ctx)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, archive.Validate(), nil)
+	assert.Equal(t, archive.Users[0].Identities, []models.ArchiveIdentity{{Issuer: "issuer", Subject: "subject"}})
+
+	// Imported into another store, the user keeps its identity under a new ID.
+	target := NewMemoryStore().Repositories()
+	other := models.User{Name: "other"}
+	assert.Equal(t, target.Users.Create(ctx, &other), nil)
+	nextRoomID := uint64(100)
+	newRoomID := func() (uint64, error) { nextRoomID++; return nextRoomID, nil }
+	mapping, err := target.Archives.Import(ctx, &archive, newRoomID)
+	assert.Equal(t, err, nil)
+	assert.NotEqual(t, mapping.Users[user.ID], other.ID)
+	assert.Equal(t, mapping.Rooms[room.ID], uint64(101))
+
+	imported, err := target.Users.GetByIdentity(ctx, "issuer", "subject")
+	assert.Equal(t, err, nil)
+	assert.Equal(t, imported.ID, mapping.Users[user.ID])
+	stored, err := target.Rooms.Get(ctx, 101)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, stored.OwnerID, imported.ID)
+	assert.Equal(t, len(stored.Users), 1)
+
+	// Importing it again conflicts with the identity, and imports nothing.
+	_, err = target.Archives.Import(ctx, &archive, newRoomID)
+	assert.Equal(t, err, ErrIdentityTaken)
+	exported, err := target.Archives.Export(ctx)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(exported.Users), 2)
+	assert.Equal(t, len(exported.Rooms), 1)
+}
+
+func TestMemoryErase(t *testing.T) {
+	ctx := context.Background()
+	repos := NewMemoryStore().Repositories()
+
+	user := models.User{Name: "user"}
+	assert.Equal(t, repos.Users.CreateWithIdentity(ctx, &user, "issuer", "subject"), nil)
+	assert.Equal(t, repos.Users.Register(ctx, user.ID, "user", "hash"), nil)
+	room := models.Room{ID: 1, Name: "room", OwnerID: user.ID, Users: []models.User{user}}
+	assert.Equal(t, repos.Rooms.Create(ctx, &room), nil)
+	deletedRoom := models.Room{ID: 2, Name: "deleted", OwnerID: user.ID, Users: []models.User{user}}
+	assert.Equal(t, repos.Rooms.Create(ctx, &deletedRoom), nil)
+	assert.Equal(t, repos.Rooms.Close(ctx, deletedRoom.ID, user.ID), nil)
+
+	data, err := repos.Users.Export(ctx, user.ID)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, data.User.Registered, true)
+	assert.Equal(t, data.Identities, []models.PersonalIdentity{{Issuer: "issuer", Subject: "subject"}})
+	assert.Equal(t, len(data.Memberships), 1)
+	assert.Equal(t, len(data.RoomsOwned), 2)
+	assert.NotEqual(t, data.RoomsOwned[1].DeletedAt, nil)
+
+	// A user still in a room is not erased.
+	assert.Equal(t, repos.Users.Erase(ctx, user.ID), ErrInUse)
+	deleted, err := repos.Rooms.RemoveUser(ctx, room.ID, user.ID)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, deleted, true)
+
+	// Its rooms, identity and handle are gone for good, unlike a deleted user.
+	assert.Equal(t, repos.Users.Erase(ctx, user.ID), nil)
+	_, err = repos.Users.Export(ctx, user.ID)
+	assert.Equal(t, err, ErrNotFound)
+	assert.Equal(t, repos.Users.Restore(ctx, user.ID, time.Time{}), ErrNotFound)
+	assert.Equal(t, repos.Rooms.Restore(ctx, deletedRoom.ID, user.ID, time.Time{}), ErrNotFound)
+	_, err = repos.Users.GetByIdentity(ctx, "issuer", "subject")
+	assert.Equal(t, err, ErrNotFound)
+	other := models.User{Name: "other"}
+	assert.Equal(t, repos.Users.Create(ctx, &other), nil)
+	assert.Equal(t, repos.Users.Register(ctx, other.ID, "user", "hash"), nil)
+	assert.Equal(t, repos.Users.Erase(ctx, user.ID), ErrNotFound)
+}
@@ -0,0 +1,128 @@
+// Package repositories gives handlers access to the stored rooms and users, whatever the storage backend.
+package repositories
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Brawdunoir/dionysos-server/models"
+)
+
+var (
+	// ErrNotFound is returned when the requested room, user, membership or token does not exist.
+	ErrNotFound = errors.New("not found")
+	// ErrHandleTaken is returned when registering a user with the handle of another user.
+	ErrHandleTaken = errors.New("handle already taken")
+	// ErrIdentityTaken is returned when importing a user with an identity linked to another user.
+	ErrIdentityTaken = errors.New("identity already linked")
+	// ErrInUse is returned when deleting a room or a user that is still referenced, e.g. a room with users.
+	ErrInUse = errors.New("still in use")
+	// ErrAlreadyMember is returned when adding a user to a room it is already a member of.
+	ErrAlreadyMember = errors.New("already a member")
+	// ErrNotOwner is returned when acting on behalf of the owner of a room with a user who does not own it.
+	ErrNotOwner = errors.New("not the owner")
+	// ErrVersionMismatch is returned when updating a room or a user whose version is not one of the expected ones.
+	ErrVersionMismatch = errors.New("version mismatch")
+)
+
+// Repositories gathers the repositories of a storage backend.
+type Repositories struct {
+	Rooms    RoomRepository
+	Users    UserRepository
+	Archives ArchiveRepository
+}
+
+// RoomRepository stores rooms and their members.
+// Changes of the members are atomic, and keep the owner of a room among its members, the room being deleted along
+// with its last member. Every change of a room, or of the name of one of its members, increments its version.
+// Deleted rooms are soft-deleted: they are hidden, can be restored, and are only removed for good once purged.
+type RoomRepository interface {
+	// Get returns the room with the given ID along with its users, in the order they joined.
+	Get(ctx context.Context, id uint64) (models.Room, error)
+	// Create stores a new room, whose ID must be set, with its users as members. It sets its version.
+	Create(ctx context.Context, room *models.Room) error
+	// Update changes the name of a room. If versions is not nil, the room is only updated if its version is one of them,
+	// and it fails with ErrVersionMismatch otherwise.
+	Update(ctx context.Context, id uint64, update *models.RoomUpdate, versions []uint64) error
+	// SetOwner changes the owner of a room.
+	SetOwner(ctx context.Context, id, ownerID uint64) error
+	// Close deletes a room on behalf of its owner, removing all of its members.
+	// It fails with ErrNotOwner if ownerID does not own the room.
+	Close(ctx context.Context, id, ownerID uint64) error
+	// Restore restores a room deleted since the given time on behalf of its owner, who becomes its only member.
+	// It fails with ErrNotFound if no such room exists, and with ErrNotOwner if ownerID does not own the room.
+	Restore(ctx context.Context, id, ownerID uint64, since time.Time) error
+	// Purge removes for good the rooms deleted before the given time, and returns how many were removed.
+	Purge(ctx context.Context, before time.Time) (int64, error)
+	// AddUser makes a user a member of a room.
+	// It fails with ErrNotFound if the room does not exist, and with ErrAlreadyMember if the user is already a member.
+	AddUser(ctx context.Context, id, userID uint64) error
+	// RemoveUser removes a user from the members of a room, and reports whether the room was deleted as it has no
+	// members left. The ownership of the room is handed over to another member if the user owned it.
+	// It fails with ErrNotFound if the user is not a member.
+	RemoveUser(ctx context.Context, id, userID uint64) (deleted bool, err error)
+	// KickUser removes a user other than the owner from the members of a room on behalf of its owner.
+	// It fails with ErrNotOwner if ownerID does not own the room, e.g. because the owner left meanwhile,
+	// and with ErrNotFound if the user is not a member.
+	KickUser(ctx context.Context, id, ownerID, userID uint64) error
+}
+
+// UserRepository stores users, along with their external identities and refresh tokens.
+// Deleted users are soft-deleted as rooms are.
+type UserRepository interface {
+	// Get returns the user with the given ID.
+	Get(ctx context.Context, id uint64) (models.User, error)
+	// GetByHandle returns the registered user with the given handle.
+	GetByHandle(ctx context.Context, handle string) (models.User, error)
+	// GetByIdentity returns the user linked to the identity with the given subject at the given issuer.
+	GetByIdentity(ctx context.Context, issuer, subject string) (models.User, error)
+	// Create stores a new user and sets its ID and version.
+	Create(ctx context.Context, user *models.User) error
+	// CreateWithIdentity stores a new user linked to the given identity, replacing any previous link of the identity.
+	CreateWithIdentity(ctx context.Context, user *models.User, issuer, subject string) error
+	// Update changes the name of a user, incrementing its version along with the versions of its rooms.
+	// If versions is not nil, the user is only updated if its version is one of them,
+	// and it fails with ErrVersionMismatch otherwise.
+	Update(ctx context.Context, id uint64, update *models.UserUpdate, versions []uint64) error
+	// SetPassword replaces the password hash of a user.
+	SetPassword(ctx context.Context, id uint64, hash string) error
+	// RotatePassword replaces the password hash of a user and increments its token generation,
+	// so that the access tokens and stream tickets issued with the previous password are rejected.
+	RotatePassword(ctx context.Context, id uint64, hash string) error
+	// Register sets the handle and password hash of a user. It fails with ErrHandleTaken if another user has the handle.
+	Register(ctx context.Context, id uint64, handle, hash string) error
+	// Delete deletes a user along with its refresh tokens, its identities being kept until it is purged.
+	// It fails with ErrInUse if the user is still in a room.
+	Delete(ctx context.Context, id uint64) error
+	// Restore restores a user deleted since the given time. It fails with ErrNotFound if no such user exists.
+	Restore(ctx context.Context, id uint64, since time.Time) error
+	// Purge removes for good the users deleted before the given time along with their identities,
+	// and returns how many were removed.
+	Purge(ctx context.Context, before time.Time) (int64, error)
+	// GetRoomIDs returns the IDs of the rooms a user is in.
+	GetRoomIDs(ctx context.Context, id uint64) ([]uint64, error)
+	// Export returns the personal data of a user. It fails with ErrNotFound if the user does not exist.
+	Export(ctx context.Context, id uint64) (models.PersonalData, error)
+	// Erase deletes a user for good along with its identities, its refresh tokens and the deleted rooms it owns,
+	// which could only be restored by the user. It fails with ErrInUse if the user is still in a room.
+	Erase(ctx context.Context, id uint64) error
+
+	// CreateRefreshToken stores a refresh token, removing the expired ones of its user at the same time.
+	CreateRefreshToken(ctx context.Context, token *models.RefreshToken) error
+	// ConsumeRefreshToken deletes the unexpired refresh token with the given hash and returns it.
+	// Only one of concurrent calls with the same hash succeeds, the others fail with ErrNotFound.
+	ConsumeRefreshToken(ctx context.Context, hash string) (models.RefreshToken, error)
+	// DeleteRefreshTokens deletes the refresh tokens of a user.
+	DeleteRefreshTokens(ctx context.Context, userID uint64) error
+}
+
+// ArchiveRepository exports and imports the users, rooms and memberships of a storage backend, see models.Archive.
+type ArchiveRepository interface {
+	// Export returns an archive of the users and rooms which are not deleted, along with their memberships.
+	Export(ctx context.Context) (models.Archive, error)
+	// Import stores the users and rooms of a valid archive under new IDs, rooms getting theirs from newRoomID,
+	// and returns the IDs they were given. Either everything is imported or nothing is.
+	// It fails with ErrHandleTaken or ErrIdentityTaken if a handle or an identity of the archive is already used.
+	Import(ctx context.Context, archive *models.Archive, newRoomID func() (uint64, error)) (models.ArchiveMapping, error)
+}
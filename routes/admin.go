@@ -0,0 +1,187 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Brawdunoir/dionysos-server/models"
+	"github.com/Brawdunoir/dionysos-server/repositories"
+	"github.com/Brawdunoir/dionysos-server/utils"
+	e "github.com/Brawdunoir/dionysos-server/utils/errors"
+	l "github.com/Brawdunoir/dionysos-server/utils/logger"
+	routes "github.com/Brawdunoir/dionysos-server/utils/routes"
+	"github.com/gin-gonic/gin"
+)
+
+// GetLogLevel godoc
+// @Summary      Gets the current log level.
+// @Tags         Admin
+// @Security     AdminToken
+// @Produce      json
+// @Success      200 {object} utils.LogLevel
+// @Failure      401 {object} utils.ErrorResponse "Invalid admin token"
+// @Router       /admin/log-level [get]
+func GetLogLevel(c *gin.Context) {
+	c.JSON(http.StatusOK, routes.LogLevel{Level: l.Level.String()})
+}
+
+// UpdateLogLevel godoc
+// @Summary      Changes the log level at runtime.
+// @Description  Changes the log level until the server restarts, without affecting access logs. Possible levels are debug, info, warn, error, dpanic, panic and fatal.
+// @Tags         Admin
+// @Security     AdminToken
+// @Accept       json
+// @Produce      json
+// @Param        level body utils.LogLevel true "New log level"
+// @Success      200 {object} utils.LogLevel
+// @Failure      400 {object} utils.ErrorResponse "Invalid request"
+// @Failure      401 {object} utils.ErrorResponse "Invalid admin token"
+// @Router       /admin/log-level [put]
+func UpdateLogLevel(c *gin.Context) {
+	var level routes.LogLevel
+
+	if err := c.ShouldBindJSON(&level); err != nil {
+		c.Error(err).SetMeta("UpdateLogLevel.ShouldBindJSON")
+		c.AbortWithError(http.StatusBadRequest, e.FailJSONBind{}).SetMeta("UpdateLogLevel.ShouldBindJSON")
+		return
+	}
+
+	previous := l.Level.String()
+	if err := l.Level.UnmarshalText([]byte(level.Level)); err != nil {
+		c.Error(err).SetMeta("UpdateLogLevel.UnmarshalText")
+		c.AbortWithError(http.StatusBadRequest, e.InvalidLogLevel{}).SetMeta("UpdateLogLevel.UnmarshalText")
+		return
+	}
+
+	l.FromContext(c).Warnf("Log level changed from %s to %s", previous, l.Level.String())
+
+	c.JSON(http.StatusOK, routes.LogLevel{Level: l.Level.String()})
+}
+
+// RestoreUser godoc
+// @Summary      Restores a deleted user.
+// @Description  Restores a user deleted during the restore period, 24 hours by default. The user does not get its rooms back.
+// @Tags         Admin
+// @Security     AdminToken
+// @Produce      json
+// @Param        id path int true "User ID"
+// @Success      204
+// @Failure      400 {object} utils.ErrorResponse "Invalid request"
+// @Failure      401 {object} utils.ErrorResponse "Invalid admin token"
+// @Failure      404 {object} utils.ErrorResponse "User not found"
+// @Failure      500 {object} utils.ErrorResponse "Internal server error"
+// @Router       /admin/users/{id}/restore [post]
+func RestoreUser(c *gin.Context) {
+	ctx, cancelCtx := context.WithTimeout(c, 1000*time.Millisecond)
+	defer cancelCtx()
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.Error(err).SetMeta("RestoreUser.ParseUint")
+		c.AbortWithError(http.StatusBadRequest, e.InvalidID{}).SetMeta("RestoreUser.ParseUint")
+		return
+	}
+
+	err = users.Restore(ctx, id, time.Now().Add(-restorePeriod))
+	if errors.Is(err, repositories.ErrNotFound) {
+		c.Error(err).SetMeta("RestoreUser.Restore")
+		c.AbortWithError(http.StatusNotFound, e.UserNotFound{}).SetMeta("RestoreUser.Restore")
+		return
+	} else if err != nil {
+		c.Error(err).SetMeta("RestoreUser.Restore")
+		c.AbortWithError(http.StatusInternalServerError, e.UserNotRestored{}).SetMeta("RestoreUser.Restore")
+		return
+	}
+	routes.TagCache(c, routes.UserTag(id))
+
+	l.FromContext(c).Warnf("User %v restored", id)
+
+	c.JSON(http.StatusNoContent, nil)
+}
+
+// ExportArchive godoc
+// @Summary      Exports the users, rooms and memberships.
+// @Description  Returns a versioned archive of the users and rooms which are not deleted, along with their memberships,
+// @Description  to back them up or import them into another instance. It holds the password hashes of the users.
+// @Tags         Admin
+// @Security     AdminToken
+// @Produce      json
+// @Success      200 {object} models.Archive
+// @Failure      401 {object} utils.ErrorResponse "Invalid admin token"
+// @Failure      500 {object} utils.ErrorResponse "Internal server error"
+// @Router       /admin/export [get]
+func ExportArchive(c *gin.Context) {
+	ctx, cancelCtx := context.WithTimeout(c, 30*time.Second)
+	defer cancelCtx()
+
+	archive, err := archives.Export(ctx)
+	if err != nil {
+		c.Error(err).SetMeta("ExportArchive.Export")
+		c.AbortWithError(http.StatusInternalServerError, e.ArchiveNotExported{}).SetMeta("ExportArchive.Export")
+		return
+	}
+
+	l.FromContext(c).Warnf("Exported %d users and %d rooms", len(archive.Users), len(archive.Rooms))
+
+	c.Header("Content-Disposition", `attachment; filename="dionysos-`+archive.ExportedAt.UTC().Format("20060102T150405Z")+`.json"`)
+	c.JSON(http.StatusOK, archive)
+}
+
+// ImportArchive godoc
+// @Summary      Imports users, rooms and memberships.
+// @Description  Imports an archive from the export endpoint, of this instance or of another one, next to the existing users and rooms.
+// @Description  Users and rooms are given new IDs, returned by archive ID. Either everything is imported or nothing is.
+// @Tags         Admin
+// @Security     AdminToken
+// @Accept       json
+// @Produce      json
+// @Param        archive body models.Archive true "Archive"
+// @Success      201 {object} models.ArchiveMapping
+// @Failure      400 {object} utils.ErrorResponse "Invalid request"
+// @Failure      401 {object} utils.ErrorResponse "Invalid admin token"
+// @Failure      409 {object} utils.ErrorResponse "Handle already taken or identity already linked"
+// @Failure      500 {object} utils.ErrorResponse "Internal server error"
+// @Router       /admin/import [post]
+func ImportArchive(c *gin.Context) {
+	var archive models.Archive
+	ctx, cancelCtx := context.WithTimeout(c, 30*time.Second)
+	defer cancelCtx()
+
+	if err := c.ShouldBindJSON(&archive); err != nil {
+		c.Error(err).SetMeta("ImportArchive.ShouldBindJSON")
+		c.AbortWithError(http.StatusBadRequest, e.FailJSONBind{}).SetMeta("ImportArchive.ShouldBindJSON")
+		return
+	}
+
+	if err := archive.Validate(); err != nil {
+		c.Error(err).SetMeta("ImportArchive.Validate")
+		c.AbortWithError(http.StatusBadRequest, e.InvalidArchive{}).SetMeta("ImportArchive.Validate")
+		return
+	}
+
+	mapping, err := archives.Import(ctx, &archive, utils.UUIDGenerator.NextID)
+	if errors.Is(err, repositories.ErrHandleTaken) {
+		c.Error(err).SetMeta("ImportArchive.Import")
+		c.AbortWithError(http.StatusConflict, e.HandleAlreadyTaken{}).SetMeta("ImportArchive.Import")
+		return
+	} else if errors.Is(err, repositories.ErrIdentityTaken) {
+		c.Error(err).SetMeta("ImportArchive.Import")
+		c.AbortWithError(http.StatusConflict, e.IdentityAlreadyLinked{}).SetMeta("ImportArchive.Import")
+		return
+	} else if err != nil {
+		c.Error(err).SetMeta("ImportArchive.Import")
+		c.AbortWithError(http.StatusInternalServerError, e.ArchiveNotImported{}).SetMeta("ImportArchive.Import")
+		return
+	}
+
+	for _, id := range mapping.Rooms {
+		_ = roomStreamsList.CreateStream(id)
+	}
+
+	l.FromContext(c).Warnf("Imported %d users and %d rooms", len(mapping.Users), len(mapping.Rooms))
+
+	c.JSON(http.StatusCreated, mapping)
+}
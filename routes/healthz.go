@@ -1,11 +1,103 @@
 package routes
 
 import (
+	"context"
 	"net/http"
+	"strconv"
+	"sync"
+	"time"
 
+	utils "github.com/Brawdunoir/dionysos-server/utils/routes"
 	"github.com/gin-gonic/gin"
 )
 
+const (
+	statusOK          = "ok"
+	statusUnavailable = "unavailable"
+)
+
+// Check checks a dependency of the API and returns an error if it is unavailable.
+type Check func(ctx context.Context) error
+
+// readinessChecks are the dependencies checked by Readyz, indexed by name. They are registered when setting up the router.
+var readinessChecks = make(map[string]Check)
+
+// Healthz reports the server as healthy, unless it is shutting down.
 func Healthz(c *gin.Context) {
+	if shuttingDown.Load() {
+		c.JSON(http.StatusServiceUnavailable, utils.CreateErrorResponse(c, "Server shutting down"))
+		return
+	}
 	c.JSON(http.StatusOK, nil)
 }
+
+// Livez godoc
+// @Summary      Liveness probe.
+// @Description  Reports the process as alive. It does not check any dependency and keeps on succeeding while the server shuts down.
+// @Tags         Misc
+// @Produce      json
+// @Success      200 {object} utils.HealthResponse
+// @Router       /livez [get]
+func Livez(c *gin.Context) {
+	c.JSON(http.StatusOK, utils.HealthResponse{Status: statusOK})
+}
+
+// Readyz godoc
+// @Summary      Readiness probe.
+// @Description  Checks every dependency of the API (database, cache, event broadcaster) and reports their status along with the check latency.
+// @Description  The server is reported as not ready as soon as it starts shutting down.
+// @Tags         Misc
+// @Produce      json
+// @Param        verbose query bool false "Include the error of failed checks"
+// @Success      200 {object} utils.HealthResponse
+// @Failure      503 {object} utils.HealthResponse "At least one dependency is unavailable or the server is shutting down"
+// @Router       /readyz [get]
+func Readyz(c *gin.Context) {
+	ctx, cancelCtx := context.WithTimeout(c, 1000*time.Millisecond)
+	defer cancelCtx()
+
+	verbose := false
+	if value, ok := c.GetQuery("verbose"); ok {
+		verbose, _ = strconv.ParseBool(value)
+		verbose = verbose || value == ""
+	}
+
+	res := utils.HealthResponse{Status: statusOK, Checks: make(map[string]utils.CheckResult, len(readinessChecks))}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range readinessChecks {
+		wg.Add(1)
+		go func(name string, check Check) {
+			defer wg.Done()
+
+			start := time.Now()
+			err := check(ctx)
+			result := utils.CheckResult{Status: statusOK, Latency: time.Since(start).String()}
+			if err != nil {
+				result.Status = statusUnavailable
+				if verbose {
+					result.Error = err.Error()
+				}
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			res.Checks[name] = result
+			if err != nil {
+				res.Status = statusUnavailable
+			}
+		}(name, check)
+	}
+	wg.Wait()
+
+	if shuttingDown.Load() {
+		res.Status = statusUnavailable
+	}
+
+	if res.Status != statusOK {
+		c.JSON(http.StatusServiceUnavailable, res)
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
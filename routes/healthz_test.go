@@ -0,0 +1,58 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/assert/v2"
+)
+
+// serveTest serves a request to the given handler and returns the response.
+func serveTest(handler gin.HandlerFunc, target string) *httptest.ResponseRecorder {
+	router := gin.New()
+	router.GET("/*path", handler)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+	return w
+}
+
+// setReadinessChecks replaces the readiness checks for the duration of the test.
+func setReadinessChecks(t *testing.T, checks map[string]Check) {
+	previous := readinessChecks
+	readinessChecks = checks
+	t.Cleanup(func() { readinessChecks = previous })
+}
+
+func TestReadyzFailingCheck(t *testing.T) {
+	setReadinessChecks(t, map[string]Check{
+		"healthy": func(ctx context.Context) error { return nil },
+		"failing": func(ctx context.Context) error { return errors.New("connection refused") },
+	})
+
+	healthy := `"healthy":{"status":"ok","latency":"[^"]+"}`
+	failing := `"failing":{"status":"unavailable","latency":"[^"]+"}`
+	failingVerbose := `"failing":{"status":"unavailable","latency":"[^"]+","error":"connection refused"}`
+
+	tests := []struct {
+		name   string
+		target string
+		body   string
+	}{
+		{"Not verbose", "/readyz", `^{"status":"unavailable","checks":{` + failing + `,` + healthy + `}}$`},
+		{"Verbose", "/readyz?verbose", `^{"status":"unavailable","checks":{` + failingVerbose + `,` + healthy + `}}$`},
+		{"Explicitly verbose", "/readyz?verbose=true", `^{"status":"unavailable","checks":{` + failingVerbose + `,` + healthy + `}}$`},
+		{"Explicitly not verbose", "/readyz?verbose=false", `^{"status":"unavailable","checks":{` + failing + `,` + healthy + `}}$`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := serveTest(Readyz, test.target)
+			assert.Equal(t, w.Code, http.StatusServiceUnavailable)
+			assert.MatchRegex(t, w.Body.String(), test.body)
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package routes
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Brawdunoir/dionysos-server/auth"
+	"github.com/Brawdunoir/dionysos-server/metrics"
+	"github.com/Brawdunoir/dionysos-server/models"
+	"github.com/Brawdunoir/dionysos-server/repositories"
+	e "github.com/Brawdunoir/dionysos-server/utils/errors"
+	"github.com/Brawdunoir/dionysos-server/variables"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// oidcCookie holds the state, nonce and PKCE verifier of a login in progress.
+	oidcCookie = "dionysos_oidc"
+	// oidcLoginTimeout is the time given to users to log in with the identity provider.
+	oidcLoginTimeout = 10 * time.Minute
+	// oidcDefaultName is the name of users whose identity provider did not give any valid one.
+	oidcDefaultName = "user"
+)
+
+// OIDCLogin godoc
+// @Summary      Starts logging in with the OpenID Connect provider.
+// @Description  Redirects to the OpenID Connect provider, which redirects back to /oidc/callback once the user logged in.
+// @Description  Only available if an OpenID Connect provider is configured.
+// @Tags         OIDC
+// @Success      302
+// @Failure      500 {object} utils.ErrorResponse "Internal server error"
+// @Router       /oidc/login [get]
+func OIDCLogin(c *gin.Context) {
+	var secrets [3]string
+	for i := range secrets {
+		secret, err := auth.GeneratePassword()
+		if err != nil {
+			c.Error(err).SetMeta("OIDCLogin.GeneratePassword")
+			c.AbortWithError(http.StatusInternalServerError, e.TokenNotCreated{}).SetMeta("OIDCLogin.GeneratePassword")
+			return
+		}
+		secrets[i] = secret
+	}
+	state, nonce, verifier := secrets[0], secrets[1], secrets[2]
+
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcCookie, strings.Join(secrets[:], "."), int(oidcLoginTimeout.Seconds()), variables.BasePath+"/oidc",
+		"", variables.Environment == variables.ENVIRONMENT_PRODUCTION, true)
+	c.Redirect(http.StatusFound, identityProvider.AuthCodeURL(state, nonce, verifier))
+}
+
+// OIDCCallback godoc
+// @Summary      Ends logging in with the OpenID Connect provider.
+// @Description  Called by the OpenID Connect provider once the user logged in. Returns the URI of the user,
+// @Description  along with an access token and a refresh token as /token does. A user is created the first time it logs in.
+// @Description  Only available if an OpenID Connect provider is configured.
+// @Tags         OIDC
+// @Produce      json
+// @Param        code  query string true "Authorization code"
+// @Param        state query string true "State"
+// @Success      200 {object} utils.TokenResponse
+// @Failure      401 {object} utils.ErrorResponse "Identity not verified"
+// @Failure      429 {object} utils.ErrorResponse "Too many requests"
+// @Failure      500 {object} utils.ErrorResponse "Internal server error"
+// @Router       /oidc/callback [get]
+func OIDCCallback(c *gin.Context) {
+	// Leave time to the identity provider to answer, on top of the database.
+	ctx, cancelCtx := context.WithTimeout(c, 5000*time.Millisecond)
+	defer cancelCtx()
+
+	cookie, err := c.Cookie(oidcCookie)
+	if err != nil {
+		c.Error(err).SetMeta("OIDCCallback.Cookie")
+		c.AbortWithError(http.StatusUnauthorized, e.IdentityNotVerified{}).SetMeta("OIDCCallback.Cookie")
+		return
+	}
+	// The login is over whatever happens next.
+	c.SetCookie(oidcCookie, "", -1, variables.BasePath+"/oidc", "", variables.Environment == variables.ENVIRONMENT_PRODUCTION, true)
+
+	secrets := strings.Split(cookie, ".")
+	if len(secrets) != 3 || subtle.ConstantTimeCompare([]byte(secrets[0]), []byte(c.Query("state"))) != 1 {
+		c.AbortWithError(http.StatusUnauthorized, e.IdentityNotVerified{}).SetMeta("OIDCCallback.CompareState")
+		return
+	}
+	if providerError, ok := c.GetQuery("error"); ok {
+		c.Error(errors.New(providerError)).SetMeta("OIDCCallback.ProviderError")
+		c.AbortWithError(http.StatusUnauthorized, e.IdentityNotVerified{}).SetMeta("OIDCCallback.ProviderError")
+		return
+	}
+
+	identity, err := identityProvider.Exchange(ctx, c.Query("code"), secrets[1], secrets[2])
+	if err != nil {
+		c.Error(err).SetMeta("OIDCCallback.Exchange")
+		c.AbortWithError(http.StatusUnauthorized, e.IdentityNotVerified{}).SetMeta("OIDCCallback.Exchange")
+		return
+	}
+
+	user, err := userFromIdentity(ctx, identity)
+	if err != nil {
+		c.Error(err).SetMeta("OIDCCallback.userFromIdentity")
+		c.AbortWithError(http.StatusInternalServerError, e.UserNotCreated{}).SetMeta("OIDCCallback.userFromIdentity")
+		return
+	}
+
+	res, err := issueTokens(ctx, user)
+	if err != nil {
+		c.Error(err).SetMeta("OIDCCallback.issueTokens")
+		c.AbortWithError(http.StatusInternalServerError, e.TokenNotCreated{}).SetMeta("OIDCCallback.issueTokens")
+		return
+	}
+	res.URI = "/users/" + fmt.Sprint(user.ID)
+
+	c.JSON(http.StatusOK, res)
+}
+
+// userFromIdentity returns the user linked to an identity.
+// A user is created if there is none yet, or if it has been deleted since.
+func userFromIdentity(ctx context.Context, identity *auth.Identity) (models.User, error) {
+	user, err := users.GetByIdentity(ctx, identity.Issuer, identity.Subject)
+	if err == nil {
+		return user, nil
+	} else if !errors.Is(err, repositories.ErrNotFound) {
+		return models.User{}, err
+	}
+
+	// Users logging in with OIDC do not know their password, but can get one from /users/{id}/credentials.
+	password, err := auth.GeneratePassword()
+	if err != nil {
+		return models.User{}, err
+	}
+	hash, err := auth.HashPassword(password)
+	if err != nil {
+		return models.User{}, err
+	}
+	user = models.User{Name: identityName(identity.Name), Password: hash}
+	err = users.CreateWithIdentity(ctx, &user, identity.Issuer, identity.Subject)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	metrics.UsersCreated.Inc()
+	return user, nil
+}
+
+// identityName returns a valid user name from the name given by an identity provider.
+func identityName(name string) string {
+	name = strings.TrimSpace(name)
+	if utf8.RuneCountInString(name) > 20 {
+		name = string([]rune(name)[:20])
+	}
+	if utf8.RuneCountInString(name) < 2 {
+		return oidcDefaultName
+	}
+	return name
+}
@@ -3,29 +3,37 @@ package routes
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"strconv"
 	"time"
 
+	"github.com/Brawdunoir/dionysos-server/metrics"
 	"github.com/Brawdunoir/dionysos-server/models"
+	"github.com/Brawdunoir/dionysos-server/repositories"
+	"github.com/Brawdunoir/dionysos-server/tracing"
 	"github.com/Brawdunoir/dionysos-server/utils"
 	e "github.com/Brawdunoir/dionysos-server/utils/errors"
 	l "github.com/Brawdunoir/dionysos-server/utils/logger"
 	routes "github.com/Brawdunoir/dionysos-server/utils/routes"
+	"github.com/gin-contrib/sse"
 	"github.com/gin-gonic/gin"
-	"golang.org/x/exp/slices"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Keep track of all SSE channels that are currently on service.
-var roomStreamsList = make(map[uint64]*utils.Stream)
+var roomStreamsList = utils.NewStreams()
 var SSEMessage = utils.Message{Event: "roomUpdate"}
+var roomClosedMessage = utils.Message{Event: "roomClosed"}
 
 // CreateRoom godoc
 // @Summary      Creates a room.
 // @Tags         Rooms
 // @Security     BasicAuth
+// @Security     BearerAuth
 // @Accept       json
 // @Produce      json
 // @Param        room body models.RoomUpdate true "Room object"
@@ -65,15 +73,17 @@ func CreateRoom(c *gin.Context) {
 	room.OwnerID = user.ID
 	room.Users = append(room.Users, user)
 
-	err = db.WithContext(ctx).Create(&room).Error
+	err = rooms.Create(ctx, room)
 	if err != nil {
 		c.Error(err).SetMeta("CreateRoom.Create")
 		c.AbortWithError(http.StatusInternalServerError, e.RoomNotCreated{}).SetMeta("CreateRoom.Create")
 		return
 	}
 
+	metrics.RoomsCreated.Inc()
+
 	// Create a new SSE channel for the room.
-	_ = utils.CreateStream(room.ID, roomStreamsList)
+	_ = roomStreamsList.CreateStream(room.ID)
 
 	c.JSON(http.StatusCreated, routes.CreateResponse{URI: "/rooms/" + fmt.Sprint(room.ID)})
 }
@@ -82,12 +92,16 @@ func CreateRoom(c *gin.Context) {
 // @Summary      Gets a room.
 // @Tags         Rooms
 // @Security     BasicAuth
+// @Security     BearerAuth
 // @Produce      json
-// @Param        id path int true "Room ID"
+// @Param        id            path   int    true  "Room ID"
+// @Param        If-None-Match header string false "ETag of a previously fetched version"
 // @Success      200 {object} models.Room
+// @Header       200 {string} ETag "Version of the room"
+// @Success      304 "Room not modified since the given version"
 // @Failure      400 {object} utils.ErrorResponse "Invalid request"
 // @Failure      401 {object} utils.ErrorResponse "User not authorized"
-// @Failure      404 {object} utils.ErrorResponse "Room not found or invalid user in auth method"
+// @Failure      404 {object} utils.ErrorResponse "Room not found"
 // @Failure      500 {object} utils.ErrorResponse "Internal server error"
 // @Router       /rooms/{id} [get]
 func GetRoom(c *gin.Context) {
@@ -102,6 +116,15 @@ func GetRoom(c *gin.Context) {
 		return
 	}
 
+	routes.TagCache(c, routes.RoomTag(room.ID))
+	for _, user := range room.Users {
+		routes.TagCache(c, routes.UserTag(user.ID))
+	}
+
+	if routes.NotModified(c, room.Version) {
+		return
+	}
+
 	c.JSON(http.StatusOK, room)
 }
 
@@ -109,14 +132,17 @@ func GetRoom(c *gin.Context) {
 // @Summary      Updates a room.
 // @Tags         Rooms
 // @Security     BasicAuth
+// @Security     BearerAuth
 // @Accept       json
 // @Produce      json
-// @Param        id   path int               true "Room ID"
-// @Param        room body models.RoomUpdate true "Room object"
+// @Param        id       path   int               true  "Room ID"
+// @Param        If-Match header string            false "ETag the room must still have to be updated"
+// @Param        room     body   models.RoomUpdate true  "Room object"
 // @Success      204
 // @Failure      400 {object} utils.ErrorResponse "Invalid request"
 // @Failure      401 {object} utils.ErrorResponse "User not authorized"
-// @Failure      404 {object} utils.ErrorResponse "Room not found or invalid user in auth method"
+// @Failure      404 {object} utils.ErrorResponse "Room not found"
+// @Failure      412 {object} utils.ErrorResponse "Room modified since the given version"
 // @Failure      500 {object} utils.ErrorResponse "Internal server error"
 // @Router       /rooms/{id} [patch]
 func UpdateRoom(c *gin.Context) {
@@ -144,20 +170,144 @@ func UpdateRoom(c *gin.Context) {
 		return
 	}
 
-	err = db.WithContext(ctx).Model(&room).Updates(r.ToRoom()).Error
+	err = rooms.Update(ctx, room.ID, &r, routes.IfMatch(c))
 	if err != nil {
 		c.Error(err).SetMeta("UpdateRoom.Updates")
-		c.AbortWithError(http.StatusInternalServerError, e.RoomNotModified{}).SetMeta("UpdateRoom.Updates")
+		switch {
+		case errors.Is(err, repositories.ErrVersionMismatch):
+			c.AbortWithError(http.StatusPreconditionFailed, e.ResourceModified{}).SetMeta("UpdateRoom.Updates")
+		case errors.Is(err, repositories.ErrNotFound):
+			c.AbortWithError(http.StatusNotFound, e.RoomNotFound{}).SetMeta("UpdateRoom.Updates")
+		default:
+			c.AbortWithError(http.StatusInternalServerError, e.RoomNotModified{}).SetMeta("UpdateRoom.Updates")
+		}
 		return
 	}
+	routes.TagCache(c, routes.RoomTag(room.ID))
 
-	stream, err := utils.GetStream(room.ID, roomStreamsList)
+	stream, err := roomStreamsList.GetStream(room.ID)
 	if err != nil {
-		l.Logger.Warnf("Failed to get stream: %v", err)
+		l.FromContext(c).Warnf("Failed to get stream: %v", err)
 	} else {
-		stream.Distribute(SSEMessage)
+		stream.Distribute(ctx, SSEMessage)
+	}
+
+	c.JSON(http.StatusNoContent, nil)
+}
+
+// CloseRoom godoc
+// @Summary      Closes a room.
+// @Description  Deletes the room on behalf of its owner, disconnecting all of its users.
+// @Description  A "roomClosed" event is sent to the subscribers of its stream, which is then closed.
+// @Description  The owner can restore it during the restore period, 24 hours by default.
+// @Tags         Rooms
+// @Security     BasicAuth
+// @Security     BearerAuth
+// @Produce      json
+// @Param        id path int true "Room ID"
+// @Success      204
+// @Failure      400 {object} utils.ErrorResponse "Invalid request"
+// @Failure      401 {object} utils.ErrorResponse "User not authorized"
+// @Failure      404 {object} utils.ErrorResponse "Room not found"
+// @Failure      500 {object} utils.ErrorResponse "Internal server error"
+// @Router       /rooms/{id} [delete]
+func CloseRoom(c *gin.Context) {
+	ctx, cancelCtx := context.WithTimeout(c, 1000*time.Millisecond)
+	defer cancelCtx()
+
+	room, err := routes.ExtractRoomFromContext(c)
+	if err != nil {
+		c.Error(err).SetMeta("CloseRoom.ExtractRoomFromContext")
+		c.AbortWithError(http.StatusInternalServerError, e.RoomNotInContext{}).SetMeta("CloseRoom.ExtractRoomFromContext")
+		return
+	}
+
+	// Check if requester is the owner of the room.
+	err = routes.AssertUser(c, room.OwnerID)
+	if err != nil {
+		return
 	}
 
+	// The ownership may have been handed over, or the room deleted, since the room was retrieved.
+	err = rooms.Close(ctx, room.ID, room.OwnerID)
+	if errors.Is(err, repositories.ErrNotOwner) {
+		c.Error(err).SetMeta("CloseRoom.Close")
+		c.AbortWithError(http.StatusUnauthorized, e.UserNotAuthorized{}).SetMeta("CloseRoom.Close")
+		return
+	} else if errors.Is(err, repositories.ErrNotFound) {
+		c.Error(err).SetMeta("CloseRoom.Close")
+		c.AbortWithError(http.StatusNotFound, e.RoomNotFound{}).SetMeta("CloseRoom.Close")
+		return
+	} else if err != nil {
+		c.Error(err).SetMeta("CloseRoom.Close")
+		c.AbortWithError(http.StatusInternalServerError, e.RoomNotDeleted{}).SetMeta("CloseRoom.Close")
+		return
+	}
+	routes.TagCache(c, routes.RoomTag(room.ID))
+
+	metrics.RoomsDeleted.Inc()
+	l.FromContext(c).Infof("Room %v closed", room.ID)
+
+	// Tell the subscribers the room is gone and end their streams, a restored room getting a new one.
+	roomStreamsList.DeleteStream(room.ID, roomClosedMessage)
+
+	c.JSON(http.StatusNoContent, nil)
+}
+
+// RestoreRoom godoc
+// @Summary      Restores a room.
+// @Description  Restores a room deleted during the restore period, 24 hours by default, on behalf of its owner.
+// @Description  The owner is connected to the room again, the other users have to reconnect.
+// @Tags         Rooms
+// @Security     BasicAuth
+// @Security     BearerAuth
+// @Produce      json
+// @Param        id path int true "Room ID"
+// @Success      204
+// @Failure      400 {object} utils.ErrorResponse "Invalid request"
+// @Failure      401 {object} utils.ErrorResponse "User not authorized"
+// @Failure      404 {object} utils.ErrorResponse "Room not found"
+// @Failure      500 {object} utils.ErrorResponse "Internal server error"
+// @Router       /rooms/{id}/restore [post]
+func RestoreRoom(c *gin.Context) {
+	ctx, cancelCtx := context.WithTimeout(c, 1000*time.Millisecond)
+	defer cancelCtx()
+
+	user, err := routes.ExtractUserFromContext(c)
+	if err != nil {
+		c.Error(err).SetMeta("RestoreRoom.ExtractUserFromContext")
+		c.AbortWithError(http.StatusInternalServerError, e.UserNotInContext{}).SetMeta("RestoreRoom.ExtractUserFromContext")
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.Error(err).SetMeta("RestoreRoom.ParseUint")
+		c.AbortWithError(http.StatusBadRequest, e.InvalidID{}).SetMeta("RestoreRoom.ParseUint")
+		return
+	}
+
+	err = rooms.Restore(ctx, id, user.ID, time.Now().Add(-restorePeriod))
+	if errors.Is(err, repositories.ErrNotFound) {
+		c.Error(err).SetMeta("RestoreRoom.Restore")
+		c.AbortWithError(http.StatusNotFound, e.RoomNotFound{}).SetMeta("RestoreRoom.Restore")
+		return
+	} else if errors.Is(err, repositories.ErrNotOwner) {
+		c.Error(err).SetMeta("RestoreRoom.Restore")
+		c.AbortWithError(http.StatusUnauthorized, e.UserNotAuthorized{}).SetMeta("RestoreRoom.Restore")
+		return
+	} else if err != nil {
+		c.Error(err).SetMeta("RestoreRoom.Restore")
+		c.AbortWithError(http.StatusInternalServerError, e.RoomNotRestored{}).SetMeta("RestoreRoom.Restore")
+		return
+	}
+	routes.TagCache(c, routes.RoomTag(id))
+
+	l.FromContext(c).Infof("Room %v restored", id)
+
+	// Closing the room deleted its stream, recreate it.
+	_ = roomStreamsList.CreateStream(id)
+
 	c.JSON(http.StatusNoContent, nil)
 }
 
@@ -165,13 +315,15 @@ func UpdateRoom(c *gin.Context) {
 // @Summary      Connects a user to a room.
 // @Tags         Rooms
 // @Security     BasicAuth
+// @Security     BearerAuth
 // @Produce      json
 // @Param        id path int true "Room ID"
 // @Success      204
 // @Failure      400 {object} utils.ErrorResponse "Invalid request"
 // @Failure      401 {object} utils.ErrorResponse "User not authorized"
-// @Failure      404 {object} utils.ErrorResponse "Room not found or invalid user in auth method"
+// @Failure      404 {object} utils.ErrorResponse "Room not found"
 // @Failure      409 {object} utils.ErrorResponse "User already in room"
+// @Failure      429 {object} utils.ErrorResponse "Too many requests"
 // @Failure      500 {object} utils.ErrorResponse "Internal server error"
 // @Router       /rooms/{id}/connect [patch]
 func ConnectUserToRoom(c *gin.Context) {
@@ -193,25 +345,32 @@ func ConnectUserToRoom(c *gin.Context) {
 	}
 
 	// Assert user is not already in the room.
-	if slices.Contains(room.Users, user) {
+	if room.HasUser(user.ID) {
 		c.AbortWithError(http.StatusConflict, e.UserAlreadyInRoom{}).SetMeta("ConnectUserToRoom.Contains")
 		return
 	}
 
-	room.Users = append(room.Users, user)
-
-	err = db.WithContext(ctx).Save(&room).Error
-	if err != nil {
-		c.Error(err).SetMeta("ConnectUserToRoom.Save")
-		c.AbortWithError(http.StatusInternalServerError, e.RoomNotModified{}).SetMeta("ConnectUserToRoom.Save")
+	// The user may have joined, or the room may have been deleted, since the room was retrieved.
+	err = rooms.AddUser(ctx, room.ID, user.ID)
+	if errors.Is(err, repositories.ErrAlreadyMember) {
+		c.AbortWithError(http.StatusConflict, e.UserAlreadyInRoom{}).SetMeta("ConnectUserToRoom.AddUser")
+		return
+	} else if errors.Is(err, repositories.ErrNotFound) {
+		c.Error(err).SetMeta("ConnectUserToRoom.AddUser")
+		c.AbortWithError(http.StatusNotFound, e.RoomNotFound{}).SetMeta("ConnectUserToRoom.AddUser")
+		return
+	} else if err != nil {
+		c.Error(err).SetMeta("ConnectUserToRoom.AddUser")
+		c.AbortWithError(http.StatusInternalServerError, e.RoomNotModified{}).SetMeta("ConnectUserToRoom.AddUser")
 		return
 	}
+	routes.TagCache(c, routes.RoomTag(room.ID))
 
-	stream, err := utils.GetStream(room.ID, roomStreamsList)
+	stream, err := roomStreamsList.GetStream(room.ID)
 	if err != nil {
-		l.Logger.Warnf("Failed to get stream: %v", err)
+		l.FromContext(c).Warnf("Failed to get stream: %v", err)
 	} else {
-		stream.Distribute(SSEMessage)
+		stream.Distribute(ctx, SSEMessage)
 	}
 
 	c.JSON(http.StatusNoContent, nil)
@@ -221,12 +380,14 @@ func ConnectUserToRoom(c *gin.Context) {
 // @Summary      Disconnects a user from a room.
 // @Tags         Rooms
 // @Security     BasicAuth
+// @Security     BearerAuth
 // @Produce      json
 // @Param        id path int true "Room ID"
 // @Success      204
 // @Failure      400 {object} utils.ErrorResponse "Invalid request"
 // @Failure      401 {object} utils.ErrorResponse "User not authorized"
-// @Failure      404 {object} utils.ErrorResponse "Room not found or invalid user in auth method"
+// @Failure      404 {object} utils.ErrorResponse "Room not found"
+// @Failure      429 {object} utils.ErrorResponse "Too many requests"
 // @Failure      500 {object} utils.ErrorResponse "Internal server error"
 // @Router       /rooms/{id}/disconnect [patch]
 func DisconnectUserFromRoom(c *gin.Context) {
@@ -247,44 +408,43 @@ func DisconnectUserFromRoom(c *gin.Context) {
 		return
 	}
 
-	// Remove user from the connected users list of the room
-	err = room.RemoveUser(ctx, db, &user)
-	if err != nil {
+	err = leaveRoom(ctx, c, room.ID, user.ID)
+	if errors.Is(err, repositories.ErrNotFound) {
 		c.Error(err).SetMeta("DisconnectUserFromRoom.RemoveUser")
-		c.AbortWithError(http.StatusBadRequest, e.RoomNotModified{}).SetMeta("DisconnectUserFromRoom.RemoveUser")
+		c.AbortWithError(http.StatusBadRequest, e.UserNotInRoom{}).SetMeta("DisconnectUserFromRoom.RemoveUser")
 		return
-	}
-
-	// We want to delete an empty room and keep an owner at every instant.
-	if len(room.Users) == 0 {
-		result := db.WithContext(ctx).Delete(&room)
-		if result.Error != nil {
-			c.Error(result.Error).SetMeta("DisconnectUserFromRoom.Delete")
-			c.AbortWithError(http.StatusInternalServerError, e.RoomNotModified{}).SetMeta("DisconnectUserFromRoom.Delete")
-			return
-		}
-		l.Logger.Infof("Room %v deleted", room.ID)
-		c.JSON(http.StatusNoContent, nil)
+	} else if err != nil {
+		c.Error(err).SetMeta("DisconnectUserFromRoom.RemoveUser")
+		c.AbortWithError(http.StatusInternalServerError, e.RoomNotModified{}).SetMeta("DisconnectUserFromRoom.RemoveUser")
 		return
-	} else if room.OwnerID == user.ID {
-		room.OwnerID = room.Users[0].ID
 	}
 
-	err = db.WithContext(ctx).Save(&room).Error
+	c.JSON(http.StatusNoContent, nil)
+}
+
+// leaveRoom removes a user from the connected users list of a room and notifies the remaining users.
+// The room is deleted along with its last user, and another user becomes the owner if the owner leaves.
+func leaveRoom(ctx context.Context, c *gin.Context, roomID, userID uint64) error {
+	deleted, err := rooms.RemoveUser(ctx, roomID, userID)
 	if err != nil {
-		c.Error(err).SetMeta("DisconnectUserFromRoom.Save")
-		c.AbortWithError(http.StatusInternalServerError, e.RoomNotModified{}).SetMeta("DisconnectUserFromRoom.Save")
-		return
+		return err
+	}
+	routes.TagCache(c, routes.RoomTag(roomID))
+
+	if deleted {
+		metrics.RoomsDeleted.Inc()
+		l.FromContext(c).Infof("Room %v deleted", roomID)
+		roomStreamsList.DeleteStream(roomID, roomClosedMessage)
+		return nil
 	}
 
-	stream, err := utils.GetStream(room.ID, roomStreamsList)
+	stream, err := roomStreamsList.GetStream(roomID)
 	if err != nil {
-		l.Logger.Warnf("Failed to get stream: %v", err)
+		l.FromContext(c).Warnf("Failed to get stream: %v", err)
 	} else {
-		stream.Distribute(SSEMessage)
+		stream.Distribute(ctx, SSEMessage)
 	}
-
-	c.JSON(http.StatusNoContent, nil)
+	return nil
 }
 
 // StreamRoom godoc
@@ -292,14 +452,20 @@ func DisconnectUserFromRoom(c *gin.Context) {
 // @Description  This endpoint is used to subscribe to a SSE stream for a given room.
 // @Description	 The stream will send an event when a room is updated.
 // @Description  A room is updated when a user connects or disconnects from it, or when we have a owner change, and so on.
+// @Description  When the server shuts down, a "serverShuttingDown" event is sent with a retry hint before the stream is closed.
+// @Description  When the room is closed or its last user leaves, a "roomClosed" event is sent before the stream is closed.
+// @Description  Clients unable to set the Authorization header can authenticate with a ticket from the stream ticket endpoint instead.
 // @Tags         Rooms,SSE
 // @Security     BasicAuth
+// @Security     BearerAuth
 // @Param        id path int true "Room ID"
+// @Param        ticket query string false "Stream ticket"
 // @Produce      text/event-stream
 // @Success      200 "Send \"RoomUpdate\" event each time room is updated. Send 200 when stream is closed"
 // @Failure      401 {object} utils.ErrorResponse "User not authorized"
-// @Failure      404 {object} utils.ErrorResponse "Room not found or invalid user in auth method"
+// @Failure      404 {object} utils.ErrorResponse "Room not found"
 // @Failure      500 {object} utils.ErrorResponse "Internal server error"
+// @Failure      503 {object} utils.ErrorResponse "Server shutting down"
 // @Router       /rooms/{id}/stream [get]
 func StreamRoom(c *gin.Context) {
 	room, err := routes.ExtractRoomFromContext(c)
@@ -316,27 +482,88 @@ func StreamRoom(c *gin.Context) {
 		return
 	}
 
-	stream, err := utils.GetStream(room.ID, roomStreamsList)
+	stream, err := roomStreamsList.GetStream(room.ID)
 	if err != nil {
 		c.Error(err).SetMeta("StreamRoom.GetStream")
 		c.AbortWithError(http.StatusInternalServerError, e.StreamNotCreated{}).SetMeta("StreamRoom.GetStream")
 		return
 	}
 
-	_ = stream.AddSub(user.ID)
+	messages, err := stream.AddSub(user.ID)
+	if err != nil && !shuttingDown.Load() {
+		// The room has been closed since it was retrieved.
+		c.Error(err).SetMeta("StreamRoom.AddSub")
+		c.AbortWithError(http.StatusNotFound, e.RoomNotFound{}).SetMeta("StreamRoom.AddSub")
+		return
+	} else if err != nil {
+		c.Error(err).SetMeta("StreamRoom.AddSub")
+		c.AbortWithError(http.StatusServiceUnavailable, e.ServerShuttingDown{}).SetMeta("StreamRoom.AddSub")
+		return
+	}
 	defer func() {
-		err := stream.DelSub(user.ID)
+		err := stream.DelSub(user.ID, messages)
 		if err != nil {
-			l.Logger.Warnf("Failed to delete sub: %v", err)
+			l.FromContext(c).Warnf("Failed to delete sub: %v", err)
 		}
 	}()
 
 	c.Stream(func(w io.Writer) bool {
-		if msg, ok := <-stream.ClientChan[user.ID]; ok {
-			c.SSEvent(msg.Event, msg.Data)
+		select {
+		case msg, ok := <-messages:
+			if !ok {
+				return false
+			}
+			_, span := tracing.Start(c, "StreamRoom.Send", trace.WithLinks(trace.Link{SpanContext: tracing.Extract(msg.Trace)}))
+			c.Render(-1, sse.Event{Event: msg.Event, Data: msg.Data, Retry: msg.Retry})
+			span.End()
 			return true
+		case <-c.Request.Context().Done():
+			return false
 		}
-		return false
+	})
+}
+
+// CreateStreamTicket godoc
+// @Summary      Creates a ticket to authenticate on the stream of a room.
+// @Description  Returns a short-lived ticket, valid on the stream of this room only, to be given in the ticket query parameter
+// @Description  of the stream endpoint by clients unable to set the Authorization header, such as browsers' EventSource.
+// @Tags         Rooms,SSE
+// @Security     BasicAuth
+// @Security     BearerAuth
+// @Param        id path int true "Room ID"
+// @Produce      json
+// @Success      200 {object} utils.StreamTicketResponse
+// @Failure      400 {object} utils.ErrorResponse "Invalid request"
+// @Failure      401 {object} utils.ErrorResponse "User not authorized"
+// @Failure      404 {object} utils.ErrorResponse "Room not found"
+// @Failure      500 {object} utils.ErrorResponse "Internal server error"
+// @Router       /rooms/{id}/stream/ticket [post]
+func CreateStreamTicket(c *gin.Context) {
+	room, err := routes.ExtractRoomFromContext(c)
+	if err != nil {
+		c.Error(err).SetMeta("CreateStreamTicket.ExtractRoomFromContext")
+		c.AbortWithError(http.StatusInternalServerError, e.RoomNotInContext{}).SetMeta("CreateStreamTicket.ExtractRoomFromContext")
+		return
+	}
+
+	user, err := routes.ExtractUserFromContext(c)
+	if err != nil {
+		c.Error(err).SetMeta("CreateStreamTicket.ExtractUserFromContext")
+		c.AbortWithError(http.StatusInternalServerError, e.UserNotInContext{}).SetMeta("CreateStreamTicket.ExtractUserFromContext")
+		return
+	}
+
+	ticket, _, err := tokens.IssueStreamTicket(user.ID, user.TokenGeneration, room.ID, streamTicketTTL)
+	if err != nil {
+		c.Error(err).SetMeta("CreateStreamTicket.IssueStreamTicket")
+		c.AbortWithError(http.StatusInternalServerError, e.TokenNotCreated{}).SetMeta("CreateStreamTicket.IssueStreamTicket")
+		return
+	}
+
+	c.JSON(http.StatusOK, routes.StreamTicketResponse{
+		Ticket:    ticket,
+		ExpiresIn: int64(streamTicketTTL.Seconds()),
+		URI:       "/rooms/" + fmt.Sprint(room.ID) + "/stream?ticket=" + url.QueryEscape(ticket),
 	})
 }
 
@@ -344,17 +571,18 @@ func StreamRoom(c *gin.Context) {
 // @Summary      Kicks a user from a room.
 // @Tags         Rooms
 // @Security     BasicAuth
+// @Security     BearerAuth
 // @Produce      json
 // @Param        id 	path int true "Room ID"
 // @Param        userid path int true "User ID"
 // @Success      204
 // @Failure      400 {object} utils.ErrorResponse "Invalid request"
 // @Failure      401 {object} utils.ErrorResponse "User not authorized"
-// @Failure      404 {object} utils.ErrorResponse "Room not found or invalid user in auth method"
+// @Failure      404 {object} utils.ErrorResponse "Room not found"
+// @Failure      429 {object} utils.ErrorResponse "Too many requests"
 // @Failure      500 {object} utils.ErrorResponse "Internal server error"
 // @Router       /rooms/{id}/kick/{userid} [patch]
 func KickUserFromRoom(c *gin.Context) {
-	var user models.User
 	ctx, cancelCtx := context.WithTimeout(c, 1000*time.Millisecond)
 	defer cancelCtx()
 
@@ -372,10 +600,10 @@ func KickUserFromRoom(c *gin.Context) {
 		return
 	}
 
-	err = db.WithContext(ctx).First(&user, userID).Error
+	user, err := users.Get(ctx, userID)
 	if err != nil {
-		c.Error(err).SetMeta("KickUserFromRoom.First")
-		c.AbortWithError(http.StatusNotFound, e.UserNotFound{}).SetMeta("KickUserFromRoom.First")
+		c.Error(err).SetMeta("KickUserFromRoom.Get")
+		c.AbortWithError(http.StatusNotFound, e.UserNotFound{}).SetMeta("KickUserFromRoom.Get")
 		return
 	}
 
@@ -387,18 +615,26 @@ func KickUserFromRoom(c *gin.Context) {
 
 	// Owner can't kick himself.
 	if room.OwnerID == user.ID {
-		c.Error(err).SetMeta("KickUserFromRoom.AssertUser")
 		c.AbortWithError(http.StatusBadRequest, e.OwnerCantKickHimself{}).SetMeta("KickUserFromRoom.AssertUser")
 		return
 	}
 
-	// Remove user from the connected users list of the room.
-	err = room.RemoveUser(ctx, db, &user)
-	if err != nil {
-		c.Error(err).SetMeta("KickUserFromRoom.RemoveUser")
-		c.AbortWithError(http.StatusInternalServerError, e.RoomNotModified{}).SetMeta("KickUserFromRoom.RemoveUser")
+	// Remove user from the connected users list of the room, provided the requester still owns it.
+	err = rooms.KickUser(ctx, room.ID, room.OwnerID, user.ID)
+	if errors.Is(err, repositories.ErrNotOwner) {
+		c.Error(err).SetMeta("KickUserFromRoom.KickUser")
+		c.AbortWithError(http.StatusUnauthorized, e.UserNotAuthorized{}).SetMeta("KickUserFromRoom.KickUser")
+		return
+	} else if errors.Is(err, repositories.ErrNotFound) {
+		c.Error(err).SetMeta("KickUserFromRoom.KickUser")
+		c.AbortWithError(http.StatusBadRequest, e.UserNotInRoom{}).SetMeta("KickUserFromRoom.KickUser")
+		return
+	} else if err != nil {
+		c.Error(err).SetMeta("KickUserFromRoom.KickUser")
+		c.AbortWithError(http.StatusInternalServerError, e.RoomNotModified{}).SetMeta("KickUserFromRoom.KickUser")
 		return
 	}
+	routes.TagCache(c, routes.RoomTag(room.ID))
 
 	c.JSON(http.StatusNoContent, nil)
 }
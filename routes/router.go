@@ -2,18 +2,22 @@
 package routes
 
 import (
+	"context"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/Brawdunoir/dionysos-server/auth"
 	"github.com/Brawdunoir/dionysos-server/database"
+	"github.com/Brawdunoir/dionysos-server/metrics"
 	"github.com/Brawdunoir/dionysos-server/middlewares"
+	"github.com/Brawdunoir/dionysos-server/repositories"
 	"github.com/Brawdunoir/dionysos-server/utils"
 	l "github.com/Brawdunoir/dionysos-server/utils/logger"
 	"github.com/Brawdunoir/dionysos-server/variables"
-	cache "github.com/chenyahui/gin-cache"
 	"github.com/chenyahui/gin-cache/persist"
 	"github.com/gin-gonic/gin"
 	"github.com/go-redis/redis/v8"
-	"gorm.io/gorm"
 
 	swaggerfiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
@@ -21,16 +25,37 @@ import (
 
 var cacheStore persist.CacheStore
 
-// Database pointer that will be used in the routes.
-var db *gorm.DB
+// Duration responses are cached for.
+const cacheDuration = 5 * time.Minute
 
-// SetupRouter sets up the router
-func SetupRouter(router *gin.Engine) *gin.Engine {
-	// Get the database connection.
-	db = database.GetDB()
-	if db == nil {
-		l.Logger.Fatal("Failed to connect to database")
-	}
+// Repositories of the rooms, users and archives, used by the routes.
+var (
+	rooms    repositories.RoomRepository
+	users    repositories.UserRepository
+	archives repositories.ArchiveRepository
+)
+
+// Cache of successful password verifications, to be told when a password changes.
+var passwords *auth.PasswordCache
+
+// Guard against brute-force attacks on passwords.
+var guard *auth.Guard
+
+// Issuer of access tokens and stream tickets.
+var tokens *auth.Tokens
+
+// Provider users can log in with, only set if OIDC is configured.
+var identityProvider auth.IdentityProvider
+
+// Duration a deleted room or user can be restored for.
+var restorePeriod time.Duration
+
+// SetupRouter sets up the router, with handlers storing rooms and users in the given repositories.
+func SetupRouter(router *gin.Engine, repos repositories.Repositories) *gin.Engine {
+	rooms, users, archives = repos.Rooms, repos.Users, repos.Archives
+
+	// Rate limits are shared with other instances through Redis if available.
+	var rateLimitStore middlewares.RateLimitStore
 
 	// Connect to Redis client or create a local redis.
 	if variables.RedisHost != "" {
@@ -38,56 +63,230 @@ func SetupRouter(router *gin.Engine) *gin.Engine {
 		if err != nil {
 			l.Logger.Fatal("Cannot connect to redis", err)
 		} else {
-			cacheStore = persist.NewRedisStore(redis.NewClient(redisURL))
+			redisClient := redis.NewClient(redisURL)
+			cacheStore = persist.NewRedisStore(redisClient)
+			rateLimitStore = middlewares.NewRedisRateLimitStore(redisClient)
+			readinessChecks["cache"] = func(ctx context.Context) error {
+				return redisClient.Ping(ctx).Err()
+			}
 		}
 	} else {
-		cacheStore = persist.NewMemoryStore(5 * time.Minute)
+		cacheStore = persist.NewMemoryStore(cacheDuration)
+		rateLimitStore = middlewares.NewMemoryRateLimitStore()
+	}
+
+	rateLimits := make(map[string]*middlewares.RateLimitPolicy)
+	for name, value := range map[string]string{
+		"createUser":    variables.RateLimitCreateUser,
+		"public":        variables.RateLimitPublic,
+		"authenticated": variables.RateLimitAuthenticated,
+		"membership":    variables.RateLimitMembership,
+	} {
+		policy, err := middlewares.ParseRateLimitPolicy(name, value)
+		if err != nil {
+			l.Logger.Fatal("Invalid rate limit: ", err)
+		}
+		rateLimits[name] = policy
+	}
+
+	// Only trust the X-Forwarded-For header of known proxies, clients could spoof their IP address otherwise.
+	var trustedProxies []string
+	for _, proxy := range strings.Split(variables.TrustedProxies, ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			trustedProxies = append(trustedProxies, proxy)
+		}
+	}
+	if err := router.SetTrustedProxies(trustedProxies); err != nil {
+		l.Logger.Fatal("Invalid trusted proxies: ", err)
+	}
+
+	passwordCacheTTL, err := time.ParseDuration(variables.PasswordCacheTTL)
+	if err != nil {
+		l.Logger.Fatal("Invalid password cache TTL: ", err)
+	}
+	passwords, err = auth.NewPasswordCache(passwordCacheTTL)
+	if err != nil {
+		l.Logger.Fatal("Failed to create password cache: ", err)
+	}
+
+	authMaxFailures, err := strconv.Atoi(variables.AuthMaxFailures)
+	if err != nil {
+		l.Logger.Fatal("Invalid maximum number of authentication failures: ", err)
+	}
+	authMaxFailuresPerIP, err := strconv.Atoi(variables.AuthMaxFailuresPerIP)
+	if err != nil {
+		l.Logger.Fatal("Invalid maximum number of authentication failures per IP: ", err)
+	}
+	authLockout, err := time.ParseDuration(variables.AuthLockout)
+	if err != nil {
+		l.Logger.Fatal("Invalid authentication lockout: ", err)
+	}
+	authMaxLockout, err := time.ParseDuration(variables.AuthMaxLockout)
+	if err != nil {
+		l.Logger.Fatal("Invalid maximum authentication lockout: ", err)
+	}
+	guard = auth.NewGuard(authMaxFailures, authMaxFailuresPerIP, authLockout, authMaxLockout)
+
+	accessTokenTTL, err := time.ParseDuration(variables.AccessTokenTTL)
+	if err != nil {
+		l.Logger.Fatal("Invalid access token TTL: ", err)
 	}
+	refreshTokenTTL, err = time.ParseDuration(variables.RefreshTokenTTL)
+	if err != nil {
+		l.Logger.Fatal("Invalid refresh token TTL: ", err)
+	}
+	streamTicketTTL, err = time.ParseDuration(variables.StreamTicketTTL)
+	if err != nil {
+		l.Logger.Fatal("Invalid stream ticket TTL: ", err)
+	}
+	restorePeriod, err = time.ParseDuration(variables.RestorePeriod)
+	if err != nil {
+		l.Logger.Fatal("Invalid restore period: ", err)
+	}
+	if variables.TokenSigningKeys == "" {
+		l.Logger.Warn("No token signing keys set, access tokens will be invalidated when the server restarts")
+	}
+	tokens, err = auth.NewTokens(variables.TokenSigningKeys, accessTokenTTL)
+	if err != nil {
+		l.Logger.Fatal("Invalid token signing keys: ", err)
+	}
+
+	if variables.OIDCIssuer != "" {
+		// The provider keys are fetched for as long as the server runs.
+		identityProvider, err = auth.NewOIDC(context.Background(), variables.OIDCIssuer, variables.OIDCClientID, variables.OIDCClientSecret,
+			variables.OIDCRedirectURL, strings.Fields(variables.OIDCScopes))
+		if err != nil {
+			l.Logger.Fatal("Failed to set up OIDC: ", err)
+		}
+	} else if variables.AnonymousUsers != "true" {
+		l.Logger.Warn("Anonymous users are disabled and OIDC is not configured, no user can be created")
+	}
+
+	// Dependencies checked by the readiness probe. There is no database to check if repositories are kept in memory.
+	if db := database.GetDB(); db != nil {
+		readinessChecks["database"] = func(ctx context.Context) error {
+			sqlDB, err := db.DB()
+			if err != nil {
+				return err
+			}
+			return sqlDB.PingContext(ctx)
+		}
+	}
+	readinessChecks["broadcaster"] = func(ctx context.Context) error {
+		return roomStreamsList.Ping()
+	}
+
+	// Let the request context, holding the tracing span, be reachable from the gin context.
+	router.ContextWithFallback = true
 
 	// Setup the routes.
 	r := router.Group(variables.BasePath)
 	{
 		// Global middlewares.
 		r.Use(
-			gin.LoggerWithWriter(gin.DefaultWriter, "/healthz"),
+			middlewares.Tracing(),
+			middlewares.RequestID(l.Logger),
+			middlewares.AccessLog(l.AccessLogger, variables.BasePath+"/healthz", variables.BasePath+"/livez", variables.BasePath+"/readyz", variables.BasePath+"/metrics"),
+			middlewares.Metrics(),
 			gin.Recovery(),
 			middlewares.Options(),
 			middlewares.ErrorHandler(l.Logger),
 		)
 		// Public routes.
 		r.GET("/healthz", Healthz)
+		r.GET("/livez", Livez)
+		r.GET("/readyz", Readyz)
+		// Metrics are served on their own port if configured, otherwise only to the admin.
+		if variables.MetricsPort == "" && variables.AdminToken != "" {
+			r.GET("/metrics", middlewares.AdminAuthentication(variables.AdminToken), gin.WrapH(metrics.Handler()))
+		} else if variables.MetricsPort == "" {
+			l.Logger.Warn("Neither a metrics port nor an admin token is configured, metrics are not served")
+		}
 		r.GET("/version", GetVersion)
 		r.GET("/doc/*any", ginSwagger.WrapHandler(swaggerfiles.Handler))
-		r.POST("/users", CreateUser)
+		r.POST("/users", middlewares.RateLimit(rateLimitStore, rateLimits["createUser"], middlewares.ByIP), CreateUser)
+
+		invalidateCache := middlewares.InvalidateCacheTags(cacheStore, cacheDuration)
+
+		// Admin routes, only registered if an admin token is configured.
+		if variables.AdminToken != "" {
+			adminRouter := r.Group("/admin", middlewares.AdminAuthentication(variables.AdminToken))
+			{
+				adminRouter.GET("/log-level", GetLogLevel)
+				adminRouter.PUT("/log-level", UpdateLogLevel)
+				adminRouter.POST("/users/:id/restore", invalidateCache, RestoreUser)
+				adminRouter.GET("/export", ExportArchive)
+				adminRouter.POST("/import", ImportArchive)
+			}
+		}
+
+		publicRateLimit := middlewares.RateLimit(rateLimitStore, rateLimits["public"], middlewares.ByIP)
+		authenticatedRateLimit := middlewares.RateLimit(rateLimitStore, rateLimits["authenticated"], middlewares.ByUser)
+		membershipRateLimit := middlewares.RateLimit(rateLimitStore, rateLimits["membership"], middlewares.ByUser)
+
+		tokenRouter := r.Group("/token", publicRateLimit)
+		{
+			tokenRouter.POST("", middlewares.BasicAuthentication(users, passwords, guard, l.Logger), CreateToken)
+			tokenRouter.POST("/refresh", RefreshToken)
+			tokenRouter.POST("/login", Login)
+		}
+
+		// OIDC routes, only registered if an identity provider is configured.
+		if identityProvider != nil {
+			oidcRouter := r.Group("/oidc", publicRateLimit)
+			{
+				oidcRouter.GET("/login", OIDCLogin)
+				oidcRouter.GET("/callback", OIDCCallback)
+			}
+		}
+
+		authentication := middlewares.Authentication(users, passwords, guard, tokens, l.Logger)
+		if variables.DebugIdentity == "true" {
+			if err := middlewares.DebugIdentityAllowed(variables.Environment, variables.Host); err != nil {
+				l.Logger.Fatal("Cannot enable debug identity: ", err)
+			}
+			l.Logger.Warnf("DEBUG IDENTITY ENABLED: any request with the %s header is authenticated as the given user WITHOUT CREDENTIALS. Never enable it on a shared or public server.", middlewares.DebugUserHeader)
+			authentication = middlewares.DebugAuthentication(users, authentication)
+		}
+
+		// The stream of a room also accepts a ticket in place of the Authorization header.
+		r.GET("/rooms/:id/stream", middlewares.StreamAuthentication(users, tokens, authentication), authenticatedRateLimit, middlewares.RetrieveRoom(l.Logger, rooms), utils.HeadersSSE, StreamRoom)
 
 		// Add authentication middleware to the following routes.
-		r.Use(middlewares.Authentication(db, l.Logger))
+		r.Use(authentication, authenticatedRateLimit)
 
 		userRouter := r.Group("/users")
 		{
-			userRouter.GET("/:id", cache.CacheByRequestURI(cacheStore, 5*time.Minute), GetUser)
+			userRouter.GET("/:id", middlewares.CacheByRequestURI(cacheStore, cacheDuration), GetUser)
+			userRouter.GET("/:id/export", ExportUser)
 
-			userRouter.Use(middlewares.InvalidateCacheURI(cacheStore, l.Logger))
+			userRouter.Use(invalidateCache)
 
 			userRouter.PATCH("/:id", UpdateUser)
+			userRouter.POST("/:id/credentials", RotateCredentials)
+			userRouter.PUT("/:id/account", RegisterUser)
 			userRouter.DELETE("/:id", DeleteUser)
+			userRouter.POST("/:id/erase", EraseUser)
 		}
 
 		roomRouter := r.Group("/rooms")
 		{
 			roomRouter.POST("", CreateRoom)
+			// Deleted rooms are not retrieved.
+			roomRouter.POST("/:id/restore", invalidateCache, RestoreRoom)
 
-			roomRouter.Use(middlewares.RetrieveRoom(l.Logger, db))
+			roomRouter.Use(middlewares.RetrieveRoom(l.Logger, rooms))
 
-			roomRouter.GET("/:id/stream", utils.HeadersSSE, StreamRoom)
-			roomRouter.GET("/:id", cache.CacheByRequestURI(cacheStore, 5*time.Minute), GetRoom)
+			roomRouter.POST("/:id/stream/ticket", CreateStreamTicket)
+			roomRouter.GET("/:id", middlewares.CacheByRequestURI(cacheStore, cacheDuration), GetRoom)
 
-			roomRouter.Use(middlewares.InvalidateCacheURI(cacheStore, l.Logger))
+			roomRouter.Use(invalidateCache)
 
 			roomRouter.PATCH("/:id", UpdateRoom)
-			roomRouter.PATCH("/:id/connect", ConnectUserToRoom)
-			roomRouter.PATCH("/:id/disconnect", DisconnectUserFromRoom)
-			roomRouter.PATCH("/:id/kick/:userid", KickUserFromRoom)
+			roomRouter.DELETE("/:id", CloseRoom)
+			roomRouter.PATCH("/:id/connect", membershipRateLimit, ConnectUserToRoom)
+			roomRouter.PATCH("/:id/disconnect", membershipRateLimit, DisconnectUserFromRoom)
+			roomRouter.PATCH("/:id/kick/:userid", membershipRateLimit, KickUserFromRoom)
 		}
 	}
 
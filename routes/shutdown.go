@@ -0,0 +1,25 @@
+package routes
+
+import (
+	"time"
+
+	"github.com/Brawdunoir/dionysos-server/utils"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/atomic"
+)
+
+// shuttingDown is set once the server started draining its connections.
+var shuttingDown = atomic.NewBool(false)
+
+// Drain marks the server as shutting down so health endpoints report it as not ready,
+// then sends a "serverShuttingDown" event to every SSE subscriber and closes their stream.
+// Clients are told to wait for reconnectDelay before reconnecting, hopefully to another instance.
+func Drain(reconnectDelay time.Duration) {
+	shuttingDown.Store(true)
+
+	roomStreamsList.Close(utils.Message{
+		Event: "serverShuttingDown",
+		Data:  gin.H{"retry": reconnectDelay.Milliseconds()},
+		Retry: uint(reconnectDelay.Milliseconds()),
+	})
+}
@@ -0,0 +1,116 @@
+package routes
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Brawdunoir/dionysos-server/metrics"
+	"github.com/Brawdunoir/dionysos-server/models"
+	"github.com/Brawdunoir/dionysos-server/utils"
+	"github.com/Brawdunoir/dionysos-server/variables"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/assert/v2"
+)
+
+// streamRecorder records the response of a stream, gin expecting the writer to notify it when the client is gone.
+type streamRecorder struct {
+	*httptest.ResponseRecorder
+}
+
+// CloseNotify never notifies, the client only going away once the server closed the stream.
+func (r streamRecorder) CloseNotify() <-chan bool {
+	return nil
+}
+
+// subscribers returns the number of clients subscribed to the stream of the given room, as counted in the metrics.
+func subscribers(room models.Room) int {
+	w := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	match := regexp.MustCompile(`dionysos_sse_subscribers{room="` + strconv.FormatUint(room.ID, 10) + `"} (\d+)`).FindStringSubmatch(w.Body.String())
+	if match == nil {
+		return 0
+	}
+	count, _ := strconv.Atoi(match[1])
+	return count
+}
+
+// streamTest subscribes the given user to the stream of the given room. It waits for the subscription to be registered,
+// unless it is refused, and returns a channel receiving the response once the server closed the stream.
+func streamTest(t *testing.T, user models.User, room models.Room) <-chan *httptest.ResponseRecorder {
+	router := gin.New()
+	router.GET("/stream", func(c *gin.Context) {
+		c.Set(variables.USER_CONTEXT_KEY, user)
+		c.Set(variables.ROOM_CONTEXT_KEY, room)
+	}, utils.HeadersSSE, StreamRoom)
+
+	before := subscribers(room)
+	done := make(chan *httptest.ResponseRecorder, 1)
+	go func() {
+		w := streamRecorder{httptest.NewRecorder()}
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/stream", nil))
+		done <- w.ResponseRecorder
+	}()
+
+	for start := time.Now(); time.Since(start) < time.Second; time.Sleep(10 * time.Millisecond) {
+		if len(done) > 0 || subscribers(room) > before {
+			return done
+		}
+	}
+	t.Fatal("stream not subscribed")
+	return nil
+}
+
+// resetShutdown restores the server as running, with no stream, once the test is over.
+func resetShutdown(t *testing.T) {
+	t.Cleanup(func() {
+		shuttingDown.Store(false)
+		roomStreamsList = utils.NewStreams()
+	})
+}
+
+func TestDrain(t *testing.T) {
+	resetShutdown(t)
+	setReadinessChecks(t, map[string]Check{
+		"healthy": func(ctx context.Context) error { return nil },
+	})
+
+	room := models.Room{ID: 1}
+	err := roomStreamsList.CreateStream(room.ID)
+	assert.Equal(t, err, nil)
+	streamA := streamTest(t, models.User{ID: 1}, room)
+	streamB := streamTest(t, models.User{ID: 2}, room)
+
+	assert.Equal(t, serveTest(Healthz, "/healthz").Code, http.StatusOK)
+	assert.Equal(t, serveTest(Readyz, "/readyz").Code, http.StatusOK)
+
+	Drain(3 * time.Second)
+
+	// Every subscriber is told to reconnect later, then its stream is closed.
+	for _, stream := range []<-chan *httptest.ResponseRecorder{streamA, streamB} {
+		select {
+		case w := <-stream:
+			assert.Equal(t, w.Code, http.StatusOK)
+			assert.Equal(t, w.Body.String(), "event:serverShuttingDown\nretry:3000\ndata:{\"retry\":3000}\n\n")
+		case <-time.After(time.Second):
+			t.Fatal("stream not closed")
+		}
+	}
+	assert.Equal(t, subscribers(room), 0)
+
+	// The server is not ready anymore, even though its dependencies are.
+	w := serveTest(Healthz, "/healthz")
+	assert.Equal(t, w.Code, http.StatusServiceUnavailable)
+	w = serveTest(Readyz, "/readyz")
+	assert.Equal(t, w.Code, http.StatusServiceUnavailable)
+	assert.MatchRegex(t, w.Body.String(), `^{"status":"unavailable","checks":{"healthy":{"status":"ok","latency":"[^"]+"}}}$`)
+
+	// Neither new subscriptions nor new streams are accepted.
+	w = <-streamTest(t, models.User{ID: 3}, room)
+	assert.Equal(t, w.Code, http.StatusServiceUnavailable)
+	assert.NotEqual(t, roomStreamsList.CreateStream(2), nil)
+}
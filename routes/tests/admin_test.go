@@ -0,0 +1,228 @@
+package routes_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/Brawdunoir/dionysos-server/models"
+
+	utils "github.com/Brawdunoir/dionysos-server/utils/tests"
+	"github.com/go-playground/assert/v2"
+)
+
+// adminToken is the admin token set in the environment for tests.
+const adminToken = "test-admin-token"
+
+const logLevelURL = "/admin/log-level"
+
+// TestLogLevel tests the GetLogLevel and UpdateLogLevel functions.
+func TestLogLevel(t *testing.T) {
+	headers := []utils.Header{{Key: "X-Admin-Token", Value: adminToken}}
+
+	test := utils.TestCreate{
+		Target:  logLevelURL,
+		Headers: headers,
+		SubTests: []utils.SubTest{
+			{Name: "Missing token", Request: utils.Request{Method: http.MethodGet, Headers: []utils.Header{}}, ResponseCode: http.StatusUnauthorized, ResponseBodyRegex: `{"error":"User not authorized","requestID":"[^"]+"}`},
+			{Name: "Wrong token", Request: utils.Request{Method: http.MethodGet, Headers: []utils.Header{{Key: "X-Admin-Token", Value: "wrong"}}}, ResponseCode: http.StatusUnauthorized, ResponseBodyRegex: `{"error":"User not authorized","requestID":"[^"]+"}`},
+			{Name: "Get level", Request: utils.Request{Method: http.MethodGet}, ResponseCode: http.StatusOK, ResponseBodyRegex: `^{"level":"info"}$`},
+			{Name: "Wrong token on update", Request: utils.Request{Method: http.MethodPut, Body: `{"level":"debug"}`, Headers: []utils.Header{{Key: "X-Admin-Token", Value: "wrong"}}}, ResponseCode: http.StatusUnauthorized, ResponseBodyRegex: `{"error":"User not authorized","requestID":"[^"]+"}`},
+			{Name: "Empty body", Request: utils.Request{Method: http.MethodPut, Body: ``}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":".+","requestID":"[^"]+"}`},
+			{Name: "Unknown level", Request: utils.Request{Method: http.MethodPut, Body: `{"level":"verbose"}`}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":"Invalid log level","requestID":"[^"]+"}`},
+			{Name: "Level unchanged", Request: utils.Request{Method: http.MethodGet}, ResponseCode: http.StatusOK, ResponseBodyRegex: `^{"level":"info"}$`},
+			{Name: "Update level", Request: utils.Request{Method: http.MethodPut, Body: `{"level":"debug"}`}, ResponseCode: http.StatusOK, ResponseBodyRegex: `^{"level":"debug"}$`},
+			{Name: "Level updated", Request: utils.Request{Method: http.MethodGet}, ResponseCode: http.StatusOK, ResponseBodyRegex: `^{"level":"debug"}$`},
+			{Name: "Restore level", Request: utils.Request{Method: http.MethodPut, Body: `{"level":"info"}`}, ResponseCode: http.StatusOK, ResponseBodyRegex: `^{"level":"info"}$`},
+		},
+	}
+	test.Run(t)
+}
+
+// TestRestoreUser tests the RestoreUser function.
+func TestRestoreUser(t *testing.T) {
+	err := utils.ResetTestStorage()
+	if err != nil {
+		t.Error(err)
+	}
+
+	// Create and delete the user that will be restored.
+	id, headers, err := utils.CreateTestUser(models.User{Name: "test"})
+	if err != nil {
+		t.Error(err)
+	}
+
+	adminHeaders := []utils.Header{{Key: "X-Admin-Token", Value: adminToken}}
+	target := "/admin/users/" + id + "/restore"
+	test := utils.TestCreate{
+		Target:  target,
+		Headers: adminHeaders,
+		SubTests: []utils.SubTest{
+			{Name: "Delete user", Request: utils.Request{Target: userURL + "/" + id, Method: http.MethodDelete, Headers: headers}, ResponseCode: http.StatusNoContent, ResponseBodyRegex: ``},
+			{Name: "Correctly deleted", Request: utils.Request{Target: userURL + "/" + id, Method: http.MethodGet, Headers: headers}, ResponseCode: http.StatusUnauthorized, ResponseBodyRegex: `{"error":"User not authorized","requestID":"[^"]+"}`},
+			{Name: "Missing token", Request: utils.Request{Method: http.MethodPost, Headers: []utils.Header{}}, ResponseCode: http.StatusUnauthorized, ResponseBodyRegex: `{"error":"User not authorized","requestID":"[^"]+"}`},
+			{Name: "Invalid ID", Request: utils.Request{Target: "/admin/users/abc/restore", Method: http.MethodPost}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":"Invalid ID","requestID":"[^"]+"}`},
+			{Name: "Not found", Request: utils.Request{Target: "/admin/users/987654321/restore", Method: http.MethodPost}, ResponseCode: http.StatusNotFound, ResponseBodyRegex: `{"error":"User not found","requestID":"[^"]+"}`},
+			{Name: "Success", Request: utils.Request{Method: http.MethodPost}, ResponseCode: http.StatusNoContent, ResponseBodyRegex: ``},
+			{Name: "Correctly restored", Request: utils.Request{Target: userURL + "/" + id, Method: http.MethodGet, Headers: headers}, ResponseCode: http.StatusOK, ResponseBodyRegex: `{"ID":` + id + `,"name":"test"}`},
+			{Name: "Already restored", Request: utils.Request{Method: http.MethodPost}, ResponseCode: http.StatusNotFound, ResponseBodyRegex: `{"error":"User not found","requestID":"[^"]+"}`},
+		},
+	}
+	test.Run(t)
+}
+
+// TestArchive tests the ExportArchive and ImportArchive functions, exporting users and rooms,
+// importing them into a fresh storage and comparing the export of the imported data with the original one.
+func TestArchive(t *testing.T) {
+	err := utils.ResetTestStorage()
+	if err != nil {
+		t.Error(err)
+	}
+
+	// Create the users and rooms to export, A being registered and in two rooms.
+	idA, headersA, err := utils.CreateTestUser(models.User{Name: "userA"})
+	if err != nil {
+		t.Error(err)
+	}
+	_, headersB, err := utils.CreateTestUser(models.User{Name: "userB"})
+	if err != nil {
+		t.Error(err)
+	}
+	_, _, err = utils.CreateTestUser(models.User{Name: "userC"})
+	if err != nil {
+		t.Error(err)
+	}
+	code, _, err := utils.ExecuteTestRequest(http.MethodPut, userURL+"/"+idA+"/account", `{"handle":"usera","password":"password123"}`, headersA)
+	if err != nil || code != http.StatusNoContent {
+		t.Fatalf("A failed to register: %d %v", code, err)
+	}
+	headersA = utils.GetBasicAuthHeader(idA, "password123")
+	roomAB, err := utils.CreateTestRoom(models.Room{Name: "roomAB"}, headersB)
+	if err != nil {
+		t.Error(err)
+	}
+	code, err = utils.SendTestRequest(http.MethodPatch, roomURL+"/"+roomAB+"/connect", headersA)
+	if err != nil || code != http.StatusNoContent {
+		t.Fatalf("A failed to join the room: %d %v", code, err)
+	}
+	_, err = utils.CreateTestRoom(models.Room{Name: "roomA"}, headersA)
+	if err != nil {
+		t.Error(err)
+	}
+
+	adminHeaders := []utils.Header{{Key: "X-Admin-Token", Value: adminToken}}
+	export := func() models.Archive {
+		t.Helper()
+		var archive models.Archive
+		code, body, err := utils.ExecuteTestRequest(http.MethodGet, "/admin/export", "", adminHeaders)
+		if err != nil || code != http.StatusOK {
+			t.Fatalf("failed to export: %d %v %s", code, err, body)
+		}
+		if err = json.Unmarshal(body, &archive); err != nil {
+			t.Fatal(err)
+		}
+		return archive
+	}
+
+	code, _, err = utils.ExecuteTestRequest(http.MethodGet, "/admin/export", "", nil)
+	if err != nil || code != http.StatusUnauthorized {
+		t.Errorf("export without admin token: %d %v", code, err)
+	}
+	archive := export()
+	assert.Equal(t, archive.Version, uint(models.ArchiveVersion))
+	assert.Equal(t, len(archive.Users), 3)
+	assert.Equal(t, len(archive.Rooms), 2)
+	body, err := json.Marshal(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Import into a fresh storage.
+	err = utils.ResetTestStorage()
+	if err != nil {
+		t.Error(err)
+	}
+	code, response, err := utils.ExecuteTestRequest(http.MethodPost, "/admin/import", string(body), adminHeaders)
+	if err != nil || code != http.StatusCreated {
+		t.Fatalf("failed to import: %d %v %s", code, err, response)
+	}
+	var mapping models.ArchiveMapping
+	if err = json.Unmarshal(response, &mapping); err != nil {
+		t.Fatal(err)
+	}
+
+	imported := export()
+	assert.Equal(t, len(imported.Users), len(archive.Users))
+	assert.Equal(t, len(imported.Rooms), len(archive.Rooms))
+	usersByID := make(map[uint64]models.ArchiveUser)
+	for _, user := range imported.Users {
+		usersByID[user.ID] = user
+	}
+	for _, user := range archive.Users {
+		got, ok := usersByID[mapping.Users[user.ID]]
+		assert.Equal(t, ok, true)
+		assert.Equal(t, got.Name, user.Name)
+		assert.Equal(t, got.Password, user.Password)
+		assert.Equal(t, got.Handle, user.Handle)
+		assert.Equal(t, got.CreatedAt.Equal(user.CreatedAt), true)
+	}
+	roomsByID := make(map[uint64]models.ArchiveRoom)
+	for _, room := range imported.Rooms {
+		roomsByID[room.ID] = room
+	}
+	for _, room := range archive.Rooms {
+		got, ok := roomsByID[mapping.Rooms[room.ID]]
+		assert.Equal(t, ok, true)
+		assert.Equal(t, got.Name, room.Name)
+		assert.Equal(t, got.OwnerID, mapping.Users[room.OwnerID])
+		members := make([]uint64, 0, len(room.Members))
+		for _, member := range room.Members {
+			members = append(members, mapping.Users[member])
+		}
+		assert.Equal(t, got.Members, members)
+		assert.Equal(t, got.CreatedAt.Equal(room.CreatedAt), true)
+	}
+
+	// Imported users log in with their password, and imported rooms are served with their stream.
+	newIDA := strconv.FormatUint(mapping.Users[archive.Users[0].ID], 10)
+	newRoomA := strconv.FormatUint(mapping.Rooms[archive.Rooms[0].ID], 10)
+	if archive.Rooms[0].Name != "roomA" {
+		newRoomA = strconv.FormatUint(mapping.Rooms[archive.Rooms[1].ID], 10)
+	}
+	newHeadersA := utils.GetBasicAuthHeader(newIDA, "password123")
+	code, err = utils.SendTestRequest(http.MethodGet, userURL+"/"+newIDA, newHeadersA)
+	if err != nil || code != http.StatusOK {
+		t.Errorf("imported user failed to log in: %d %v", code, err)
+	}
+	stream, err := utils.SubscribeTestStream(newRoomA, newHeadersA)
+	if err != nil {
+		t.Error(err)
+	} else {
+		code, err = utils.SendTestRequest(http.MethodDelete, roomURL+"/"+newRoomA, newHeadersA)
+		if err != nil || code != http.StatusNoContent {
+			t.Errorf("imported user failed to close the room: %d %v", code, err)
+		}
+		if events, err := stream(); err != nil || !strings.Contains(events, "event:roomClosed") {
+			t.Errorf("imported room stream: %q %v", events, err)
+		}
+	}
+
+	test := utils.TestCreate{
+		Target:  "/admin/import",
+		Headers: adminHeaders,
+		SubTests: []utils.SubTest{
+			{Name: "Missing token", Request: utils.Request{Method: http.MethodPost, Headers: []utils.Header{}, Body: string(body)}, ResponseCode: http.StatusUnauthorized, ResponseBodyRegex: `{"error":"User not authorized","requestID":"[^"]+"}`},
+			{Name: "Empty body", Request: utils.Request{Method: http.MethodPost, Body: ``}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":"Failed to bind JSON","requestID":"[^"]+"}`},
+			{Name: "Unsupported version", Request: utils.Request{Method: http.MethodPost, Body: `{"version":99,"users":[],"rooms":[]}`}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":"Invalid archive","requestID":"[^"]+"}`},
+			{Name: "Unknown member", Request: utils.Request{Method: http.MethodPost, Body: `{"version":1,"users":[{"id":1,"name":"test"}],"rooms":[{"id":1,"name":"test","ownerID":1,"members":[1,2]}]}`}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":"Invalid archive","requestID":"[^"]+"}`},
+			{Name: "Owner not a member", Request: utils.Request{Method: http.MethodPost, Body: `{"version":1,"users":[{"id":1,"name":"test"},{"id":2,"name":"test"}],"rooms":[{"id":1,"name":"test","ownerID":2,"members":[1]}]}`}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":"Invalid archive","requestID":"[^"]+"}`},
+			{Name: "Handle already taken", Request: utils.Request{Method: http.MethodPost, Body: string(body)}, ResponseCode: http.StatusConflict, ResponseBodyRegex: `{"error":"Handle already taken","requestID":"[^"]+"}`},
+		},
+	}
+	test.Run(t)
+
+	// Nothing is imported from a conflicting archive.
+	assert.Equal(t, len(export().Users), len(archive.Users))
+}
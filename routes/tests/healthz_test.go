@@ -0,0 +1,39 @@
+package routes_test
+
+import (
+	"net/http"
+	"testing"
+
+	utils "github.com/Brawdunoir/dionysos-server/utils/tests"
+)
+
+// TestLivez tests the Livez function.
+func TestLivez(t *testing.T) {
+	method := http.MethodGet
+	test := utils.TestCreate{
+		Target: "/livez",
+		SubTests: []utils.SubTest{
+			{Name: "Success", Request: utils.Request{Method: method}, ResponseCode: http.StatusOK, ResponseBodyRegex: `^{"status":"ok"}$`},
+		},
+	}
+	test.Run(t)
+}
+
+// TestReadyz tests the Readyz function with every dependency available, failing checks being tested in the routes package.
+func TestReadyz(t *testing.T) {
+	check := `{"status":"ok","latency":"[^"]+"}`
+	checks := `{"status":"ok","checks":{"broadcaster":` + check + `}}`
+	if utils.UsesDatabase() {
+		checks = `{"status":"ok","checks":{"broadcaster":` + check + `,"database":` + check + `}}`
+	}
+
+	method := http.MethodGet
+	test := utils.TestCreate{
+		Target: "/readyz",
+		SubTests: []utils.SubTest{
+			{Name: "Success", Request: utils.Request{Method: method}, ResponseCode: http.StatusOK, ResponseBodyRegex: `^` + checks + `$`},
+			{Name: "Verbose without failure", Request: utils.Request{Method: method, Target: "/readyz?verbose"}, ResponseCode: http.StatusOK, ResponseBodyRegex: `^` + checks + `$`},
+		},
+	}
+	test.Run(t)
+}
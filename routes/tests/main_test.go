@@ -1,16 +1,39 @@
 package routes_test
 
 import (
+	"log"
 	"os"
 	"testing"
 
 	utils "github.com/Brawdunoir/dionysos-server/utils/tests"
 )
 
+// oidcProvider is the identity provider users log in with in tests.
+var oidcProvider *utils.MockOIDCProvider
+
 func TestMain(m *testing.M) {
+	var err error
+	oidcProvider, err = utils.NewMockOIDCProvider()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	os.Setenv("ENVIRONMENT", "TEST")
+	os.Setenv("ADMIN_TOKEN", adminToken)
+	os.Setenv("DEBUG_IDENTITY", "true")
+	os.Setenv("HOST", "127.0.0.1")
+	os.Setenv("OIDC_ISSUER", oidcProvider.URL)
+	os.Setenv("OIDC_CLIENT_ID", utils.MockOIDCClientID)
+	os.Setenv("OIDC_CLIENT_SECRET", utils.MockOIDCClientSecret)
+	os.Setenv("OIDC_REDIRECT_URL", "http://localhost:8080/oidc/callback")
+	// All the requests of the tests come from the same client.
+	os.Setenv("RATE_LIMIT_CREATE_USER", "100000/1m")
+	os.Setenv("RATE_LIMIT_PUBLIC", "100000/1m")
+	os.Setenv("AUTH_MAX_FAILURES_PER_IP", "100000")
 	utils.SetupTestEnvironment()
 
 	exitVal := m.Run()
 
+	oidcProvider.Close()
 	os.Exit(exitVal)
 }
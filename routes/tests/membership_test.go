@@ -0,0 +1,204 @@
+package routes_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/Brawdunoir/dionysos-server/models"
+	"github.com/Brawdunoir/dionysos-server/repositories"
+	utils "github.com/Brawdunoir/dionysos-server/utils/tests"
+	"github.com/go-playground/assert/v2"
+)
+
+// membershipUser is a user joining and leaving rooms in the concurrency tests.
+type membershipUser struct {
+	id      uint64
+	headers []utils.Header
+}
+
+// createMembershipUsers creates n users for the concurrency tests.
+func createMembershipUsers(t *testing.T, n int) []membershipUser {
+	users := make([]membershipUser, n)
+	for i := range users {
+		id, headers, err := utils.CreateTestUser(models.User{Name: fmt.Sprint("user", i)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		users[i].id, err = strconv.ParseUint(id, 10, 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		users[i].headers = headers
+	}
+	return users
+}
+
+// sendConcurrently sends a request for each user at the same time, and returns the response codes in the order of the users.
+func sendConcurrently(t *testing.T, target func(i int) string, users []membershipUser) []int {
+	var wg sync.WaitGroup
+	codes := make([]int, len(users))
+
+	for i, user := range users {
+		wg.Add(1)
+		go func(i int, user membershipUser) {
+			defer wg.Done()
+			code, err := utils.SendTestRequest(http.MethodPatch, target(i), user.headers)
+			if err != nil {
+				t.Error(err)
+			}
+			codes[i] = code
+		}(i, user)
+	}
+	wg.Wait()
+	return codes
+}
+
+// assertMembers asserts the room has exactly the given members, one of them owning it.
+func assertMembers(t *testing.T, roomID string, members []membershipUser) {
+	id, err := strconv.ParseUint(roomID, 10, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	room, err := utils.Storage.Rooms.Get(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, len(room.Users), len(members))
+	for _, member := range members {
+		if !room.HasUser(member.id) {
+			t.Errorf("user %d is not a member of the room", member.id)
+		}
+	}
+	if !room.HasUser(room.OwnerID) {
+		t.Errorf("owner %d is not a member of the room", room.OwnerID)
+	}
+}
+
+// TestRoomConcurrentMembership tests that concurrent joins and leaves keep rooms consistent:
+// no membership is lost, the owner is always a member and empty rooms are deleted.
+func TestRoomConcurrentMembership(t *testing.T) {
+	err := utils.ResetTestStorage()
+	if err != nil {
+		t.Error(err)
+	}
+
+	t.Run("Joins and leaves", func(t *testing.T) {
+		owner := createMembershipUsers(t, 1)[0]
+		roomID, err := utils.CreateTestRoom(models.Room{Name: "test"}, owner.headers)
+		if err != nil {
+			t.Fatal(err)
+		}
+		target := roomURL + "/" + roomID
+
+		// The first user keeps the room from being emptied while the owner leaves.
+		users := createMembershipUsers(t, 9)
+		code, err := utils.SendTestRequest(http.MethodPatch, target+"/connect", users[0].headers)
+		assert.Equal(t, err, nil)
+		assert.Equal(t, code, http.StatusNoContent)
+
+		// The others join while the owner leaves.
+		codes := sendConcurrently(t, func(i int) string {
+			if i == 0 {
+				return target + "/disconnect"
+			}
+			return target + "/connect"
+		}, append([]membershipUser{owner}, users[1:]...))
+		for _, code := range codes {
+			assert.Equal(t, code, http.StatusNoContent)
+		}
+		assertMembers(t, roomID, users)
+
+		// Half of them leave at the same time.
+		codes = sendConcurrently(t, func(int) string { return target + "/disconnect" }, users[:5])
+		for _, code := range codes {
+			assert.Equal(t, code, http.StatusNoContent)
+		}
+		assertMembers(t, roomID, users[5:])
+	})
+
+	t.Run("Same user joins twice", func(t *testing.T) {
+		users := createMembershipUsers(t, 2)
+		roomID, err := utils.CreateTestRoom(models.Room{Name: "test"}, users[0].headers)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		codes := sendConcurrently(t, func(int) string { return roomURL + "/" + roomID + "/connect" }, []membershipUser{users[1], users[1], users[1]})
+		joined := 0
+		for _, code := range codes {
+			if code == http.StatusNoContent {
+				joined++
+			} else {
+				assert.Equal(t, code, http.StatusConflict)
+			}
+		}
+		assert.Equal(t, joined, 1)
+		assertMembers(t, roomID, users)
+	})
+
+	t.Run("Everyone leaves", func(t *testing.T) {
+		users := createMembershipUsers(t, 8)
+		roomID, err := utils.CreateTestRoom(models.Room{Name: "test"}, users[0].headers)
+		if err != nil {
+			t.Fatal(err)
+		}
+		target := roomURL + "/" + roomID
+		for _, user := range users[1:] {
+			code, err := utils.SendTestRequest(http.MethodPatch, target+"/connect", user.headers)
+			assert.Equal(t, err, nil)
+			assert.Equal(t, code, http.StatusNoContent)
+		}
+
+		codes := sendConcurrently(t, func(int) string { return target + "/disconnect" }, users)
+		for _, code := range codes {
+			assert.Equal(t, code, http.StatusNoContent)
+		}
+
+		id, err := strconv.ParseUint(roomID, 10, 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = utils.Storage.Rooms.Get(context.Background(), id)
+		assert.Equal(t, err, repositories.ErrNotFound)
+		for _, user := range users {
+			roomIDs, err := utils.Storage.Users.GetRoomIDs(context.Background(), user.id)
+			assert.Equal(t, err, nil)
+			assert.Equal(t, len(roomIDs), 0)
+		}
+	})
+
+	t.Run("Owner leaves while kicking", func(t *testing.T) {
+		users := createMembershipUsers(t, 3)
+		roomID, err := utils.CreateTestRoom(models.Room{Name: "test"}, users[0].headers)
+		if err != nil {
+			t.Fatal(err)
+		}
+		target := roomURL + "/" + roomID
+		for _, user := range users[1:] {
+			code, err := utils.SendTestRequest(http.MethodPatch, target+"/connect", user.headers)
+			assert.Equal(t, err, nil)
+			assert.Equal(t, code, http.StatusNoContent)
+		}
+
+		// Whichever comes first, the owner is a member: either the second user is kicked before the owner leaves,
+		// or the kick is refused as the owner left and one of the others owns the room.
+		codes := sendConcurrently(t, func(i int) string {
+			if i == 0 {
+				return target + "/disconnect"
+			}
+			return target + "/kick/" + fmt.Sprint(users[1].id)
+		}, []membershipUser{users[0], users[0]})
+		assert.Equal(t, codes[0], http.StatusNoContent)
+		if codes[1] == http.StatusNoContent {
+			assertMembers(t, roomID, users[2:])
+		} else {
+			assert.Equal(t, codes[1], http.StatusUnauthorized)
+			assertMembers(t, roomID, users[1:])
+		}
+	})
+}
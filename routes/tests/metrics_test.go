@@ -0,0 +1,62 @@
+package routes_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Brawdunoir/dionysos-server/models"
+	utils "github.com/Brawdunoir/dionysos-server/utils/tests"
+)
+
+// TestMetrics tests the metrics endpoint is only served to the admin and exposes HTTP, SSE and domain metrics.
+func TestMetrics(t *testing.T) {
+	_, headers, err := utils.CreateTestUser(models.User{Name: "test"})
+	if err != nil {
+		t.Error(err)
+	}
+	roomID, err := utils.CreateTestRoom(models.Room{Name: "test"}, headers)
+	if err != nil {
+		t.Error(err)
+	}
+	stream, err := utils.SubscribeTestStream(roomID, headers)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	method := http.MethodGet
+	adminHeaders := []utils.Header{{Key: "X-Admin-Token", Value: adminToken}}
+	subscribers := `dionysos_sse_subscribers{room="` + roomID + `"}`
+	test := utils.TestCreate{
+		Target:  "/metrics",
+		Headers: adminHeaders,
+		SubTests: []utils.SubTest{
+			{Name: "No admin token", Request: utils.Request{Method: method, Headers: []utils.Header{}}, ResponseCode: http.StatusUnauthorized, ResponseBodyRegex: `{"error":"User not authorized","requestID":"[^"]+"}`},
+			{Name: "User credentials", Request: utils.Request{Method: method, Headers: headers}, ResponseCode: http.StatusUnauthorized, ResponseBodyRegex: `{"error":"User not authorized","requestID":"[^"]+"}`},
+			{Name: "Request duration by route template", Request: utils.Request{Method: method}, ResponseCode: http.StatusOK, ResponseBodyRegex: `dionysos_http_request_duration_seconds_count{method="POST",route="/users",status="201"} [1-9]`},
+			{Name: "Users created", Request: utils.Request{Method: method}, ResponseCode: http.StatusOK, ResponseBodyRegex: `dionysos_users_created_total [1-9]`},
+			{Name: "Rooms created", Request: utils.Request{Method: method}, ResponseCode: http.StatusOK, ResponseBodyRegex: `dionysos_rooms_created_total [1-9]`},
+			{Name: "Subscribers by room", Request: utils.Request{Method: method}, ResponseCode: http.StatusOK, ResponseBodyRegex: subscribers + ` 1`},
+		},
+	}
+	if utils.UsesDatabase() {
+		test.SubTests = append(test.SubTests, utils.SubTest{Name: "Database query duration", Request: utils.Request{Method: method}, ResponseCode: http.StatusOK, ResponseBodyRegex: `dionysos_db_query_duration_seconds_count{operation="create",table="rooms"} [1-9]`})
+	}
+	test.Run(t)
+
+	// The subscribers of a room are not reported anymore once its stream is closed.
+	code, err := utils.SendTestRequest(http.MethodDelete, roomURL+"/"+roomID, headers)
+	if err != nil || code != http.StatusNoContent {
+		t.Fatalf("failed to close the room: %d %v", code, err)
+	}
+	if _, err := stream(); err != nil {
+		t.Fatal(err)
+	}
+	code, body, err := utils.ExecuteTestRequest(method, "/metrics", "", adminHeaders)
+	if err != nil || code != http.StatusOK {
+		t.Fatalf("failed to get the metrics: %d %v", code, err)
+	}
+	if strings.Contains(string(body), subscribers) {
+		t.Errorf("subscribers of a closed room still reported")
+	}
+}
@@ -1,11 +1,17 @@
 package routes_test
 
 import (
+	"context"
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 	"testing"
 
+	"github.com/Brawdunoir/dionysos-server/middlewares"
 	"github.com/Brawdunoir/dionysos-server/models"
 	utils "github.com/Brawdunoir/dionysos-server/utils/tests"
+	"github.com/Brawdunoir/dionysos-server/variables"
 )
 
 // TestAuthentication tests the authentication middleware.
@@ -21,12 +27,188 @@ func TestAuthenticate(t *testing.T) {
 		Target:  roomURL,
 		Headers: headers,
 		SubTests: []utils.SubTest{
-			{Name: "Wrong password", Request: utils.Request{Method: method, Headers: utils.GetBasicAuthHeader(id, "password")}, ResponseCode: http.StatusUnauthorized, ResponseBodyRegex: `{"error":"User not authorized"}`},
-			{Name: "User not found", Request: utils.Request{Method: method, Headers: utils.GetBasicAuthHeader("987654321", "password")}, ResponseCode: http.StatusNotFound, ResponseBodyRegex: `{"error":"User not found during authentication"}`},
-			{Name: "Empty authorization header", Request: utils.Request{Method: method, Headers: []utils.Header{}}, ResponseCode: http.StatusUnauthorized, ResponseBodyRegex: `{"error":"User not authorized"}`},
-			{Name: "Badly formed authorization header", Request: utils.Request{Method: method, Headers: []utils.Header{{Key: "Authorization", Value: "apikey xxx"}}}, ResponseCode: http.StatusUnauthorized, ResponseBodyRegex: `{"error":"User not authorized"}`},
+			{Name: "Wrong password", Request: utils.Request{Method: method, Headers: utils.GetBasicAuthHeader(id, "password")}, ResponseCode: http.StatusUnauthorized, ResponseBodyRegex: `{"error":"User not authorized","requestID":"[^"]+"}`},
+			{Name: "User not found", Request: utils.Request{Method: method, Headers: utils.GetBasicAuthHeader("987654321", "password")}, ResponseCode: http.StatusUnauthorized, ResponseBodyRegex: `{"error":"User not authorized","requestID":"[^"]+"}`},
+			{Name: "Empty authorization header", Request: utils.Request{Method: method, Headers: []utils.Header{}}, ResponseCode: http.StatusUnauthorized, ResponseBodyRegex: `{"error":"User not authorized","requestID":"[^"]+"}`},
+			{Name: "Badly formed authorization header", Request: utils.Request{Method: method, Headers: []utils.Header{{Key: "Authorization", Value: "apikey xxx"}}}, ResponseCode: http.StatusUnauthorized, ResponseBodyRegex: `{"error":"User not authorized","requestID":"[^"]+"}`},
 		},
 	}
 
 	tests.Run(t)
 }
+
+// TestAuthenticatePlaintextPassword tests that users whose password was stored in plaintext can still authenticate,
+// and that their password gets hashed in the process.
+func TestAuthenticatePlaintextPassword(t *testing.T) {
+	user := models.User{Name: "legacy", Password: "legacypassword"}
+	err := utils.Storage.Users.Create(context.Background(), &user)
+	if err != nil {
+		t.Error(err)
+	}
+	id := fmt.Sprint(user.ID)
+
+	method := http.MethodPost
+	tests := utils.TestCreate{
+		Target: roomURL,
+		SubTests: []utils.SubTest{
+			{Name: "Wrong password", Request: utils.Request{Method: method, Headers: utils.GetBasicAuthHeader(id, "password"), Body: `{"name":"legacy"}`}, ResponseCode: http.StatusUnauthorized, ResponseBodyRegex: `{"error":"User not authorized","requestID":"[^"]+"}`},
+			{Name: "Right password", Request: utils.Request{Method: method, Headers: utils.GetBasicAuthHeader(id, "legacypassword"), Body: `{"name":"legacy"}`}, ResponseCode: http.StatusCreated, ResponseBodyRegex: `{"uri":"/rooms/[0-9]+"}`},
+			{Name: "Right password once hashed", Request: utils.Request{Method: method, Headers: utils.GetBasicAuthHeader(id, "legacypassword"), Body: `{"name":"legacy"}`}, ResponseCode: http.StatusCreated, ResponseBodyRegex: `{"uri":"/rooms/[0-9]+"}`},
+		},
+	}
+	tests.Run(t)
+
+	user, err = utils.Storage.Users.Get(context.Background(), user.ID)
+	if err != nil {
+		t.Error(err)
+	}
+	if !strings.HasPrefix(user.Password, "$argon2id$") {
+		t.Errorf("password has not been hashed: %s", user.Password)
+	}
+}
+
+// TestRequestID tests that the request ID sent by the client is reused in error bodies, and replaced if invalid.
+func TestRequestID(t *testing.T) {
+	method := http.MethodPost
+	tests := utils.TestCreate{
+		Target: roomURL,
+		SubTests: []utils.SubTest{
+			{Name: "Given ID", Request: utils.Request{Method: method, Headers: []utils.Header{{Key: "X-Request-ID", Value: "test-request-id"}}}, ResponseCode: http.StatusUnauthorized, ResponseBodyRegex: `{"error":"User not authorized","requestID":"test-request-id"}`},
+			{Name: "Invalid ID", Request: utils.Request{Method: method, Headers: []utils.Header{{Key: "X-Request-ID", Value: "invalid id\""}}}, ResponseCode: http.StatusUnauthorized, ResponseBodyRegex: `{"error":"User not authorized","requestID":"[0-9a-f]{32}"}`},
+			{Name: "Generated ID", Request: utils.Request{Method: method, Headers: []utils.Header{}}, ResponseCode: http.StatusUnauthorized, ResponseBodyRegex: `{"error":"User not authorized","requestID":"[0-9a-f]{32}"}`},
+		},
+	}
+
+	tests.Run(t)
+}
+
+// TestDebugIdentity tests the X-Debug-User header, enabled for the tests in TestMain,
+// and that neither it nor a wrong password is accepted outside of the testing environment.
+func TestDebugIdentity(t *testing.T) {
+	id, _, err := utils.CreateTestUser(models.User{Name: "test"})
+	if err != nil {
+		t.Error(err)
+	}
+	debugHeaders := []utils.Header{{Key: middlewares.DebugUserHeader, Value: id}}
+
+	method := http.MethodPost
+	tests := utils.TestCreate{
+		Target:  roomURL,
+		Headers: debugHeaders,
+		SubTests: []utils.SubTest{
+			{Name: "Debug user", Request: utils.Request{Method: method, Body: `{"name":"debug"}`}, ResponseCode: http.StatusCreated, ResponseBodyRegex: `{"uri":"/rooms/[0-9]+"}`},
+			{Name: "Debug user not found", Request: utils.Request{Method: method, Headers: []utils.Header{{Key: middlewares.DebugUserHeader, Value: "987654321"}}, Body: `{"name":"debug"}`}, ResponseCode: http.StatusUnauthorized, ResponseBodyRegex: `{"error":"User not authorized","requestID":"[^"]+"}`},
+			{Name: "Invalid debug user", Request: utils.Request{Method: method, Headers: []utils.Header{{Key: middlewares.DebugUserHeader, Value: "1 OR 1=1"}}, Body: `{"name":"debug"}`}, ResponseCode: http.StatusUnauthorized, ResponseBodyRegex: `{"error":"User not authorized","requestID":"[^"]+"}`},
+		},
+	}
+	tests.Run(t)
+
+	for _, environment := range []string{variables.ENVIRONMENT_PRODUCTION, variables.ENVIRONMENT_DEVELOPMENT} {
+		t.Run(environment, func(t *testing.T) {
+			defer func(environment string) { variables.Environment = environment }(variables.Environment)
+			variables.Environment = environment
+
+			tests := utils.TestCreate{
+				Target: roomURL,
+				SubTests: []utils.SubTest{
+					{Name: "Wrong password", Request: utils.Request{Method: method, Headers: utils.GetBasicAuthHeader(id, "password"), Body: `{"name":"debug"}`}, ResponseCode: http.StatusUnauthorized, ResponseBodyRegex: `{"error":"User not authorized","requestID":"[^"]+"}`},
+				},
+			}
+			if environment == variables.ENVIRONMENT_PRODUCTION {
+				tests.SubTests = append(tests.SubTests, utils.SubTest{Name: "Debug user", Request: utils.Request{Method: method, Headers: debugHeaders, Body: `{"name":"debug"}`}, ResponseCode: http.StatusUnauthorized, ResponseBodyRegex: `{"error":"User not authorized","requestID":"[^"]+"}`})
+			}
+			tests.Run(t)
+		})
+	}
+}
+
+// TestDebugIdentityAllowed tests in which conditions the debug identity can be enabled.
+func TestDebugIdentityAllowed(t *testing.T) {
+	tests := []struct {
+		name        string
+		environment string
+		host        string
+		allowed     bool
+	}{
+		{"Production on loopback", variables.ENVIRONMENT_PRODUCTION, "127.0.0.1", false},
+		{"Production on localhost", variables.ENVIRONMENT_PRODUCTION, "localhost", false},
+		{"Production on all interfaces", variables.ENVIRONMENT_PRODUCTION, "", false},
+		{"Development on all interfaces", variables.ENVIRONMENT_DEVELOPMENT, "", false},
+		{"Development on a public address", variables.ENVIRONMENT_DEVELOPMENT, "192.0.2.1", false},
+		{"Development on any address", variables.ENVIRONMENT_DEVELOPMENT, "0.0.0.0", false},
+		{"Development on loopback", variables.ENVIRONMENT_DEVELOPMENT, "127.0.0.1", true},
+		{"Development on IPv6 loopback", variables.ENVIRONMENT_DEVELOPMENT, "::1", true},
+		{"Development on localhost", variables.ENVIRONMENT_DEVELOPMENT, "localhost", true},
+		{"Testing on loopback", variables.ENVIRONMENT_TESTING, "127.0.0.1", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := middlewares.DebugIdentityAllowed(test.environment, test.host)
+			if (err == nil) != test.allowed {
+				t.Errorf("expected allowed to be %v, got error %v", test.allowed, err)
+			}
+		})
+	}
+}
+
+// TestRateLimit tests that users are rate limited, on the room membership routes whose limit is the lowest.
+func TestRateLimit(t *testing.T) {
+	_, headers, err := utils.CreateTestUser(models.User{Name: "test"})
+	if err != nil {
+		t.Error(err)
+	}
+	roomID, err := utils.CreateTestRoom(models.Room{Name: "test"}, headers)
+	if err != nil {
+		t.Error(err)
+	}
+	_, otherHeaders, err := utils.CreateTestUser(models.User{Name: "other"})
+	if err != nil {
+		t.Error(err)
+	}
+
+	limit, err := strconv.Atoi(strings.Split(variables.RateLimitMembership, "/")[0])
+	if err != nil {
+		t.Error(err)
+	}
+
+	method := http.MethodPatch
+	tests := utils.TestCreate{
+		Target:  roomURL + "/" + roomID + "/connect",
+		Headers: headers,
+	}
+	for i := 0; i < limit; i++ {
+		tests.SubTests = append(tests.SubTests, utils.SubTest{Name: fmt.Sprintf("Request %d", i+1), Request: utils.Request{Method: method}, ResponseCode: http.StatusConflict, ResponseBodyRegex: `{"error":"User already in room","requestID":"[^"]+"}`})
+	}
+	tests.SubTests = append(tests.SubTests,
+		utils.SubTest{Name: "Limit exceeded", Request: utils.Request{Method: method}, ResponseCode: http.StatusTooManyRequests, ResponseBodyRegex: `{"error":"Too many requests","requestID":"[^"]+"}`},
+		utils.SubTest{Name: "Other user", Request: utils.Request{Method: method, Headers: otherHeaders}, ResponseCode: http.StatusNoContent, ResponseBodyRegex: ``},
+		utils.SubTest{Name: "Other route", Request: utils.Request{Method: method, Target: roomURL + "/" + roomID, Body: `{"name":"test2"}`}, ResponseCode: http.StatusNoContent, ResponseBodyRegex: ``},
+	)
+	tests.Run(t)
+}
+
+func TestBruteForce(t *testing.T) {
+	id, headers, err := utils.CreateTestUser(models.User{Name: "test"})
+	if err != nil {
+		t.Error(err)
+	}
+
+	limit, err := strconv.Atoi(variables.AuthMaxFailures)
+	if err != nil {
+		t.Error(err)
+	}
+
+	method := http.MethodPost
+	tests := utils.TestCreate{
+		Target:  roomURL,
+		Headers: utils.GetBasicAuthHeader(id, "password"),
+	}
+	for i := 0; i < limit; i++ {
+		tests.SubTests = append(tests.SubTests, utils.SubTest{Name: fmt.Sprintf("Wrong password %d", i+1), Request: utils.Request{Method: method, Body: `{"name":"test"}`}, ResponseCode: http.StatusUnauthorized, ResponseBodyRegex: `{"error":"User not authorized","requestID":"[^"]+"}`})
+	}
+	tests.SubTests = append(tests.SubTests,
+		utils.SubTest{Name: "Right password while locked out", Request: utils.Request{Method: method, Headers: headers, Body: `{"name":"test"}`}, ResponseCode: http.StatusTooManyRequests, ResponseBodyRegex: `{"error":"Too many requests","requestID":"[^"]+"}`},
+		utils.SubTest{Name: "Other user", Request: utils.Request{Method: method, Headers: utils.GetBasicAuthHeader("987654321", "password"), Body: `{"name":"test"}`}, ResponseCode: http.StatusUnauthorized, ResponseBodyRegex: `{"error":"User not authorized","requestID":"[^"]+"}`},
+	)
+	tests.Run(t)
+}
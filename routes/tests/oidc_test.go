@@ -0,0 +1,67 @@
+package routes_test
+
+import (
+	"net/http"
+	"path"
+	"testing"
+
+	utils "github.com/Brawdunoir/dionysos-server/utils/tests"
+	"github.com/Brawdunoir/dionysos-server/variables"
+)
+
+// TestOIDCLogin tests the OIDCLogin and OIDCCallback functions against a mock provider.
+func TestOIDCLogin(t *testing.T) {
+	err := utils.ResetTestStorage()
+	if err != nil {
+		t.Error(err)
+	}
+
+	tokens, err := utils.LoginTestOIDC(oidcProvider, "alice", "Alice")
+	if err != nil {
+		t.Error(err)
+	}
+	id := path.Base(tokens.URI)
+	target, headers, err := utils.StartTestOIDCLogin(oidcProvider, "alice", "Alice")
+	if err != nil {
+		t.Error(err)
+	}
+	otherTarget, otherHeaders, err := utils.StartTestOIDCLogin(oidcProvider, "bob", "B")
+	if err != nil {
+		t.Error(err)
+	}
+
+	method := http.MethodGet
+	test := utils.TestCreate{
+		Headers: headers,
+		SubTests: []utils.SubTest{
+			{Name: "Redirect to provider", Request: utils.Request{Method: method, Target: "/oidc/login"}, ResponseCode: http.StatusFound, ResponseBodyRegex: ``},
+			{Name: "Missing cookie", Request: utils.Request{Method: method, Target: target, Headers: []utils.Header{}}, ResponseCode: http.StatusUnauthorized, ResponseBodyRegex: `{"error":"Identity not verified","requestID":"[^"]+"}`},
+			{Name: "Wrong state", Request: utils.Request{Method: method, Target: "/oidc/callback?code=abc&state=abc"}, ResponseCode: http.StatusUnauthorized, ResponseBodyRegex: `{"error":"Identity not verified","requestID":"[^"]+"}`},
+			{Name: "Cookie of another login", Request: utils.Request{Method: method, Target: target, Headers: otherHeaders}, ResponseCode: http.StatusUnauthorized, ResponseBodyRegex: `{"error":"Identity not verified","requestID":"[^"]+"}`},
+			{Name: "Provider error", Request: utils.Request{Method: method, Target: target + "&error=access_denied"}, ResponseCode: http.StatusUnauthorized, ResponseBodyRegex: `{"error":"Identity not verified","requestID":"[^"]+"}`},
+			{Name: "Same user", Request: utils.Request{Method: method, Target: target}, ResponseCode: http.StatusOK, ResponseBodyRegex: `^{"accessToken":"[\w-]+\.[\w-]+\.[\w-]+","tokenType":"Bearer","expiresIn":900,"refreshToken":"[0-9a-f]{64}","uri":"/users/` + id + `"}$`},
+			{Name: "Code already used", Request: utils.Request{Method: method, Target: target}, ResponseCode: http.StatusUnauthorized, ResponseBodyRegex: `{"error":"Identity not verified","requestID":"[^"]+"}`},
+			{Name: "Other user", Request: utils.Request{Method: method, Target: otherTarget, Headers: otherHeaders}, ResponseCode: http.StatusOK, ResponseBodyRegex: `"uri":"/users/[0-9]+"`},
+			{Name: "Authenticated with access token", Request: utils.Request{Method: http.MethodPatch, Target: userURL + "/" + id, Headers: utils.GetBearerAuthHeader(tokens.AccessToken), Body: `{"name":"Alice2"}`}, ResponseCode: http.StatusNoContent, ResponseBodyRegex: ``},
+		},
+	}
+	test.Run(t)
+
+	t.Run("Anonymous users disabled", func(t *testing.T) {
+		defer func(anonymousUsers string) { variables.AnonymousUsers = anonymousUsers }(variables.AnonymousUsers)
+		variables.AnonymousUsers = "false"
+
+		target, headers, err := utils.StartTestOIDCLogin(oidcProvider, "alice", "Alice")
+		if err != nil {
+			t.Error(err)
+		}
+
+		test := utils.TestCreate{
+			SubTests: []utils.SubTest{
+				{Name: "Anonymous user", Request: utils.Request{Method: http.MethodPost, Target: userURL, Body: `{"name":"test"}`}, ResponseCode: http.StatusForbidden, ResponseBodyRegex: `{"error":"Anonymous users disabled","requestID":"[^"]+"}`},
+				{Name: "OIDC user", Request: utils.Request{Method: method, Target: target, Headers: headers}, ResponseCode: http.StatusOK, ResponseBodyRegex: `"uri":"/users/` + id + `"`},
+			},
+		}
+		test.Run(t)
+	})
+}
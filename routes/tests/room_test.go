@@ -6,7 +6,6 @@ import (
 	"net/http"
 	"testing"
 
-	"github.com/Brawdunoir/dionysos-server/database"
 	"github.com/Brawdunoir/dionysos-server/models"
 	utilsRoutes "github.com/Brawdunoir/dionysos-server/utils/routes"
 	utils "github.com/Brawdunoir/dionysos-server/utils/tests"
@@ -30,7 +29,7 @@ var roomCreateRequest = utils.Request{Method: http.MethodPost, Target: roomURL,
 
 // TestCreateRoom tests the CreateRoom function.
 func TestCreateRoom(t *testing.T) {
-	err := database.MigrateDB(database.GetDB(), true)
+	err := utils.ResetTestStorage()
 	if err != nil {
 		t.Error(err)
 	}
@@ -47,16 +46,16 @@ func TestCreateRoom(t *testing.T) {
 		Headers: headers,
 		SubTests: []utils.SubTest{
 			{Name: "Success", Request: utils.Request{Method: method, Body: `{"name":"test"}`}, ResponseCode: http.StatusCreated, ResponseBodyRegex: `{"uri":"` + roomURL + `/\d+"}`},
-			{Name: "Empty body", Request: utils.Request{Method: method, Body: ``}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":".+"}`},
-			{Name: "Empty json", Request: utils.Request{Method: method, Body: `{}`}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":".+"}`},
-			{Name: "Bad name key", Request: utils.Request{Method: method, Body: `{"wrongkey":"test"}`}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":".+"}`},
-			{Name: "Empty name value", Request: utils.Request{Method: method, Body: `{"name":""}`}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":".+"}`},
-			{Name: "Nil name value", Request: utils.Request{Method: method, Body: `{"name":nil}`}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":".+"}`},
-			{Name: "Integer name value", Request: utils.Request{Method: method, Body: `{"name":1}`}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":".+"}`},
-			{Name: "Object name value", Request: utils.Request{Method: method, Body: `{"name":{"somekey":"somevalue"}}`}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":".+"}`},
-			{Name: "Less than min caracters", Request: utils.Request{Method: method, Body: `{"name":"a"}`}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":".+"}`},
+			{Name: "Empty body", Request: utils.Request{Method: method, Body: ``}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":".+","requestID":"[^"]+"}`},
+			{Name: "Empty json", Request: utils.Request{Method: method, Body: `{}`}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":".+","requestID":"[^"]+"}`},
+			{Name: "Bad name key", Request: utils.Request{Method: method, Body: `{"wrongkey":"test"}`}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":".+","requestID":"[^"]+"}`},
+			{Name: "Empty name value", Request: utils.Request{Method: method, Body: `{"name":""}`}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":".+","requestID":"[^"]+"}`},
+			{Name: "Nil name value", Request: utils.Request{Method: method, Body: `{"name":nil}`}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":".+","requestID":"[^"]+"}`},
+			{Name: "Integer name value", Request: utils.Request{Method: method, Body: `{"name":1}`}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":".+","requestID":"[^"]+"}`},
+			{Name: "Object name value", Request: utils.Request{Method: method, Body: `{"name":{"somekey":"somevalue"}}`}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":".+","requestID":"[^"]+"}`},
+			{Name: "Less than min caracters", Request: utils.Request{Method: method, Body: `{"name":"a"}`}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":".+","requestID":"[^"]+"}`},
 			{Name: "Exactly min caracters", Request: utils.Request{Method: method, Body: `{"name":"ab"}`}, ResponseCode: http.StatusCreated, ResponseBodyRegex: `{"uri":"` + roomURL + `/\d+"}`},
-			{Name: "More than max caracters", Request: utils.Request{Method: method, Body: `{"name":"xxxxxxxxxxxxxxxxxxxxx"}`}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":".+"}`},
+			{Name: "More than max caracters", Request: utils.Request{Method: method, Body: `{"name":"xxxxxxxxxxxxxxxxxxxxx"}`}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":".+","requestID":"[^"]+"}`},
 			{Name: "Exactly max caracters", Request: utils.Request{Method: method, Body: `{"name":"xxxxxxxxxxxxxxxxxxxx"}`}, ResponseCode: http.StatusCreated, ResponseBodyRegex: `{"uri":"` + roomURL + `/\d+"}`},
 		},
 	}
@@ -65,7 +64,7 @@ func TestCreateRoom(t *testing.T) {
 
 // TestGetRoom tests the GetRoom function.
 func TestGetRoom(t *testing.T) {
-	err := database.MigrateDB(database.GetDB(), true)
+	err := utils.ResetTestStorage()
 	if err != nil {
 		t.Error(err)
 	}
@@ -85,8 +84,8 @@ func TestGetRoom(t *testing.T) {
 		CreateRequestHeaders: headers,
 		SubTests: []utils.SubTest{
 			{Name: "Success", Request: utils.Request{Method: method, Headers: headers}, ResponseCode: http.StatusOK, ResponseBodyRegex: `{"name":"test"` + suffix},
-			{Name: "Invalid ID", Request: utils.Request{Method: method, Target: "abc", Headers: headers}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":"Invalid ID"}`},
-			{Name: "Not found", Request: utils.Request{Method: method, Target: "987654321", Headers: headers}, ResponseCode: http.StatusNotFound, ResponseBodyRegex: `{"error":"Room not found"}`},
+			{Name: "Invalid ID", Request: utils.Request{Method: method, Target: "abc", Headers: headers}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":"Invalid ID","requestID":"[^"]+"}`},
+			{Name: "Not found", Request: utils.Request{Method: method, Target: roomURL + "/987654321", Absolute: true, Headers: headers}, ResponseCode: http.StatusNotFound, ResponseBodyRegex: `{"error":"Room not found","requestID":"[^"]+"}`},
 		},
 	}
 	test.Run(t)
@@ -94,7 +93,7 @@ func TestGetRoom(t *testing.T) {
 
 // TestUpdateRoom tests the UpdateRoom function.
 func TestUpdateRoom(t *testing.T) {
-	err := database.MigrateDB(database.GetDB(), true)
+	err := utils.ResetTestStorage()
 	if err != nil {
 		t.Error(err)
 	}
@@ -115,21 +114,59 @@ func TestUpdateRoom(t *testing.T) {
 		SubTests: []utils.SubTest{
 			{Name: "Success", Request: utils.Request{Method: method, Headers: headers, Body: `{"name":"test2"}`}, ResponseCode: http.StatusNoContent, ResponseBodyRegex: ``},
 			{Name: "Correctly updated", Request: utils.Request{Method: http.MethodGet, Headers: headers}, ResponseCode: http.StatusOK, ResponseBodyRegex: `{"name":"test2"` + suffix},
-			{Name: "Empty Body", Request: utils.Request{Method: method, Headers: headers, Body: ``}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":".+"}`},
-			{Name: "Empty json", Request: utils.Request{Method: method, Headers: headers, Body: `{}`}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":".+"}`},
-			{Name: "Bad name key", Request: utils.Request{Method: method, Headers: headers, Body: `{"wrongkey":"test2"}`}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":".+"}`},
-			{Name: "Empty name value", Request: utils.Request{Method: method, Headers: headers, Body: `{"name":""}`}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":".+"}`},
-			{Name: "Nil name value", Request: utils.Request{Method: method, Headers: headers, Body: `{"name":nil}`}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":".+"}`},
-			{Name: "Integer name value", Request: utils.Request{Method: method, Headers: headers, Body: `{"name":1}`}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":".+"}`},
-			{Name: "Object name value", Request: utils.Request{Method: method, Headers: headers, Body: `{"name":{"somekey":"somevalue"}}`}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":".+"}`},
-			{Name: "Less than min caracters", Request: utils.Request{Method: method, Headers: headers, Body: `{"name":"a"}`}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":".+"}`},
+			{Name: "Empty Body", Request: utils.Request{Method: method, Headers: headers, Body: ``}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":".+","requestID":"[^"]+"}`},
+			{Name: "Empty json", Request: utils.Request{Method: method, Headers: headers, Body: `{}`}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":".+","requestID":"[^"]+"}`},
+			{Name: "Bad name key", Request: utils.Request{Method: method, Headers: headers, Body: `{"wrongkey":"test2"}`}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":".+","requestID":"[^"]+"}`},
+			{Name: "Empty name value", Request: utils.Request{Method: method, Headers: headers, Body: `{"name":""}`}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":".+","requestID":"[^"]+"}`},
+			{Name: "Nil name value", Request: utils.Request{Method: method, Headers: headers, Body: `{"name":nil}`}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":".+","requestID":"[^"]+"}`},
+			{Name: "Integer name value", Request: utils.Request{Method: method, Headers: headers, Body: `{"name":1}`}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":".+","requestID":"[^"]+"}`},
+			{Name: "Object name value", Request: utils.Request{Method: method, Headers: headers, Body: `{"name":{"somekey":"somevalue"}}`}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":".+","requestID":"[^"]+"}`},
+			{Name: "Less than min caracters", Request: utils.Request{Method: method, Headers: headers, Body: `{"name":"a"}`}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":".+","requestID":"[^"]+"}`},
 			{Name: "Exactly min caracters", Request: utils.Request{Method: method, Headers: headers, Body: `{"name":"ab"}`}, ResponseCode: http.StatusNoContent, ResponseBodyRegex: ``},
 			{Name: "Correctly updated", Request: utils.Request{Method: http.MethodGet, Headers: headers}, ResponseCode: http.StatusOK, ResponseBodyRegex: `{"name":"ab"` + suffix},
-			{Name: "More than max caracters", Request: utils.Request{Method: method, Headers: headers, Body: `{"name":"xxxxxxxxxxxxxxxxxxxxx"}`}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":".+"}`},
+			{Name: "More than max caracters", Request: utils.Request{Method: method, Headers: headers, Body: `{"name":"xxxxxxxxxxxxxxxxxxxxx"}`}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":".+","requestID":"[^"]+"}`},
 			{Name: "Exactly max caracters", Request: utils.Request{Method: method, Headers: headers, Body: `{"name":"xxxxxxxxxxxxxxxxxxxx"}`}, ResponseCode: http.StatusNoContent, ResponseBodyRegex: ``},
 			{Name: "Correctly updated", Request: utils.Request{Method: http.MethodGet, Headers: headers}, ResponseCode: http.StatusOK, ResponseBodyRegex: `{"name":"xxxxxxxxxxxxxxxxxxxx"` + suffix},
-			{Name: "Invalid ID", Request: utils.Request{Method: method, Headers: headers, Target: "abc"}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":"Invalid ID"}`},
-			{Name: "Not found", Request: utils.Request{Method: method, Headers: headers, Target: "987654321", Body: `{"name":"test2"}`}, ResponseCode: http.StatusNotFound, ResponseBodyRegex: `{"error":"Room not found"}`},
+			{Name: "Invalid ID", Request: utils.Request{Method: method, Headers: headers, Target: "abc"}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":"Invalid ID","requestID":"[^"]+"}`},
+			{Name: "Not found", Request: utils.Request{Method: method, Headers: headers, Target: roomURL + "/987654321", Absolute: true, Body: `{"name":"test2"}`}, ResponseCode: http.StatusNotFound, ResponseBodyRegex: `{"error":"Room not found","requestID":"[^"]+"}`},
+		},
+	}
+	test.Run(t)
+}
+
+// TestConditionalRoom tests the ETag of the GetRoom function and the If-Match header of the UpdateRoom function.
+func TestConditionalRoom(t *testing.T) {
+	err := utils.ResetTestStorage()
+	if err != nil {
+		t.Error(err)
+	}
+
+	// Create the user that will be used to pursue the tests.
+	id, headers, err := utils.CreateTestUser(models.User{Name: "test"})
+	if err != nil {
+		t.Error(err)
+	}
+
+	suffix := fmt.Sprintf(`,"ownerID":%s,"users":\[{"ID":%s,"name":"test"}\]}`, id, id)
+	ifMatch := func(value string) []utils.Header { return []utils.Header{{Key: "If-Match", Value: value}} }
+	ifNoneMatch := func(value string) []utils.Header { return []utils.Header{{Key: "If-None-Match", Value: value}} }
+
+	method := http.MethodPatch
+	test := utils.TestRUD{
+		CreateRequest:        roomCreateRequest,
+		CreateRequestHeaders: headers,
+		CreateResponse:       CreateResponseRoom{},
+		SubTests: []utils.SubTest{
+			{Name: "Not modified", Request: utils.Request{Method: http.MethodGet, Headers: headers, ExtraHeaders: ifNoneMatch(`"1"`)}, ResponseCode: http.StatusNotModified, ResponseBodyRegex: `^$`},
+			{Name: "Modified", Request: utils.Request{Method: http.MethodGet, Headers: headers, ExtraHeaders: ifNoneMatch(`"0"`)}, ResponseCode: http.StatusOK, ResponseBodyRegex: `{"name":"test"` + suffix},
+			{Name: "Matching version", Request: utils.Request{Method: method, Headers: headers, ExtraHeaders: ifMatch(`"1"`), Body: `{"name":"test2"}`}, ResponseCode: http.StatusNoContent, ResponseBodyRegex: ``},
+			{Name: "Stale version", Request: utils.Request{Method: method, Headers: headers, ExtraHeaders: ifMatch(`"1"`), Body: `{"name":"test3"}`}, ResponseCode: http.StatusPreconditionFailed, ResponseBodyRegex: `{"error":"Resource modified since it was read","requestID":"[^"]+"}`},
+			{Name: "Weak version", Request: utils.Request{Method: method, Headers: headers, ExtraHeaders: ifMatch(`W/"2"`), Body: `{"name":"test3"}`}, ResponseCode: http.StatusPreconditionFailed, ResponseBodyRegex: `{"error":"Resource modified since it was read","requestID":"[^"]+"}`},
+			{Name: "Not updated", Request: utils.Request{Method: http.MethodGet, Headers: headers, ExtraHeaders: ifNoneMatch(`"1"`)}, ResponseCode: http.StatusOK, ResponseBodyRegex: `{"name":"test2"` + suffix},
+			{Name: "One of the versions", Request: utils.Request{Method: method, Headers: headers, ExtraHeaders: ifMatch(`"1", "2"`), Body: `{"name":"test3"}`}, ResponseCode: http.StatusNoContent, ResponseBodyRegex: ``},
+			{Name: "Any version", Request: utils.Request{Method: method, Headers: headers, ExtraHeaders: ifMatch(`*`), Body: `{"name":"test4"}`}, ResponseCode: http.StatusNoContent, ResponseBodyRegex: ``},
+			{Name: "Not modified since update", Request: utils.Request{Method: http.MethodGet, Headers: headers, ExtraHeaders: ifNoneMatch(`"3", W/"4"`)}, ResponseCode: http.StatusNotModified, ResponseBodyRegex: `^$`},
+			{Name: "Not found", Request: utils.Request{Method: method, Headers: headers, ExtraHeaders: ifMatch(`"1"`), Target: roomURL + "/987654321", Absolute: true, Body: `{"name":"test2"}`}, ResponseCode: http.StatusNotFound, ResponseBodyRegex: `{"error":"Room not found","requestID":"[^"]+"}`},
 		},
 	}
 	test.Run(t)
@@ -137,7 +174,7 @@ func TestUpdateRoom(t *testing.T) {
 
 // TestConnectRoom tests the ConnectUserToRoom function.
 func TestConnectRoom(t *testing.T) {
-	err := database.MigrateDB(database.GetDB(), true)
+	err := utils.ResetTestStorage()
 	if err != nil {
 		t.Error(err)
 	}
@@ -158,10 +195,10 @@ func TestConnectRoom(t *testing.T) {
 		CreateResponse:       CreateResponseRoom{},
 		SubTests: []utils.SubTest{
 			{Name: "Success", Request: utils.Request{Method: http.MethodGet, Headers: headers}, ResponseCode: http.StatusOK, ResponseBodyRegex: regex},
-			{Name: "Connect 2nd time", Request: utils.Request{Target: target, Method: method, Headers: headers}, ResponseCode: http.StatusConflict, ResponseBodyRegex: `{"error":"User already in room"}`},
+			{Name: "Connect 2nd time", Request: utils.Request{Target: target, Method: method, Headers: headers}, ResponseCode: http.StatusConflict, ResponseBodyRegex: `{"error":"User already in room","requestID":"[^"]+"}`},
 			{Name: "Not added 2nd time", Request: utils.Request{Method: http.MethodGet, Headers: headers}, ResponseCode: http.StatusOK, ResponseBodyRegex: regex},
-			{Name: "Invalid ID", Request: utils.Request{Method: method, Headers: headers, Target: "abc" + target}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":"Invalid ID"}`},
-			{Name: "Not found", Request: utils.Request{Method: method, Headers: headers, Target: "987654321" + target}, ResponseCode: http.StatusNotFound, ResponseBodyRegex: `{"error":"Room not found"}`},
+			{Name: "Invalid ID", Request: utils.Request{Method: method, Headers: headers, Target: "abc" + target}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":"Invalid ID","requestID":"[^"]+"}`},
+			{Name: "Not found", Request: utils.Request{Method: method, Headers: headers, Target: roomURL + "/987654321" + target, Absolute: true}, ResponseCode: http.StatusNotFound, ResponseBodyRegex: `{"error":"Room not found","requestID":"[^"]+"}`},
 		},
 	}
 	test.Run(t)
@@ -169,7 +206,7 @@ func TestConnectRoom(t *testing.T) {
 
 // TestDisconnectRoom tests the DisconnectUserFromRoom function.
 func TestDisconnectRoom(t *testing.T) {
-	err := database.MigrateDB(database.GetDB(), true)
+	err := utils.ResetTestStorage()
 	if err != nil {
 		t.Error(err)
 	}
@@ -187,10 +224,10 @@ func TestDisconnectRoom(t *testing.T) {
 		CreateRequestHeaders: headers,
 		CreateResponse:       CreateResponseRoom{},
 		SubTests: []utils.SubTest{
-			{Name: "Invalid ID", Request: utils.Request{Method: method, Headers: headers, Target: "abc" + target}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":"Invalid ID"}`},
-			{Name: "Not found", Request: utils.Request{Method: method, Headers: headers, Target: "987654321" + target}, ResponseCode: http.StatusNotFound, ResponseBodyRegex: `{"error":"Room not found"}`},
+			{Name: "Invalid ID", Request: utils.Request{Method: method, Headers: headers, Target: "abc" + target}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":"Invalid ID","requestID":"[^"]+"}`},
+			{Name: "Not found", Request: utils.Request{Method: method, Headers: headers, Target: roomURL + "/987654321" + target, Absolute: true}, ResponseCode: http.StatusNotFound, ResponseBodyRegex: `{"error":"Room not found","requestID":"[^"]+"}`},
 			{Name: "Success", Request: utils.Request{Target: target, Method: method, Headers: headers}, ResponseCode: http.StatusNoContent, ResponseBodyRegex: ``},
-			{Name: "Room should be deleted", Request: utils.Request{Method: http.MethodGet, Headers: headers}, ResponseCode: http.StatusNotFound, ResponseBodyRegex: `{"error":"Room not found"}`},
+			{Name: "Room should be deleted", Request: utils.Request{Method: http.MethodGet, Headers: headers}, ResponseCode: http.StatusNotFound, ResponseBodyRegex: `{"error":"Room not found","requestID":"[^"]+"}`},
 		},
 	}
 	test.Run(t)
@@ -203,7 +240,7 @@ func TestDisconnectRoom(t *testing.T) {
 // — A disconnects, the ownership is transferred to B.
 // — B disconnects, the room is deleted.
 func TestRoomScenarioA(t *testing.T) {
-	err := database.MigrateDB(database.GetDB(), true)
+	err := utils.ResetTestStorage()
 	if err != nil {
 		t.Error(err)
 	}
@@ -243,11 +280,11 @@ func TestRoomScenarioA(t *testing.T) {
 			{Name: "Assert C has joined", Request: utils.Request{Method: http.MethodGet, Headers: headersC}, ResponseCode: http.StatusOK, ResponseBodyRegex: roomWhenABC},
 			{Name: "C disconnects", Request: utils.Request{Target: targetDisconnect, Method: http.MethodPatch, Headers: headersC}, ResponseCode: http.StatusNoContent, ResponseBodyRegex: ``},
 			{Name: "Assert C has disconnected", Request: utils.Request{Method: http.MethodGet, Headers: headersA}, ResponseCode: http.StatusOK, ResponseBodyRegex: roomWhenAB},
-			{Name: "C tries to disconnects again", Request: utils.Request{Target: targetDisconnect, Method: http.MethodPatch, Headers: headersC}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":"User not in room"}`},
+			{Name: "C tries to disconnects again", Request: utils.Request{Target: targetDisconnect, Method: http.MethodPatch, Headers: headersC}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":"User not in room","requestID":"[^"]+"}`},
 			{Name: "A disconnects", Request: utils.Request{Target: targetDisconnect, Method: http.MethodPatch, Headers: headersA}, ResponseCode: http.StatusNoContent, ResponseBodyRegex: ``},
 			{Name: "Assert A has disconnected", Request: utils.Request{Method: http.MethodGet, Headers: headersA}, ResponseCode: http.StatusOK, ResponseBodyRegex: roomWhenB},
 			{Name: "B disconnects", Request: utils.Request{Target: targetDisconnect, Method: http.MethodPatch, Headers: headersB}, ResponseCode: http.StatusNoContent, ResponseBodyRegex: ``},
-			{Name: "Room should be deleted", Request: utils.Request{Method: http.MethodGet, Headers: headersA}, ResponseCode: http.StatusNotFound, ResponseBodyRegex: `{"error":"Room not found"}`},
+			{Name: "Room should be deleted", Request: utils.Request{Method: http.MethodGet, Headers: headersA}, ResponseCode: http.StatusNotFound, ResponseBodyRegex: `{"error":"Room not found","requestID":"[^"]+"}`},
 		},
 	}
 	test.Run(t)
@@ -260,7 +297,7 @@ func TestRoomScenarioA(t *testing.T) {
 // - A tries to kick B, it is accepted.
 // - A tries to kick himself, it is refused.
 func TestRoomScenarioB(t *testing.T) {
-	err := database.MigrateDB(database.GetDB(), true)
+	err := utils.ResetTestStorage()
 	if err != nil {
 		t.Error(err)
 	}
@@ -287,17 +324,161 @@ func TestRoomScenarioB(t *testing.T) {
 		CreateRequestHeaders: headersA,
 		CreateResponse:       CreateResponseRoom{},
 		SubTests: []utils.SubTest{
-			{Name: "Invalid room ID", Request: utils.Request{Method: method, Headers: headersA, Target: "abc" + targetKick + idA}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":"Invalid room ID"}`},
-			{Name: "Invalid user ID", Request: utils.Request{Method: method, Headers: headersA, Target: targetKick + "abc"}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":"Invalid user ID"}`},
-			{Name: "Room not found", Request: utils.Request{Method: method, Headers: headersA, Target: "987654321" + targetKick + idA}, ResponseCode: http.StatusNotFound, ResponseBodyRegex: `{"error":"Room not found"}`},
-			{Name: "User not found", Request: utils.Request{Method: method, Headers: headersA, Target: targetKick + "987654321"}, ResponseCode: http.StatusNotFound, ResponseBodyRegex: `{"error":"User not found"}`},
-			{Name: "User not in room", Request: utils.Request{Method: method, Headers: headersA, Target: targetKick + idB}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":"User not in room"}`},
+			{Name: "Invalid room ID", Request: utils.Request{Method: method, Headers: headersA, Target: "abc" + targetKick + idA}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":"Invalid ID","requestID":"[^"]+"}`},
+			{Name: "Invalid user ID", Request: utils.Request{Method: method, Headers: headersA, Target: targetKick + "abc"}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":"Invalid ID","requestID":"[^"]+"}`},
+			{Name: "Room not found", Request: utils.Request{Method: method, Headers: headersA, Target: roomURL + "/987654321" + targetKick + idA, Absolute: true}, ResponseCode: http.StatusNotFound, ResponseBodyRegex: `{"error":"Room not found","requestID":"[^"]+"}`},
+			{Name: "User not found", Request: utils.Request{Method: method, Headers: headersA, Target: targetKick + "987654321"}, ResponseCode: http.StatusNotFound, ResponseBodyRegex: `{"error":"User not found","requestID":"[^"]+"}`},
+			{Name: "User not in room", Request: utils.Request{Method: method, Headers: headersA, Target: targetKick + idB}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":"User not in room","requestID":"[^"]+"}`},
 			{Name: "B joins", Request: utils.Request{Target: "/connect", Method: method, Headers: headersB}, ResponseCode: http.StatusNoContent, ResponseBodyRegex: ``},
-			{Name: "B tries to kick A", Request: utils.Request{Target: targetKick + idA, Method: method, Headers: headersB}, ResponseCode: http.StatusUnauthorized, ResponseBodyRegex: `{"error":"User not authorized"}`},
+			{Name: "B tries to kick A", Request: utils.Request{Target: targetKick + idA, Method: method, Headers: headersB}, ResponseCode: http.StatusUnauthorized, ResponseBodyRegex: `{"error":"User not authorized","requestID":"[^"]+"}`},
 			{Name: "Assert A hasn't been kicked", Request: utils.Request{Method: http.MethodGet, Headers: headersB}, ResponseCode: http.StatusOK, ResponseBodyRegex: roomWhenAB},
 			{Name: "A, angry, kicks B", Request: utils.Request{Target: targetKick + idB, Method: method, Headers: headersA}, ResponseCode: http.StatusNoContent, ResponseBodyRegex: ``},
 			{Name: "Assert B has been kicked", Request: utils.Request{Method: http.MethodGet, Headers: headersA}, ResponseCode: http.StatusOK, ResponseBodyRegex: roomWhenA},
-			{Name: "A, regretting his action, tries to kick himself", Request: utils.Request{Target: targetKick + idA, Method: method, Headers: headersA}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":"Cannot kick owner from room"}`},
+			{Name: "A, regretting his action, tries to kick himself", Request: utils.Request{Target: targetKick + idA, Method: method, Headers: headersA}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":"Cannot kick owner from room","requestID":"[^"]+"}`},
+		},
+	}
+	test.Run(t)
+}
+
+// TestRoomScenarioC is the following scenario, checking the cached room is never stale:
+// — A creates the room, B joins.
+// — B renames, the room shows the new name.
+// — A kicks B, the room only shows A.
+func TestRoomScenarioC(t *testing.T) {
+	err := utils.ResetTestStorage()
+	if err != nil {
+		t.Error(err)
+	}
+
+	// Create the users and the room that will be used to pursue the tests.
+	idA, headersA, err := utils.CreateTestUser(models.User{Name: "userA"})
+	if err != nil {
+		t.Error(err)
+	}
+	idB, headersB, err := utils.CreateTestUser(models.User{Name: "userB"})
+	if err != nil {
+		t.Error(err)
+	}
+	roomID, err := utils.CreateTestRoom(models.Room{Name: "test"}, headersA)
+	if err != nil {
+		t.Error(err)
+	}
+
+	name := `{"name":"test"`
+	roomWhenA := fmt.Sprintf(`%s,"ownerID":%s,"users":\[{"ID":%s,"name":"userA"}\]}`, name, idA, idA)
+	roomWhenAB := fmt.Sprintf(`%s,"ownerID":%s,"users":\[{"ID":%s,"name":"userA"},{"ID":%s,"name":"userB"}\]}`, name, idA, idA, idB)
+	roomWhenABRenamed := fmt.Sprintf(`%s,"ownerID":%s,"users":\[{"ID":%s,"name":"userA"},{"ID":%s,"name":"renamed"}\]}`, name, idA, idA, idB)
+
+	target := roomURL + "/" + roomID
+	test := utils.TestCreate{
+		Target: target,
+		SubTests: []utils.SubTest{
+			{Name: "Assert A is in room", Request: utils.Request{Method: http.MethodGet, Headers: headersA}, ResponseCode: http.StatusOK, ResponseBodyRegex: roomWhenA},
+			{Name: "B joins", Request: utils.Request{Target: target + "/connect", Method: http.MethodPatch, Headers: headersB}, ResponseCode: http.StatusNoContent, ResponseBodyRegex: ``},
+			{Name: "Assert B has joined", Request: utils.Request{Method: http.MethodGet, Headers: headersA}, ResponseCode: http.StatusOK, ResponseBodyRegex: roomWhenAB},
+			{Name: "B renames", Request: utils.Request{Target: userURL + "/" + idB, Method: http.MethodPatch, Headers: headersB, Body: `{"name":"renamed"}`}, ResponseCode: http.StatusNoContent, ResponseBodyRegex: ``},
+			{Name: "Assert B has renamed", Request: utils.Request{Method: http.MethodGet, Headers: headersA}, ResponseCode: http.StatusOK, ResponseBodyRegex: roomWhenABRenamed},
+			{Name: "A kicks B", Request: utils.Request{Target: target + "/kick/" + idB, Method: http.MethodPatch, Headers: headersA}, ResponseCode: http.StatusNoContent, ResponseBodyRegex: ``},
+			{Name: "Assert B has been kicked", Request: utils.Request{Method: http.MethodGet, Headers: headersA}, ResponseCode: http.StatusOK, ResponseBodyRegex: roomWhenA},
+		},
+	}
+	test.Run(t)
+}
+
+// TestRoomScenarioD tests the CloseRoom and RestoreRoom functions with the following scenario:
+// — A creates the room, B joins.
+// — B tries to close the room, it is refused.
+// — A closes the room, it is not found anymore.
+// — B tries to restore the room, it is refused.
+// — A restores the room, A is its only member.
+// — A tries to restore the room again, it is not found.
+func TestRoomScenarioD(t *testing.T) {
+	err := utils.ResetTestStorage()
+	if err != nil {
+		t.Error(err)
+	}
+
+	// Create the users and the room that will be used to pursue the tests.
+	idA, headersA, err := utils.CreateTestUser(models.User{Name: "userA"})
+	if err != nil {
+		t.Error(err)
+	}
+	idB, headersB, err := utils.CreateTestUser(models.User{Name: "userB"})
+	if err != nil {
+		t.Error(err)
+	}
+	roomID, err := utils.CreateTestRoom(models.Room{Name: "test"}, headersA)
+	if err != nil {
+		t.Error(err)
+	}
+
+	name := `{"name":"test"`
+	roomWhenA := fmt.Sprintf(`%s,"ownerID":%s,"users":\[{"ID":%s,"name":"userA"}\]}`, name, idA, idA)
+	roomWhenAB := fmt.Sprintf(`%s,"ownerID":%s,"users":\[{"ID":%s,"name":"userA"},{"ID":%s,"name":"userB"}\]}`, name, idA, idA, idB)
+
+	target := roomURL + "/" + roomID
+	targetRestore := target + "/restore"
+	test := utils.TestCreate{
+		Target: target,
+		SubTests: []utils.SubTest{
+			{Name: "B joins", Request: utils.Request{Target: target + "/connect", Method: http.MethodPatch, Headers: headersB}, ResponseCode: http.StatusNoContent, ResponseBodyRegex: ``},
+			{Name: "Assert B has joined", Request: utils.Request{Method: http.MethodGet, Headers: headersA}, ResponseCode: http.StatusOK, ResponseBodyRegex: roomWhenAB},
+			{Name: "B tries to close the room", Request: utils.Request{Method: http.MethodDelete, Headers: headersB}, ResponseCode: http.StatusUnauthorized, ResponseBodyRegex: `{"error":"User not authorized","requestID":"[^"]+"}`},
+			{Name: "Assert room is still open", Request: utils.Request{Method: http.MethodGet, Headers: headersA}, ResponseCode: http.StatusOK, ResponseBodyRegex: roomWhenAB},
+			{Name: "A closes the room", Request: utils.Request{Method: http.MethodDelete, Headers: headersA}, ResponseCode: http.StatusNoContent, ResponseBodyRegex: ``},
+			{Name: "Room should be deleted", Request: utils.Request{Method: http.MethodGet, Headers: headersA}, ResponseCode: http.StatusNotFound, ResponseBodyRegex: `{"error":"Room not found","requestID":"[^"]+"}`},
+			{Name: "A tries to close the room again", Request: utils.Request{Method: http.MethodDelete, Headers: headersA}, ResponseCode: http.StatusNotFound, ResponseBodyRegex: `{"error":"Room not found","requestID":"[^"]+"}`},
+			{Name: "B tries to restore the room", Request: utils.Request{Target: targetRestore, Method: http.MethodPost, Headers: headersB}, ResponseCode: http.StatusUnauthorized, ResponseBodyRegex: `{"error":"User not authorized","requestID":"[^"]+"}`},
+			{Name: "A restores the room", Request: utils.Request{Target: targetRestore, Method: http.MethodPost, Headers: headersA}, ResponseCode: http.StatusNoContent, ResponseBodyRegex: ``},
+			{Name: "Assert only A is in room", Request: utils.Request{Method: http.MethodGet, Headers: headersA}, ResponseCode: http.StatusOK, ResponseBodyRegex: roomWhenA},
+			{Name: "A tries to restore the room again", Request: utils.Request{Target: targetRestore, Method: http.MethodPost, Headers: headersA}, ResponseCode: http.StatusNotFound, ResponseBodyRegex: `{"error":"Room not found","requestID":"[^"]+"}`},
+			{Name: "Invalid ID", Request: utils.Request{Target: roomURL + "/abc/restore", Method: http.MethodPost, Headers: headersA}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":"Invalid ID","requestID":"[^"]+"}`},
+		},
+	}
+	test.Run(t)
+}
+
+// TestRoomScenarioE is the following scenario, checking members are kept in the order they joined:
+// — A creates the room, C joins, then B.
+// — The room shows A, C and B in that order.
+// — A disconnects, the ownership is transferred to C.
+func TestRoomScenarioE(t *testing.T) {
+	err := utils.ResetTestStorage()
+	if err != nil {
+		t.Error(err)
+	}
+
+	// Create the users and the room that will be used to pursue the tests.
+	idA, headersA, err := utils.CreateTestUser(models.User{Name: "userA"})
+	if err != nil {
+		t.Error(err)
+	}
+	idB, headersB, err := utils.CreateTestUser(models.User{Name: "userB"})
+	if err != nil {
+		t.Error(err)
+	}
+	idC, headersC, err := utils.CreateTestUser(models.User{Name: "userC"})
+	if err != nil {
+		t.Error(err)
+	}
+	roomID, err := utils.CreateTestRoom(models.Room{Name: "test"}, headersA)
+	if err != nil {
+		t.Error(err)
+	}
+
+	name := `{"name":"test"`
+	roomWhenACB := fmt.Sprintf(`%s,"ownerID":%s,"users":\[{"ID":%s,"name":"userA"},{"ID":%s,"name":"userC"},{"ID":%s,"name":"userB"}\]}`, name, idA, idA, idC, idB)
+	roomWhenCB := fmt.Sprintf(`%s,"ownerID":%s,"users":\[{"ID":%s,"name":"userC"},{"ID":%s,"name":"userB"}\]}`, name, idC, idC, idB)
+
+	target := roomURL + "/" + roomID
+	test := utils.TestCreate{
+		Target: target,
+		SubTests: []utils.SubTest{
+			{Name: "C joins", Request: utils.Request{Target: target + "/connect", Method: http.MethodPatch, Headers: headersC}, ResponseCode: http.StatusNoContent, ResponseBodyRegex: ``},
+			{Name: "B joins", Request: utils.Request{Target: target + "/connect", Method: http.MethodPatch, Headers: headersB}, ResponseCode: http.StatusNoContent, ResponseBodyRegex: ``},
+			{Name: "Assert members are in join order", Request: utils.Request{Method: http.MethodGet, Headers: headersA}, ResponseCode: http.StatusOK, ResponseBodyRegex: roomWhenACB},
+			{Name: "A disconnects", Request: utils.Request{Target: target + "/disconnect", Method: http.MethodPatch, Headers: headersA}, ResponseCode: http.StatusNoContent, ResponseBodyRegex: ``},
+			{Name: "Assert C is the new owner", Request: utils.Request{Method: http.MethodGet, Headers: headersB}, ResponseCode: http.StatusOK, ResponseBodyRegex: roomWhenCB},
 		},
 	}
 	test.Run(t)
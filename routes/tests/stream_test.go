@@ -0,0 +1,139 @@
+package routes_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Brawdunoir/dionysos-server/models"
+	utils "github.com/Brawdunoir/dionysos-server/utils/tests"
+)
+
+// TestStreamTicket tests the CreateStreamTicket function and the authentication on streams with a ticket.
+// Accepted tickets are checked on a deleted room, the stream of an existing room never ending.
+func TestStreamTicket(t *testing.T) {
+	err := utils.ResetTestStorage()
+	if err != nil {
+		t.Error(err)
+	}
+
+	id, headers, err := utils.CreateTestUser(models.User{Name: "test"})
+	if err != nil {
+		t.Error(err)
+	}
+	tokens, err := utils.CreateTestTokens(headers)
+	if err != nil {
+		t.Error(err)
+	}
+	deletedRoomID, err := utils.CreateTestRoom(models.Room{Name: "deleted"}, headers)
+	if err != nil {
+		t.Error(err)
+	}
+	roomID, err := utils.CreateTestRoom(models.Room{Name: "test"}, headers)
+	if err != nil {
+		t.Error(err)
+	}
+	ticket, err := utils.CreateTestStreamTicket(deletedRoomID, headers)
+	if err != nil {
+		t.Error(err)
+	}
+
+	deletedRoomURL := roomURL + "/" + deletedRoomID
+	testRoomURL := roomURL + "/" + roomID
+	noHeaders := []utils.Header{}
+
+	test := utils.TestCreate{
+		Target:  testRoomURL + "/stream/ticket",
+		Headers: headers,
+		SubTests: []utils.SubTest{
+			{Name: "Success", Request: utils.Request{Method: http.MethodPost}, ResponseCode: http.StatusOK, ResponseBodyRegex: `^{"ticket":"[\w-]+\.[\w-]+\.[\w-]+","expiresIn":60,"uri":"/rooms/` + roomID + `/stream\?ticket=[\w.-]+"}$`},
+			{Name: "With access token", Request: utils.Request{Method: http.MethodPost, Headers: utils.GetBearerAuthHeader(tokens.AccessToken)}, ResponseCode: http.StatusOK, ResponseBodyRegex: `"ticket":"[\w-]+\.[\w-]+\.[\w-]+"`},
+			{Name: "Not authenticated", Request: utils.Request{Method: http.MethodPost, Headers: noHeaders}, ResponseCode: http.StatusUnauthorized, ResponseBodyRegex: `{"error":"User not authorized","requestID":"[^"]+"}`},
+			{Name: "Room not found", Request: utils.Request{Method: http.MethodPost, Target: roomURL + "/987654321/stream/ticket"}, ResponseCode: http.StatusNotFound, ResponseBodyRegex: `{"error":"Room not found","requestID":"[^"]+"}`},
+			{Name: "Leave room", Request: utils.Request{Method: http.MethodPatch, Target: deletedRoomURL + "/disconnect"}, ResponseCode: http.StatusNoContent, ResponseBodyRegex: ``},
+			{Name: "Ticket accepted on stream", Request: utils.Request{Method: http.MethodGet, Target: deletedRoomURL + "/stream?ticket=" + ticket.Ticket, Headers: noHeaders}, ResponseCode: http.StatusNotFound, ResponseBodyRegex: `{"error":"Room not found","requestID":"[^"]+"}`},
+			{Name: "Ticket of another room", Request: utils.Request{Method: http.MethodGet, Target: testRoomURL + "/stream?ticket=" + ticket.Ticket, Headers: noHeaders}, ResponseCode: http.StatusUnauthorized, ResponseBodyRegex: `{"error":"User not authorized","requestID":"[^"]+"}`},
+			{Name: "Invalid ticket", Request: utils.Request{Method: http.MethodGet, Target: testRoomURL + "/stream?ticket=abc", Headers: noHeaders}, ResponseCode: http.StatusUnauthorized, ResponseBodyRegex: `{"error":"User not authorized","requestID":"[^"]+"}`},
+			{Name: "Access token as ticket", Request: utils.Request{Method: http.MethodGet, Target: deletedRoomURL + "/stream?ticket=" + tokens.AccessToken, Headers: noHeaders}, ResponseCode: http.StatusUnauthorized, ResponseBodyRegex: `{"error":"User not authorized","requestID":"[^"]+"}`},
+			{Name: "Ticket as access token", Request: utils.Request{Method: http.MethodPatch, Target: testRoomURL, Headers: utils.GetBearerAuthHeader(ticket.Ticket), Body: `{"name":"test2"}`}, ResponseCode: http.StatusUnauthorized, ResponseBodyRegex: `{"error":"User not authorized","requestID":"[^"]+"}`},
+			{Name: "Ticket outside of stream", Request: utils.Request{Method: http.MethodPatch, Target: deletedRoomURL + "?ticket=" + ticket.Ticket, Headers: noHeaders, Body: `{"name":"test2"}`}, ResponseCode: http.StatusUnauthorized, ResponseBodyRegex: `{"error":"User not authorized","requestID":"[^"]+"}`},
+			{Name: "Delete user", Request: utils.Request{Method: http.MethodDelete, Target: userURL + "/" + id}, ResponseCode: http.StatusNoContent, ResponseBodyRegex: ``},
+			{Name: "Ticket of a deleted user", Request: utils.Request{Method: http.MethodGet, Target: deletedRoomURL + "/stream?ticket=" + ticket.Ticket, Headers: noHeaders}, ResponseCode: http.StatusUnauthorized, ResponseBodyRegex: `{"error":"User not authorized","requestID":"[^"]+"}`},
+		},
+	}
+	test.Run(t)
+}
+
+// TestRoomClosed tests the streams of a room are closed with a "roomClosed" event when the room is closed,
+// or when its last user leaves, and are created again when the room is restored.
+func TestRoomClosed(t *testing.T) {
+	err := utils.ResetTestStorage()
+	if err != nil {
+		t.Error(err)
+	}
+
+	_, headersA, err := utils.CreateTestUser(models.User{Name: "userA"})
+	if err != nil {
+		t.Error(err)
+	}
+	_, headersB, err := utils.CreateTestUser(models.User{Name: "userB"})
+	if err != nil {
+		t.Error(err)
+	}
+	roomID, err := utils.CreateTestRoom(models.Room{Name: "test"}, headersA)
+	if err != nil {
+		t.Error(err)
+	}
+	target := roomURL + "/" + roomID
+
+	code, err := utils.SendTestRequest(http.MethodPatch, target+"/connect", headersB)
+	if err != nil || code != http.StatusNoContent {
+		t.Fatalf("B failed to join the room: %d %v", code, err)
+	}
+
+	// assertClosed checks the given streams end with a "roomClosed" event.
+	assertClosed := func(streams ...func() (string, error)) {
+		t.Helper()
+		for _, wait := range streams {
+			events, err := wait()
+			if err != nil {
+				t.Error(err)
+			} else if !strings.Contains(events, "event:roomClosed") {
+				t.Errorf("stream closed without a roomClosed event: %q", events)
+			}
+		}
+	}
+
+	streamA, err := utils.SubscribeTestStream(roomID, headersA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	streamB, err := utils.SubscribeTestStream(roomID, headersB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err = utils.SendTestRequest(http.MethodDelete, target, headersA)
+	if err != nil || code != http.StatusNoContent {
+		t.Fatalf("A failed to close the room: %d %v", code, err)
+	}
+	assertClosed(streamA, streamB)
+
+	code, err = utils.SendTestRequest(http.MethodGet, target+"/stream", headersA)
+	if err != nil || code != http.StatusNotFound {
+		t.Errorf("stream of a closed room: %d %v", code, err)
+	}
+
+	code, err = utils.SendTestRequest(http.MethodPost, target+"/restore", headersA)
+	if err != nil || code != http.StatusNoContent {
+		t.Fatalf("A failed to restore the room: %d %v", code, err)
+	}
+	streamA, err = utils.SubscribeTestStream(roomID, headersA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err = utils.SendTestRequest(http.MethodPatch, target+"/disconnect", headersA)
+	if err != nil || code != http.StatusNoContent {
+		t.Fatalf("A failed to leave the room: %d %v", code, err)
+	}
+	assertClosed(streamA)
+}
@@ -0,0 +1,112 @@
+package routes_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/Brawdunoir/dionysos-server/models"
+	utils "github.com/Brawdunoir/dionysos-server/utils/tests"
+)
+
+var tokenURL = "/token"
+
+// TestCreateToken tests the CreateToken function and the authentication with access tokens.
+func TestCreateToken(t *testing.T) {
+	err := utils.ResetTestStorage()
+	if err != nil {
+		t.Error(err)
+	}
+
+	id, headers, err := utils.CreateTestUser(models.User{Name: "test"})
+	if err != nil {
+		t.Error(err)
+	}
+	tokens, err := utils.CreateTestTokens(headers)
+	if err != nil {
+		t.Error(err)
+	}
+	bearer := utils.GetBearerAuthHeader(tokens.AccessToken)
+
+	test := utils.TestCreate{
+		Target:  tokenURL,
+		Headers: headers,
+		SubTests: []utils.SubTest{
+			{Name: "Success", Request: utils.Request{Method: http.MethodPost}, ResponseCode: http.StatusOK, ResponseBodyRegex: `^{"accessToken":"[\w-]+\.[\w-]+\.[\w-]+","tokenType":"Bearer","expiresIn":900,"refreshToken":"[0-9a-f]{64}"}$`},
+			{Name: "Wrong password", Request: utils.Request{Method: http.MethodPost, Headers: utils.GetBasicAuthHeader(id, "password")}, ResponseCode: http.StatusUnauthorized, ResponseBodyRegex: `{"error":"User not authorized","requestID":"[^"]+"}`},
+			{Name: "Access token not accepted", Request: utils.Request{Method: http.MethodPost, Headers: bearer}, ResponseCode: http.StatusUnauthorized, ResponseBodyRegex: `{"error":"User not authorized","requestID":"[^"]+"}`},
+			{Name: "Authenticated with access token", Request: utils.Request{Method: http.MethodPatch, Target: userURL + "/" + id, Headers: bearer, Body: `{"name":"test2"}`}, ResponseCode: http.StatusNoContent, ResponseBodyRegex: ``},
+			{Name: "Lowercase scheme", Request: utils.Request{Method: http.MethodPatch, Target: userURL + "/" + id, Headers: []utils.Header{{Key: "Authorization", Value: "bearer " + tokens.AccessToken}}, Body: `{"name":"test3"}`}, ResponseCode: http.StatusNoContent, ResponseBodyRegex: ``},
+			{Name: "Invalid access token", Request: utils.Request{Method: http.MethodPost, Target: roomURL, Headers: utils.GetBearerAuthHeader("abc.def.ghi"), Body: `{"name":"test"}`}, ResponseCode: http.StatusUnauthorized, ResponseBodyRegex: `{"error":"User not authorized","requestID":"[^"]+"}`},
+			{Name: "Unsigned access token", Request: utils.Request{Method: http.MethodPost, Target: roomURL, Headers: utils.GetBearerAuthHeader("eyJhbGciOiJub25lIiwidHlwIjoiSldUIn0.eyJpc3MiOiJkaW9ueXNvcyIsInN1YiI6IjEiLCJleHAiOjQxMDI0NDQ4MDB9."), Body: `{"name":"test"}`}, ResponseCode: http.StatusUnauthorized, ResponseBodyRegex: `{"error":"User not authorized","requestID":"[^"]+"}`},
+			{Name: "Delete user", Request: utils.Request{Method: http.MethodDelete, Target: userURL + "/" + id, Headers: bearer}, ResponseCode: http.StatusNoContent, ResponseBodyRegex: ``},
+			{Name: "Access token revoked", Request: utils.Request{Method: http.MethodPost, Target: roomURL, Headers: bearer, Body: `{"name":"test"}`}, ResponseCode: http.StatusUnauthorized, ResponseBodyRegex: `{"error":"User not authorized","requestID":"[^"]+"}`},
+			{Name: "Refresh token revoked", Request: utils.Request{Method: http.MethodPost, Target: tokenURL + "/refresh", Headers: []utils.Header{}, Body: `{"refreshToken":"` + tokens.RefreshToken + `"}`}, ResponseCode: http.StatusUnauthorized, ResponseBodyRegex: `{"error":"Invalid refresh token","requestID":"[^"]+"}`},
+		},
+	}
+	test.Run(t)
+}
+
+// TestRefreshToken tests the RefreshToken function.
+func TestRefreshToken(t *testing.T) {
+	err := utils.ResetTestStorage()
+	if err != nil {
+		t.Error(err)
+	}
+
+	_, headers, err := utils.CreateTestUser(models.User{Name: "test"})
+	if err != nil {
+		t.Error(err)
+	}
+	tokens, err := utils.CreateTestTokens(headers)
+	if err != nil {
+		t.Error(err)
+	}
+
+	method := http.MethodPost
+	test := utils.TestCreate{
+		Target: tokenURL + "/refresh",
+		SubTests: []utils.SubTest{
+			{Name: "Empty body", Request: utils.Request{Method: method, Body: ``}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":".+","requestID":"[^"]+"}`},
+			{Name: "Empty json", Request: utils.Request{Method: method, Body: `{}`}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":".+","requestID":"[^"]+"}`},
+			{Name: "Unknown token", Request: utils.Request{Method: method, Body: `{"refreshToken":"abc"}`}, ResponseCode: http.StatusUnauthorized, ResponseBodyRegex: `{"error":"Invalid refresh token","requestID":"[^"]+"}`},
+			{Name: "Access token instead of refresh token", Request: utils.Request{Method: method, Body: `{"refreshToken":"` + tokens.AccessToken + `"}`}, ResponseCode: http.StatusUnauthorized, ResponseBodyRegex: `{"error":"Invalid refresh token","requestID":"[^"]+"}`},
+			{Name: "Success", Request: utils.Request{Method: method, Body: `{"refreshToken":"` + tokens.RefreshToken + `"}`}, ResponseCode: http.StatusOK, ResponseBodyRegex: `^{"accessToken":"[\w-]+\.[\w-]+\.[\w-]+","tokenType":"Bearer","expiresIn":900,"refreshToken":"[0-9a-f]{64}"}$`},
+			{Name: "Token already used", Request: utils.Request{Method: method, Body: `{"refreshToken":"` + tokens.RefreshToken + `"}`}, ResponseCode: http.StatusUnauthorized, ResponseBodyRegex: `{"error":"Invalid refresh token","requestID":"[^"]+"}`},
+		},
+	}
+	test.Run(t)
+}
+
+// TestLogin tests the Login function.
+func TestLogin(t *testing.T) {
+	err := utils.ResetTestStorage()
+	if err != nil {
+		t.Error(err)
+	}
+
+	id, headers, err := utils.CreateTestUser(models.User{Name: "test"})
+	if err != nil {
+		t.Error(err)
+	}
+	_, anonymousHeaders, err := utils.CreateTestUser(models.User{Name: "anonymous"})
+	if err != nil {
+		t.Error(err)
+	}
+
+	method := http.MethodPost
+	test := utils.TestCreate{
+		Target:  tokenURL + "/login",
+		Headers: []utils.Header{},
+		SubTests: []utils.SubTest{
+			{Name: "Register", Request: utils.Request{Method: http.MethodPut, Target: userURL + "/" + id + "/account", Headers: headers, Body: `{"handle":"test","password":"password123"}`}, ResponseCode: http.StatusNoContent, ResponseBodyRegex: ``},
+			{Name: "Success", Request: utils.Request{Method: method, Body: `{"handle":"test","password":"password123"}`}, ResponseCode: http.StatusOK, ResponseBodyRegex: `^{"accessToken":"[\w-]+\.[\w-]+\.[\w-]+","tokenType":"Bearer","expiresIn":900,"refreshToken":"[0-9a-f]{64}","uri":"/users/` + id + `"}$`},
+			{Name: "Case-insensitive handle", Request: utils.Request{Method: method, Body: `{"handle":"TeSt","password":"password123"}`}, ResponseCode: http.StatusOK, ResponseBodyRegex: `"uri":"/users/` + id + `"`},
+			{Name: "Wrong password", Request: utils.Request{Method: method, Body: `{"handle":"test","password":"password456"}`}, ResponseCode: http.StatusUnauthorized, ResponseBodyRegex: `{"error":"Invalid handle or password","requestID":"[^"]+"}`},
+			{Name: "Unknown handle", Request: utils.Request{Method: method, Body: `{"handle":"unknown","password":"password123"}`}, ResponseCode: http.StatusUnauthorized, ResponseBodyRegex: `{"error":"Invalid handle or password","requestID":"[^"]+"}`},
+			{Name: "Empty body", Request: utils.Request{Method: method, Body: ``}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":"Failed to bind JSON","requestID":"[^"]+"}`},
+			{Name: "Chosen password with ID", Request: utils.Request{Method: http.MethodPatch, Target: userURL + "/" + id, Headers: utils.GetBasicAuthHeader(id, "password123"), Body: `{"name":"test2"}`}, ResponseCode: http.StatusNoContent, ResponseBodyRegex: ``},
+			{Name: "Anonymous user still works", Request: utils.Request{Method: method, Target: tokenURL, Headers: anonymousHeaders}, ResponseCode: http.StatusOK, ResponseBodyRegex: `^{"accessToken":"[\w-]+\.[\w-]+\.[\w-]+","tokenType":"Bearer","expiresIn":900,"refreshToken":"[0-9a-f]{64}"}$`},
+		},
+	}
+	test.Run(t)
+}
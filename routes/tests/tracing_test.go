@@ -0,0 +1,81 @@
+package routes_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/Brawdunoir/dionysos-server/models"
+	"github.com/Brawdunoir/dionysos-server/tracing"
+	utils "github.com/Brawdunoir/dionysos-server/utils/tests"
+	"github.com/go-playground/assert/v2"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// TestTracing tests a user joining a room produces spans for the middlewares, the queries and the broadcast,
+// all correlated with the request that caused them. There are no queries if rooms and users are kept in memory.
+func TestTracing(t *testing.T) {
+	err := utils.ResetTestStorage()
+	if err != nil {
+		t.Error(err)
+	}
+
+	exporter := tracetest.NewInMemoryExporter()
+	tracing.InitWithExporter(exporter)
+
+	_, headersA, err := utils.CreateTestUser(models.User{Name: "userA"})
+	if err != nil {
+		t.Error(err)
+	}
+	_, headersB, err := utils.CreateTestUser(models.User{Name: "userB"})
+	if err != nil {
+		t.Error(err)
+	}
+
+	test := utils.TestRUD{
+		CreateRequest:        roomCreateRequest,
+		CreateRequestHeaders: headersA,
+		CreateResponse:       CreateResponseRoom{},
+		SubTests: []utils.SubTest{
+			{Name: "B joins", Request: utils.Request{Target: "/connect", Method: http.MethodPatch, Headers: headersB}, ResponseCode: http.StatusNoContent, ResponseBodyRegex: ``},
+			{Name: "B gets the room", Request: utils.Request{Method: http.MethodGet, Headers: headersB}, ResponseCode: http.StatusOK, ResponseBodyRegex: `"name":"userB"`},
+			{Name: "B leaves", Request: utils.Request{Target: "/disconnect", Method: http.MethodPatch, Headers: headersB}, ResponseCode: http.StatusNoContent, ResponseBodyRegex: ``},
+		},
+	}
+	test.Run(t)
+
+	spans := exporter.GetSpans()
+	var join tracetest.SpanStub
+	for _, span := range spans {
+		if span.Name == "PATCH /rooms/:id/connect" {
+			join = span
+		}
+	}
+	assert.Equal(t, join.Name, "PATCH /rooms/:id/connect")
+
+	// Children of the join request, indexed by name.
+	children := make(map[string]tracetest.SpanStub)
+	queries := 0
+	for _, span := range spans {
+		if span.SpanContext.TraceID() != join.SpanContext.TraceID() {
+			continue
+		}
+		if span.Parent.SpanID() == join.SpanContext.SpanID() {
+			children[span.Name] = span
+		}
+		if span.Name == "gorm.query" {
+			queries++
+		}
+	}
+	assert.Equal(t, children["Authentication"].Name, "Authentication")
+	assert.Equal(t, children["RetrieveRoom"].Name, "RetrieveRoom")
+	assert.Equal(t, children["Stream.Distribute"].Name, "Stream.Distribute")
+	if utils.UsesDatabase() {
+		assert.NotEqual(t, queries, 0)
+	}
+
+	cached := false
+	for _, span := range spans {
+		cached = cached || span.Name == "Cache"
+	}
+	assert.Equal(t, cached, true)
+}
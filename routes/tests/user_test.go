@@ -2,11 +2,12 @@ package routes_test
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"path"
 	"testing"
 
-	"github.com/Brawdunoir/dionysos-server/database"
+	"github.com/Brawdunoir/dionysos-server/models"
 	utils_routes "github.com/Brawdunoir/dionysos-server/utils/routes"
 	utils "github.com/Brawdunoir/dionysos-server/utils/tests"
 )
@@ -34,7 +35,7 @@ var userCreateRequest = utils.Request{Method: http.MethodPost, Target: userURL,
 
 // TestCreateUser tests the CreateUser function.
 func TestCreateUser(t *testing.T) {
-	err := database.MigrateDB(database.GetDB(), true)
+	err := utils.ResetTestStorage()
 	if err != nil {
 		t.Error(err)
 	}
@@ -44,16 +45,16 @@ func TestCreateUser(t *testing.T) {
 		Target: userURL,
 		SubTests: []utils.SubTest{
 			{Name: "Success", Request: utils.Request{Method: method, Body: `{"name":"test"}`}, ResponseCode: http.StatusCreated, ResponseBodyRegex: `{"uri":"` + userURL + `/\d+","password":"[0-9a-f]{64}"}`},
-			{Name: "Empty body", Request: utils.Request{Method: method, Body: ``}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":".+"}`},
-			{Name: "Empty json", Request: utils.Request{Method: method, Body: `{}`}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":".+"}`},
-			{Name: "Bad name key", Request: utils.Request{Method: method, Body: `{"wrongkey":"test"}`}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":".+"}`},
-			{Name: "Empty name value", Request: utils.Request{Method: method, Body: `{"name":""}`}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":".+"}`},
-			{Name: "Nil name value", Request: utils.Request{Method: method, Body: `{"name":nil}`}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":".+"}`},
-			{Name: "Integer name value", Request: utils.Request{Method: method, Body: `{"name":1}`}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":".+"}`},
-			{Name: "Object name value", Request: utils.Request{Method: method, Body: `{"name":{"somekey":"somevalue"}}`}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":".+"}`},
-			{Name: "Less than min caracters", Request: utils.Request{Method: method, Body: `{"name":"a"}`}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":".+"}`},
+			{Name: "Empty body", Request: utils.Request{Method: method, Body: ``}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":".+","requestID":"[^"]+"}`},
+			{Name: "Empty json", Request: utils.Request{Method: method, Body: `{}`}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":".+","requestID":"[^"]+"}`},
+			{Name: "Bad name key", Request: utils.Request{Method: method, Body: `{"wrongkey":"test"}`}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":".+","requestID":"[^"]+"}`},
+			{Name: "Empty name value", Request: utils.Request{Method: method, Body: `{"name":""}`}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":".+","requestID":"[^"]+"}`},
+			{Name: "Nil name value", Request: utils.Request{Method: method, Body: `{"name":nil}`}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":".+","requestID":"[^"]+"}`},
+			{Name: "Integer name value", Request: utils.Request{Method: method, Body: `{"name":1}`}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":".+","requestID":"[^"]+"}`},
+			{Name: "Object name value", Request: utils.Request{Method: method, Body: `{"name":{"somekey":"somevalue"}}`}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":".+","requestID":"[^"]+"}`},
+			{Name: "Less than min caracters", Request: utils.Request{Method: method, Body: `{"name":"a"}`}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":".+","requestID":"[^"]+"}`},
 			{Name: "Exactly min caracters", Request: utils.Request{Method: method, Body: `{"name":"ab"}`}, ResponseCode: http.StatusCreated, ResponseBodyRegex: `{"uri":"` + userURL + `/\d+","password":"[0-9a-f]{64}"}`},
-			{Name: "More than max caracters", Request: utils.Request{Method: method, Body: `{"name":"xxxxxxxxxxxxxxxxxxxxx"}`}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":".+"}`},
+			{Name: "More than max caracters", Request: utils.Request{Method: method, Body: `{"name":"xxxxxxxxxxxxxxxxxxxxx"}`}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":".+","requestID":"[^"]+"}`},
 			{Name: "Exactly max caracters", Request: utils.Request{Method: method, Body: `{"name":"xxxxxxxxxxxxxxxxxxxx"}`}, ResponseCode: http.StatusCreated, ResponseBodyRegex: `{"uri":"` + userURL + `/\d+","password":"[0-9a-f]{64}"}`},
 		},
 	}
@@ -62,7 +63,7 @@ func TestCreateUser(t *testing.T) {
 
 // TestGetUser tests the GetUser function.
 func TestGetUser(t *testing.T) {
-	err := database.MigrateDB(database.GetDB(), true)
+	err := utils.ResetTestStorage()
 	if err != nil {
 		t.Error(err)
 	}
@@ -73,8 +74,8 @@ func TestGetUser(t *testing.T) {
 		CreateResponse: CreateResponseUser{},
 		SubTests: []utils.SubTest{
 			{Name: "Success", Request: utils.Request{Method: method}, ResponseCode: http.StatusOK, ResponseBodyRegex: `{"ID":\d+,"name":"test"}`},
-			{Name: "Invalid ID", Request: utils.Request{Method: method, Target: "abc"}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":"Invalid user ID"}`},
-			{Name: "Not found", Request: utils.Request{Method: method, Target: "987654321"}, ResponseCode: http.StatusNotFound, ResponseBodyRegex: `{"error":"User not found"}`},
+			{Name: "Invalid ID", Request: utils.Request{Method: method, Target: "abc"}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":"Invalid ID","requestID":"[^"]+"}`},
+			{Name: "Not found", Request: utils.Request{Method: method, Target: "987654321"}, ResponseCode: http.StatusNotFound, ResponseBodyRegex: `{"error":"User not found","requestID":"[^"]+"}`},
 		},
 	}
 	test.Run(t)
@@ -82,7 +83,7 @@ func TestGetUser(t *testing.T) {
 
 // TestUpdateUser tests the UpdateUser function.
 func TestUpdateUser(t *testing.T) {
-	err := database.MigrateDB(database.GetDB(), true)
+	err := utils.ResetTestStorage()
 	if err != nil {
 		t.Error(err)
 	}
@@ -94,21 +95,45 @@ func TestUpdateUser(t *testing.T) {
 		SubTests: []utils.SubTest{
 			{Name: "Success", Request: utils.Request{Method: method, Body: `{"name":"test2"}`}, ResponseCode: http.StatusNoContent, ResponseBodyRegex: ``},
 			{Name: "Correctly updated", Request: utils.Request{Method: http.MethodGet}, ResponseCode: http.StatusOK, ResponseBodyRegex: `{"ID":\d+,"name":"test2"}`},
-			{Name: "Empty Body", Request: utils.Request{Method: method, Body: ``}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":".+"}`},
-			{Name: "Empty json", Request: utils.Request{Method: method, Body: `{}`}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":".+"}`},
-			{Name: "Bad name key", Request: utils.Request{Method: method, Body: `{"wrongkey":"test2"}`}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":".+"}`},
-			{Name: "Empty name value", Request: utils.Request{Method: method, Body: `{"name":""}`}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":".+"}`},
-			{Name: "Nil name value", Request: utils.Request{Method: method, Body: `{"name":nil}`}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":".+"}`},
-			{Name: "Integer name value", Request: utils.Request{Method: method, Body: `{"name":1}`}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":".+"}`},
-			{Name: "Object name value", Request: utils.Request{Method: method, Body: `{"name":{"somekey":"somevalue"}}`}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":".+"}`},
-			{Name: "Less than min caracters", Request: utils.Request{Method: method, Body: `{"name":"a"}`}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":".+"}`},
+			{Name: "Empty Body", Request: utils.Request{Method: method, Body: ``}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":".+","requestID":"[^"]+"}`},
+			{Name: "Empty json", Request: utils.Request{Method: method, Body: `{}`}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":".+","requestID":"[^"]+"}`},
+			{Name: "Bad name key", Request: utils.Request{Method: method, Body: `{"wrongkey":"test2"}`}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":".+","requestID":"[^"]+"}`},
+			{Name: "Empty name value", Request: utils.Request{Method: method, Body: `{"name":""}`}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":".+","requestID":"[^"]+"}`},
+			{Name: "Nil name value", Request: utils.Request{Method: method, Body: `{"name":nil}`}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":".+","requestID":"[^"]+"}`},
+			{Name: "Integer name value", Request: utils.Request{Method: method, Body: `{"name":1}`}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":".+","requestID":"[^"]+"}`},
+			{Name: "Object name value", Request: utils.Request{Method: method, Body: `{"name":{"somekey":"somevalue"}}`}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":".+","requestID":"[^"]+"}`},
+			{Name: "Less than min caracters", Request: utils.Request{Method: method, Body: `{"name":"a"}`}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":".+","requestID":"[^"]+"}`},
 			{Name: "Exactly min caracters", Request: utils.Request{Method: method, Body: `{"name":"ab"}`}, ResponseCode: http.StatusNoContent, ResponseBodyRegex: ``},
 			{Name: "Correctly updated", Request: utils.Request{Method: http.MethodGet}, ResponseCode: http.StatusOK, ResponseBodyRegex: `{"ID":\d+,"name":"ab"}`},
-			{Name: "More than max caracters", Request: utils.Request{Method: method, Body: `{"name":"xxxxxxxxxxxxxxxxxxxxx"}`}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":".+"}`},
+			{Name: "More than max caracters", Request: utils.Request{Method: method, Body: `{"name":"xxxxxxxxxxxxxxxxxxxxx"}`}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":".+","requestID":"[^"]+"}`},
 			{Name: "Exactly max caracters", Request: utils.Request{Method: method, Body: `{"name":"xxxxxxxxxxxxxxxxxxxx"}`}, ResponseCode: http.StatusNoContent, ResponseBodyRegex: ``},
 			{Name: "Correctly updated", Request: utils.Request{Method: http.MethodGet}, ResponseCode: http.StatusOK, ResponseBodyRegex: `{"ID":\d+,"name":"xxxxxxxxxxxxxxxxxxxx"}`},
-			{Name: "Invalid ID", Request: utils.Request{Method: method, Target: "abc"}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":"Invalid user ID"}`},
-			{Name: "Unauthorized to patch another user", Request: utils.Request{Method: method, Target: "987654321", Body: `{"name":"test2"}`}, ResponseCode: http.StatusUnauthorized, ResponseBodyRegex: `{"error":"User not authorized"}`},
+			{Name: "Invalid ID", Request: utils.Request{Method: method, Target: "abc"}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":"Invalid ID","requestID":"[^"]+"}`},
+			{Name: "Unauthorized to patch another user", Request: utils.Request{Method: method, Target: "987654321", Body: `{"name":"test2"}`}, ResponseCode: http.StatusUnauthorized, ResponseBodyRegex: `{"error":"User not authorized","requestID":"[^"]+"}`},
+		},
+	}
+	test.Run(t)
+}
+
+// TestConditionalUser tests the ETag of the GetUser function and the If-Match header of the UpdateUser function.
+func TestConditionalUser(t *testing.T) {
+	err := utils.ResetTestStorage()
+	if err != nil {
+		t.Error(err)
+	}
+	ifMatch := func(value string) []utils.Header { return []utils.Header{{Key: "If-Match", Value: value}} }
+	ifNoneMatch := func(value string) []utils.Header { return []utils.Header{{Key: "If-None-Match", Value: value}} }
+	method := http.MethodPatch
+
+	test := utils.TestRUD{
+		CreateRequest:  userCreateRequest,
+		CreateResponse: CreateResponseUser{},
+		SubTests: []utils.SubTest{
+			{Name: "Not modified", Request: utils.Request{Method: http.MethodGet, ExtraHeaders: ifNoneMatch(`"1"`)}, ResponseCode: http.StatusNotModified, ResponseBodyRegex: `^$`},
+			{Name: "Stale version", Request: utils.Request{Method: method, ExtraHeaders: ifMatch(`"2"`), Body: `{"name":"test2"}`}, ResponseCode: http.StatusPreconditionFailed, ResponseBodyRegex: `{"error":"Resource modified since it was read","requestID":"[^"]+"}`},
+			{Name: "Matching version", Request: utils.Request{Method: method, ExtraHeaders: ifMatch(`"1"`), Body: `{"name":"test2"}`}, ResponseCode: http.StatusNoContent, ResponseBodyRegex: ``},
+			{Name: "Modified", Request: utils.Request{Method: http.MethodGet, ExtraHeaders: ifNoneMatch(`"1"`)}, ResponseCode: http.StatusOK, ResponseBodyRegex: `{"ID":\d+,"name":"test2"}`},
+			{Name: "Not modified since update", Request: utils.Request{Method: http.MethodGet, ExtraHeaders: ifNoneMatch(`"2"`)}, ResponseCode: http.StatusNotModified, ResponseBodyRegex: `^$`},
 		},
 	}
 	test.Run(t)
@@ -116,7 +141,7 @@ func TestUpdateUser(t *testing.T) {
 
 // TestDeleteUser tests the DeleteUser function.
 func TestDeleteUser(t *testing.T) {
-	err := database.MigrateDB(database.GetDB(), true)
+	err := utils.ResetTestStorage()
 	if err != nil {
 		t.Error(err)
 	}
@@ -126,10 +151,290 @@ func TestDeleteUser(t *testing.T) {
 		CreateRequest:  userCreateRequest,
 		CreateResponse: CreateResponseUser{},
 		SubTests: []utils.SubTest{
-			{Name: "Unauthorized to delete another user", Request: utils.Request{Method: method, Target: "987654321"}, ResponseCode: http.StatusUnauthorized, ResponseBodyRegex: `{"error":"User not authorized"}`},
-			{Name: "Invalid ID", Request: utils.Request{Method: method, Target: "abc"}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":"Invalid user ID"}`},
+			{Name: "Unauthorized to delete another user", Request: utils.Request{Method: method, Target: "987654321"}, ResponseCode: http.StatusUnauthorized, ResponseBodyRegex: `{"error":"User not authorized","requestID":"[^"]+"}`},
+			{Name: "Invalid ID", Request: utils.Request{Method: method, Target: "abc"}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":"Invalid ID","requestID":"[^"]+"}`},
 			{Name: "Success", Request: utils.Request{Method: method}, ResponseCode: http.StatusNoContent, ResponseBodyRegex: ``},
-			{Name: "Correctly deleted", Request: utils.Request{Method: http.MethodGet}, ResponseCode: http.StatusNotFound, ResponseBodyRegex: `{"error":"User not found during authentication"}`},
+			{Name: "Correctly deleted", Request: utils.Request{Method: http.MethodGet}, ResponseCode: http.StatusUnauthorized, ResponseBodyRegex: `{"error":"User not authorized","requestID":"[^"]+"}`},
+		},
+	}
+	test.Run(t)
+}
+
+// TestDeleteUserScenario is the following scenario, checking deleted users leave their rooms:
+// — A creates the room, B joins.
+// — A is deleted, the ownership is transferred to B.
+// — B is deleted, the room is deleted.
+func TestDeleteUserScenario(t *testing.T) {
+	err := utils.ResetTestStorage()
+	if err != nil {
+		t.Error(err)
+	}
+
+	// Create the users and the room that will be used to pursue the tests.
+	idA, headersA, err := utils.CreateTestUser(models.User{Name: "userA"})
+	if err != nil {
+		t.Error(err)
+	}
+	idB, headersB, err := utils.CreateTestUser(models.User{Name: "userB"})
+	if err != nil {
+		t.Error(err)
+	}
+	_, headersC, err := utils.CreateTestUser(models.User{Name: "userC"})
+	if err != nil {
+		t.Error(err)
+	}
+	roomID, err := utils.CreateTestRoom(models.Room{Name: "test"}, headersA)
+	if err != nil {
+		t.Error(err)
+	}
+
+	name := `{"name":"test"`
+	roomWhenAB := fmt.Sprintf(`%s,"ownerID":%s,"users":\[{"ID":%s,"name":"userA"},{"ID":%s,"name":"userB"}\]}`, name, idA, idA, idB)
+	roomWhenB := fmt.Sprintf(`%s,"ownerID":%s,"users":\[{"ID":%s,"name":"userB"}\]}`, name, idB, idB)
+
+	target := roomURL + "/" + roomID
+	test := utils.TestCreate{
+		Target: target,
+		SubTests: []utils.SubTest{
+			{Name: "B joins", Request: utils.Request{Target: target + "/connect", Method: http.MethodPatch, Headers: headersB}, ResponseCode: http.StatusNoContent, ResponseBodyRegex: ``},
+			{Name: "Assert B has joined", Request: utils.Request{Method: http.MethodGet, Headers: headersB}, ResponseCode: http.StatusOK, ResponseBodyRegex: roomWhenAB},
+			{Name: "A is deleted", Request: utils.Request{Target: userURL + "/" + idA, Method: http.MethodDelete, Headers: headersA}, ResponseCode: http.StatusNoContent, ResponseBodyRegex: ``},
+			{Name: "Assert B is the owner", Request: utils.Request{Method: http.MethodGet, Headers: headersB}, ResponseCode: http.StatusOK, ResponseBodyRegex: roomWhenB},
+			{Name: "B is deleted", Request: utils.Request{Target: userURL + "/" + idB, Method: http.MethodDelete, Headers: headersB}, ResponseCode: http.StatusNoContent, ResponseBodyRegex: ``},
+			{Name: "Room should be deleted", Request: utils.Request{Method: http.MethodGet, Headers: headersC}, ResponseCode: http.StatusNotFound, ResponseBodyRegex: `{"error":"Room not found","requestID":"[^"]+"}`},
+		},
+	}
+	test.Run(t)
+}
+
+// TestExportUser tests the ExportUser function.
+func TestExportUser(t *testing.T) {
+	err := utils.ResetTestStorage()
+	if err != nil {
+		t.Error(err)
+	}
+
+	// A is registered, owns a room, a deleted room, and is in a room of B.
+	idA, headersA, err := utils.CreateTestUser(models.User{Name: "userA"})
+	if err != nil {
+		t.Error(err)
+	}
+	_, headersB, err := utils.CreateTestUser(models.User{Name: "userB"})
+	if err != nil {
+		t.Error(err)
+	}
+	code, _, err := utils.ExecuteTestRequest(http.MethodPut, userURL+"/"+idA+"/account", `{"handle":"usera","password":"password123"}`, headersA)
+	if err != nil || code != http.StatusNoContent {
+		t.Fatalf("A failed to register: %d %v", code, err)
+	}
+	headersA = utils.GetBasicAuthHeader(idA, "password123")
+	roomA, err := utils.CreateTestRoom(models.Room{Name: "roomA"}, headersA)
+	if err != nil {
+		t.Error(err)
+	}
+	roomB, err := utils.CreateTestRoom(models.Room{Name: "roomB"}, headersB)
+	if err != nil {
+		t.Error(err)
+	}
+	deletedRoom, err := utils.CreateTestRoom(models.Room{Name: "deleted"}, headersA)
+	if err != nil {
+		t.Error(err)
+	}
+	code, err = utils.SendTestRequest(http.MethodPatch, roomURL+"/"+roomB+"/connect", headersA)
+	if err != nil || code != http.StatusNoContent {
+		t.Fatalf("A failed to join the room: %d %v", code, err)
+	}
+	code, err = utils.SendTestRequest(http.MethodDelete, roomURL+"/"+deletedRoom, headersA)
+	if err != nil || code != http.StatusNoContent {
+		t.Fatalf("A failed to close the room: %d %v", code, err)
+	}
+
+	timestamps := `"createdAt":"[^"]+","updatedAt":"[^"]+"`
+	room := func(id, name, ownerID string) string {
+		return fmt.Sprintf(`{"id":%s,"name":"%s","ownerID":%s,%s`, id, name, ownerID, timestamps)
+	}
+
+	method := http.MethodGet
+	test := utils.TestCreate{
+		Target:  userURL + "/" + idA + "/export",
+		Headers: headersA,
+		SubTests: []utils.SubTest{
+			{Name: "Other user", Request: utils.Request{Method: method, Headers: headersB}, ResponseCode: http.StatusUnauthorized, ResponseBodyRegex: `{"error":"User not authorized","requestID":"[^"]+"}`},
+			{Name: "Invalid ID", Request: utils.Request{Method: method, Target: userURL + "/abc/export"}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":"Invalid ID","requestID":"[^"]+"}`},
+			{Name: "Profile", Request: utils.Request{Method: method}, ResponseCode: http.StatusOK, ResponseBodyRegex: `^{"exportedAt":"[^"]+","user":{"id":` + idA + `,"name":"userA","handle":"usera","registered":true,` + timestamps + `},"identities":\[\]`},
+			{Name: "Memberships", Request: utils.Request{Method: method}, ResponseCode: http.StatusOK, ResponseBodyRegex: `"memberships":\[` + room(roomA, "roomA", idA) + `},` + room(roomB, "roomB", `\d+`) + `}\]`},
+			{Name: "Rooms owned", Request: utils.Request{Method: method}, ResponseCode: http.StatusOK, ResponseBodyRegex: `"roomsOwned":\[` + room(roomA, "roomA", idA) + `},` + room(deletedRoom, "deleted", idA) + `,"deletedAt":"[^"]+"}\]`},
+			{Name: "Refresh tokens", Request: utils.Request{Method: method}, ResponseCode: http.StatusOK, ResponseBodyRegex: `"refreshTokens":\[\]}$`},
+		},
+	}
+	test.Run(t)
+}
+
+// TestEraseUser tests the EraseUser function with the following scenario:
+// — A owns a room with B, a deleted room, and is in a room of B.
+// — B tries to erase A, it is refused.
+// — A is erased, its room is handed over to B and anonymised, and the room of B is left as is.
+// — A cannot be restored and its handle is freed.
+func TestEraseUser(t *testing.T) {
+	err := utils.ResetTestStorage()
+	if err != nil {
+		t.Error(err)
+	}
+
+	idA, headersA, err := utils.CreateTestUser(models.User{Name: "userA"})
+	if err != nil {
+		t.Error(err)
+	}
+	idB, headersB, err := utils.CreateTestUser(models.User{Name: "userB"})
+	if err != nil {
+		t.Error(err)
+	}
+	code, _, err := utils.ExecuteTestRequest(http.MethodPut, userURL+"/"+idA+"/account", `{"handle":"usera","password":"password123"}`, headersA)
+	if err != nil || code != http.StatusNoContent {
+		t.Fatalf("A failed to register: %d %v", code, err)
+	}
+	headersA = utils.GetBasicAuthHeader(idA, "password123")
+	roomA, err := utils.CreateTestRoom(models.Room{Name: "roomA"}, headersA)
+	if err != nil {
+		t.Error(err)
+	}
+	roomB, err := utils.CreateTestRoom(models.Room{Name: "roomB"}, headersB)
+	if err != nil {
+		t.Error(err)
+	}
+	deletedRoom, err := utils.CreateTestRoom(models.Room{Name: "deleted"}, headersA)
+	if err != nil {
+		t.Error(err)
+	}
+	for _, join := range []struct {
+		roomID  string
+		headers []utils.Header
+	}{{roomA, headersB}, {roomB, headersA}} {
+		code, err = utils.SendTestRequest(http.MethodPatch, roomURL+"/"+join.roomID+"/connect", join.headers)
+		if err != nil || code != http.StatusNoContent {
+			t.Fatalf("failed to join the room: %d %v", code, err)
+		}
+	}
+	code, err = utils.SendTestRequest(http.MethodDelete, roomURL+"/"+deletedRoom, headersA)
+	if err != nil || code != http.StatusNoContent {
+		t.Fatalf("A failed to close the room: %d %v", code, err)
+	}
+
+	roomWhenB := func(name string) string {
+		return fmt.Sprintf(`{"name":"%s","ownerID":%s,"users":\[{"ID":%s,"name":"userB"}\]}`, name, idB, idB)
+	}
+
+	method := http.MethodPost
+	test := utils.TestCreate{
+		Target:  userURL + "/" + idA + "/erase",
+		Headers: headersA,
+		SubTests: []utils.SubTest{
+			{Name: "Other user", Request: utils.Request{Method: method, Headers: headersB}, ResponseCode: http.StatusUnauthorized, ResponseBodyRegex: `{"error":"User not authorized","requestID":"[^"]+"}`},
+			{Name: "Invalid ID", Request: utils.Request{Method: method, Target: userURL + "/abc/erase"}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":"Invalid ID","requestID":"[^"]+"}`},
+			{Name: "Success", Request: utils.Request{Method: method}, ResponseCode: http.StatusNoContent, ResponseBodyRegex: ``},
+			{Name: "Correctly erased", Request: utils.Request{Method: http.MethodGet, Target: userURL + "/" + idA}, ResponseCode: http.StatusUnauthorized, ResponseBodyRegex: `{"error":"User not authorized","requestID":"[^"]+"}`},
+			{Name: "Room of A anonymised", Request: utils.Request{Method: http.MethodGet, Target: roomURL + "/" + roomA, Headers: headersB}, ResponseCode: http.StatusOK, ResponseBodyRegex: roomWhenB("Unnamed room")},
+			{Name: "Room of B left as is", Request: utils.Request{Method: http.MethodGet, Target: roomURL + "/" + roomB, Headers: headersB}, ResponseCode: http.StatusOK, ResponseBodyRegex: roomWhenB("roomB")},
+			{Name: "Cannot be restored", Request: utils.Request{Method: method, Target: "/admin/users/" + idA + "/restore", Headers: []utils.Header{{Key: "X-Admin-Token", Value: adminToken}}}, ResponseCode: http.StatusNotFound, ResponseBodyRegex: `{"error":"User not found","requestID":"[^"]+"}`},
+			{Name: "Handle freed", Request: utils.Request{Method: http.MethodPut, Target: userURL + "/" + idB + "/account", Headers: headersB, Body: `{"handle":"usera","password":"password123"}`}, ResponseCode: http.StatusNoContent, ResponseBodyRegex: ``},
+		},
+	}
+	test.Run(t)
+}
+
+// TestRotateCredentials tests the RotateCredentials function.
+func TestRotateCredentials(t *testing.T) {
+	err := utils.ResetTestStorage()
+	if err != nil {
+		t.Error(err)
+	}
+
+	id, oldHeaders, err := utils.CreateTestUser(models.User{Name: "test"})
+	if err != nil {
+		t.Error(err)
+	}
+	otherID, otherHeaders, err := utils.CreateTestUser(models.User{Name: "other"})
+	if err != nil {
+		t.Error(err)
+	}
+
+	method := http.MethodPost
+	test := utils.TestRUD{
+		CreateRequest:        utils.Request{Method: method, Target: userURL + "/" + id + "/credentials"},
+		CreateRequestHeaders: oldHeaders,
+		CreateResponse:       CreateResponseUser{},
+		SubTests: []utils.SubTest{
+			{Name: "Old password rejected", Request: utils.Request{Method: http.MethodPatch, Headers: oldHeaders, Body: `{"name":"test2"}`}, ResponseCode: http.StatusUnauthorized, ResponseBodyRegex: `{"error":"User not authorized","requestID":"[^"]+"}`},
+			{Name: "New password accepted", Request: utils.Request{Method: http.MethodPatch, Body: `{"name":"test2"}`}, ResponseCode: http.StatusNoContent, ResponseBodyRegex: ``},
+			{Name: "Other user", Request: utils.Request{Method: method, Target: "/credentials", Headers: otherHeaders}, ResponseCode: http.StatusUnauthorized, ResponseBodyRegex: `{"error":"User not authorized","requestID":"[^"]+"}`},
+			{Name: "Rotate again", Request: utils.Request{Method: method, Target: "/credentials"}, ResponseCode: http.StatusOK, ResponseBodyRegex: `^{"uri":"/users/` + id + `","password":"[0-9a-f]{64}"}$`},
+			{Name: "Previous password rejected", Request: utils.Request{Method: method, Target: "/credentials"}, ResponseCode: http.StatusUnauthorized, ResponseBodyRegex: `{"error":"User not authorized","requestID":"[^"]+"}`},
+		},
+	}
+	test.Run(t)
+
+	// Access tokens issued with the previous password are rejected, unlike the ones issued with the new password.
+	oldTokens, err := utils.CreateTestTokens(otherHeaders)
+	if err != nil {
+		t.Error(err)
+	}
+	code, body, err := utils.ExecuteTestRequest(method, userURL+"/"+otherID+"/credentials", "", utils.GetBearerAuthHeader(oldTokens.AccessToken))
+	if err != nil || code != http.StatusOK {
+		t.Fatalf("failed to rotate credentials: %d %v", code, err)
+	}
+	var credentials utils_routes.CreateResponse
+	err = json.Unmarshal(body, &credentials)
+	if err != nil {
+		t.Error(err)
+	}
+	newTokens, err := utils.CreateTestTokens(utils.GetBasicAuthHeader(otherID, credentials.Password))
+	if err != nil {
+		t.Error(err)
+	}
+	for _, check := range []struct {
+		token string
+		code  int
+	}{{oldTokens.AccessToken, http.StatusUnauthorized}, {newTokens.AccessToken, http.StatusNoContent}} {
+		code, _, err = utils.ExecuteTestRequest(http.MethodPatch, userURL+"/"+otherID, `{"name":"other2"}`, utils.GetBearerAuthHeader(check.token))
+		if err != nil || code != check.code {
+			t.Errorf("update with access token: got %d %v, want %d", code, err, check.code)
+		}
+	}
+}
+
+// TestRegisterUser tests the RegisterUser function.
+func TestRegisterUser(t *testing.T) {
+	err := utils.ResetTestStorage()
+	if err != nil {
+		t.Error(err)
+	}
+
+	id, headers, err := utils.CreateTestUser(models.User{Name: "test"})
+	if err != nil {
+		t.Error(err)
+	}
+	otherID, otherHeaders, err := utils.CreateTestUser(models.User{Name: "other"})
+	if err != nil {
+		t.Error(err)
+	}
+	newHeaders := utils.GetBasicAuthHeader(id, "password123")
+
+	method := http.MethodPut
+	test := utils.TestCreate{
+		Target:  userURL + "/" + id + "/account",
+		Headers: headers,
+		SubTests: []utils.SubTest{
+			{Name: "Empty body", Request: utils.Request{Method: method, Body: ``}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":"Failed to bind JSON","requestID":"[^"]+"}`},
+			{Name: "Invalid handle", Request: utils.Request{Method: method, Body: `{"handle":"te st","password":"password123"}`}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":"Failed to bind JSON","requestID":"[^"]+"}`},
+			{Name: "Short password", Request: utils.Request{Method: method, Body: `{"handle":"test","password":"pass"}`}, ResponseCode: http.StatusBadRequest, ResponseBodyRegex: `{"error":"Failed to bind JSON","requestID":"[^"]+"}`},
+			{Name: "Other user", Request: utils.Request{Method: method, Headers: otherHeaders, Body: `{"handle":"test","password":"password123"}`}, ResponseCode: http.StatusUnauthorized, ResponseBodyRegex: `{"error":"User not authorized","requestID":"[^"]+"}`},
+			{Name: "Success", Request: utils.Request{Method: method, Body: `{"handle":"Test","password":"password123"}`}, ResponseCode: http.StatusNoContent, ResponseBodyRegex: ``},
+			{Name: "Old password rejected", Request: utils.Request{Method: method, Body: `{"handle":"test","password":"password456"}`}, ResponseCode: http.StatusUnauthorized, ResponseBodyRegex: `{"error":"User not authorized","requestID":"[^"]+"}`},
+			{Name: "Handle already taken", Request: utils.Request{Method: method, Target: userURL + "/" + otherID + "/account", Headers: otherHeaders, Body: `{"handle":"TEST","password":"password123"}`}, ResponseCode: http.StatusConflict, ResponseBodyRegex: `{"error":"Handle already taken","requestID":"[^"]+"}`},
+			{Name: "Change password", Request: utils.Request{Method: method, Headers: newHeaders, Body: `{"handle":"test","password":"password456"}`}, ResponseCode: http.StatusNoContent, ResponseBodyRegex: ``},
+			{Name: "Previous password rejected", Request: utils.Request{Method: method, Headers: newHeaders, Body: `{"handle":"test","password":"password789"}`}, ResponseCode: http.StatusUnauthorized, ResponseBodyRegex: `{"error":"User not authorized","requestID":"[^"]+"}`},
+			{Name: "Handle freed", Request: utils.Request{Method: method, Headers: utils.GetBasicAuthHeader(id, "password456"), Body: `{"handle":"test2","password":"password456"}`}, ResponseCode: http.StatusNoContent, ResponseBodyRegex: ``},
+			{Name: "Handle of other user", Request: utils.Request{Method: method, Target: userURL + "/" + otherID + "/account", Headers: otherHeaders, Body: `{"handle":"test","password":"password123"}`}, ResponseCode: http.StatusNoContent, ResponseBodyRegex: ``},
 		},
 	}
 	test.Run(t)
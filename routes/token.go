@@ -0,0 +1,199 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Brawdunoir/dionysos-server/auth"
+	"github.com/Brawdunoir/dionysos-server/models"
+	"github.com/Brawdunoir/dionysos-server/repositories"
+	e "github.com/Brawdunoir/dionysos-server/utils/errors"
+	routes "github.com/Brawdunoir/dionysos-server/utils/routes"
+	"github.com/gin-gonic/gin"
+)
+
+// Validity of refresh tokens and stream tickets. They are set when setting up the router.
+var refreshTokenTTL, streamTicketTTL time.Duration
+
+// CreateToken godoc
+// @Summary      Exchanges credentials for tokens.
+// @Description  Returns a short-lived access token, to be sent in the Authorization header with the Bearer scheme instead of the user credentials,
+// @Description  and a refresh token to get a new access token once it expires.
+// @Tags         Tokens
+// @Security     BasicAuth
+// @Produce      json
+// @Success      200 {object} utils.TokenResponse
+// @Failure      401 {object} utils.ErrorResponse "User not authorized"
+// @Failure      429 {object} utils.ErrorResponse "Too many requests"
+// @Failure      500 {object} utils.ErrorResponse "Internal server error"
+// @Router       /token [post]
+func CreateToken(c *gin.Context) {
+	ctx, cancelCtx := context.WithTimeout(c, 1000*time.Millisecond)
+	defer cancelCtx()
+
+	user, err := routes.ExtractUserFromContext(c)
+	if err != nil {
+		c.Error(err).SetMeta("CreateToken.ExtractUserFromContext")
+		c.AbortWithError(http.StatusInternalServerError, e.UserNotInContext{}).SetMeta("CreateToken.ExtractUserFromContext")
+		return
+	}
+
+	res, err := issueTokens(ctx, user)
+	if err != nil {
+		c.Error(err).SetMeta("CreateToken.issueTokens")
+		c.AbortWithError(http.StatusInternalServerError, e.TokenNotCreated{}).SetMeta("CreateToken.issueTokens")
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+// RefreshToken godoc
+// @Summary      Exchanges a refresh token for new tokens.
+// @Description  Returns a new access token and a new refresh token. The given refresh token cannot be used anymore.
+// @Tags         Tokens
+// @Accept       json
+// @Produce      json
+// @Param        token body utils.RefreshRequest true "Refresh token"
+// @Success      200 {object} utils.TokenResponse
+// @Failure      400 {object} utils.ErrorResponse "Invalid request"
+// @Failure      401 {object} utils.ErrorResponse "Invalid refresh token"
+// @Failure      429 {object} utils.ErrorResponse "Too many requests"
+// @Failure      500 {object} utils.ErrorResponse "Internal server error"
+// @Router       /token/refresh [post]
+func RefreshToken(c *gin.Context) {
+	var req routes.RefreshRequest
+	ctx, cancelCtx := context.WithTimeout(c, 1000*time.Millisecond)
+	defer cancelCtx()
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.Error(err).SetMeta("RefreshToken.ShouldBindJSON")
+		c.AbortWithError(http.StatusBadRequest, e.FailJSONBind{}).SetMeta("RefreshToken.ShouldBindJSON")
+		return
+	}
+
+	// A refresh token is used only once, the first concurrent request to consume it wins.
+	refreshToken, err := users.ConsumeRefreshToken(ctx, auth.HashRefreshToken(req.RefreshToken))
+	if errors.Is(err, repositories.ErrNotFound) {
+		c.Error(err).SetMeta("RefreshToken.ConsumeRefreshToken")
+		c.AbortWithError(http.StatusUnauthorized, e.InvalidRefreshToken{}).SetMeta("RefreshToken.ConsumeRefreshToken")
+		return
+	} else if err != nil {
+		c.Error(err).SetMeta("RefreshToken.ConsumeRefreshToken")
+		c.AbortWithError(http.StatusInternalServerError, e.TokenNotCreated{}).SetMeta("RefreshToken.ConsumeRefreshToken")
+		return
+	}
+
+	// The user may have been deleted since the token was issued.
+	user, err := users.Get(ctx, refreshToken.UserID)
+	if err != nil {
+		c.Error(err).SetMeta("RefreshToken.Get")
+		c.AbortWithError(http.StatusUnauthorized, e.InvalidRefreshToken{}).SetMeta("RefreshToken.Get")
+		return
+	}
+
+	res, err := issueTokens(ctx, user)
+	if err != nil {
+		c.Error(err).SetMeta("RefreshToken.issueTokens")
+		c.AbortWithError(http.StatusInternalServerError, e.TokenNotCreated{}).SetMeta("RefreshToken.issueTokens")
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+// Login godoc
+// @Summary      Logs a registered user in with its handle and password.
+// @Description  Returns the URI of the user, holding its ID to authenticate with BasicAuth,
+// @Description  along with an access token and a refresh token as /token does. Handles are case-insensitive.
+// @Tags         Tokens
+// @Accept       json
+// @Produce      json
+// @Param        account body models.UserAccount true "Account"
+// @Success      200 {object} utils.TokenResponse
+// @Failure      400 {object} utils.ErrorResponse "Invalid request"
+// @Failure      401 {object} utils.ErrorResponse "Invalid handle or password"
+// @Failure      429 {object} utils.ErrorResponse "Too many requests"
+// @Failure      500 {object} utils.ErrorResponse "Internal server error"
+// @Router       /token/login [post]
+func Login(c *gin.Context) {
+	var account models.UserAccount
+	ctx, cancelCtx := context.WithTimeout(c, 1000*time.Millisecond)
+	defer cancelCtx()
+
+	if err := c.ShouldBindJSON(&account); err != nil {
+		c.Error(err).SetMeta("Login.ShouldBindJSON")
+		c.AbortWithError(http.StatusBadRequest, e.FailJSONBind{}).SetMeta("Login.ShouldBindJSON")
+		return
+	}
+
+	handle := strings.ToLower(account.Handle)
+	if err := routes.AssertNotLockedOut(c, guard, "handle:"+handle); err != nil {
+		return
+	}
+
+	user, err := users.GetByHandle(ctx, handle)
+	if errors.Is(err, repositories.ErrNotFound) {
+		// Do not reveal whether the handle exists through the response time.
+		auth.VerifyUnknownUser(account.Password)
+		routes.RecordAuthenticationFailure(c, guard, "handle:"+handle)
+		c.Error(err).SetMeta("Login.GetByHandle")
+		c.AbortWithError(http.StatusUnauthorized, e.InvalidCredentials{}).SetMeta("Login.GetByHandle")
+		return
+	} else if err != nil {
+		c.Error(err).SetMeta("Login.GetByHandle")
+		c.AbortWithError(http.StatusInternalServerError, e.TokenNotCreated{}).SetMeta("Login.GetByHandle")
+		return
+	}
+
+	passwordMatch, err := passwords.Verify(user.ID, account.Password, user.Password)
+	if err != nil {
+		c.Error(err).SetMeta("Login.Verify")
+	}
+	if !passwordMatch {
+		routes.RecordAuthenticationFailure(c, guard, "handle:"+handle)
+		c.AbortWithError(http.StatusUnauthorized, e.InvalidCredentials{}).SetMeta("Login.Verify")
+		return
+	}
+	guard.Succeed("handle:" + handle)
+
+	res, err := issueTokens(ctx, user)
+	if err != nil {
+		c.Error(err).SetMeta("Login.issueTokens")
+		c.AbortWithError(http.StatusInternalServerError, e.TokenNotCreated{}).SetMeta("Login.issueTokens")
+		return
+	}
+	res.URI = "/users/" + fmt.Sprint(user.ID)
+
+	c.JSON(http.StatusOK, res)
+}
+
+// issueTokens creates an access token and a refresh token for a user.
+// Expired refresh tokens of the user are removed at the same time.
+func issueTokens(ctx context.Context, user models.User) (*routes.TokenResponse, error) {
+	accessToken, _, err := tokens.Issue(user.ID, user.TokenGeneration)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, hash, err := auth.GenerateRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+
+	err = users.CreateRefreshToken(ctx, &models.RefreshToken{UserID: user.ID, Hash: hash, ExpiresAt: time.Now().Add(refreshTokenTTL)})
+	if err != nil {
+		return nil, err
+	}
+
+	return &routes.TokenResponse{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(tokens.TTL().Seconds()),
+		RefreshToken: refreshToken,
+	}, nil
+}
@@ -3,74 +3,98 @@ package routes
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"math/rand"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/Brawdunoir/dionysos-server/auth"
+	"github.com/Brawdunoir/dionysos-server/metrics"
 	"github.com/Brawdunoir/dionysos-server/models"
-	"github.com/Brawdunoir/dionysos-server/utils"
+	"github.com/Brawdunoir/dionysos-server/repositories"
 	e "github.com/Brawdunoir/dionysos-server/utils/errors"
 	l "github.com/Brawdunoir/dionysos-server/utils/logger"
 	routes "github.com/Brawdunoir/dionysos-server/utils/routes"
+	"github.com/Brawdunoir/dionysos-server/variables"
 	"github.com/gin-gonic/gin"
 )
 
 // CreateUser godoc
 // @Summary      Creates a user. Needed for further request during authentication.
 // @Description  Creates a user. You will need to use BasicAuth to authenticate with the created user, using its ID and password produced by this endpoint.
+// @Description  Disabled if the server only accepts users logging in with OIDC.
 // @Tags         Users
 // @Accept       json
 // @Produce      json
 // @Param        user body models.UserUpdate true "User object"
 // @Success      201	{object} utils.CreateResponse "User created"
 // @Failure      400	{object} utils.ErrorResponse "Invalid request"
+// @Failure      403	{object} utils.ErrorResponse "Anonymous users disabled"
+// @Failure      429	{object} utils.ErrorResponse "Too many requests"
 // @Failure      500	{object} utils.ErrorResponse "Internal server error"
 // @Router       /users [post]
 func CreateUser(c *gin.Context) {
 	var u models.UserUpdate
-	rand.Seed(time.Now().UnixNano())
 	ctx, cancelCtx := context.WithTimeout(c, 1000*time.Millisecond)
 	defer cancelCtx()
 
+	if variables.AnonymousUsers != "true" {
+		c.AbortWithError(http.StatusForbidden, e.AnonymousUsersDisabled{}).SetMeta("CreateUser.AnonymousUsers")
+		return
+	}
+
 	if err := c.ShouldBindJSON(&u); err != nil {
 		c.Error(err).SetMeta("CreateUser.ShouldBindJSON")
 		c.AbortWithError(http.StatusBadRequest, e.FailJSONBind{}).SetMeta("CreateUser.ShouldBindJSON")
 		return
 	}
 
-	// Create 32 bytes random password
-	password := make([]byte, 32)
-	rand.Read(password)
 	user := u.ToUser()
 
-	user.Password = fmt.Sprintf("%x", password)
-
-	err := db.WithContext(ctx).Create(&user).Error
+	password, err := auth.GeneratePassword()
+	if err != nil {
+		c.Error(err).SetMeta("CreateUser.GeneratePassword")
+		c.AbortWithError(http.StatusInternalServerError, e.UserNotCreated{}).SetMeta("CreateUser.GeneratePassword")
+		return
+	}
+	hash, err := auth.HashPassword(password)
+	if err != nil {
+		c.Error(err).SetMeta("CreateUser.HashPassword")
+		c.AbortWithError(http.StatusInternalServerError, e.UserNotCreated{}).SetMeta("CreateUser.HashPassword")
+		return
+	}
+	user.Password = hash
 
+	err = users.Create(ctx, user)
 	if err != nil {
 		c.Error(err).SetMeta("CreateUser.Create")
 		c.AbortWithError(http.StatusInternalServerError, e.UserNotCreated{}).SetMeta("CreateUser.Create")
 		return
 	}
 
-	c.JSON(http.StatusCreated, routes.CreateResponse{URI: "/users/" + fmt.Sprint(user.ID), Password: user.Password})
+	metrics.UsersCreated.Inc()
+
+	c.JSON(http.StatusCreated, routes.CreateResponse{URI: "/users/" + fmt.Sprint(user.ID), Password: password})
 }
 
 // GetUser godoc
 // @Summary      Gets a user.
 // @Tags         Users
 // @Security     BasicAuth
+// @Security     BearerAuth
 // @Produce      json
-// @Param        id path int true "User ID"
+// @Param        id            path   int    true  "User ID"
+// @Param        If-None-Match header string false "ETag of a previously fetched version"
 // @Success      200 	{object} models.User
+// @Header       200 	{string} ETag "Version of the user"
+// @Success      304 	"User not modified since the given version"
 // @Failure      400 	{object} utils.ErrorResponse "Invalid request"
 // @Failure      401 	{object} utils.ErrorResponse "User not authorized"
 // @Failure      404 	{object} utils.ErrorResponse "User not found"
 // @Router       /users/{id} [get]
 func GetUser(c *gin.Context) {
-	var user models.User
 	ctx, cancelCtx := context.WithTimeout(c, 1000*time.Millisecond)
 	defer cancelCtx()
 
@@ -81,11 +105,16 @@ func GetUser(c *gin.Context) {
 		return
 	}
 
-	err = db.WithContext(ctx).First(&user, id).Error
-
+	user, err := users.Get(ctx, id)
 	if err != nil {
-		c.Error(err).SetMeta("GetUser.First")
-		c.AbortWithError(http.StatusNotFound, e.UserNotFound{}).SetMeta("GetUser.First")
+		c.Error(err).SetMeta("GetUser.Get")
+		c.AbortWithError(http.StatusNotFound, e.UserNotFound{}).SetMeta("GetUser.Get")
+		return
+	}
+
+	routes.TagCache(c, routes.UserTag(user.ID))
+
+	if routes.NotModified(c, user.Version) {
 		return
 	}
 
@@ -96,14 +125,17 @@ func GetUser(c *gin.Context) {
 // @Summary      Updates a user.
 // @Tags         Users
 // @Security     BasicAuth
+// @Security     BearerAuth
 // @Accept       json
 // @Produce      json
-// @Param        id   path int               true "User ID"
-// @Param        user body models.UserUpdate true "User object"
+// @Param        id       path   int               true  "User ID"
+// @Param        If-Match header string            false "ETag the user must still have to be updated"
+// @Param        user     body   models.UserUpdate true  "User object"
 // @Success      204
 // @Failure      400 {object} utils.ErrorResponse "Invalid request"
 // @Failure      401 {object} utils.ErrorResponse "User not authorized"
 // @Failure      404 {object} utils.ErrorResponse "User not found"
+// @Failure      412 {object} utils.ErrorResponse "User modified since the given version"
 // @Failure      500 {object} utils.ErrorResponse "Internal server error"
 // @Router       /users/{id} [patch]
 func UpdateUser(c *gin.Context) {
@@ -137,31 +169,176 @@ func UpdateUser(c *gin.Context) {
 		return
 	}
 
-	err = db.WithContext(ctx).Model(&patchedUser).Updates(u.ToUser()).Error
+	err = users.Update(ctx, patchedUser.ID, &u, routes.IfMatch(c))
 	if err != nil {
-		c.Error(err).SetMeta("UpdateUser.Updates")
-		c.AbortWithError(http.StatusInternalServerError, e.UserNotModified{}).SetMeta("UpdateUser.Updates")
+		c.Error(err).SetMeta("UpdateUser.Update")
+		if errors.Is(err, repositories.ErrVersionMismatch) {
+			c.AbortWithError(http.StatusPreconditionFailed, e.ResourceModified{}).SetMeta("UpdateUser.Update")
+		} else {
+			c.AbortWithError(http.StatusInternalServerError, e.UserNotModified{}).SetMeta("UpdateUser.Update")
+		}
 		return
 	}
+	routes.TagCache(c, routes.UserTag(patchedUser.ID))
 
-	// If the user has a room, broadcast its rename to room members.
-	roomID, err := patchedUser.GetRoomID(ctx, db)
-	if err == nil {
-		stream, err := utils.GetStream(roomID, roomStreamsList)
+	// Broadcast the rename to the members of the rooms of the user.
+	roomIDs, err := users.GetRoomIDs(ctx, patchedUser.ID)
+	if err != nil {
+		l.FromContext(c).Warnf("Failed to get rooms of user: %v", err)
+	}
+	for _, roomID := range roomIDs {
+		stream, err := roomStreamsList.GetStream(roomID)
 		if err != nil {
-			l.Logger.Infof("Failed to get stream: %v", err)
+			l.FromContext(c).Infof("Failed to get stream: %v", err)
 		} else {
-			stream.Distribute(SSEMessage)
+			stream.Distribute(ctx, SSEMessage)
 		}
 	}
 
 	c.JSON(http.StatusNoContent, nil)
 }
 
+// RotateCredentials godoc
+// @Summary      Rotates the password of a user.
+// @Description  Generates a new password for the user. The previous password stops working immediately,
+// @Description  and the access tokens, stream tickets and refresh tokens issued before are revoked.
+// @Tags         Users
+// @Security     BasicAuth
+// @Security     BearerAuth
+// @Produce      json
+// @Param        id path int true "User ID"
+// @Success      200 {object} utils.CreateResponse "New password"
+// @Failure      400 {object} utils.ErrorResponse "Invalid request"
+// @Failure      401 {object} utils.ErrorResponse "User not authorized"
+// @Failure      500 {object} utils.ErrorResponse "Internal server error"
+// @Router       /users/{id}/credentials [post]
+func RotateCredentials(c *gin.Context) {
+	ctx, cancelCtx := context.WithTimeout(c, 1000*time.Millisecond)
+	defer cancelCtx()
+
+	user, err := routes.ExtractUserFromContext(c)
+	if err != nil {
+		c.Error(err).SetMeta("RotateCredentials.ExtractUserFromContext")
+		c.AbortWithError(http.StatusInternalServerError, e.UserNotInContext{}).SetMeta("RotateCredentials.ExtractUserFromContext")
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.Error(err).SetMeta("RotateCredentials.ParseUint")
+		c.AbortWithError(http.StatusBadRequest, e.InvalidID{}).SetMeta("RotateCredentials.ParseUint")
+		return
+	}
+
+	// Assert the request is coming from the right user.
+	if err := routes.AssertUser(c, id); err != nil {
+		return
+	}
+
+	password, err := auth.GeneratePassword()
+	if err != nil {
+		c.Error(err).SetMeta("RotateCredentials.GeneratePassword")
+		c.AbortWithError(http.StatusInternalServerError, e.UserNotModified{}).SetMeta("RotateCredentials.GeneratePassword")
+		return
+	}
+	hash, err := auth.HashPassword(password)
+	if err != nil {
+		c.Error(err).SetMeta("RotateCredentials.HashPassword")
+		c.AbortWithError(http.StatusInternalServerError, e.UserNotModified{}).SetMeta("RotateCredentials.HashPassword")
+		return
+	}
+
+	// Access tokens and stream tickets issued with the previous password are rejected from now on.
+	err = users.RotatePassword(ctx, user.ID, hash)
+	if err != nil {
+		c.Error(err).SetMeta("RotateCredentials.RotatePassword")
+		c.AbortWithError(http.StatusInternalServerError, e.UserNotModified{}).SetMeta("RotateCredentials.RotatePassword")
+		return
+	}
+	passwords.Forget(user.ID)
+
+	// Refresh tokens obtained with the previous password must not outlive it.
+	deleteRefreshTokens(ctx, user.ID)
+
+	c.JSON(http.StatusOK, routes.CreateResponse{URI: "/users/" + fmt.Sprint(user.ID), Password: password})
+}
+
+// RegisterUser godoc
+// @Summary      Registers a user with a handle and a password.
+// @Description  Turns an anonymous user into a registered one, or changes the handle and password of a registered user.
+// @Description  The user can then log in from any device with its handle and password to get its ID back, see /token/login.
+// @Description  Handles are case-insensitive. The previous password stops working immediately and refresh tokens are revoked.
+// @Tags         Users
+// @Security     BasicAuth
+// @Security     BearerAuth
+// @Accept       json
+// @Param        id      path int                true "User ID"
+// @Param        account body models.UserAccount true "Account"
+// @Success      204
+// @Failure      400 {object} utils.ErrorResponse "Invalid request"
+// @Failure      401 {object} utils.ErrorResponse "User not authorized"
+// @Failure      409 {object} utils.ErrorResponse "Handle already taken"
+// @Failure      500 {object} utils.ErrorResponse "Internal server error"
+// @Router       /users/{id}/account [put]
+func RegisterUser(c *gin.Context) {
+	var account models.UserAccount
+	ctx, cancelCtx := context.WithTimeout(c, 1000*time.Millisecond)
+	defer cancelCtx()
+
+	user, err := routes.ExtractUserFromContext(c)
+	if err != nil {
+		c.Error(err).SetMeta("RegisterUser.ExtractUserFromContext")
+		c.AbortWithError(http.StatusInternalServerError, e.UserNotInContext{}).SetMeta("RegisterUser.ExtractUserFromContext")
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.Error(err).SetMeta("RegisterUser.ParseUint")
+		c.AbortWithError(http.StatusBadRequest, e.InvalidID{}).SetMeta("RegisterUser.ParseUint")
+		return
+	}
+
+	// Assert the request is coming from the right user.
+	if err := routes.AssertUser(c, id); err != nil {
+		return
+	}
+
+	if err := c.ShouldBindJSON(&account); err != nil {
+		c.Error(err).SetMeta("RegisterUser.ShouldBindJSON")
+		c.AbortWithError(http.StatusBadRequest, e.FailJSONBind{}).SetMeta("RegisterUser.ShouldBindJSON")
+		return
+	}
+	handle := strings.ToLower(account.Handle)
+
+	hash, err := auth.HashPassword(account.Password)
+	if err != nil {
+		c.Error(err).SetMeta("RegisterUser.HashPassword")
+		c.AbortWithError(http.StatusInternalServerError, e.UserNotModified{}).SetMeta("RegisterUser.HashPassword")
+		return
+	}
+
+	err = users.Register(ctx, user.ID, handle, hash)
+	if errors.Is(err, repositories.ErrHandleTaken) {
+		c.AbortWithError(http.StatusConflict, e.HandleAlreadyTaken{}).SetMeta("RegisterUser.Register")
+		return
+	} else if err != nil {
+		c.Error(err).SetMeta("RegisterUser.Register")
+		c.AbortWithError(http.StatusInternalServerError, e.UserNotModified{}).SetMeta("RegisterUser.Register")
+		return
+	}
+	passwords.Forget(user.ID)
+	deleteRefreshTokens(ctx, user.ID)
+
+	c.JSON(http.StatusNoContent, nil)
+}
+
 // DeleteUser godoc
 // @Summary      Deletes a user. Should be used when disconnecting a user.
+// @Description  The user leaves all of its rooms first. It can be restored by an administrator during the restore period, 24 hours by default.
 // @Tags         Users
 // @Security     BasicAuth
+// @Security     BearerAuth
 // @Param        id path int true "User ID"
 // @Success      204
 // @Failure      400 {object} utils.ErrorResponse "Invalid request"
@@ -177,6 +354,7 @@ func DeleteUser(c *gin.Context) {
 	if err != nil {
 		c.Error(err).SetMeta("DeleteUser.ParseUint")
 		c.AbortWithError(http.StatusBadRequest, e.InvalidID{}).SetMeta("DeleteUser.ParseUint")
+		return
 	}
 
 	// Assert the request is coming from the right user.
@@ -184,17 +362,175 @@ func DeleteUser(c *gin.Context) {
 		return
 	}
 
-	result := db.WithContext(ctx).Delete(&models.User{}, id)
+	// Leave all the rooms of the user, handing their ownership over to other users if needed.
+	roomIDs, err := users.GetRoomIDs(ctx, id)
+	if err != nil {
+		c.Error(err).SetMeta("DeleteUser.GetRoomIDs")
+		c.AbortWithError(http.StatusInternalServerError, e.UserNotDeleted{}).SetMeta("DeleteUser.GetRoomIDs")
+		return
+	}
+	for _, roomID := range roomIDs {
+		// The user may have left the room meanwhile.
+		err = leaveRoom(ctx, c, roomID, id)
+		if err != nil && !errors.Is(err, repositories.ErrNotFound) {
+			c.Error(err).SetMeta("DeleteUser.LeaveRoom")
+			c.AbortWithError(http.StatusInternalServerError, e.UserNotDeleted{}).SetMeta("DeleteUser.LeaveRoom")
+			return
+		}
+	}
 
-	if result.Error != nil {
-		c.Error(result.Error).SetMeta("DeleteUser.Delete.NotDeleted")
+	// Refresh tokens of the user are deleted along with it.
+	err = users.Delete(ctx, id)
+	if errors.Is(err, repositories.ErrNotFound) {
+		c.Error(err).SetMeta("DeleteUser.Delete.NotFound")
+		c.AbortWithError(http.StatusNotFound, e.UserNotFound{}).SetMeta("DeleteUser.Delete.NotFound")
+		return
+	} else if err != nil {
+		c.Error(err).SetMeta("DeleteUser.Delete.NotDeleted")
 		c.AbortWithError(http.StatusInternalServerError, e.UserNotDeleted{}).SetMeta("DeleteUser.Delete.NotDeleted")
 		return
-	} else if result.RowsAffected < 1 {
-		c.Error(result.Error).SetMeta("DeleteUser.Delete.NotFound")
-		c.AbortWithError(http.StatusNotFound, e.UserNotFound{}).SetMeta("DeleteUser.Delete.NotFound")
+	}
+	routes.TagCache(c, routes.UserTag(id))
+
+	passwords.Forget(id)
+
+	metrics.UsersDeleted.Inc()
+
+	c.JSON(http.StatusNoContent, nil)
+}
+
+// ExportUser godoc
+// @Summary      Exports the personal data of a user.
+// @Description  Returns everything stored about the user: its profile, identities, memberships, owned rooms, deleted ones included,
+// @Description  and refresh tokens, along with their timestamps. Credentials are left out.
+// @Tags         Users
+// @Security     BasicAuth
+// @Security     BearerAuth
+// @Produce      json
+// @Param        id path int true "User ID"
+// @Success      200 {object} models.PersonalData
+// @Failure      400 {object} utils.ErrorResponse "Invalid request"
+// @Failure      401 {object} utils.ErrorResponse "User not authorized"
+// @Failure      404 {object} utils.ErrorResponse "User not found"
+// @Failure      500 {object} utils.ErrorResponse "Internal server error"
+// @Router       /users/{id}/export [get]
+func ExportUser(c *gin.Context) {
+	ctx, cancelCtx := context.WithTimeout(c, 1000*time.Millisecond)
+	defer cancelCtx()
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.Error(err).SetMeta("ExportUser.ParseUint")
+		c.AbortWithError(http.StatusBadRequest, e.InvalidID{}).SetMeta("ExportUser.ParseUint")
+		return
+	}
+
+	// Assert the request is coming from the right user.
+	if err := routes.AssertUser(c, id); err != nil {
+		return
+	}
+
+	data, err := users.Export(ctx, id)
+	if errors.Is(err, repositories.ErrNotFound) {
+		c.Error(err).SetMeta("ExportUser.Export")
+		c.AbortWithError(http.StatusNotFound, e.UserNotFound{}).SetMeta("ExportUser.Export")
+		return
+	} else if err != nil {
+		c.Error(err).SetMeta("ExportUser.Export")
+		c.AbortWithError(http.StatusInternalServerError, e.UserDataNotExported{}).SetMeta("ExportUser.Export")
 		return
 	}
 
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, data)
+}
+
+// erasedRoomName replaces the names of the rooms owned by a user whose personal data is erased.
+const erasedRoomName = "Unnamed room"
+
+// EraseUser godoc
+// @Summary      Erases a user and its personal data.
+// @Description  The user leaves all of its rooms, whose names are anonymised if it owns them, then the user, its identities,
+// @Description  its refresh tokens and its deleted rooms are deleted for good. Unlike a deleted user, an erased user cannot be restored.
+// @Tags         Users
+// @Security     BasicAuth
+// @Security     BearerAuth
+// @Param        id path int true "User ID"
+// @Success      204
+// @Failure      400 {object} utils.ErrorResponse "Invalid request"
+// @Failure      401 {object} utils.ErrorResponse "User not authorized"
+// @Failure      404 {object} utils.ErrorResponse "User not found"
+// @Failure      500 {object} utils.ErrorResponse "Internal server error"
+// @Router       /users/{id}/erase [post]
+func EraseUser(c *gin.Context) {
+	ctx, cancelCtx := context.WithTimeout(c, 1000*time.Millisecond)
+	defer cancelCtx()
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.Error(err).SetMeta("EraseUser.ParseUint")
+		c.AbortWithError(http.StatusBadRequest, e.InvalidID{}).SetMeta("EraseUser.ParseUint")
+		return
+	}
+
+	// Assert the request is coming from the right user.
+	if err := routes.AssertUser(c, id); err != nil {
+		return
+	}
+
+	roomIDs, err := users.GetRoomIDs(ctx, id)
+	if err != nil {
+		c.Error(err).SetMeta("EraseUser.GetRoomIDs")
+		c.AbortWithError(http.StatusInternalServerError, e.UserNotErased{}).SetMeta("EraseUser.GetRoomIDs")
+		return
+	}
+	for _, roomID := range roomIDs {
+		// Anonymise the rooms of the user before handing them over, the user may have left them meanwhile.
+		err = anonymiseRoom(ctx, roomID, id)
+		if err == nil {
+			err = leaveRoom(ctx, c, roomID, id)
+		}
+		if err != nil && !errors.Is(err, repositories.ErrNotFound) {
+			c.Error(err).SetMeta("EraseUser.LeaveRoom")
+			c.AbortWithError(http.StatusInternalServerError, e.UserNotErased{}).SetMeta("EraseUser.LeaveRoom")
+			return
+		}
+	}
+
+	err = users.Erase(ctx, id)
+	if errors.Is(err, repositories.ErrNotFound) {
+		c.Error(err).SetMeta("EraseUser.Erase")
+		c.AbortWithError(http.StatusNotFound, e.UserNotFound{}).SetMeta("EraseUser.Erase")
+		return
+	} else if err != nil {
+		c.Error(err).SetMeta("EraseUser.Erase")
+		c.AbortWithError(http.StatusInternalServerError, e.UserNotErased{}).SetMeta("EraseUser.Erase")
+		return
+	}
+	routes.TagCache(c, routes.UserTag(id))
+
+	passwords.Forget(id)
+
+	metrics.UsersDeleted.Inc()
+	l.FromContext(c).Infof("User %v erased", id)
+
 	c.JSON(http.StatusNoContent, nil)
 }
+
+// anonymiseRoom replaces the name of a room by erasedRoomName if it is owned by the given user.
+func anonymiseRoom(ctx context.Context, roomID, userID uint64) error {
+	room, err := rooms.Get(ctx, roomID)
+	if err != nil || room.OwnerID != userID {
+		return err
+	}
+	return rooms.Update(ctx, roomID, &models.RoomUpdate{Name: erasedRoomName}, nil)
+}
+
+// deleteRefreshTokens deletes the refresh tokens of a user, e.g. when its password changes.
+// Failing to do so is only logged, the request having already succeeded.
+func deleteRefreshTokens(ctx context.Context, userID uint64) {
+	err := users.DeleteRefreshTokens(ctx, userID)
+	if err != nil {
+		l.FromContext(ctx).Errorf("Failed to delete refresh tokens of user %v: %v", userID, err)
+	}
+}
@@ -18,7 +18,7 @@ import (
 func GetVersion(c *gin.Context) {
 	var version string
 	if version = os.Getenv("VERSION"); version == "" {
-		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse("Version not set"))
+		c.JSON(http.StatusInternalServerError, utils.CreateErrorResponse(c, "Version not set"))
 		return
 	}
 	c.String(http.StatusOK, version)
@@ -7,6 +7,7 @@ docker-compose -f docker-compose_testing.yaml up --build -d >/dev/null 2>&1
 
 # Load env variables and run tests on the given package
 ENVIRONMENT=TEST \
+TEST_DATABASE=true \
 GIN_MODE=release \
 POSTGRES_HOST=localhost \
 POSTGRES_USER=$POSTGRES_USER \
@@ -20,5 +21,21 @@ go test -failfast \
 -coverpkg ./... ./... \
 -v
 
+status=$?
+
+# Run the tests again against SQLite
+sqlite_dir=$(mktemp -d)
+ENVIRONMENT=TEST \
+TEST_DATABASE=true \
+GIN_MODE=release \
+DATABASE_DRIVER=sqlite \
+SQLITE_PATH="$sqlite_dir/dionysos.db" \
+go test -failfast \
+-race \
+./... || status=1
+rm -rf "$sqlite_dir"
+
 # Stop the DB
 docker-compose -f docker-compose_testing.yaml down >/dev/null 2>&1
+
+exit $status
@@ -0,0 +1,100 @@
+package tracing
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/Brawdunoir/dionysos-server/variables"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	instrumentationName = "github.com/Brawdunoir/dionysos-server"
+	serviceName         = "dionysos"
+)
+
+// provider is the tracer provider set up by Init, nil if tracing is disabled.
+var provider *sdktrace.TracerProvider
+
+// Init sets up tracing, exporting spans to the OTLP endpoint set in the environment.
+// Tracing is disabled if no endpoint has been set, spans are then no-op.
+func Init() error {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	if variables.TracingEndpoint == "" {
+		return nil
+	}
+
+	ratio, err := strconv.ParseFloat(variables.TracingSampleRatio, 64)
+	if err != nil {
+		return err
+	}
+
+	options := []otlptracehttp.Option{otlptracehttp.WithEndpoint(variables.TracingEndpoint)}
+	if variables.TracingInsecure == "true" {
+		options = append(options, otlptracehttp.WithInsecure())
+	}
+	exporter, err := otlptracehttp.New(context.Background(), options...)
+	if err != nil {
+		return err
+	}
+
+	setProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+	)
+	return nil
+}
+
+// InitWithExporter sets up tracing with the given exporter, every span being sampled and exported synchronously.
+// It is meant to be used in tests along with an in-memory exporter.
+func InitWithExporter(exporter sdktrace.SpanExporter) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	setProvider(
+		sdktrace.WithSyncer(exporter),
+		sdktrace.WithSampler(sdktrace.AlwaysSample()),
+	)
+}
+
+// Shutdown flushes the remaining spans and stops the tracer provider.
+func Shutdown(ctx context.Context) error {
+	if provider == nil {
+		return nil
+	}
+	return provider.Shutdown(ctx)
+}
+
+// Start starts a span as a child of the span found in ctx, if any.
+func Start(ctx context.Context, name string, options ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, options...)
+}
+
+// Inject returns a carrier holding the trace context of ctx, so that it can travel along with a message.
+func Inject(ctx context.Context) propagation.MapCarrier {
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	return carrier
+}
+
+// Extract returns the span context held by a carrier filled by Inject.
+func Extract(carrier propagation.MapCarrier) trace.SpanContext {
+	return trace.SpanContextFromContext(otel.GetTextMapPropagator().Extract(context.Background(), carrier))
+}
+
+// setProvider creates a tracer provider with the given options and sets it as the global one.
+func setProvider(options ...sdktrace.TracerProviderOption) {
+	options = append(options, sdktrace.WithResource(resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceNameKey.String(serviceName),
+	)))
+
+	provider = sdktrace.NewTracerProvider(options...)
+	otel.SetTracerProvider(provider)
+}
@@ -1,22 +1,41 @@
 package errors
 
 const (
-	failJSONBind         = "failed to bind JSON"
-	invalidID            = "invalid ID"
-	userNotCreated       = "user not created"
-	userNotFound         = "user not found"
-	userNotInContext     = "user not found in context. Has it been set in the middleware?"
-	userNotAuthorized    = "user not authorized"
-	userNotModified      = "user not modified"
-	userNotDeleted       = "user not deleted"
-	userAlreadyInRoom    = "user already in room"
-	roomNotCreated       = "room not created"
-	roomNotFound         = "room not found"
-	roomNotInContext     = "room not found in context. Has it been set in the middleware?"
-	roomNotModified      = "room not modified"
-	roomNotDeleted       = "room not deleted"
-	streamNotCreated     = "stream not created"
-	ownerCantKickHimself = "cannot kick owner from room"
+	failJSONBind           = "failed to bind JSON"
+	invalidID              = "invalid ID"
+	userNotCreated         = "user not created"
+	userNotFound           = "user not found"
+	userNotInContext       = "user not found in context. Has it been set in the middleware?"
+	userNotAuthorized      = "user not authorized"
+	userNotModified        = "user not modified"
+	userNotDeleted         = "user not deleted"
+	userAlreadyInRoom      = "user already in room"
+	roomNotCreated         = "room not created"
+	roomNotFound           = "room not found"
+	roomNotInContext       = "room not found in context. Has it been set in the middleware?"
+	roomNotModified        = "room not modified"
+	roomNotDeleted         = "room not deleted"
+	streamNotCreated       = "stream not created"
+	ownerCantKickHimself   = "cannot kick owner from room"
+	serverShuttingDown     = "server shutting down"
+	invalidLogLevel        = "invalid log level"
+	invalidRefreshToken    = "invalid refresh token"
+	tokenNotCreated        = "token not created"
+	handleAlreadyTaken     = "handle already taken"
+	invalidCredentials     = "invalid handle or password"
+	identityNotVerified    = "identity not verified"
+	anonymousUsersDisabled = "anonymous users disabled"
+	tooManyRequests        = "too many requests"
+	resourceModified       = "resource modified since it was read"
+	roomNotRestored        = "room not restored"
+	userNotRestored        = "user not restored"
+	invalidArchive         = "invalid archive"
+	identityAlreadyLinked  = "identity already linked"
+	archiveNotExported     = "archive not exported"
+	archiveNotImported     = "archive not imported"
+	userDataNotExported    = "user data not exported"
+	userNotErased          = "user not erased"
+	userNotInRoom          = "user not in room"
 )
 
 type FailJSONBind struct{}
@@ -35,6 +54,25 @@ type RoomNotDeleted struct{}
 type UserAlreadyInRoom struct{}
 type StreamNotCreated struct{}
 type OwnerCantKickHimself struct{}
+type ServerShuttingDown struct{}
+type InvalidLogLevel struct{}
+type InvalidRefreshToken struct{}
+type TokenNotCreated struct{}
+type HandleAlreadyTaken struct{}
+type InvalidCredentials struct{}
+type IdentityNotVerified struct{}
+type AnonymousUsersDisabled struct{}
+type TooManyRequests struct{}
+type ResourceModified struct{}
+type RoomNotRestored struct{}
+type UserNotRestored struct{}
+type InvalidArchive struct{}
+type IdentityAlreadyLinked struct{}
+type ArchiveNotExported struct{}
+type ArchiveNotImported struct{}
+type UserDataNotExported struct{}
+type UserNotErased struct{}
+type UserNotInRoom struct{}
 
 func (e FailJSONBind) Error() string {
 	return failJSONBind
@@ -84,3 +122,60 @@ func (e StreamNotCreated) Error() string {
 func (e OwnerCantKickHimself) Error() string {
 	return ownerCantKickHimself
 }
+func (e ServerShuttingDown) Error() string {
+	return serverShuttingDown
+}
+func (e InvalidLogLevel) Error() string {
+	return invalidLogLevel
+}
+func (e InvalidRefreshToken) Error() string {
+	return invalidRefreshToken
+}
+func (e TokenNotCreated) Error() string {
+	return tokenNotCreated
+}
+func (e HandleAlreadyTaken) Error() string {
+	return handleAlreadyTaken
+}
+func (e InvalidCredentials) Error() string {
+	return invalidCredentials
+}
+func (e IdentityNotVerified) Error() string {
+	return identityNotVerified
+}
+func (e AnonymousUsersDisabled) Error() string {
+	return anonymousUsersDisabled
+}
+func (e TooManyRequests) Error() string {
+	return tooManyRequests
+}
+func (e ResourceModified) Error() string {
+	return resourceModified
+}
+func (e RoomNotRestored) Error() string {
+	return roomNotRestored
+}
+func (e UserNotRestored) Error() string {
+	return userNotRestored
+}
+func (e InvalidArchive) Error() string {
+	return invalidArchive
+}
+func (e IdentityAlreadyLinked) Error() string {
+	return identityAlreadyLinked
+}
+func (e ArchiveNotExported) Error() string {
+	return archiveNotExported
+}
+func (e ArchiveNotImported) Error() string {
+	return archiveNotImported
+}
+func (e UserDataNotExported) Error() string {
+	return userDataNotExported
+}
+func (e UserNotErased) Error() string {
+	return userNotErased
+}
+func (e UserNotInRoom) Error() string {
+	return userNotInRoom
+}
@@ -4,11 +4,23 @@ import (
 	"log"
 
 	"github.com/Brawdunoir/dionysos-server/database"
+	"github.com/Brawdunoir/dionysos-server/tracing"
 	l "github.com/Brawdunoir/dionysos-server/utils/logger"
 	"github.com/Brawdunoir/dionysos-server/variables"
 )
 
+// InitAPI initializes everything the API needs, including the database connection.
 func InitAPI() {
+	InitEnvironment()
+
+	// DB initialization.
+	database.Init()
+	l.Logger.Debug("Database initialized.")
+}
+
+// InitEnvironment initializes everything the API needs but the database connection,
+// for the API to run with repositories kept in memory.
+func InitEnvironment() {
 	// ! Order of these calls matters.
 	// Load variables from environment.
 	variables.LoadVariables()
@@ -22,7 +34,10 @@ func InitAPI() {
 	defer l.Logger.Sync()
 	l.Logger.Debug("Logger initialized.")
 
-	// DB initialization.
-	database.Init()
-	l.Logger.Debug("Database initialized.")
+	// Tracing initialization.
+	err = tracing.Init()
+	if err != nil {
+		l.Logger.Fatal("Failed to initialize tracing: ", err)
+	}
+	l.Logger.Debug("Tracing initialized.")
 }
@@ -0,0 +1,23 @@
+package utils
+
+import (
+	"context"
+
+	c "github.com/Brawdunoir/dionysos-server/variables"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// FromContext returns the request-scoped logger placed in the context by the RequestID middleware.
+// It falls back to Logger outside of a request.
+func FromContext(ctx context.Context) *zap.SugaredLogger {
+	if logger, ok := ctx.Value(c.LOGGER_CONTEXT_KEY).(*zap.SugaredLogger); ok {
+		return logger
+	}
+	return Logger
+}
+
+// AddFields adds key-value pairs to the request-scoped logger, so that every later log of the request carries them.
+func AddFields(ctx *gin.Context, keysAndValues ...interface{}) {
+	ctx.Set(c.LOGGER_CONTEXT_KEY, FromContext(ctx).With(keysAndValues...))
+}
@@ -1,36 +1,120 @@
 package utils
 
 import (
+	"fmt"
 	"log"
 	"os"
+	"strconv"
+	"strings"
 
 	c "github.com/Brawdunoir/dionysos-server/variables"
 
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// Possible values for the LOG_OUTPUT and LOG_FORMAT variables.
+const (
+	outputStdout  = "stdout"
+	outputStderr  = "stderr"
+	outputFile    = "file"
+	formatConsole = "console"
+	formatJSON    = "json"
 )
 
 var Logger *zap.SugaredLogger
 
+// AccessLogger writes one structured JSON entry per HTTP request, whatever the level of Logger.
+var AccessLogger *zap.Logger
+
+// Level is the level of Logger. It can be changed at runtime.
+var Level zap.AtomicLevel
+
 // InitLogger initializes the Logger.
 // The Logger is then available in the utils package.
 func InitLogger() error {
 	config, defaultLogLevel := createConfig()
 	config.EncodeTime = zapcore.ISO8601TimeEncoder
+
+	Level = zap.NewAtomicLevelAt(defaultLogLevel)
+	if c.LogLevel != "" {
+		if err := Level.UnmarshalText([]byte(c.LogLevel)); err != nil {
+			return fmt.Errorf("invalid LOG_LEVEL: %w", err)
+		}
+	}
+
+	var consoleEncoder zapcore.Encoder
+	switch c.LogFormat {
+	case formatConsole:
+		consoleEncoder = zapcore.NewConsoleEncoder(config)
+	case formatJSON:
+		consoleEncoder = zapcore.NewJSONEncoder(config)
+	default:
+		return fmt.Errorf("unknown LOG_FORMAT: %s", c.LogFormat)
+	}
 	fileEncoder := zapcore.NewJSONEncoder(config)
-	consoleEncoder := zapcore.NewConsoleEncoder(config)
-	logFile, err := os.OpenFile("dionysos.logs", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		return err
+
+	accessConfig := zap.NewProductionEncoderConfig()
+	accessConfig.EncodeTime = zapcore.ISO8601TimeEncoder
+	accessEncoder := zapcore.NewJSONEncoder(accessConfig)
+
+	var cores, accessCores []zapcore.Core
+	for _, output := range strings.Split(c.LogOutput, ",") {
+		var sink zapcore.WriteSyncer
+		encoder := consoleEncoder
+
+		switch strings.TrimSpace(output) {
+		case outputStdout:
+			sink = zapcore.Lock(os.Stdout)
+		case outputStderr:
+			sink = zapcore.Lock(os.Stderr)
+		case outputFile:
+			fileSink, err := createFileSink()
+			if err != nil {
+				return err
+			}
+			sink = fileSink
+			encoder = fileEncoder
+		default:
+			return fmt.Errorf("unknown LOG_OUTPUT: %s", output)
+		}
+
+		cores = append(cores, zapcore.NewCore(encoder, sink, Level))
+		accessCores = append(accessCores, zapcore.NewCore(accessEncoder, sink, zapcore.InfoLevel))
 	}
-	core := zapcore.NewTee(
-		zapcore.NewCore(fileEncoder, zapcore.AddSync(logFile), defaultLogLevel),
-		zapcore.NewCore(consoleEncoder, zapcore.AddSync(os.Stdout), defaultLogLevel),
-	)
-	Logger = zap.New(core, zap.AddCaller()).Sugar()
+
+	Logger = zap.New(zapcore.NewTee(cores...), zap.AddCaller()).Sugar()
+	AccessLogger = zap.New(zapcore.NewTee(accessCores...))
 	return nil
 }
 
+// createFileSink opens the log file, rotated once it exceeds LOG_MAX_SIZE megabytes.
+// Rotated files are removed after LOG_MAX_AGE days.
+func createFileSink() (zapcore.WriteSyncer, error) {
+	maxSize, err := strconv.Atoi(c.LogMaxSize)
+	if err != nil {
+		return nil, fmt.Errorf("invalid LOG_MAX_SIZE: %w", err)
+	}
+	maxAge, err := strconv.Atoi(c.LogMaxAge)
+	if err != nil {
+		return nil, fmt.Errorf("invalid LOG_MAX_AGE: %w", err)
+	}
+
+	// Fail early if the file cannot be written rather than on the first log.
+	logFile, err := os.OpenFile(c.LogFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	logFile.Close()
+
+	return zapcore.AddSync(&lumberjack.Logger{
+		Filename: c.LogFile,
+		MaxSize:  maxSize,
+		MaxAge:   maxAge,
+	}), nil
+}
+
 func createConfig() (zapcore.EncoderConfig, zapcore.Level) {
 	switch c.Environment {
 	case c.ENVIRONMENT_TESTING:
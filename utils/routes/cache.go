@@ -0,0 +1,25 @@
+package utils
+
+import (
+	"strconv"
+
+	"github.com/Brawdunoir/dionysos-server/variables"
+	"github.com/gin-gonic/gin"
+)
+
+// RoomTag returns the cache tag of a room.
+func RoomTag(id uint64) string {
+	return "room:" + strconv.FormatUint(id, 10)
+}
+
+// UserTag returns the cache tag of a user.
+func UserTag(id uint64) string {
+	return "user:" + strconv.FormatUint(id, 10)
+}
+
+// TagCache adds cache tags to the request.
+// On a cached route, the tags are the entities the response contains and the response is dropped when any of them is invalidated.
+// On any other route, the tags are the entities the request changed and are invalidated if the request succeeds.
+func TagCache(c *gin.Context, tags ...string) {
+	c.Set(variables.CACHE_TAGS_CONTEXT_KEY, append(c.GetStringSlice(variables.CACHE_TAGS_CONTEXT_KEY), tags...))
+}
@@ -0,0 +1,65 @@
+package utils
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ETag returns the entity tag of a resource at the given version.
+func ETag(version uint64) string {
+	return `"` + strconv.FormatUint(version, 10) + `"`
+}
+
+// NotModified sets the ETag header of a resource at the given version and compares it to the If-None-Match header.
+// It returns true if the client already holds this version, in which case the 304 response is already set
+// and the caller only needs to return.
+func NotModified(c *gin.Context, version uint64) bool {
+	etag := ETag(version)
+	c.Header("ETag", etag)
+
+	for _, tag := range entityTags(c.GetHeader("If-None-Match")) {
+		// If-None-Match uses the weak comparison.
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+			c.AbortWithStatus(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
+
+// IfMatch returns the versions listed in the If-Match header, to be given to a conditional update.
+// It returns nil if the header is absent or matches any version.
+// Weak and malformed tags never match, as If-Match uses the strong comparison, so they are returned as version 0.
+func IfMatch(c *gin.Context) []uint64 {
+	tags := entityTags(c.GetHeader("If-Match"))
+	if len(tags) == 0 {
+		return nil
+	}
+
+	versions := make([]uint64, 0, len(tags))
+	for _, tag := range tags {
+		if tag == "*" {
+			return nil
+		}
+		version, err := strconv.ParseUint(strings.Trim(tag, `"`), 10, 64)
+		if err != nil || !strings.HasPrefix(tag, `"`) {
+			version = 0
+		}
+		versions = append(versions, version)
+	}
+	return versions
+}
+
+// entityTags splits a comma separated list of entity tags.
+func entityTags(header string) []string {
+	var tags []string
+	for _, tag := range strings.Split(header, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
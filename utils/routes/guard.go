@@ -0,0 +1,44 @@
+package utils
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/Brawdunoir/dionysos-server/auth"
+	e "github.com/Brawdunoir/dionysos-server/utils/errors"
+	l "github.com/Brawdunoir/dionysos-server/utils/logger"
+	"github.com/gin-gonic/gin"
+)
+
+// AssertNotLockedOut checks that the client may try to authenticate on the given account.
+// It returns an error if either is locked out by the guard after too many failures.
+// It also sets the JSON response so caller only needs to return if an error is returned.
+func AssertNotLockedOut(c *gin.Context, guard *auth.Guard, account string) error {
+	lockout := guard.Check(account, c.ClientIP())
+	if lockout <= 0 {
+		return nil
+	}
+
+	err := errors.New("authentication locked out after too many failures")
+	c.Error(err).SetMeta("AssertNotLockedOut.Check")
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(lockout.Seconds()))))
+	c.AbortWithError(http.StatusTooManyRequests, e.TooManyRequests{}).SetMeta("AssertNotLockedOut.Check")
+	return err
+}
+
+// RecordAuthenticationFailure tells the guard that the client failed to authenticate on the given account,
+// and writes an audit log entry if the account or the client got locked out.
+func RecordAuthenticationFailure(c *gin.Context, guard *auth.Guard, account string) {
+	accountLockout, clientLockout := guard.Fail(account, c.ClientIP())
+	if accountLockout > 0 || clientLockout > 0 {
+		l.FromContext(c).Warnw("Authentication locked out after too many failures",
+			"audit", "lockout",
+			"account", account,
+			"clientIP", c.ClientIP(),
+			"accountLockout", accountLockout.String(),
+			"clientLockout", clientLockout.String(),
+		)
+	}
+}
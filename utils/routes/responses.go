@@ -5,11 +5,15 @@ import (
 	"net/http"
 
 	e "github.com/Brawdunoir/dionysos-server/utils/errors"
+	"github.com/Brawdunoir/dionysos-server/variables"
 	"github.com/gin-gonic/gin"
 )
 
 type ErrorResponse struct {
 	Error string `json:"error"`
+
+	// RequestID is the ID of the request, to be given when reporting the error.
+	RequestID string `json:"requestID,omitempty"`
 }
 
 type CreateResponse struct {
@@ -19,6 +23,57 @@ type CreateResponse struct {
 	Password string `json:"password,omitempty"`
 }
 
+// HealthResponse is the response of the liveness and readiness endpoints.
+type HealthResponse struct {
+	Status string `json:"status" example:"ok"`
+
+	// Only set for readiness, the result of each dependency check indexed by dependency name.
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+// CheckResult is the result of a single dependency check.
+type CheckResult struct {
+	Status  string `json:"status" example:"ok"`
+	Latency string `json:"latency" example:"1.234ms"`
+
+	// Only set in verbose mode when the check failed.
+	Error string `json:"error,omitempty"`
+}
+
+// TokenResponse is the response of the token endpoints.
+type TokenResponse struct {
+	AccessToken string `json:"accessToken"`
+	TokenType   string `json:"tokenType" example:"Bearer"`
+
+	// ExpiresIn is the number of seconds the access token is valid for.
+	ExpiresIn    int64  `json:"expiresIn" example:"900"`
+	RefreshToken string `json:"refreshToken"`
+
+	// Only set when logging in with a handle, the URI of the user.
+	URI string `json:"uri,omitempty" example:"/users/1"`
+}
+
+// StreamTicketResponse is the response of the stream ticket endpoint.
+type StreamTicketResponse struct {
+	Ticket string `json:"ticket"`
+
+	// ExpiresIn is the number of seconds the ticket is valid for.
+	ExpiresIn int64 `json:"expiresIn" example:"60"`
+
+	// URI is the URI of the stream including the ticket.
+	URI string `json:"uri" example:"/rooms/1/stream?ticket=xxx"`
+}
+
+// RefreshRequest is the body of a request exchanging a refresh token for new tokens.
+type RefreshRequest struct {
+	RefreshToken string `json:"refreshToken" binding:"required"`
+}
+
+// LogLevel is the level of the logger, used both to read and change it through the admin API.
+type LogLevel struct {
+	Level string `json:"level" binding:"required" example:"debug"`
+}
+
 // AssertUser compares the ID of the authenticated user in context and the ID of the room owner.
 // It returns an error if the user is not the owner of the room.
 // It also sets the JSON response so caller only needs to return if an error is returned.
@@ -40,8 +95,10 @@ func AssertUser(c *gin.Context, expectedID uint64) error {
 	return nil
 }
 
-func CreateErrorResponse(error string) *ErrorResponse {
+// CreateErrorResponse creates an error response carrying the ID of the request.
+func CreateErrorResponse(c *gin.Context, error string) *ErrorResponse {
 	return &ErrorResponse{
-		Error: error,
+		Error:     error,
+		RequestID: c.GetString(variables.REQUEST_ID_CONTEXT_KEY),
 	}
 }
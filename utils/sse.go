@@ -1,19 +1,49 @@
 package utils
 
 import (
+	"context"
 	"errors"
+	"strconv"
+	"sync"
 
+	"github.com/Brawdunoir/dionysos-server/metrics"
+	"github.com/Brawdunoir/dionysos-server/tracing"
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// ErrStreamClosed is returned when subscribing to or creating a stream after it has been closed.
+var ErrStreamClosed = errors.New("stream is closed")
+
+// clientBufferSize is the number of messages a client can lag behind before new messages are dropped for it.
+const clientBufferSize = 16
+
+// Streams keeps track of all SSE streams currently on service, indexed by room ID.
+// It is safe for concurrent use.
+type Streams struct {
+	mu      sync.RWMutex
+	streams map[uint64]*Stream
+	closed  bool
+}
+
 // Stream got a list of connected users and a channel per user to broadcast events.
 type Stream struct {
+	mu sync.RWMutex
+
+	// ID is the ID of the room the stream belongs to.
+	ID uint64
+
 	// Users is a map of users subscribed to the stream.
 	// The key is the user ID and the value is a boolean indicating if the user is subscribed or not.
 	Users map[uint64]bool
 
 	// ClientChan is a map of channels to send messages to clients.
 	ClientChan ClientChan
+
+	// closed is set once the stream has been closed, it then refuses new subscribers.
+	closed bool
 }
 
 // Message represents a SSE type message.
@@ -22,15 +52,32 @@ type Message struct {
 	Event string
 	// Data is the data to send.
 	Data any
+	// Retry is the reconnection time in milliseconds sent to the client, omitted if zero.
+	Retry uint
+	// Trace carries the trace context of the request that published the message.
+	Trace propagation.MapCarrier
 }
 
 // New event messages are broadcast to all registered client connection channels.
 type MessageChan chan Message
 type ClientChan map[uint64]MessageChan
 
+// NewStreams returns an empty list of streams.
+func NewStreams() *Streams {
+	return &Streams{streams: make(map[uint64]*Stream)}
+}
+
 // CreateStream creates a new stream and adds it to the list.
-func CreateStream(ID uint64, list map[uint64]*Stream) error {
-	list[ID] = &Stream{
+func (l *Streams) CreateStream(ID uint64) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		return ErrStreamClosed
+	}
+
+	l.streams[ID] = &Stream{
+		ID:         ID,
 		Users:      make(map[uint64]bool),
 		ClientChan: make(ClientChan),
 	}
@@ -38,49 +85,160 @@ func CreateStream(ID uint64, list map[uint64]*Stream) error {
 }
 
 // GetStream returns an existing stream or error if it does not exist.
-func GetStream(ID uint64, list map[uint64]*Stream) (*Stream, error) {
-	stream, ok := list[ID]
+func (l *Streams) GetStream(ID uint64) (*Stream, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	stream, ok := l.streams[ID]
 	if !ok {
 		return nil, errors.New("stream does not exist")
 	}
 	return stream, nil
 }
 
-func (s *Stream) Distribute(m Message) {
+// Ping returns an error if the list has been closed and does not accept new streams anymore.
+func (l *Streams) Ping() error {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if l.closed {
+		return ErrStreamClosed
+	}
+	return nil
+}
+
+// Close sends a last message to every subscriber of every stream, then closes them.
+// No stream can be created once the list has been closed.
+func (l *Streams) Close(m Message) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, stream := range l.streams {
+		stream.Close(m)
+	}
+	l.closed = true
+}
+
+// DeleteStream sends a last message to every subscriber of a stream, closes it and removes it from the list.
+// It is a no-op if the stream does not exist.
+func (l *Streams) DeleteStream(ID uint64, m Message) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	stream, ok := l.streams[ID]
+	if !ok {
+		return
+	}
+	stream.Close(m)
+	delete(l.streams, ID)
+}
+
+// Distribute sends a message to all subscribed clients.
+// A client lagging too far behind misses the message instead of blocking the others.
+// The trace context of ctx is attached to the message so its delivery can be correlated with the request that caused it.
+func (s *Stream) Distribute(ctx context.Context, m Message) {
+	ctx, span := tracing.Start(ctx, "Stream.Distribute", trace.WithAttributes(
+		attribute.String("event", m.Event),
+		attribute.String("room.id", strconv.FormatUint(s.ID, 10)),
+	))
+	defer span.End()
+	m.Trace = tracing.Inject(ctx)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
 	for clientID, clientChan := range s.ClientChan {
 		if s.Users[clientID] {
-			clientChan <- m
+			select {
+			case clientChan <- m:
+				metrics.EventsDistributed.WithLabelValues(m.Event).Inc()
+			default:
+				metrics.EventsDropped.WithLabelValues(m.Event).Inc()
+			}
 		}
 	}
 }
 
-// AddSub adds an ID to a stream if not already sub.
-func (s *Stream) AddSub(id uint64) error {
+// AddSub subscribes an ID to a stream and returns the channel to listen to.
+// If the ID is already subscribed, e.g. a client reconnecting before its previous
+// connection has been noticed as gone, the previous subscription is closed and replaced.
+func (s *Stream) AddSub(id uint64) (MessageChan, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil, ErrStreamClosed
+	}
 	if s.Users[id] {
-		return errors.New("user already subscribed to stream")
+		close(s.ClientChan[id])
 	}
 
-	s.ClientChan[id] = make(MessageChan)
+	s.ClientChan[id] = make(MessageChan, clientBufferSize)
 	s.Users[id] = true
+	s.updateSubscribersMetric()
 
-	return nil
+	return s.ClientChan[id], nil
 }
 
-// DelSub removes an ID from a stream.
-func (s *Stream) DelSub(id uint64) error {
+// DelSub removes an ID from a stream, given the channel returned by AddSub.
+// It is a no-op if the subscription has already been replaced or the stream closed.
+func (s *Stream) DelSub(id uint64, ch MessageChan) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	bool, ok := s.Users[id]
 	if !ok {
 		return errors.New("user has not subscribed to stream")
-	} else if !bool {
-		return errors.New("user has already been unsubscribed to stream")
+	} else if !bool || s.ClientChan[id] != ch {
+		return nil
 	}
 
-	close(s.ClientChan[id])
+	close(ch)
 	s.Users[id] = false
+	s.updateSubscribersMetric()
 
 	return nil
 }
 
+// Close sends a last message to all subscribers and closes their channel.
+func (s *Stream) Close(m Message) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for clientID, clientChan := range s.ClientChan {
+		if s.Users[clientID] {
+			select {
+			case clientChan <- m:
+				metrics.EventsDistributed.WithLabelValues(m.Event).Inc()
+			default:
+				metrics.EventsDropped.WithLabelValues(m.Event).Inc()
+			}
+			close(clientChan)
+			s.Users[clientID] = false
+		}
+	}
+	s.closed = true
+	s.updateSubscribersMetric()
+}
+
+// updateSubscribersMetric reports the number of subscribers of the stream, the caller must hold the lock.
+// The metric is removed once nobody is subscribed anymore so that gone rooms do not linger.
+func (s *Stream) updateSubscribersMetric() {
+	count := 0
+	for _, subscribed := range s.Users {
+		if subscribed {
+			count++
+		}
+	}
+
+	room := strconv.FormatUint(s.ID, 10)
+	if count == 0 {
+		metrics.SSESubscribers.DeleteLabelValues(room)
+	} else {
+		metrics.SSESubscribers.WithLabelValues(room).Set(float64(count))
+	}
+}
+
 // HeaderSSE sets the regular headers for SSE at gin level.
 func HeadersSSE(c *gin.Context) {
 	c.Header("Content-Type", "text/event-stream")
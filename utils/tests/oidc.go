@@ -0,0 +1,200 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+
+	utilsRoutes "github.com/Brawdunoir/dionysos-server/utils/routes"
+	"github.com/gin-gonic/gin"
+	"github.com/goccy/go-json"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// Credentials of the API as a client of the MockOIDCProvider.
+const (
+	MockOIDCClientID     = "dionysos"
+	MockOIDCClientSecret = "dionysos-secret"
+	mockOIDCKeyID        = "mock"
+)
+
+// MockOIDCProvider is a minimal OpenID Connect provider for tests, logging users in without asking anything.
+type MockOIDCProvider struct {
+	*httptest.Server
+
+	key   *rsa.PrivateKey
+	mu    sync.Mutex
+	codes map[string]mockOIDCCode
+}
+
+// mockOIDCCode is what an authorization code stands for.
+type mockOIDCCode struct {
+	subject   string
+	name      string
+	nonce     string
+	challenge string
+}
+
+// NewMockOIDCProvider starts a MockOIDCProvider. It must be closed once the tests are over.
+func NewMockOIDCProvider() (*MockOIDCProvider, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	p := &MockOIDCProvider{key: key, codes: make(map[string]mockOIDCCode)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", p.discovery)
+	mux.HandleFunc("/keys", p.keys)
+	mux.HandleFunc("/token", p.token)
+	p.Server = httptest.NewServer(mux)
+
+	return p, nil
+}
+
+// Authorize logs in the user with the given subject and name at the given authorization URL, as a browser would.
+// It returns the target of the callback the user is redirected to.
+func (p *MockOIDCProvider) Authorize(authURL, subject, name string) (string, error) {
+	u, err := url.Parse(authURL)
+	if err != nil {
+		return "", err
+	}
+	query := u.Query()
+	if query.Get("client_id") != MockOIDCClientID || query.Get("code_challenge_method") != "S256" {
+		return "", errors.New("invalid authorization request")
+	}
+
+	code := base64.RawURLEncoding.EncodeToString([]byte(subject + time.Now().String()))
+	p.mu.Lock()
+	p.codes[code] = mockOIDCCode{subject: subject, name: name, nonce: query.Get("nonce"), challenge: query.Get("code_challenge")}
+	p.mu.Unlock()
+
+	redirectURL, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil {
+		return "", err
+	}
+	return redirectURL.Path + "?" + url.Values{"code": {code}, "state": {query.Get("state")}}.Encode(), nil
+}
+
+func (p *MockOIDCProvider) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, gin.H{
+		"issuer":                                p.URL,
+		"authorization_endpoint":                p.URL + "/authorize",
+		"token_endpoint":                        p.URL + "/token",
+		"jwks_uri":                              p.URL + "/keys",
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+	})
+}
+
+func (p *MockOIDCProvider) keys(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, gin.H{"keys": []gin.H{{
+		"kty": "RSA",
+		"alg": "RS256",
+		"use": "sig",
+		"kid": mockOIDCKeyID,
+		"n":   base64.RawURLEncoding.EncodeToString(p.key.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(p.key.E)).Bytes()),
+	}}})
+}
+
+// token exchanges a code, usable only once, for an ID token.
+func (p *MockOIDCProvider) token(w http.ResponseWriter, r *http.Request) {
+	clientID, clientSecret, ok := r.BasicAuth()
+	if !ok {
+		clientID, clientSecret = r.PostFormValue("client_id"), r.PostFormValue("client_secret")
+	}
+	if clientID != MockOIDCClientID || clientSecret != MockOIDCClientSecret {
+		writeJSON(w, http.StatusUnauthorized, gin.H{"error": "invalid_client"})
+		return
+	}
+
+	p.mu.Lock()
+	code, ok := p.codes[r.PostFormValue("code")]
+	delete(p.codes, r.PostFormValue("code"))
+	p.mu.Unlock()
+
+	challenge := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+	if !ok || code.challenge != base64.RawURLEncoding.EncodeToString(challenge[:]) {
+		writeJSON(w, http.StatusBadRequest, gin.H{"error": "invalid_grant"})
+		return
+	}
+
+	now := time.Now()
+	idToken := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":                p.URL,
+		"sub":                code.subject,
+		"aud":                MockOIDCClientID,
+		"iat":                now.Unix(),
+		"exp":                now.Add(time.Minute).Unix(),
+		"nonce":              code.nonce,
+		"preferred_username": code.name,
+	})
+	idToken.Header["kid"] = mockOIDCKeyID
+	signed, err := idToken.SignedString(p.key)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, gin.H{"error": "server_error"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, gin.H{
+		"access_token": "mock",
+		"token_type":   "Bearer",
+		"expires_in":   60,
+		"id_token":     signed,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	//nolint:errcheck
+	json.NewEncoder(w).Encode(body)
+}
+
+// StartTestOIDCLogin starts logging in with OIDC and lets the user with the given subject and name log in with the provider.
+// It returns the target of the callback along with the headers carrying the login cookie.
+func StartTestOIDCLogin(provider *MockOIDCProvider, subject, name string) (string, []Header, error) {
+	res, err := executeRequest(http.MethodGet, "/oidc/login", "", nil)
+	if err != nil {
+		return "", nil, err
+	}
+	if res.Code != http.StatusFound {
+		return "", nil, errors.New("login not redirected to the provider")
+	}
+
+	target, err := provider.Authorize(res.Header().Get("Location"), subject, name)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var headers []Header
+	for _, cookie := range (&http.Response{Header: res.Header()}).Cookies() {
+		headers = append(headers, Header{Key: "Cookie", Value: cookie.Name + "=" + cookie.Value})
+	}
+	return target, headers, nil
+}
+
+// LoginTestOIDC logs in with OIDC as the user with the given subject and name.
+func LoginTestOIDC(provider *MockOIDCProvider, subject, name string) (utilsRoutes.TokenResponse, error) {
+	var t utilsRoutes.TokenResponse
+
+	target, headers, err := StartTestOIDCLogin(provider, subject, name)
+	if err != nil {
+		return t, err
+	}
+	res, err := executeRequest(http.MethodGet, target, "", headers)
+	if err != nil {
+		return t, err
+	}
+
+	err = json.Unmarshal(res.Body.Bytes(), &t)
+	return t, err
+}
@@ -0,0 +1,69 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"time"
+
+	"github.com/Brawdunoir/dionysos-server/variables"
+)
+
+// streamTimeout is how long to wait for a stream to be subscribed to, or closed by the server.
+const streamTimeout = time.Second
+
+// streamRecorder records the response of a stream, gin expecting the writer to notify it when the client is gone.
+type streamRecorder struct {
+	*httptest.ResponseRecorder
+}
+
+// CloseNotify never notifies, the client only going away once the server closed the stream.
+func (r streamRecorder) CloseNotify() <-chan bool {
+	return nil
+}
+
+// SubscribeTestStream subscribes to the stream of the room with the given ID and waits for the subscription to be registered.
+// The returned function waits for the server to close the stream and returns the events received.
+func SubscribeTestStream(roomID string, headers []Header) (func() (string, error), error) {
+	req, err := newRequest(http.MethodGet, "/rooms/"+roomID+"/stream", "", headers)
+	if err != nil {
+		return nil, err
+	}
+
+	w := streamRecorder{httptest.NewRecorder()}
+	done := make(chan struct{})
+	go func() {
+		router.ServeHTTP(w, req)
+		close(done)
+	}()
+
+	wait := func() (string, error) {
+		select {
+		case <-done:
+			return w.Body.String(), nil
+		case <-time.After(streamTimeout):
+			return "", errors.New("stream not closed")
+		}
+	}
+
+	// The subscription is registered once it is counted in the metrics.
+	subscribed := regexp.MustCompile(`dionysos_sse_subscribers{room="` + roomID + `"} [1-9]`)
+	for start := time.Now(); time.Since(start) < streamTimeout; time.Sleep(10 * time.Millisecond) {
+		select {
+		case <-done:
+			return nil, fmt.Errorf("stream ended with code %d: %s", w.Code, w.Body.String())
+		default:
+		}
+
+		res, err := executeRequest(http.MethodGet, "/metrics", "", []Header{{Key: "X-Admin-Token", Value: variables.AdminToken}})
+		if err != nil {
+			return nil, err
+		}
+		if subscribed.Match(res.Body.Bytes()) {
+			return wait, nil
+		}
+	}
+	return nil, errors.New("stream not subscribed")
+}
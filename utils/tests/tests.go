@@ -6,10 +6,13 @@ import (
 	"encoding/base64"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"path"
 	"testing"
 
+	"github.com/Brawdunoir/dionysos-server/database"
 	"github.com/Brawdunoir/dionysos-server/models"
+	"github.com/Brawdunoir/dionysos-server/repositories"
 	"github.com/Brawdunoir/dionysos-server/routes"
 	"github.com/Brawdunoir/dionysos-server/utils"
 	utilsRoutes "github.com/Brawdunoir/dionysos-server/utils/routes"
@@ -19,6 +22,12 @@ import (
 
 var router *gin.Engine
 
+// Storage holds the repositories the router of the tests uses.
+var Storage repositories.Repositories
+
+// memoryStore holds the rooms and users of the tests, unless they run against the database.
+var memoryStore *repositories.MemoryStore
+
 // ITest interface to run tests.
 type ITest interface {
 	Run(t *testing.T)
@@ -48,12 +57,16 @@ type Request struct {
 	Method string
 	// Target is appended to the Test Target URL.
 	Target string
+	// Absolute is set if Target is the full URL, rather than appended to the URL of the object created by TestRUD.
+	Absolute bool
 	// Body is the body of the request.
 	Body string
 	// Headers is a list of headers to send with the request.
 	// If not nil, they take precedence over the Test headers.
 	// If nil, the Test headers are used instead.
 	Headers []Header
+	// ExtraHeaders is a list of headers to send in addition to the headers above.
+	ExtraHeaders []Header
 }
 
 // Header symbolizes a header to be sent with a request.
@@ -84,6 +97,74 @@ func CreateTestUser(user models.User) (string, []Header, error) {
 	return id, GetBasicAuthHeader(id, c.Password), nil
 }
 
+// CreateTestRoom creates a new room for tests, owned by the user of the given headers, and returns its ID.
+func CreateTestRoom(room models.Room, headers []Header) (string, error) {
+	var c utilsRoutes.CreateResponse
+
+	body, err := json.Marshal(room)
+	if err != nil {
+		return "", err
+	}
+	res, err := executeRequest(http.MethodPost, "/rooms", string(body), headers)
+	if err != nil {
+		return "", err
+	}
+
+	err = json.Unmarshal(res.Body.Bytes(), &c)
+	return path.Base(c.URI), err
+}
+
+// CreateTestStreamTicket gets a ticket for the stream of the room with the given ID.
+func CreateTestStreamTicket(roomID string, headers []Header) (utilsRoutes.StreamTicketResponse, error) {
+	var t utilsRoutes.StreamTicketResponse
+
+	res, err := executeRequest(http.MethodPost, "/rooms/"+roomID+"/stream/ticket", "", headers)
+	if err != nil {
+		return t, err
+	}
+
+	err = json.Unmarshal(res.Body.Bytes(), &t)
+	return t, err
+}
+
+// CreateTestTokens exchanges the credentials in the given headers for tokens.
+func CreateTestTokens(headers []Header) (utilsRoutes.TokenResponse, error) {
+	var t utilsRoutes.TokenResponse
+
+	res, err := executeRequest(http.MethodPost, "/token", "", headers)
+	if err != nil {
+		return t, err
+	}
+
+	err = json.Unmarshal(res.Body.Bytes(), &t)
+	return t, err
+}
+
+// SendTestRequest sends a request to the router of the tests, with an empty body, and returns the response code.
+// Unlike the tests, it can be called concurrently.
+func SendTestRequest(method, target string, headers []Header) (int, error) {
+	res, err := executeRequest(method, target, "", headers)
+	if err != nil {
+		return 0, err
+	}
+	return res.Code, nil
+}
+
+// ExecuteTestRequest sends a request to the router of the tests and returns the response code and body.
+func ExecuteTestRequest(method, target, body string, headers []Header) (int, []byte, error) {
+	res, err := executeRequest(method, target, body, headers)
+	if err != nil {
+		return 0, nil, err
+	}
+	return res.Code, res.Body.Bytes(), nil
+}
+
+// GetBearerAuthHeader returns the Authorization header for a given access token.
+func GetBearerAuthHeader(token string) []Header {
+	return []Header{
+		{Key: "Authorization", Value: "Bearer " + token}}
+}
+
 // GetBasicAuthHeader returns the Authorization header for a given id and password.
 func GetBasicAuthHeader(id, password string) []Header {
 	authHeader := base64.StdEncoding.EncodeToString([]byte(id + ":" + password))
@@ -92,20 +173,38 @@ func GetBasicAuthHeader(id, password string) []Header {
 		{Key: "Authorization", Value: "Basic " + authHeader}}
 }
 
-// disableLogs to remove logs from default logger during tests.
+// SetupTestEnvironment sets up the router of the tests. Rooms and users are kept in memory,
+// unless TEST_DATABASE is set to true to run the tests against the database configured by the environment.
 func SetupTestEnvironment() {
-	utils.InitAPI()
-	router = routes.SetupRouter(gin.New())
+	if os.Getenv("TEST_DATABASE") == "true" {
+		utils.InitAPI()
+		Storage = repositories.NewGorm(database.GetDB())
+	} else {
+		utils.InitEnvironment()
+		memoryStore = repositories.NewMemoryStore()
+		Storage = memoryStore.Repositories()
+	}
+	router = routes.SetupRouter(gin.New(), Storage)
+}
+
+// UsesDatabase reports whether the tests run against the database, rather than in memory.
+func UsesDatabase() bool {
+	return memoryStore == nil
+}
+
+// ResetTestStorage deletes all rooms and users, as a fresh database would be.
+func ResetTestStorage() error {
+	if memoryStore != nil {
+		memoryStore.Reset()
+		return nil
+	}
+	return database.MigrateDB(database.GetDB(), true)
 }
 
 // executeTest executes a single request and returns the response.
 func executeRequest(method, url, body string, headers []Header) (w *httptest.ResponseRecorder, err error) {
 	w = httptest.NewRecorder()
-	req, err := http.NewRequest(method, url, bytes.NewBufferString(body))
-	for _, header := range headers {
-		req.Header.Set(header.Key, header.Value)
-	}
-
+	req, err := newRequest(method, url, body, headers)
 	if err != nil {
 		return nil, err
 	}
@@ -113,3 +212,17 @@ func executeRequest(method, url, body string, headers []Header) (w *httptest.Res
 	router.ServeHTTP(w, req)
 	return
 }
+
+// newRequest returns a request as received by the router.
+func newRequest(method, url, body string, headers []Header) (*http.Request, error) {
+	req, err := http.NewRequest(method, url, bytes.NewBufferString(body))
+	if err != nil {
+		return nil, err
+	}
+	// Set by the server for incoming requests, the cache is keyed by it.
+	req.RequestURI = url
+	for _, header := range headers {
+		req.Header.Set(header.Key, header.Value)
+	}
+	return req, nil
+}
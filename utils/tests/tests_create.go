@@ -39,6 +39,7 @@ func (test TestCreate) Run(t *testing.T) {
 		} else {
 			headers = test.Headers
 		}
+		headers = append(headers[:len(headers):len(headers)], subtest.Request.ExtraHeaders...)
 
 		t.Run(subtest.Name, func(t *testing.T) {
 			w, err := executeRequest(subtest.Request.Method, url, subtest.Request.Body, headers)
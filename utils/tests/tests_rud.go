@@ -40,6 +40,9 @@ func (test TestRUD) Run(t *testing.T) {
 		var headers []Header
 		t.Run(subtest.Name, func(t *testing.T) {
 			url := uri + subtest.Request.Target
+			if subtest.Request.Absolute {
+				url = subtest.Request.Target
+			}
 
 			if subtest.Request.Headers != nil {
 				headers = subtest.Request.Headers
@@ -49,6 +52,7 @@ func (test TestRUD) Run(t *testing.T) {
 					t.Error(err)
 				}
 			}
+			headers = append(headers[:len(headers):len(headers)], subtest.Request.ExtraHeaders...)
 			w, err := executeRequest(subtest.Request.Method, url, subtest.Request.Body, headers)
 			if err != nil {
 				t.Error(err)
@@ -7,5 +7,14 @@ const (
 	ENVIRONMENT_TESTING     = "TEST"
 )
 
+const (
+	// Represents the possible values for the DATABASE_DRIVER variable.
+	DATABASE_DRIVER_POSTGRES = "postgres"
+	DATABASE_DRIVER_SQLITE   = "sqlite"
+)
+
 const USER_CONTEXT_KEY = "requestAuthor"
 const ROOM_CONTEXT_KEY = "roomInRequest"
+const REQUEST_ID_CONTEXT_KEY = "requestID"
+const LOGGER_CONTEXT_KEY = "requestLogger"
+const CACHE_TAGS_CONTEXT_KEY = "cacheTags"
@@ -15,15 +15,154 @@ type Variable struct {
 // Environment is the environment of the API. e.g. PROD, DEV, TEST. See const.go for the possible values.
 var Environment string
 
+// Host is the address the API and metrics servers listen on. e.g. 127.0.0.1. The API listens on all interfaces if empty.
+var Host string
+
 // Port is the port of the API.
 var Port string
 
+// MetricsPort is the port serving Prometheus metrics. If empty, metrics are served by the API under /metrics
+// to requests carrying the admin token, and not at all without one.
+var MetricsPort string
+
+// TracingEndpoint is the OTLP/HTTP endpoint spans are exported to. e.g. otel-collector:4318. Tracing is disabled if empty.
+var TracingEndpoint string
+
+// TracingInsecure disables TLS when exporting spans if set to "true".
+var TracingInsecure string
+
+// TracingSampleRatio is the ratio of traces sampled, between 0 and 1. e.g. 0.1 samples 10% of the traces.
+var TracingSampleRatio string
+
 // BasePath is the base path of the API. e.g. http://localhost:8080/api/v1 if set to /api/v1.
 var BasePath string
 
+// ShutdownTimeout is the maximum duration given to in-flight requests to complete when the server shuts down. e.g. 15s.
+var ShutdownTimeout string
+
+// ShutdownDelay is the duration during which the server keeps accepting requests while reporting itself as not ready
+// when shutting down, leaving time to load balancers to stop routing traffic to it. e.g. 5s.
+var ShutdownDelay string
+
+// ReconnectDelay is the delay SSE clients are asked to wait before reconnecting when the server shuts down. e.g. 5s.
+var ReconnectDelay string
+
+// LogLevel is the minimum level of the logs, e.g. debug, info, warn, error. If empty, it depends on the environment.
+// It can be changed at runtime through the admin API.
+var LogLevel string
+
+// LogFormat is the format of the logs written to stdout and stderr, either console or json. Logs in file are always in JSON.
+var LogFormat string
+
+// LogOutput is a comma-separated list of the outputs logs are written to, among stdout, stderr and file.
+var LogOutput string
+
+// LogFile is the path of the log file, used if LogOutput contains file.
+var LogFile string
+
+// LogMaxSize is the size in megabytes from which the log file is rotated.
+var LogMaxSize string
+
+// LogMaxAge is the number of days rotated log files are kept.
+var LogMaxAge string
+
+// PasswordCacheTTL is the duration a successful password verification is remembered, sparing the KDF cost
+// to clients sending the same credentials again. e.g. 5m. Verifications are not cached if set to 0.
+var PasswordCacheTTL string
+
+// TokenSigningKeys is a comma-separated list of the keys signing access tokens, written as kid:secret with secrets of
+// at least 32 bytes. Tokens are signed with the first key and verified with all of them, so that keys can be rotated.
+// If empty, a random key is generated and tokens are invalidated whenever the server restarts.
+var TokenSigningKeys string
+
+// AccessTokenTTL is the duration an access token is valid for. e.g. 15m.
+var AccessTokenTTL string
+
+// RefreshTokenTTL is the duration a refresh token is valid for. e.g. 720h.
+var RefreshTokenTTL string
+
+// RestorePeriod is the duration a deleted room or user can be restored for. e.g. 24h.
+var RestorePeriod string
+
+// DeletedRetention is the duration deleted rooms and users are kept for before being purged, at least RestorePeriod. e.g. 720h.
+var DeletedRetention string
+
+// PurgeInterval is the interval between two purges of the deleted rooms and users. e.g. 1h.
+var PurgeInterval string
+
+// AuthMaxFailures is the number of failed password verifications in a row after which a user is locked out. e.g. 5.
+var AuthMaxFailures string
+
+// AuthMaxFailuresPerIP is the number of failed password verifications in a row after which a client IP address
+// is locked out, whatever the users it tried to authenticate as. e.g. 20.
+var AuthMaxFailuresPerIP string
+
+// AuthLockout is the duration of the first lockout. Each new lockout lasts twice as long as the previous one. e.g. 1m.
+var AuthLockout string
+
+// AuthMaxLockout is the maximum duration of a lockout. Failures are forgotten after that long without any. e.g. 1h.
+var AuthMaxLockout string
+
+// StreamTicketTTL is the duration a stream ticket, authenticating on the stream of a room, is valid for. e.g. 1m.
+var StreamTicketTTL string
+
+// AnonymousUsers lets anyone create a user without logging in through OIDC if set to "true".
+// Set it to "false" so that only users of the OIDC provider can use the API.
+var AnonymousUsers string
+
+// OIDCIssuer is the URL of the OpenID Connect provider users can log in with, e.g. https://sso.example.com/realms/dionysos.
+// Logging in with OIDC is disabled if empty.
+var OIDCIssuer string
+
+// OIDCClientID is the ID of the API as a client of the OpenID Connect provider.
+var OIDCClientID string
+
+// OIDCClientSecret is the secret of the API as a client of the OpenID Connect provider.
+var OIDCClientSecret string
+
+// OIDCRedirectURL is the URL the OpenID Connect provider redirects users to once they logged in,
+// i.e. the URL of the /oidc/callback endpoint as seen by the users. e.g. https://api.example.com/oidc/callback.
+var OIDCRedirectURL string
+
+// OIDCScopes is a space-separated list of the scopes requested in addition to openid. e.g. profile email.
+var OIDCScopes string
+
+// TrustedProxies is a comma-separated list of the IP addresses or CIDR ranges of the reverse proxies in front of the API,
+// whose X-Forwarded-For header is trusted to find the IP address of clients. e.g. 10.0.0.0/8. No proxy is trusted if empty.
+var TrustedProxies string
+
+// RateLimitCreateUser limits the users created per client IP address, written as limit/period. e.g. 20/1h.
+// Rate limits are disabled if empty.
+var RateLimitCreateUser string
+
+// RateLimitPublic limits the requests per client IP address on the other routes not requiring authentication,
+// such as logging in. e.g. 60/1m.
+var RateLimitPublic string
+
+// RateLimitAuthenticated limits the requests per user on the routes requiring authentication. e.g. 600/1m.
+var RateLimitAuthenticated string
+
+// RateLimitMembership limits, on top of RateLimitAuthenticated, the connections to, disconnections and kicks from rooms
+// per user, since each of them is broadcast to the whole room. e.g. 30/1m.
+var RateLimitMembership string
+
+// AdminToken is the token to send in the X-Admin-Token header to access the admin API. The admin API is disabled if empty.
+var AdminToken string
+
+// DebugIdentity enables, if set to "true", the X-Debug-User header authenticating requests as the user with the given ID
+// without any credentials. It is meant for local development only: the server refuses to start with it in production
+// or when Host is not a loopback address.
+var DebugIdentity string
+
 // RedisHost is the host of the Redis server.
 var RedisHost string
 
+// DatabaseDriver is the database storing rooms and users. See const.go for the possible values.
+var DatabaseDriver string
+
+// SQLitePath is the file of the SQLite database, created if missing. e.g. /data/dionysos.db.
+var SQLitePath string
+
 // PostgresHost is the host of the Postgres server.
 var PostgresHost string
 
@@ -42,14 +181,55 @@ var PostgresDB string
 // All the possible variables within environment.
 var env = []Variable{
 	{"ENVIRONMENT", &Environment, ENVIRONMENT_PRODUCTION, false},
+	{"HOST", &Host, "", false},
 	{"PORT", &Port, "8080", false},
+	{"METRICS_PORT", &MetricsPort, "", false},
+	{"TRACING_ENDPOINT", &TracingEndpoint, "", false},
+	{"TRACING_INSECURE", &TracingInsecure, "false", false},
+	{"TRACING_SAMPLE_RATIO", &TracingSampleRatio, "1", false},
 	{"BASE_PATH", &BasePath, "", false},
+	{"SHUTDOWN_TIMEOUT", &ShutdownTimeout, "15s", false},
+	{"SHUTDOWN_DELAY", &ShutdownDelay, "0s", false},
+	{"RECONNECT_DELAY", &ReconnectDelay, "5s", false},
+	{"LOG_LEVEL", &LogLevel, "", false},
+	{"LOG_FORMAT", &LogFormat, "console", false},
+	{"LOG_OUTPUT", &LogOutput, "stdout,file", false},
+	{"LOG_FILE", &LogFile, "dionysos.logs", false},
+	{"LOG_MAX_SIZE", &LogMaxSize, "100", false},
+	{"LOG_MAX_AGE", &LogMaxAge, "28", false},
+	{"PASSWORD_CACHE_TTL", &PasswordCacheTTL, "5m", false},
+	{"TOKEN_SIGNING_KEYS", &TokenSigningKeys, "", false},
+	{"ACCESS_TOKEN_TTL", &AccessTokenTTL, "15m", false},
+	{"REFRESH_TOKEN_TTL", &RefreshTokenTTL, "720h", false},
+	{"RESTORE_PERIOD", &RestorePeriod, "24h", false},
+	{"DELETED_RETENTION", &DeletedRetention, "720h", false},
+	{"PURGE_INTERVAL", &PurgeInterval, "1h", false},
+	{"AUTH_MAX_FAILURES", &AuthMaxFailures, "5", false},
+	{"AUTH_MAX_FAILURES_PER_IP", &AuthMaxFailuresPerIP, "20", false},
+	{"AUTH_LOCKOUT", &AuthLockout, "1m", false},
+	{"AUTH_MAX_LOCKOUT", &AuthMaxLockout, "1h", false},
+	{"STREAM_TICKET_TTL", &StreamTicketTTL, "1m", false},
+	{"ANONYMOUS_USERS", &AnonymousUsers, "true", false},
+	{"OIDC_ISSUER", &OIDCIssuer, "", false},
+	{"OIDC_CLIENT_ID", &OIDCClientID, "", false},
+	{"OIDC_CLIENT_SECRET", &OIDCClientSecret, "", false},
+	{"OIDC_REDIRECT_URL", &OIDCRedirectURL, "", false},
+	{"OIDC_SCOPES", &OIDCScopes, "profile", false},
+	{"TRUSTED_PROXIES", &TrustedProxies, "", false},
+	{"RATE_LIMIT_CREATE_USER", &RateLimitCreateUser, "20/1h", false},
+	{"RATE_LIMIT_PUBLIC", &RateLimitPublic, "60/1m", false},
+	{"RATE_LIMIT_AUTHENTICATED", &RateLimitAuthenticated, "600/1m", false},
+	{"RATE_LIMIT_MEMBERSHIP", &RateLimitMembership, "30/1m", false},
+	{"ADMIN_TOKEN", &AdminToken, "", false},
+	{"DEBUG_IDENTITY", &DebugIdentity, "false", false},
 	{"REDIS_HOST", &RedisHost, "", false},
-	{"POSTGRES_HOST", &PostgresHost, "", true},
-	{"POSTGRES_PORT", &PostgresPort, "", true},
-	{"POSTGRES_USER", &PostgresUser, "", true},
-	{"POSTGRES_PASSWORD", &PostgresPassword, "", true},
-	{"POSTGRES_DB", &PostgresDB, "", true},
+	{"DATABASE_DRIVER", &DatabaseDriver, DATABASE_DRIVER_POSTGRES, false},
+	{"SQLITE_PATH", &SQLitePath, "dionysos.db", false},
+	{"POSTGRES_HOST", &PostgresHost, "", false},
+	{"POSTGRES_PORT", &PostgresPort, "", false},
+	{"POSTGRES_USER", &PostgresUser, "", false},
+	{"POSTGRES_PASSWORD", &PostgresPassword, "", false},
+	{"POSTGRES_DB", &PostgresDB, "", false},
 }
 
 // LoadVariables loads the environment variables and set the default values if not found.